@@ -1,294 +1,1412 @@
+//go:build ignore
+
 // gpt-partitions-complete.go
 // Reads a GPT header and partition entry array from a block device, disk image,
 // or a 16896-byte file that contains the GPT header + partition array.
 // Prints header fields, recalculated CRCs, and detailed partition entry info
-// with an extensive built-in map of known partition type GUIDs.
+// with an extensive built-in map of known partition type GUIDs. For a
+// partition holding an ext filesystem it adds when the filesystem was created,
+// last mounted and last written, as its superblock records, for triage.
+//
+// -json prints the same information as a versioned document whose layout is
+// published in the report package (Go structs + JSON Schema).
+//
+// -parted prints the colon-separated records of "parted -ms <disk> unit U
+// print" (U from -unit) so scripts written against parted can parse it.
+//
+// -partx prints the columns of "partx --show" (choose them with -columns)
+// for scripts that wrap partx.
+//
+// -output export prints blkid -o export style KEY=value blocks, one per
+// partition, safe to eval from a shell.
+//
+// -porcelain prints a stable, versioned "key=value" listing meant to be
+// diffed by test suites; -mask replaces run-dependent values (GUIDs, CRCs,
+// the source path) with fixed placeholders.
+//
+// -tree prints the partitions together with the containers and filesystems
+// detected inside them instead of the raw field dump.
+//
+// The GPT does not have to start at byte 0: -offset or -preset shift every read
+// so the table of a member device behind mdraid/bcache metadata can be inspected.
 package main
 
 import (
     "bytes"
     "encoding/binary"
     "encoding/hex"
+    "encoding/json"
+    "errors"
     "flag"
     "fmt"
-    "hash/crc32"
+    "io"
     "log"
     "os"
     "path/filepath"
+    "slices"
+    "strconv"
     "strings"
-    "unicode/utf16"
+    "time"
+
+    "github.com/cpuuntery/go-code-and-bin/device"
+    "github.com/cpuuntery/go-code-and-bin/fsinfo"
+    "github.com/cpuuntery/go-code-and-bin/gpt"
+    "github.com/cpuuntery/go-code-and-bin/probe"
+    "github.com/cpuuntery/go-code-and-bin/report"
+    _ "github.com/cpuuntery/go-code-and-bin/simg"
+    "github.com/cpuuntery/go-code-and-bin/verify"
 )
 
 const (
     SECTOR_SIZE = 512
 )
 
-type GPTHeader struct {
-    Signature          [8]byte
-    Revision           uint32
-    HeaderSize         uint32
-    HeaderCRC32        uint32
-    Reserved           uint32
-    CurrentLBA         uint64
-    BackupLBA          uint64
-    FirstUsableLBA     uint64
-    LastUsableLBA      uint64
-    DiskGUID           [16]byte
-    PartitionTableLBA  uint64
-    NumPartitions      uint32
-    PartitionEntrySize uint32
-    PartitionTableCRC  uint32
+// maxTableBytes caps how much of a declared entry array is buffered, so a
+// hostile header cannot make us allocate gigabytes (-max-table-bytes).
+var maxTableBytes int64 = 4 << 20
+
+// diskImage is what the GPT is read from: the disk or image file itself, or
+// the disk inside a container format such as an Android sparse image.
+type diskImage interface {
+    io.ReaderAt
+    io.Seeker
+}
+
+// stackedPreset describes a common stacked-storage layout that puts its own
+// metadata in front of (or behind) the data of the underlying member device.
+type stackedPreset struct {
+    name          string
+    description   string
+    defaultOffset int64
+    // probe looks for the layer's superblock and returns the data offset it
+    // records; ok is false when no superblock was found.
+    probe func(f diskImage) (offset int64, ok bool)
+}
+
+var stackedPresets = []stackedPreset{
+    {"mdraid-1.0", "md RAID metadata 1.0 (superblock at the end, data at 0)", 0, probeMD10},
+    {"mdraid-1.2", "md RAID metadata 1.2 (superblock at 4 KiB)", 1 << 20, probeMD12},
+    {"bcache", "bcache backing device (superblock at 4 KiB, data at 8 KiB)", 8 << 10, probeBcache},
+}
+
+func findPreset(name string) *stackedPreset {
+    for i := range stackedPresets {
+        if stackedPresets[i].name == name {
+            return &stackedPresets[i]
+        }
+    }
+    return nil
+}
+
+const (
+    mdMagic          = 0xa92b4efc
+    bcacheSBOffset   = 4096
+    bcacheVerBdevOff = 4 // BCACHE_SB_VERSION_BDEV_WITH_OFFSET
+)
+
+var bcacheMagic = []byte{0xc6, 0x85, 0x73, 0xf6, 0x4e, 0x1a, 0x45, 0xca, 0x82, 0x65, 0xf5, 0x7f, 0x48, 0xba, 0x6d, 0x81}
+
+// readMDSuperblock returns the data_offset (bytes) recorded in an md v1.x
+// superblock located at off, if the magic matches.
+func readMDSuperblock(f diskImage, off int64) (int64, bool) {
+    sb := make([]byte, 256)
+    if n, err := f.ReadAt(sb, off); err != nil || n != len(sb) {
+        return 0, false
+    }
+    if binary.LittleEndian.Uint32(sb[0:4]) != mdMagic || binary.LittleEndian.Uint32(sb[4:8]) != 1 {
+        return 0, false
+    }
+    return int64(binary.LittleEndian.Uint64(sb[128:136])) * SECTOR_SIZE, true
 }
 
-type GPTEntry struct {
-    PartitionTypeGUID [16]byte
-    UniqueGUID        [16]byte
-    StartingLBA       uint64
-    EndingLBA         uint64
-    Attributes        uint64
-    PartitionName     [72]byte
+func probeMD12(f diskImage) (int64, bool) {
+    return readMDSuperblock(f, 4096)
 }
 
-// Very large map of known partition type GUIDs (canonical lowercase keys)
-var knownGuidPairs = [][2]string{
-    // UEFI / common
-    {"c12a7328-f81f-11d2-ba4b-00a0c93ec93b", "EFI System Partition"},
-    {"21686148-6449-6e6f-744e-656564454649", "BIOS Boot Partition"},
+func probeMD10(f diskImage) (int64, bool) {
+    size, err := f.Seek(0, io.SeekEnd)
+    if err != nil || size < 8192 {
+        return 0, false
+    }
+    // mdadm places the 1.0 superblock 8 KiB before the end, 4 KiB aligned
+    sbOff := (((size / SECTOR_SIZE) - 16) &^ 7) * SECTOR_SIZE
+    return readMDSuperblock(f, sbOff)
+}
 
-    // Linux / distro / LVM / RAID
-    {"0fc63daf-8483-4772-8e79-3d69d8477de4", "Linux filesystem data"},
-    {"0657fd6d-a4ab-43c4-84e5-0933c84b4f4f", "Linux swap"},
-    {"e6d6d379-f507-44c2-a23c-238f2a3df928", "Linux LVM"},
-    {"a19d880f-05fc-4d3b-a006-743f0f84911e", "Linux root (old coreos style)"},
-    {"930a0d1a-6b73-4b1a-9cc9-9e6d2a3f3b9d", "Linux home (non-standard)"},
-    {"0bfb3f1a-9b27-4e6f-8d3a-000000000000", "Linux reserved (nonstandard)"},
-    {"9163b3ee-6b79-4a9a-9a8b-3a44f2b6f1f5", "Linux RAID"},
-    {"1777a15b-d0a1-4ef9-b0c8-2f2f6b6a4a3f", "Linux reserved (vendor)"},
+func probeBcache(f diskImage) (int64, bool) {
+    sb := make([]byte, 192)
+    if n, err := f.ReadAt(sb, bcacheSBOffset); err != nil || n != len(sb) {
+        return 0, false
+    }
+    if !bytes.Equal(sb[24:40], bcacheMagic) {
+        return 0, false
+    }
+    if binary.LittleEndian.Uint64(sb[16:24]) == bcacheVerBdevOff {
+        return int64(binary.LittleEndian.Uint64(sb[184:192])) * SECTOR_SIZE, true
+    }
+    return 8 << 10, true
+}
 
-    // Microsoft / Windows
-    {"e3c9e316-0b5c-4db8-817d-f92df00215ae", "Microsoft Reserved Partition (MSR)"},
-    {"ebd0a0a2-b9e5-4433-87c0-68b6b72699c7", "Microsoft Basic Data"},
-    {"de94bba4-06d1-4d40-a16a-bfd50179d6ac", "Windows Recovery Environment"},
+func readAtOrFail(f diskImage, buf []byte, off int64) {
+    n, err := f.ReadAt(buf, off)
+    if err != nil || n != len(buf) {
+        if err == nil {
+            err = fmt.Errorf("short read: %d != %d", n, len(buf))
+        }
+        log.Fatalf("read failed at offset %d: %v", off, err)
+    }
+}
 
-    // ChromeOS / CoreOS / Android / vendor
-    {"fe3a2a5d-4f32-41a7-b725-accc3285a309", "ChromeOS rootfs"},
-    {"44479540-f297-41b2-9af7-d131d5f0458a", "Android fstab (vendor-defined)"},
+// ---------------------------------------------------------------------------
+// tree view: disk -> GPT partitions -> containers -> filesystems, all derived
+// from on-image signatures so it works on offline images (like lsblk -f).
 
-    // Misc historical / obscure / vendor-specific types
-    {"024dee41-33e7-11d3-9d69-0008c781f39f", "MBR partition scheme GUID (protective MBR)"},
+type treeNode struct {
+    index    int // entry index for partitions
+    name     string
+    fstype   string
+    label    string
+    uuid     string
+    size     int64
+    children []*treeNode
+}
 
-    // QNX
-    {"a19d880f-05fc-4d3b-a006-743f0f84911e", "QNX6 filesystem / QNX6 power-safe"},
+const maxTreeDepth = 6
 
-    // Gaming consoles / embedded / special
-    {"e3c9e316-0b5c-4db8-817d-f92df00215ae", "Embedded vendor reserved (MSR GUID reused)"},
+// readRegion reads len(buf) bytes at off, reporting false on any short read.
+func readRegion(f diskImage, buf []byte, off int64) bool {
+    if off < 0 {
+        return false
+    }
+    n, err := f.ReadAt(buf, off)
+    return n == len(buf) && (err == nil || err == io.EOF)
+}
 
-    // Extended collection of many documented GUIDs (lowercase keys)
-    {"b921b045-1df0-41c3-af44-4c6f280d3fae", "Linux / boot partition by GUID used by some tools"},
-    {"37a0f9a0-5a8a-4e6f-8b2a-e7a4b7f55a3f", "Non-standard vendor partition"},
+func cString(b []byte) string {
+    if i := bytes.IndexByte(b, 0); i >= 0 {
+        b = b[:i]
+    }
+    return strings.TrimSpace(string(b))
+}
 
-    // Add a large set of other GUIDs commonly found in public lists
-    {"e2a1b0f0-5a0f-11d3-9d69-0008c781f39f", "Partition map (rare)"},
+// plainUUID formats 16 bytes stored in big-endian order (ext4, xfs, btrfs, md).
+func plainUUID(b []byte) string {
+    return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
 }
 
+// sizeUnits are the units humanSize prints in, binary like lsblk unless -si
+// picks the decimal ones storage vendors quote.
+var sizeUnits = iecSizeUnits
+
+var (
+    iecSizeUnits = struct {
+        base  float64
+        names []string
+    }{1024, []string{"B", "K", "M", "G", "T", "P"}}
+    siSizeUnits = struct {
+        base  float64
+        names []string
+    }{1000, []string{"B", "kB", "MB", "GB", "TB", "PB"}}
+)
+
+func humanSize(n int64) string {
+    f := float64(n)
+    i := 0
+    for f >= sizeUnits.base && i < len(sizeUnits.names)-1 {
+        f /= sizeUnits.base
+        i++
+    }
+    if i == 0 {
+        return fmt.Sprintf("%dB", n)
+    }
+    return fmt.Sprintf("%.1f%s", f, sizeUnits.names[i])
+}
 
-var knownTypes map[string]string
+// probeRegion identifies what lives at [off, off+size) and fills node,
+// descending into containers that expose further layers.
+func probeRegion(f diskImage, off, size int64, node *treeNode, depth int) {
+    if depth > maxTreeDepth {
+        return
+    }
+    buf := make([]byte, 4096)
+    if !readRegion(f, buf, off) {
+        return
+    }
 
-func init() {
-    knownTypes = make(map[string]string, len(knownGuidPairs))
-    for _, p := range knownGuidPairs {
-        key := strings.ToLower(p[0])
-        if _, exists := knownTypes[key]; !exists {
-            knownTypes[key] = p[1]
+    switch {
+    case bytes.Equal(buf[0:6], []byte("LUKS\xba\xbe")):
+        node.fstype = "crypto_LUKS"
+        node.uuid = cString(buf[168:208])
+        if binary.BigEndian.Uint16(buf[6:8]) == 2 {
+            node.label = cString(buf[24:72])
+        }
+        node.children = append(node.children, &treeNode{name: "(encrypted payload)"})
+        return
+    case bytes.Equal(buf[512:520], []byte("EFI PART")):
+        node.fstype = "gpt"
+        node.uuid = gpt.GUID(buf[512+56 : 512+72]).String()
+        node.children = nestedGPTTree(f, off, depth)
+        return
+    }
+    if probeMDMember(f, off, size, node, depth) {
+        return
+    }
+    if probeLVMMember(f, off, node, depth) {
+        return
+    }
+    probeFilesystem(f, off, buf, node)
+    if node.fstype == "" {
+        // formats registered by out-of-tree code (package probe)
+        if res, ok := probe.Identify(f, off, size); ok {
+            node.fstype, node.label, node.uuid = res.Type, res.Label, res.UUID
         }
     }
 }
 
+// probeFilesystem recognises the filesystems people usually find on GPT disks.
+func probeFilesystem(f diskImage, off int64, head []byte, node *treeNode) {
+    sb := make([]byte, 1024)
+    if readRegion(f, sb, off+1024) && binary.LittleEndian.Uint16(sb[56:58]) == 0xEF53 {
+        compat := binary.LittleEndian.Uint32(sb[92:96])
+        incompat := binary.LittleEndian.Uint32(sb[96:100])
+        node.fstype = "ext2"
+        if compat&0x4 != 0 {
+            node.fstype = "ext3"
+        }
+        if incompat&(0x40|0x80|0x200) != 0 {
+            node.fstype = "ext4"
+        }
+        node.label = cString(sb[120:136])
+        node.uuid = plainUUID(sb[104:120])
+        return
+    }
+    if readRegion(f, sb, off+65536) && bytes.Equal(sb[64:72], []byte("_BHRfS_M")) {
+        node.fstype = "btrfs"
+        node.label = cString(sb[299:555])
+        node.uuid = plainUUID(sb[32:48])
+        return
+    }
+    switch {
+    case bytes.Equal(head[0:4], []byte("XFSB")):
+        node.fstype = "xfs"
+        node.label = cString(head[108:120])
+        node.uuid = plainUUID(head[32:48])
+    case bytes.Equal(head[3:11], []byte("NTFS    ")):
+        node.fstype = "ntfs"
+        node.uuid = fmt.Sprintf("%016X", binary.LittleEndian.Uint64(head[72:80]))
+    case bytes.Equal(head[3:11], []byte("EXFAT   ")):
+        node.fstype = "exfat"
+        node.uuid = fmt.Sprintf("%04X-%04X", binary.LittleEndian.Uint16(head[102:104]), binary.LittleEndian.Uint16(head[100:102]))
+    case bytes.Equal(head[82:87], []byte("FAT32")):
+        node.fstype = "vfat"
+        node.label = cString(head[71:82])
+        node.uuid = fmt.Sprintf("%04X-%04X", binary.LittleEndian.Uint16(head[69:71]), binary.LittleEndian.Uint16(head[67:69]))
+    case bytes.Equal(head[54:59], []byte("FAT12")), bytes.Equal(head[54:59], []byte("FAT16")):
+        node.fstype = "vfat"
+        node.label = cString(head[43:54])
+        node.uuid = fmt.Sprintf("%04X-%04X", binary.LittleEndian.Uint16(head[41:43]), binary.LittleEndian.Uint16(head[39:41]))
+    case bytes.Equal(head[4086:4096], []byte("SWAPSPACE2")):
+        node.fstype = "swap"
+        node.label = cString(head[1024+28 : 1024+44])
+        node.uuid = plainUUID(head[1024+12 : 1024+28])
+    case bytes.Equal(head[0:4], []byte("hsqs")):
+        node.fstype = "squashfs"
+    case binary.LittleEndian.Uint32(head[1024:1028]) == 0xF2F52010:
+        node.fstype = "f2fs"
+        node.uuid = plainUUID(head[1024+108 : 1024+124])
+    default:
+        iso := make([]byte, 6)
+        if readRegion(f, iso, off+32768) && bytes.Equal(iso[1:6], []byte("CD001")) {
+            node.fstype = "iso9660"
+        }
+    }
+}
 
-// Helper: encode GUID bytes to contiguous hex (lowercase)
-func guidBytesToHex(b [16]byte) string {
-    return hex.EncodeToString(b[:])
+// nestedGPTTree lists the partitions of a GPT found at byte offset off.
+func nestedGPTTree(f diskImage, off int64, depth int) []*treeNode {
+    opts := []gpt.Option{gpt.WithOffset(off), gpt.WithSectorSize(SECTOR_SIZE), gpt.WithMaxTableBytes(maxTableBytes)}
+    hdr, err := gpt.ReadHeader(f, opts...)
+    if hdr == nil || errors.Is(err, gpt.ErrHeaderSize) {
+        return nil
+    }
+    entries, _ := gpt.ReadEntries(f, hdr, opts...)
+    if entries == nil {
+        return nil
+    }
+    return gptTree(f, off, hdr, entries, depth)
 }
 
-// Helper: format GUID canonical string xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
-// GPT stores GUID with mixed endianness (first three fields little-endian)
-func formatGUID(b [16]byte) string {
-    var d [16]byte
-    copy(d[:], b[:])
-    reverse := func(s, e int) {
-        for i, j := s, e-1; i < j; i, j = i+1, j-1 {
-            d[i], d[j] = d[j], d[i]
+// gptTree turns the entries of a partition array into tree nodes and probes
+// the content of every used partition.
+func gptTree(f diskImage, off int64, hdr *gpt.Header, entries []gpt.Entry, depth int) []*treeNode {
+    var nodes []*treeNode
+    for i, e := range entries {
+        if e.IsEmpty() {
+            continue
+        }
+        name := fmt.Sprintf("#%d", i)
+        if n := e.Name(); n != "" {
+            name += " " + n
+        }
+        node := &treeNode{index: i, name: name}
+        if e.EndingLBA >= e.StartingLBA {
+            node.size = int64(e.EndingLBA-e.StartingLBA+1) * SECTOR_SIZE
         }
+        probeRegion(f, off+int64(e.StartingLBA)*SECTOR_SIZE, node.size, node, depth+1)
+        nodes = append(nodes, node)
     }
-    reverse(0, 4)
-    reverse(4, 6)
-    reverse(6, 8)
-    return fmt.Sprintf("%08x-%04x-%04x-%02x%02x-%02x%02x%02x%02x%02x%02x",
-        binary.BigEndian.Uint32(d[0:4]),
-        binary.BigEndian.Uint16(d[4:6]),
-        binary.BigEndian.Uint16(d[6:8]),
-        d[8], d[9],
-        d[10], d[11], d[12], d[13], d[14], d[15],
-    )
+    return nodes
 }
 
-func lookupTypeName(g string) string {
-    g = strings.ToLower(g)
-    if v, ok := knownTypes[g]; ok {
-        return v
+// probeMDMember looks for an md v1.x superblock (1.1 at 0, 1.2 at 4 KiB,
+// 1.0 near the end) and descends into the array data.
+func probeMDMember(f diskImage, off, size int64, node *treeNode, depth int) bool {
+    candidates := []int64{0, 4096}
+    if size >= 8192 {
+        candidates = append(candidates, (((size/SECTOR_SIZE)-16)&^7)*SECTOR_SIZE)
     }
-    return ""
+    sb := make([]byte, 256)
+    for _, c := range candidates {
+        if !readRegion(f, sb, off+c) || binary.LittleEndian.Uint32(sb[0:4]) != mdMagic || binary.LittleEndian.Uint32(sb[4:8]) != 1 {
+            continue
+        }
+        node.fstype = "linux_raid_member"
+        node.label = cString(sb[32:64])
+        node.uuid = plainUUID(sb[16:32])
+        dataOff := int64(binary.LittleEndian.Uint64(sb[128:136])) * SECTOR_SIZE
+        dataSize := int64(binary.LittleEndian.Uint64(sb[136:144])) * SECTOR_SIZE
+        md := &treeNode{
+            name: fmt.Sprintf("md (raid%d)", int32(binary.LittleEndian.Uint32(sb[72:76]))),
+            size: dataSize,
+        }
+        probeRegion(f, off+dataOff, dataSize, md, depth+1)
+        node.children = append(node.children, md)
+        return true
+    }
+    return false
 }
 
-func utf16leNameToString(b [72]byte) string {
-    u16 := make([]uint16, 0, 36)
-    for i := 0; i < len(b); i += 2 {
-        u := binary.LittleEndian.Uint16(b[i : i+2])
-        if u == 0 {
+// probeLVMMember reads an LVM2 PV label and its text metadata to list the
+// logical volumes; linear LVs that start on this PV are probed further.
+func probeLVMMember(f diskImage, off int64, node *treeNode, depth int) bool {
+    sec := make([]byte, SECTOR_SIZE)
+    labelSector := int64(-1)
+    for i := int64(0); i < 4; i++ {
+        if readRegion(f, sec, off+i*SECTOR_SIZE) && bytes.Equal(sec[0:8], []byte("LABELONE")) && bytes.Equal(sec[24:32], []byte("LVM2 001")) {
+            labelSector = i
+            break
+        }
+    }
+    if labelSector < 0 {
+        return false
+    }
+    pvh := sec[binary.LittleEndian.Uint32(sec[20:24]):]
+    pvUUID := string(pvh[0:32])
+    node.fstype = "LVM2_member"
+    node.uuid = lvmUUID(pvUUID)
+
+    // disk_locn lists: data areas then metadata areas, each zero-terminated
+    p := 40
+    readLocns := func() (locns [][2]uint64) {
+        for p+16 <= len(pvh) {
+            o, s := binary.LittleEndian.Uint64(pvh[p:p+8]), binary.LittleEndian.Uint64(pvh[p+8:p+16])
+            p += 16
+            if o == 0 && s == 0 {
+                break
+            }
+            locns = append(locns, [2]uint64{o, s})
+        }
+        return locns
+    }
+    readLocns()
+    mdas := readLocns()
+    if len(mdas) == 0 {
+        return true
+    }
+    text := readLVMMetadata(f, off, int64(mdas[0][0]), int64(mdas[0][1]))
+    if text == "" {
+        return true
+    }
+    root := parseLVMText(text)
+    var vgName string
+    var vg *lvmSection
+    for _, k := range root.keys {
+        if s, ok := root.sections[k]; ok {
+            vgName, vg = k, s
             break
         }
-        u16 = append(u16, u)
     }
-    return string(utf16.Decode(u16))
+    if vg == nil {
+        return true
+    }
+    extentSize := vg.int("extent_size")
+
+    // which pvN in the metadata is us, and where do its extents start
+    pvKey, peStart := "", int64(0)
+    if pvs := vg.sections["physical_volumes"]; pvs != nil {
+        for _, k := range pvs.keys {
+            pv := pvs.sections[k]
+            if pv != nil && strings.ReplaceAll(pv.str("id"), "-", "") == pvUUID {
+                pvKey, peStart = k, pv.int("pe_start")
+            }
+        }
+    }
+
+    lvs := vg.sections["logical_volumes"]
+    if lvs == nil {
+        return true
+    }
+    for _, name := range lvs.keys {
+        lv := lvs.sections[name]
+        if lv == nil {
+            continue
+        }
+        child := &treeNode{name: vgName + "-" + name, uuid: lvmUUID(strings.ReplaceAll(lv.str("id"), "-", ""))}
+        var extents int64
+        for _, sk := range lv.keys {
+            if seg := lv.sections[sk]; seg != nil && strings.HasPrefix(sk, "segment") {
+                extents += seg.int("extent_count")
+            }
+        }
+        child.size = extents * extentSize * SECTOR_SIZE
+        if seg := lv.sections["segment1"]; seg != nil && lv.int("segment_count") == 1 && seg.int("stripe_count") == 1 {
+            if stripes := seg.list("stripes"); len(stripes) == 2 && stripes[0] == pvKey {
+                if startExt, err := strconv.ParseInt(stripes[1], 10, 64); err == nil {
+                    lvOff := off + peStart*SECTOR_SIZE + startExt*extentSize*SECTOR_SIZE
+                    probeRegion(f, lvOff, child.size, child, depth+1)
+                }
+            }
+        }
+        node.children = append(node.children, child)
+    }
+    return true
 }
 
-func readAtOrFail(f *os.File, buf []byte, off int64) {
-    n, err := f.ReadAt(buf, off)
-    if err != nil || n != len(buf) {
-        if err == nil {
-            err = fmt.Errorf("short read: %d != %d", n, len(buf))
+func lvmUUID(s string) string {
+    if len(s) != 32 {
+        return s
+    }
+    return s[0:6] + "-" + s[6:10] + "-" + s[10:14] + "-" + s[14:18] + "-" + s[18:22] + "-" + s[22:26] + "-" + s[26:32]
+}
+
+// readLVMMetadata returns the current text metadata from the circular buffer
+// of a metadata area located at mdaOff (relative to the PV start).
+func readLVMMetadata(f diskImage, pvOff, mdaOff, mdaSize int64) string {
+    mh := make([]byte, 512)
+    if !readRegion(f, mh, pvOff+mdaOff) || !bytes.Equal(mh[4:20], []byte(" LVM2 x[5A%r0N*>")) {
+        return ""
+    }
+    rOff := int64(binary.LittleEndian.Uint64(mh[40:48]))
+    rSize := int64(binary.LittleEndian.Uint64(mh[48:56]))
+    if rOff == 0 || rSize <= 0 || rSize > 16<<20 {
+        return ""
+    }
+    text := make([]byte, rSize)
+    first := rSize
+    if rOff+rSize > mdaSize {
+        // wrapped around the end of the buffer, continues after the header
+        first = mdaSize - rOff
+    }
+    if !readRegion(f, text[:first], pvOff+mdaOff+rOff) {
+        return ""
+    }
+    if first < rSize && !readRegion(f, text[first:], pvOff+mdaOff+512) {
+        return ""
+    }
+    return cString(text)
+}
+
+// lvmSection is a parsed block of the LVM2 text metadata format.
+type lvmSection struct {
+    keys     []string // sections in file order
+    sections map[string]*lvmSection
+    values   map[string][]string
+}
+
+func (s *lvmSection) str(k string) string {
+    if v := s.values[k]; len(v) > 0 {
+        return v[0]
+    }
+    return ""
+}
+
+func (s *lvmSection) int(k string) int64 {
+    n, _ := strconv.ParseInt(s.str(k), 10, 64)
+    return n
+}
+
+func (s *lvmSection) list(k string) []string {
+    return s.values[k]
+}
+
+func parseLVMText(text string) *lvmSection {
+    // tokenise: identifiers/numbers, quoted strings, and punctuation
+    var toks []string
+    for i := 0; i < len(text); {
+        c := text[i]
+        switch {
+        case c == '#':
+            for i < len(text) && text[i] != '\n' {
+                i++
+            }
+        case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+            i++
+        case strings.IndexByte("{}[]=,", c) >= 0:
+            toks = append(toks, string(c))
+            i++
+        case c == '"':
+            j := i + 1
+            for j < len(text) && text[j] != '"' {
+                if text[j] == '\\' {
+                    j++
+                }
+                j++
+            }
+            if j > len(text) {
+                j = len(text)
+            }
+            toks = append(toks, text[i:j])
+            i = j + 1
+        default:
+            j := i
+            for j < len(text) && strings.IndexByte(" \t\r\n{}[]=,#\"", text[j]) < 0 {
+                j++
+            }
+            toks = append(toks, text[i:j])
+            i = j
         }
-        log.Fatalf("read failed at offset %d: %v", off, err)
+    }
+    unquote := func(t string) string { return strings.TrimPrefix(t, "\"") }
+
+    pos := 0
+    var parse func() *lvmSection
+    parse = func() *lvmSection {
+        s := &lvmSection{sections: map[string]*lvmSection{}, values: map[string][]string{}}
+        for pos < len(toks) && toks[pos] != "}" {
+            key := toks[pos]
+            pos++
+            if pos >= len(toks) {
+                break
+            }
+            switch toks[pos] {
+            case "{":
+                pos++
+                s.keys = append(s.keys, key)
+                s.sections[key] = parse()
+                pos++ // closing brace
+            case "=":
+                pos++
+                if pos < len(toks) && toks[pos] == "[" {
+                    pos++
+                    for pos < len(toks) && toks[pos] != "]" {
+                        if toks[pos] != "," {
+                            s.values[key] = append(s.values[key], unquote(toks[pos]))
+                        }
+                        pos++
+                    }
+                    pos++
+                } else if pos < len(toks) {
+                    s.values[key] = []string{unquote(toks[pos])}
+                    pos++
+                }
+            }
+        }
+        return s
+    }
+    return parse()
+}
+
+func printTree(n *treeNode, prefix string, last, root bool) {
+    branch := ""
+    childPrefix := prefix
+    if !root {
+        if last {
+            branch = prefix + "└─"
+            childPrefix = prefix + "  "
+        } else {
+            branch = prefix + "├─"
+            childPrefix = prefix + "│ "
+        }
+    }
+    label := branch + n.name
+    size := ""
+    if n.size > 0 {
+        size = humanSize(n.size)
+    }
+    fmt.Printf("%-36s %-18s %-8s %-16s %s\n", label, n.fstype, size, n.label, n.uuid)
+    for i, c := range n.children {
+        printTree(c, childPrefix, i == len(n.children)-1, false)
+    }
+}
+
+// partedNumber formats a byte count the way parted does for unit.
+func partedNumber(n int64, unit string) string {
+    switch unit {
+    case "B":
+        return fmt.Sprintf("%dB", n)
+    case "s":
+        return fmt.Sprintf("%ds", n/SECTOR_SIZE)
+    case "compact":
+        // the largest SI unit that still leaves at least two digits
+        unit = "B"
+        for _, u := range []string{"TB", "GB", "MB", "kB"} {
+            if n >= 10*partedUnitSizes[u] {
+                unit = u
+                break
+            }
+        }
+        if unit == "B" {
+            return fmt.Sprintf("%dB", n)
+        }
+    }
+    d := float64(n) / float64(partedUnitSizes[unit])
+    prec := 0
+    switch {
+    case d+0.005 < 10:
+        prec = 2
+    case d+0.05 < 100:
+        prec = 1
+    }
+    return strconv.FormatFloat(d, 'f', prec, 64) + unit
+}
+
+var partedUnitSizes = map[string]int64{
+    "kB": 1e3, "MB": 1e6, "GB": 1e9, "TB": 1e12,
+    "KiB": 1 << 10, "MiB": 1 << 20, "GiB": 1 << 30, "TiB": 1 << 40,
+}
+
+// partedTypeFlags are the flags parted derives from a partition type.
+var partedTypeFlags = map[string]string{
+    "c12a7328-f81f-11d2-ba4b-00a0c93ec93b": "boot, esp",
+    "21686148-6449-6e6f-744e-656564454649": "bios_grub",
+    "e3c9e316-0b5c-4db8-817d-f92df00215ae": "msftres",
+    "ebd0a0a2-b9e5-4433-87c0-68b6b72699c7": "msftdata",
+    "e6d6d379-f507-44c2-a23c-238f2a3df928": "lvm",
+    "a19d880f-05fc-4d3b-a006-743f0f84911e": "raid",
+    "0657fd6d-a4ab-43c4-84e5-0933c84b4f4f": "swap",
+    "de94bba4-06d1-4d40-a16a-bfd50179d6ac": "diag",
+    "9e1a2d38-c612-4316-aa26-8b49521e5a8b": "prep",
+    "bc13c2ff-59e6-4262-a352-b275fd6f7172": "bls_boot",
+    "933ac7e1-2eb4-4f13-b844-0e14e2aef915": "linux-home",
+    "d3bfe2de-3daf-11df-ba40-e3a556d89593": "irst",
+    "fe3a2a5d-4f32-41a7-b725-accc3285a309": "chromeos_kernel",
+}
+
+func partedFlags(e gpt.Entry) string {
+    var flags []string
+    if f, ok := partedTypeFlags[e.PartitionTypeGUID.String()]; ok {
+        flags = append(flags, f)
+    }
+    if e.Attributes&(1<<2) != 0 {
+        flags = append(flags, "legacy_boot")
+    }
+    if e.Attributes&(1<<62) != 0 {
+        flags = append(flags, "hidden")
+    }
+    if e.Attributes&(1<<63) != 0 {
+        flags = append(flags, "no_automount")
+    }
+    return strings.Join(flags, ", ")
+}
+
+// partedFS names the filesystem at off the way parted's probes do.
+func partedFS(f diskImage, off int64) string {
+    head := make([]byte, 4096)
+    if !readRegion(f, head, off) {
+        return ""
+    }
+    var node treeNode
+    probeFilesystem(f, off, head, &node)
+    switch node.fstype {
+    case "vfat":
+        if bytes.Equal(head[82:87], []byte("FAT32")) {
+            return "fat32"
+        }
+        if bytes.Equal(head[54:59], []byte("FAT12")) {
+            return "fat12"
+        }
+        return "fat16"
+    case "swap":
+        return "linux-swap(v1)"
+    case "iso9660", "squashfs", "exfat":
+        return ""
+    }
+    return node.fstype
+}
+
+// partedEscape escapes the record separators like parted -m does.
+func partedEscape(s string) string {
+    return strings.NewReplacer(`\`, `\\`, ":", `\:`).Replace(s)
+}
+
+// printParted prints the records of "parted -ms <disk> unit <unit> print".
+func printParted(f diskImage, path string, base int64, hdr *gpt.Header, entries []gpt.Entry, only int, unit string) {
+    size, _ := f.Seek(0, io.SeekEnd)
+    size -= base
+    transport, model, phys := "file", "", SECTOR_SIZE
+    if d, err := device.Describe(path); err == nil {
+        transport, model = d.Transport, d.Model
+        if d.PhysicalSectorSize != 0 {
+            phys = d.PhysicalSectorSize
+        }
+    }
+    fmt.Println("BYT;")
+    fmt.Printf("%s:%s:%s:%d:%d:gpt:%s:;\n", partedEscape(path), partedNumber(size, unit), transport, SECTOR_SIZE, phys, partedEscape(model))
+
+    for i, e := range entries {
+        if e.IsEmpty() || e.EndingLBA < e.StartingLBA || (only >= 0 && i != only) {
+            continue
+        }
+        start := int64(e.StartingLBA) * SECTOR_SIZE
+        end := int64(e.EndingLBA+1)*SECTOR_SIZE - 1
+        endStr := partedNumber(end, unit)
+        if unit == "s" {
+            endStr = fmt.Sprintf("%ds", e.EndingLBA)
+        }
+        fmt.Printf("%d:%s:%s:%s:%s:%s:%s;\n", i+1,
+            partedNumber(start, unit), endStr, partedNumber(end-start+1, unit),
+            partedFS(f, base+start), partedEscape(e.Name()), partedFlags(e))
+    }
+}
+
+// partxSize formats sizes like util-linux: binary one-letter suffixes with
+// at most one decimal, e.g. "512M", "1.5G".
+func partxSize(n int64) string {
+    units := []string{"B", "K", "M", "G", "T", "P", "E"}
+    i := 0
+    for i < len(units)-1 && n >= 1<<(10*(i+1)) {
+        i++
+    }
+    if i == 0 {
+        return fmt.Sprintf("%dB", n)
+    }
+    whole := n >> (10 * i)
+    frac := n - whole<<(10*i)
+    // one decimal, rounded
+    dec := (frac*10 + 1<<(10*i)/2) >> (10 * i)
+    if dec == 10 {
+        whole, dec = whole+1, 0
+    }
+    if dec == 0 {
+        return fmt.Sprintf("%d%s", whole, units[i])
+    }
+    return fmt.Sprintf("%d.%d%s", whole, dec, units[i])
+}
+
+// partxColumns are the columns partx knows; right marks numeric ones.
+var partxColumns = map[string]bool{
+    "NR": true, "START": true, "END": true, "SECTORS": true, "SIZE": true,
+    "NAME": false, "UUID": false, "TYPE": false, "FLAGS": false, "SCHEME": false,
+    // not partx's: absolute byte offsets of the first and last byte
+    "START_BYTE": true, "END_BYTE": true,
+}
+
+// printPartx prints the used entries as "partx --show -o columns" does.
+func printPartx(base int64, hdr *gpt.Header, entries []gpt.Entry, only int, columns string, headings bool) {
+    cols := strings.Split(strings.ToUpper(columns), ",")
+    for _, c := range cols {
+        if _, ok := partxColumns[c]; !ok {
+            log.Fatalf("unknown partx column %q", c)
+        }
+    }
+    var rows [][]string
+    if headings {
+        rows = append(rows, cols)
+    }
+    for i, e := range entries {
+        if e.IsEmpty() || e.EndingLBA < e.StartingLBA || (only >= 0 && i != only) {
+            continue
+        }
+        sectors := e.EndingLBA - e.StartingLBA + 1
+        row := make([]string, len(cols))
+        for k, c := range cols {
+            switch c {
+            case "NR":
+                row[k] = strconv.Itoa(i + 1)
+            case "START":
+                row[k] = strconv.FormatUint(e.StartingLBA, 10)
+            case "END":
+                row[k] = strconv.FormatUint(e.EndingLBA, 10)
+            case "SECTORS":
+                row[k] = strconv.FormatUint(sectors, 10)
+            case "SIZE":
+                row[k] = partxSize(int64(sectors) * SECTOR_SIZE)
+            case "NAME":
+                row[k] = e.Name()
+            case "UUID":
+                row[k] = e.UniqueGUID.String()
+            case "TYPE":
+                row[k] = e.PartitionTypeGUID.String()
+            case "FLAGS":
+                row[k] = fmt.Sprintf("0x%x", e.Attributes)
+            case "SCHEME":
+                row[k] = "gpt"
+            case "START_BYTE":
+                row[k] = strconv.FormatInt(startByte(base, e), 10)
+            case "END_BYTE":
+                row[k] = strconv.FormatInt(endByte(base, e), 10)
+            }
+        }
+        rows = append(rows, row)
+    }
+
+    widths := make([]int, len(cols))
+    for _, r := range rows {
+        for k, v := range r {
+            widths[k] = max(widths[k], len([]rune(v)))
+        }
+    }
+    for _, r := range rows {
+        var line strings.Builder
+        for k, v := range r {
+            if k > 0 {
+                line.WriteByte(' ')
+            }
+            pad := strings.Repeat(" ", widths[k]-len([]rune(v)))
+            if partxColumns[cols[k]] {
+                line.WriteString(pad + v)
+            } else if k < len(r)-1 {
+                line.WriteString(v + pad)
+            } else {
+                line.WriteString(v)
+            }
+        }
+        fmt.Println(line.String())
+    }
+}
+
+// exportEscape backslash-escapes everything but a conservative set of
+// characters so the value survives shell eval, like blkid -o export.
+func exportEscape(s string) string {
+    var b strings.Builder
+    for _, r := range s {
+        safe := r >= 0x80 || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("._-+/:@,%", r)
+        if !safe {
+            b.WriteByte('\\')
+        }
+        b.WriteRune(r)
+    }
+    return b.String()
+}
+
+// porcelainVersion is the first line of -porcelain output. It changes only
+// when existing keys change meaning or format; new keys may be added.
+const porcelainVersion = "gpt-porcelain 1"
+
+// printPorcelain prints every header field and every used entry as
+// key=value lines in a fixed order. Masked GUIDs become placeholders that
+// only depend on the entry number, so two images built from the same layout
+// print identically.
+func printPorcelain(path string, base int64, hdr *gpt.Header, hdrCRC, tableCRC uint32, entries []gpt.Entry, bootCode string, only int, mask map[string]bool, withBytes bool) {
+    guid := func(g gpt.GUID, placeholder string) string {
+        if mask["guids"] {
+            return placeholder
+        }
+        return g.String()
+    }
+    crc := func(v uint32) string {
+        if mask["crcs"] {
+            return "<crc>"
+        }
+        return fmt.Sprintf("0x%08x", v)
+    }
+    kv := func(k string, v any) {
+        fmt.Printf("%s=%v\n", k, v)
+    }
+    fmt.Println(porcelainVersion)
+    if !mask["source"] {
+        kv("source", strconv.Quote(path))
+    }
+    kv("offset", base)
+    // "" when blank; boot loaders changing between two images show here
+    kv("mbr.boot_code_sha256", strconv.Quote(bootCode))
+    kv("header.signature", strconv.Quote(string(hdr.Signature[:])))
+    kv("header.revision", fmt.Sprintf("0x%08x", hdr.Revision))
+    kv("header.header_size", hdr.HeaderSize)
+    kv("header.header_crc32", crc(hdr.HeaderCRC32))
+    kv("header.header_crc32_valid", hdr.HeaderCRC32 == hdrCRC)
+    kv("header.reserved", hdr.Reserved)
+    kv("header.my_lba", hdr.CurrentLBA)
+    kv("header.alternate_lba", hdr.BackupLBA)
+    kv("header.first_usable_lba", hdr.FirstUsableLBA)
+    kv("header.last_usable_lba", hdr.LastUsableLBA)
+    kv("header.disk_guid", guid(hdr.DiskGUID, "<disk-guid>"))
+    kv("header.partition_entry_lba", hdr.PartitionTableLBA)
+    kv("header.number_of_partition_entries", hdr.NumPartitions)
+    kv("header.size_of_partition_entry", hdr.PartitionEntrySize)
+    kv("header.partition_entry_array_crc32", crc(hdr.PartitionTableCRC))
+    kv("header.partition_entry_array_crc32_valid", hdr.PartitionTableCRC == tableCRC)
+
+    for i, e := range entries {
+        if e.IsEmpty() || (only >= 0 && i != only) {
+            continue
+        }
+        p := fmt.Sprintf("partition.%d.", i+1)
+        kv(p+"type_guid", e.PartitionTypeGUID.String())
+        kv(p+"type_name", strconv.Quote(gpt.TypeName(e.PartitionTypeGUID)))
+        kv(p+"unique_guid", guid(e.UniqueGUID, fmt.Sprintf("<partition-%d-guid>", i+1)))
+        kv(p+"starting_lba", e.StartingLBA)
+        kv(p+"ending_lba", e.EndingLBA)
+        if withBytes {
+            kv(p+"start_byte", startByte(base, e))
+            kv(p+"end_byte", endByte(base, e))
+        }
+        kv(p+"attributes", fmt.Sprintf("0x%016x", e.Attributes))
+        kv(p+"name", strconv.Quote(e.Name()))
+    }
+}
+
+// printJSON prints the -json document described by the report package.
+// offsetSource says where a non-zero base came from, "" to leave it out.
+func printJSON(f diskImage, path string, base int64, offsetSource string, hdr *gpt.Header, calcHdrCRC, calcTableCRC uint32, entries []gpt.Entry, only int) {
+    doc := report.Disk{
+        SchemaVersion: report.SchemaVersion,
+        Source:        path,
+        Offset:        base,
+        OffsetSource:  offsetSource,
+        Header: report.Header{
+            Signature:                    string(hdr.Signature[:]),
+            Revision:                     hdr.Revision,
+            HeaderSize:                   hdr.HeaderSize,
+            HeaderCRC32:                  hdr.HeaderCRC32,
+            HeaderCRC32Calculated:        calcHdrCRC,
+            Reserved:                     hdr.Reserved,
+            MyLBA:                        hdr.CurrentLBA,
+            AlternateLBA:                 hdr.BackupLBA,
+            FirstUsableLBA:               hdr.FirstUsableLBA,
+            LastUsableLBA:                hdr.LastUsableLBA,
+            DiskGUID:                     hdr.DiskGUID.String(),
+            PartitionEntryLBA:            hdr.PartitionTableLBA,
+            NumberOfPartitionEntries:     hdr.NumPartitions,
+            SizeOfPartitionEntry:         hdr.PartitionEntrySize,
+            PartitionEntryArrayCRC32:     hdr.PartitionTableCRC,
+            PartitionEntryArrayCRC32Calc: calcTableCRC,
+        },
+        Partitions: []report.Partition{},
+    }
+    for i, e := range entries {
+        if e.IsEmpty() || (only >= 0 && i != only) {
+            continue
+        }
+        doc.Partitions = append(doc.Partitions, report.Partition{
+            Index:          i,
+            TypeGUID:       e.PartitionTypeGUID.String(),
+            TypeName:       gpt.TypeName(e.PartitionTypeGUID),
+            UniqueGUID:     e.UniqueGUID.String(),
+            StartingLBA:    e.StartingLBA,
+            EndingLBA:      e.EndingLBA,
+            StartByte:      startByte(base, e),
+            EndByte:        endByte(base, e),
+            Attributes:     e.Attributes,
+            FirmwareHidden: e.Attributes&gpt.AttrEFIIgnore != 0,
+            Name:           e.Name(),
+            Filesystem:     fsActivity(f, startByte(base, e)),
+        })
+    }
+    enc := json.NewEncoder(os.Stdout)
+    enc.SetIndent("", "  ")
+    if err := enc.Encode(doc); err != nil {
+        log.Fatalf("encode json: %v", err)
+    }
+}
+
+// fsActivity is what the superblock of the filesystem at off records of
+// its use, nil when none is found or it keeps no such record.
+func fsActivity(f io.ReaderAt, off int64) *report.FSActivity {
+    t, err := fsinfo.ReadTimes(f, off)
+    if err != nil {
+        return nil
+    }
+    stamp := func(t time.Time) string {
+        if t.IsZero() {
+            return ""
+        }
+        return t.Format(time.RFC3339)
+    }
+    return &report.FSActivity{
+        Type:          t.Type,
+        Created:       stamp(t.Created),
+        LastMount:     stamp(t.LastMount),
+        LastWrite:     stamp(t.LastWrite),
+        LastCheck:     stamp(t.LastCheck),
+        MountCount:    t.MountCount,
+        LastMountedOn: t.LastMountedOn,
+    }
+}
+
+// startByte and endByte are the absolute offsets in the input of the first
+// and last byte of partition e, ready for dd skip= or mount -o offset=.
+func startByte(base int64, e gpt.Entry) int64 {
+    return base + int64(e.StartingLBA)*SECTOR_SIZE
+}
+
+func endByte(base int64, e gpt.Entry) int64 {
+    return base + int64(e.EndingLBA+1)*SECTOR_SIZE - 1
+}
+
+// partitionNode returns the kernel's name for partition n of disk, or "" if
+// disk is not a block device.
+func partitionNode(disk string, fi os.FileInfo, n int) string {
+    if fi.Mode()&os.ModeDevice == 0 {
+        return ""
+    }
+    return device.PartitionPath(disk, n)
+}
+
+// printExport prints one blank-line separated block of KEY=value lines per
+// partition.
+func printExport(f diskImage, fi os.FileInfo, path string, base int64, hdr *gpt.Header, entries []gpt.Entry, only int) {
+    first := true
+    for i, e := range entries {
+        if e.IsEmpty() || (only >= 0 && i != only) {
+            continue
+        }
+        if !first {
+            fmt.Println()
+        }
+        first = false
+        kv := func(k, v string) {
+            if v != "" {
+                fmt.Printf("%s=%s\n", k, exportEscape(v))
+            }
+        }
+        kv("DEVNAME", partitionNode(path, fi, i+1))
+        var node treeNode
+        head := make([]byte, 4096)
+        if e.EndingLBA >= e.StartingLBA && readRegion(f, head, base+int64(e.StartingLBA)*SECTOR_SIZE) {
+            probeFilesystem(f, base+int64(e.StartingLBA)*SECTOR_SIZE, head, &node)
+        }
+        kv("LABEL", node.label)
+        kv("UUID", node.uuid)
+        kv("TYPE", node.fstype)
+        kv("PARTLABEL", e.Name())
+        kv("PARTUUID", e.UniqueGUID.String())
+        kv("PTTYPE", "gpt")
+        kv("PTUUID", hdr.DiskGUID.String())
+        kv("PART_ENTRY_NUMBER", strconv.Itoa(i+1))
+        kv("PART_ENTRY_TYPE", e.PartitionTypeGUID.String())
+    }
+}
+
+// printMBR reports a disk that has a classic MBR partition table instead of
+// a GPT.
+func printMBR(path string, parts []gpt.MBRPartition) {
+    fmt.Printf("%s: MBR-partitioned disk (no GPT)\n\n", path)
+    fmt.Printf("%-3s %-4s %12s %12s %8s  %s\n", "#", "BOOT", "START", "SECTORS", "SIZE", "TYPE")
+    for _, p := range parts {
+        boot := ""
+        if p.Bootable {
+            boot = "*"
+        }
+        fmt.Printf("%-3d %-4s %12d %12d %8s  0x%02x %s\n", p.Index+1, boot, p.Start, p.Sectors, humanSize(int64(p.Sectors)*SECTOR_SIZE), p.Type, p.TypeName())
+    }
+    fmt.Printf("\nTo convert the disk to GPT keeping its partitions: sgdisk --mbrtogpt %s\n", path)
+}
+
+// printMBRSection decodes LBA 0 of a GPT disk and checks it: the boot
+// signature, a 0xEE record covering the disk, and hybrid or stale records
+// besides it.
+func printMBRSection(f diskImage, base int64, hdr *gpt.Header, entries []gpt.Entry) {
+    mbr := make([]byte, SECTOR_SIZE)
+    readAtOrFail(f, mbr, base)
+    kind, records := gpt.ClassifyMBR(mbr)
+    fmt.Printf("<<< MBR (LBA 0) >>>\n")
+    fmt.Printf("MBR.BootSignature:                                              0x%04x\n", binary.LittleEndian.Uint16(mbr[510:]))
+    fmt.Printf("MBR.Kind (syn):                                                 %s\n", kind)
+    fmt.Printf("MBR.DiskSignature:                                              0x%08x\n", binary.LittleEndian.Uint32(mbr[440:]))
+    bootCode := "none"
+    if sum := gpt.BootCodeSum(mbr); sum != "" {
+        bootCode = "sha256:" + sum
+    }
+    fmt.Printf("MBR.BootCode (syn):                                             %s\n", bootCode)
+    for _, p := range records {
+        boot := "no"
+        if p.Bootable {
+            boot = "yes"
+        }
+        name := p.TypeName()
+        if name == "" {
+            name = "<unknown>"
+        }
+        fmt.Printf("MBR.Record#%d:                         type=0x%02x (%s) boot=%s start=%d sectors=%d\n", p.Index+1, p.Type, name, boot, p.Start, p.Sectors)
+    }
+    var findings []verify.Finding
+    if end, err := f.Seek(0, io.SeekEnd); err == nil && end-base >= 2*SECTOR_SIZE {
+        disk := io.NewSectionReader(f, base, end-base)
+        findings = verify.ProtectiveMBR(disk, SECTOR_SIZE, uint64((end-base)/SECTOR_SIZE))
+        findings = append(findings, verify.MBRRecords(disk, SECTOR_SIZE, &gpt.Table{Header: *hdr, Entries: entries, SectorSize: SECTOR_SIZE})...)
+    }
+    if len(findings) == 0 {
+        fmt.Printf("MBR.Check (syn):                                                ok\n")
+    }
+    for _, fd := range findings {
+        fmt.Printf("MBR.Check (syn):                                                %s %s: %s\n", fd.Severity, fd.Rule.ID, fd.Message)
+    }
+    fmt.Printf("\n")
+}
+
+// warnMBR notes a hybrid or stale MBR on stderr, which the dump leaves out
+// unless -mbr asks for it.
+func warnMBR(f diskImage, base int64) {
+    mbr := make([]byte, SECTOR_SIZE)
+    if _, err := f.ReadAt(mbr, base); err != nil {
+        return
+    }
+    switch kind, _ := gpt.ClassifyMBR(mbr); kind {
+    case gpt.MBRHybrid:
+        log.Printf("warning: LBA 0 holds a hybrid MBR whose records mirror GPT partitions; -mbr shows it")
+    case gpt.MBRClassic:
+        log.Printf("warning: LBA 0 holds a stale MBR partition table instead of a protective MBR; -mbr shows it")
     }
 }
 
 func main() {
     flag.Usage = func() {
-        fmt.Fprintf(flag.CommandLine.Output(), "usage: %s <device|image|header-file>\n", filepath.Base(os.Args[0]))
+        fmt.Fprintf(flag.CommandLine.Output(), "usage: %s <device|image|header-file|PARTUUID=..|PARTLABEL=..>\n", filepath.Base(os.Args[0]))
         flag.PrintDefaults()
+        fmt.Fprintf(flag.CommandLine.Output(), "\npresets:\n")
+        for _, p := range stackedPresets {
+            fmt.Fprintf(flag.CommandLine.Output(), "  %-12s %s\n", p.name, p.description)
+        }
     }
+    offsetFlag := flag.Int64("offset", 0, "byte offset of the GPT disk inside the input (e.g. data offset of a RAID member)")
+    presetFlag := flag.String("preset", "", "stacked-storage layout to assume (see presets below)")
+    treeFlag := flag.Bool("tree", false, "print a disk -> partition -> container -> filesystem tree instead of the raw dump")
+    jsonFlag := flag.Bool("json", false, "print a versioned JSON document (see -json-schema)")
+    schemaFlag := flag.Bool("json-schema", false, "print the JSON Schema of the -json output and exit")
+    partedFlag := flag.Bool("parted", false, "print parted -ms compatible records")
+    unitFlag := flag.String("unit", "compact", "unit of the -parted output: compact, B, s, kB, MB, GB, TB, KiB, MiB, GiB or TiB")
+    partxFlag := flag.Bool("partx", false, "print partx --show compatible columns")
+    columnsFlag := flag.String("columns", "NR,START,END,SECTORS,SIZE,NAME,UUID,TYPE", "columns of the -partx output")
+    noHeadingsFlag := flag.Bool("noheadings", false, "omit the -partx header line")
+    porcelainFlag := flag.Bool("porcelain", false, "print a stable, versioned key=value listing for golden tests")
+    maskFlag := flag.String("mask", "", "with -porcelain, comma separated run-dependent values to mask: guids, crcs, source")
+    flag.Int64Var(&maxTableBytes, "max-table-bytes", maxTableBytes, "largest partition entry array to read, in bytes; 0 for no limit")
+    flag.BoolFunc("si", "print human-readable sizes (-tree, MBR disks) in decimal units, kB, MB, GB", func(string) error {
+        sizeUnits = siSizeUnits
+        return nil
+    })
+    bytesFlag := flag.Bool("bytes", false, "also print the absolute byte offsets of each partition's first and last byte (dump and -porcelain; -partx has START_BYTE and END_BYTE columns)")
+    mbrFlag := flag.Bool("mbr", false, "also decode and check LBA 0: the protective MBR, and any hybrid or stale partition records")
+    backupFlag := flag.Bool("backup", false, "also read the backup header at AlternateLBA (the last LBA if there is none there), check its CRCs and compare it with the primary")
+    outputFlag := flag.String("output", "", `"export" prints blkid -o export style KEY=value lines per partition`)
+    hexdumpFlag := flag.Bool("hexdump", false, "print the header and used entries as hex, each field on its own line with its name and value")
     flag.Parse()
+    if *schemaFlag {
+        os.Stdout.Write(report.JSONSchema)
+        return
+    }
     if flag.NArg() < 1 {
         flag.Usage()
         os.Exit(2)
     }
     path := flag.Arg(0)
 
+    // PARTUUID=, PARTLABEL=, /dev/disk/by-* and partition nodes name a partition
+    // of their parent disk; only that entry is printed
+    target, err := device.Resolve(path)
+    if err != nil {
+        log.Fatalf("resolve %q: %v", path, err)
+    }
+    path = target.Disk
+    only := target.Index
+
     fi, err := os.Stat(path)
     if err != nil {
         log.Fatalf("stat %q: %v", path, err)
     }
 
-    f, err := os.Open(path)
+    // images in a registered container format are read as the disk they
+    // hold
+    var f diskImage
+    img, _, err := device.OpenImage(path)
     if err != nil {
         log.Fatalf("open %q: %v", path, err)
     }
-    defer f.Close()
+    if img != nil {
+        defer img.Close()
+        f = io.NewSectionReader(img, 0, img.Size())
+    } else {
+        file, err := os.Open(path)
+        if err != nil {
+            log.Fatalf("open %q: %v", path, err)
+        }
+        defer file.Close()
+        f = file
+    }
+
+    // work out where the GPT disk starts inside the input
+    base := *offsetFlag
+    offsetLabel := "explicit -offset"
+    if *presetFlag != "" {
+        p := findPreset(*presetFlag)
+        if p == nil {
+            log.Fatalf("unknown preset %q", *presetFlag)
+        }
+        if off, ok := p.probe(f); ok {
+            base = off
+            offsetLabel = fmt.Sprintf("%s, from superblock", p.name)
+        } else {
+            base = p.defaultOffset
+            offsetLabel = fmt.Sprintf("%s, assumed default (no superblock found)", p.name)
+        }
+        if *offsetFlag != 0 {
+            base = *offsetFlag
+            offsetLabel = fmt.Sprintf("%s, overridden by -offset", p.name)
+        }
+    }
+    if base < 0 {
+        log.Fatalf("invalid offset %d", base)
+    }
 
-    var hdrBuf []byte
-    var partBuf []byte
+    // a damaged header or entry array is still shown, the calculated CRCs
+    // next to the stored ones; only one that cannot be read stops here
+    opts := []gpt.Option{gpt.WithOffset(base), gpt.WithSectorSize(SECTOR_SIZE), gpt.WithMaxTableBytes(maxTableBytes)}
+    hdr, err := gpt.ReadHeader(f, opts...)
+    if errors.Is(err, gpt.ErrSignature) {
+        // no GPT: a disk still partitioned the old way is reported
+        mbr := make([]byte, SECTOR_SIZE)
+        readAtOrFail(f, mbr, base)
+        if parts, ok := gpt.ParseMBR(mbr); ok && len(parts) > 0 && gpt.ProtectiveRecord(mbr) < 0 {
+            if *jsonFlag || *partedFlag || *partxFlag || *porcelainFlag || *outputFlag != "" {
+                log.Fatalf("%s is an MBR-partitioned disk with no GPT; sgdisk --mbrtogpt (or gdisk) converts it", path)
+            }
+            printMBR(path, parts)
+            return
+        }
+    }
+    if hdr == nil && *backupFlag {
+        // with the primary gone, the backup in the last sector may be all
+        // there is
+        fmt.Printf("Primary GPT header:                                             unreadable (%v)\n", err)
+        if end, serr := f.Seek(0, io.SeekEnd); serr == nil && end-base >= 2*SECTOR_SIZE {
+            last := uint64((end-base)/SECTOR_SIZE) - 1
+            printBackup(f, nil, nil, last, last, opts)
+        }
+        os.Exit(1)
+    }
+    if hdr == nil || errors.Is(err, gpt.ErrHeaderSize) {
+        log.Fatalf("read header: %v", err)
+    }
 
+    var entries []gpt.Entry
+    arrayOff := base + int64(hdr.PartitionTableLBA)*SECTOR_SIZE
     // If input file is exactly 16896 bytes treat as GPT header+partition-array blob
-    if fi.Mode().IsRegular() && fi.Size() == 16896 {
+    if base == 0 && fi.Mode().IsRegular() && fi.Size() == 16896 {
         all := make([]byte, fi.Size())
         readAtOrFail(f, all, 0)
-        hdrBuf = make([]byte, SECTOR_SIZE)
-        copy(hdrBuf, all[SECTOR_SIZE:2*SECTOR_SIZE])
-        partBuf = make([]byte, 128*128)
-        copy(partBuf, all[2*SECTOR_SIZE:])
-    } else {
-        // read header at LBA 1
-        hdrBuf = make([]byte, SECTOR_SIZE)
-        readAtOrFail(f, hdrBuf, SECTOR_SIZE)
-        var hdr GPTHeader
-        if err := binary.Read(bytes.NewReader(hdrBuf), binary.LittleEndian, &hdr); err != nil {
-            log.Fatalf("decode header: %v", err)
+        // the array follows the header, whatever LBA the header names
+        arrayOff = 2 * SECTOR_SIZE
+        entries, err = gpt.ParseEntryArray(all[arrayOff:], int(hdr.PartitionEntrySize))
+        if err != nil {
+            log.Fatalf("decode partition entries: %v", err)
         }
-        tableSize := int64(hdr.NumPartitions) * int64(hdr.PartitionEntrySize)
-        if tableSize == 0 {
-            // fallback to common 128 entries * 128 bytes
-            tableSize = 128 * 128
+    } else {
+        entries, err = gpt.ReadEntries(f, hdr, opts...)
+        if entries == nil {
+            log.Fatalf("read partition entries: %v", err)
         }
-        partBuf = make([]byte, tableSize)
-        partOffset := int64(hdr.PartitionTableLBA) * SECTOR_SIZE
-        readAtOrFail(f, partBuf, partOffset)
     }
 
-    // decode header
-    var hdr GPTHeader
-    if err := binary.Read(bytes.NewReader(hdrBuf), binary.LittleEndian, &hdr); err != nil {
-        log.Fatalf("decode header: %v", err)
-    }
+    calcHdrCRC := hdr.ComputeCRC()
+    calcTableCRC := (&gpt.Table{Header: *hdr, Entries: entries}).ComputeArrayCRC()
 
-    // recalc header CRC
-    origHdrCRC := hdr.HeaderCRC32
-    hdrForCRC := make([]byte, hdr.HeaderSize)
-    copy(hdrForCRC, hdrBuf[:hdr.HeaderSize])
-    for i := 16; i < 20; i++ {
-        hdrForCRC[i] = 0
+    switch *outputFlag {
+    case "":
+    case "export":
+        printExport(f, fi, path, base, hdr, entries, only)
+        return
+    default:
+        log.Fatalf("unknown -output %q", *outputFlag)
+    }
+    if *hexdumpFlag {
+        printHexdump(f, base, hdr, entries, arrayOff)
+        return
     }
-    calcHdrCRC := crc32.ChecksumIEEE(hdrForCRC)
-
-    // calc partition array CRC
-    calcTableCRC := crc32.ChecksumIEEE(partBuf)
-
-    // print header info (preserve spacing/format)
-    fmt.Printf("Signature:                                              0x%s\n", hex.EncodeToString(hdr.Signature[:]))
-    fmt.Printf("Revision:                                                       0x%08x\n", hdr.Revision)
-    fmt.Printf("HeaderSize:                                                             %d\n", hdr.HeaderSize)
-    fmt.Printf("HeaderCRC32:                                                    0x%08x\n", origHdrCRC)
-    fmt.Printf("HeaderCRC32 (calculated):                                       0x%08x\n", calcHdrCRC)
-    fmt.Printf("Reserved:                                                       0x%08x\n", hdr.Reserved)
-    fmt.Printf("MyLBA:                                                                   %d\n", hdr.CurrentLBA)
-    fmt.Printf("AlternateLBA:                                                      %d\n", hdr.BackupLBA)
-    fmt.Printf("FirstUsableLBA:                                                         %d\n", hdr.FirstUsableLBA)
-    fmt.Printf("LastUsableLBA:                                                     %d\n", hdr.LastUsableLBA)
-    fmt.Printf("PartitionEntryLBA:                                                       %d\n", hdr.PartitionTableLBA)
-    fmt.Printf("NumberOfPartitionEntries:                                              %d\n", hdr.NumPartitions)
-    fmt.Printf("SizeOfPartitionEntry:                                                  %d\n", hdr.PartitionEntrySize)
-    fmt.Printf("PartitionEntryArrayCRC32:                                       0x%08x\n", hdr.PartitionTableCRC)
-    fmt.Printf("PartitionEntryArrayCRC32 (calculated):                          0x%08x\n", calcTableCRC)
-    fmt.Printf("\n############################################################################################\n")
 
-    entrySize := int(hdr.PartitionEntrySize)
-    if entrySize == 0 {
-        entrySize = 128
+    if *porcelainFlag {
+        mask := map[string]bool{}
+        for _, m := range strings.Split(*maskFlag, ",") {
+            switch m = strings.TrimSpace(m); m {
+            case "":
+            case "guids", "crcs", "source":
+                mask[m] = true
+            default:
+                log.Fatalf("unknown -mask value %q", m)
+            }
+        }
+        mbr := make([]byte, gpt.BootCodeSize)
+        readAtOrFail(f, mbr, base)
+        printPorcelain(path, base, hdr, calcHdrCRC, calcTableCRC, entries, gpt.BootCodeSum(mbr), only, mask, *bytesFlag)
+        return
     }
-    num := int(hdr.NumPartitions)
-    if num == 0 {
-        num = (len(partBuf) / entrySize)
+
+    if *partxFlag {
+        printPartx(base, hdr, entries, only, *columnsFlag, !*noHeadingsFlag)
+        return
     }
 
-    for i := 0; i < num; i++ {
-        offset := i * entrySize
-        if offset+entrySize > len(partBuf) {
-            break
+    if *partedFlag {
+        if _, ok := partedUnitSizes[*unitFlag]; !ok && *unitFlag != "compact" && *unitFlag != "B" && *unitFlag != "s" {
+            log.Fatalf("unknown unit %q", *unitFlag)
         }
-        var e GPTEntry
-        if err := binary.Read(bytes.NewReader(partBuf[offset:offset+entrySize]), binary.LittleEndian, &e); err != nil {
-            break
+        printParted(f, path, base, hdr, entries, only, *unitFlag)
+        return
+    }
+
+    if *treeFlag {
+        root := &treeNode{name: filepath.Base(path), fstype: "gpt", uuid: hdr.DiskGUID.String()}
+        if end, err := f.Seek(0, io.SeekEnd); err == nil {
+            root.size = end - base
         }
-        // skip empty partition entries
-        empty := true
-        for _, b := range e.PartitionTypeGUID {
-            if b != 0 {
-                empty = false
-                break
+        for _, n := range gptTree(f, base, hdr, entries, 0) {
+            if only < 0 || n.index == only {
+                root.children = append(root.children, n)
             }
         }
-        if empty {
+        fmt.Printf("%-36s %-18s %-8s %-16s %s\n", "NAME", "FSTYPE", "SIZE", "LABEL", "UUID")
+        printTree(root, "", true, true)
+        return
+    }
+
+    if *jsonFlag {
+        offsetSource := ""
+        if base != 0 || *presetFlag != "" {
+            offsetSource = offsetLabel
+        }
+        printJSON(f, path, base, offsetSource, hdr, calcHdrCRC, calcTableCRC, entries, only)
+        return
+    }
+
+    if *mbrFlag {
+        printMBRSection(f, base, hdr, entries)
+    } else {
+        warnMBR(f, base)
+    }
+
+    // print header info (preserve spacing/format)
+    if base != 0 || *presetFlag != "" {
+        fmt.Printf("Offset:                                                          %d\n", base)
+        fmt.Printf("Offset (syn):                                 %s\n", offsetLabel)
+    }
+    printHeaderFields(hdr, calcTableCRC)
+    fmt.Printf("\n############################################################################################\n")
+
+    entrySize := int(hdr.PartitionEntrySize)
+    for i, e := range entries {
+        if e.IsEmpty() || (only >= 0 && i != only) {
             continue
         }
 
-        ptHex := guidBytesToHex(e.PartitionTypeGUID)
-        ptSyn := formatGUID(e.PartitionTypeGUID)
-        ptName := lookupTypeName(ptSyn)
-        ugHex := guidBytesToHex(e.UniqueGUID)
-        ugSyn := formatGUID(e.UniqueGUID)
+        ptHex := e.PartitionTypeGUID.Hex()
+        ptSyn := e.PartitionTypeGUID.String()
+        ptName := gpt.TypeName(e.PartitionTypeGUID)
+        ugHex := e.UniqueGUID.Hex()
+        ugSyn := e.UniqueGUID.String()
         start := e.StartingLBA
         end := e.EndingLBA
         attr := e.Attributes
-        nameStr := utf16leNameToString(e.PartitionName)
+        nameStr := e.Name()
 
         fmt.Printf("\n<<< GPT Partition Entry #%d >>>\n", i)
         fmt.Printf("#%d.PartitionTypeGUID:                   0x%s\n", i, ptHex)
@@ -302,13 +1420,201 @@ func main() {
         fmt.Printf("#%d.UniquePartitionGUID (syn):         %s\n", i, ugSyn)
         fmt.Printf("#%d.StartingLBA:                                                     %d\n", i, start)
         fmt.Printf("#%d.EndingLBA:                                                       %d\n", i, end)
+        if *bytesFlag {
+            fmt.Printf("#%d.StartingByte:                                                    %d\n", i, startByte(base, e))
+            fmt.Printf("#%d.EndingByte:                                                      %d\n", i, endByte(base, e))
+        }
         fmt.Printf("#%d.Attributes:                                                         0x%x\n", i, attr)
         attrList := []string{}
-        // (optional) decode known attribute bits into readable list - left empty for brevity
+        if attr&(1<<0) != 0 {
+            attrList = append(attrList, "platform-required")
+        }
+        if attr&(1<<1) != 0 {
+            // firmware produces no block I/O for the partition: an ESP with
+            // this bit is invisible to the boot manager
+            attrList = append(attrList, "efi-ignore")
+        }
+        if attr&(1<<2) != 0 {
+            attrList = append(attrList, "legacy-bios-bootable")
+        }
         fmt.Printf("#%d.Attributes (syn):                                                    [%s]\n", i, strings.Join(attrList, ","))
         fmt.Printf("#%d.PartitionName (syn):                               %s\n", i, nameStr)
+        if t, err := fsinfo.ReadTimes(f, startByte(base, e)); err == nil {
+            // what the superblock recorded of the filesystem's use, for
+            // triage without mounting it
+            for _, v := range []struct {
+                label string
+                t     time.Time
+            }{
+                {"Created", t.Created},
+                {"LastMount", t.LastMount},
+                {"LastWrite", t.LastWrite},
+                {"LastCheck", t.LastCheck},
+            } {
+                if !v.t.IsZero() {
+                    fmt.Printf("#%d.%-36s%s\n", i, v.label+" ("+t.Type+"):", v.t.Format(time.RFC3339))
+                }
+            }
+            fmt.Printf("#%d.%-36s%d\n", i, "MountCount ("+t.Type+"):", t.MountCount)
+            if t.LastMountedOn != "" {
+                fmt.Printf("#%d.%-36s%s\n", i, "LastMountedOn ("+t.Type+"):", t.LastMountedOn)
+            }
+        }
+        if entrySize > 128 {
+            // entries of 128 × 2^n bytes carry vendor data past the defined fields
+            tail := make([]byte, entrySize-128)
+            copy(tail, e.Extra)
+            if bytes.Count(tail, []byte{0}) == len(tail) {
+                fmt.Printf("#%d.VendorBytes:                                       %d bytes, all zero\n", i, len(tail))
+            } else {
+                fmt.Printf("#%d.VendorBytes:                                       %d bytes at entry offset 128\n", i, len(tail))
+                for _, l := range strings.Split(strings.TrimRight(hex.Dump(tail), "\n"), "\n") {
+                    fmt.Printf("    %s\n", l)
+                }
+            }
+        }
     }
 
     fmt.Printf("\n<<< Calculated >>>\nPartitionEntryArrayCRC32 (calculated):                          0x%08x\n", calcTableCRC)
+    if *backupFlag {
+        lastLBA := uint64(0)
+        if end, err := f.Seek(0, io.SeekEnd); err == nil && end-base >= 2*SECTOR_SIZE {
+            lastLBA = uint64((end-base)/SECTOR_SIZE) - 1
+        }
+        printBackup(f, hdr, entries, hdr.BackupLBA, lastLBA, opts)
+    }
+}
+
+// printHexdump prints the primary header and the used entries byte by
+// byte, one field of gpt.FieldLayout per line with its name and value, so
+// a damaged table can be read field by field.
+func printHexdump(f diskImage, base int64, hdr *gpt.Header, entries []gpt.Entry, arrayOff int64) {
+    size := int64(hdr.HeaderSize)
+    if size < gpt.MinHeaderSize || size > SECTOR_SIZE {
+        size = gpt.MinHeaderSize
+    }
+    b := make([]byte, size)
+    readAtOrFail(f, b, base+SECTOR_SIZE)
+    fmt.Printf("<<< GPT header, LBA 1, byte %d >>>\n", base+SECTOR_SIZE)
+    printFieldBytes(b, false)
+    if len(b) > gpt.MinHeaderSize {
+        printHexLines(b[gpt.MinHeaderSize:], gpt.MinHeaderSize, "(past the defined fields)")
+    }
+    es := int64(hdr.PartitionEntrySize)
+    e := make([]byte, es)
+    for i := range entries {
+        if entries[i].IsEmpty() {
+            continue
+        }
+        off := arrayOff + int64(i)*es
+        readAtOrFail(f, e, off)
+        fmt.Printf("\n<<< #%d, byte %d >>>\n", i, off)
+        printFieldBytes(e, true)
+        if es > gpt.EntrySize {
+            printHexLines(e[gpt.EntrySize:], gpt.EntrySize, "(vendor bytes)")
+        }
+    }
+}
+
+// printFieldBytes prints the header or entry fields of b.
+func printFieldBytes(b []byte, entry bool) {
+    for _, fl := range gpt.FieldLayout() {
+        if fl.Entry != entry {
+            continue
+        }
+        raw, _ := fl.Bytes(b)
+        val, _ := fl.Format(b)
+        printHexLines(raw, fl.Offset, fmt.Sprintf("%-24s  %s", fl.Name, val))
+    }
+}
+
+// printHexLines prints b, found at offset off, 16 bytes a line, with label
+// after the first.
+func printHexLines(b []byte, off int, label string) {
+    for k := 0; k < len(b); k += 16 {
+        chunk := b[k:min(k+16, len(b))]
+        if k == 0 {
+            fmt.Printf("  0x%03x  %-47s  %s\n", off+k, fmt.Sprintf("% x", chunk), label)
+        } else {
+            fmt.Printf("  0x%03x  % x\n", off+k, chunk)
+        }
+    }
+}
+
+// printHeaderFields prints the fields of a GPT header with the calculated
+// CRCs next to the stored ones; arrayCRC is that of the entry array read.
+func printHeaderFields(hdr *gpt.Header, arrayCRC uint32) {
+    fmt.Printf("Signature:                                              0x%s\n", hex.EncodeToString(hdr.Signature[:]))
+    fmt.Printf("Revision:                                                       0x%08x\n", hdr.Revision)
+    fmt.Printf("HeaderSize:                                                             %d\n", hdr.HeaderSize)
+    fmt.Printf("HeaderCRC32:                                                    0x%08x\n", hdr.HeaderCRC32)
+    fmt.Printf("HeaderCRC32 (calculated):                                       0x%08x\n", hdr.ComputeCRC())
+    fmt.Printf("Reserved:                                                       0x%08x\n", hdr.Reserved)
+    fmt.Printf("MyLBA:                                                                   %d\n", hdr.CurrentLBA)
+    fmt.Printf("AlternateLBA:                                                      %d\n", hdr.BackupLBA)
+    fmt.Printf("FirstUsableLBA:                                                         %d\n", hdr.FirstUsableLBA)
+    fmt.Printf("LastUsableLBA:                                                     %d\n", hdr.LastUsableLBA)
+    fmt.Printf("PartitionEntryLBA:                                                       %d\n", hdr.PartitionTableLBA)
+    fmt.Printf("NumberOfPartitionEntries:                                              %d\n", hdr.NumPartitions)
+    fmt.Printf("SizeOfPartitionEntry:                                                  %d\n", hdr.PartitionEntrySize)
+    fmt.Printf("PartitionEntryArrayCRC32:                                       0x%08x\n", hdr.PartitionTableCRC)
+    fmt.Printf("PartitionEntryArrayCRC32 (calculated):                          0x%08x\n", arrayCRC)
+}
+
+// printBackup reads the backup header at AlternateLBA, or in the last
+// sector (lastLBA) when there is none there, prints it with its entry
+// array's CRC and says whether it agrees with the primary, which is nil
+// when the primary could not be read.
+func printBackup(f diskImage, primary *gpt.Header, primaryEntries []gpt.Entry, altLBA, lastLBA uint64, opts []gpt.Option) {
+    fmt.Printf("\n############################################################################################\n")
+    fmt.Printf("\n<<< Backup GPT Header >>>\n")
+    hdr, err := gpt.ReadHeaderAt(f, altLBA, opts...)
+    if hdr == nil && lastLBA != 0 && lastLBA != altLBA {
+        fmt.Printf("No backup header at AlternateLBA %d (%v); trying the last LBA %d\n", altLBA, err, lastLBA)
+        hdr, err = gpt.ReadHeaderAt(f, lastLBA, opts...)
+    }
+    if hdr == nil {
+        fmt.Printf("Backup header:                                                  unreadable (%v)\n", err)
+        return
+    }
+    var entries []gpt.Entry
+    arrayCRC := uint32(0)
+    var arrayErr error
+    if !errors.Is(err, gpt.ErrHeaderSize) {
+        entries, arrayErr = gpt.ReadEntries(f, hdr, opts...)
+        if entries != nil {
+            arrayCRC = (&gpt.Table{Header: *hdr, Entries: entries}).ComputeArrayCRC()
+        }
+    }
+    printHeaderFields(hdr, arrayCRC)
+
+    var problems []string
+    if err != nil {
+        problems = append(problems, err.Error())
+    }
+    if arrayErr != nil {
+        problems = append(problems, arrayErr.Error())
+    }
+    if hdr.IsPrimary() {
+        problems = append(problems, fmt.Sprintf("MyLBA %d is that of a primary header", hdr.CurrentLBA))
+    }
+    if len(problems) == 0 {
+        fmt.Printf("Backup (syn):                                                   valid\n")
+    } else {
+        fmt.Printf("Backup (syn):                                                   damaged\n")
+        for _, p := range problems {
+            fmt.Printf("    %s\n", p)
+        }
+    }
+    if primary == nil {
+        return
+    }
+    agree := "yes"
+    if cerr := gpt.CompareCopies(&gpt.Table{Header: *primary, Entries: primaryEntries}, &gpt.Table{Header: *hdr, Entries: entries}); cerr != nil {
+        agree = "no, " + strings.TrimPrefix(cerr.Error(), "gpt: ")
+    } else if entries != nil && primaryEntries != nil && !slices.EqualFunc(primaryEntries, entries, gpt.Entry.Equal) {
+        agree = "no, the entry arrays differ"
+    }
+    fmt.Printf("Primary and backup agree (syn):                                 %s\n", agree)
 }
 
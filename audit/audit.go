@@ -0,0 +1,247 @@
+// Package audit records every modification the tools make to a disk as a
+// structured, append-only log entry: who did what to which device, the header
+// and array CRCs before and after, per-entry differences and each write.
+package audit
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/journald"
+)
+
+// CRCs are the stored checksums of both GPT copies.
+type CRCs struct {
+	PrimaryHeader uint32 `json:"primary_header_crc32"`
+	PrimaryArray  uint32 `json:"primary_array_crc32"`
+	BackupHeader  uint32 `json:"backup_header_crc32"`
+	BackupArray   uint32 `json:"backup_array_crc32"`
+}
+
+// EntryChange is one field of one partition entry that changed.
+type EntryChange struct {
+	Index int    `json:"index"`
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Write is one region written to the device.
+type Write struct {
+	Purpose string `json:"purpose"`
+	LBA     uint64 `json:"lba"`
+	Sectors uint64 `json:"sectors"`
+	OldSum  string `json:"old_sha256"`
+	NewSum  string `json:"new_sha256"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Record is a single audit log entry.
+type Record struct {
+	Time      time.Time     `json:"time"`
+	User      string        `json:"user"`
+	SudoUser  string        `json:"sudo_user,omitempty"`
+	Host      string        `json:"host"`
+	PID       int           `json:"pid"`
+	Command   []string      `json:"command"`
+	Device    string        `json:"device"`
+	Operation string        `json:"operation"`
+	Before    CRCs          `json:"before"`
+	After     CRCs          `json:"after"`
+	Entries   []EntryChange `json:"entries,omitempty"`
+	Writes    []Write       `json:"writes"`
+	Error     string        `json:"error,omitempty"`
+
+	before *gpt.Table
+}
+
+// Begin starts a record for operation on disk, capturing its current state.
+func Begin(disk *gpt.Disk, operation string) *Record {
+	r := NewRecord(disk.Path, operation)
+	r.Before = crcsOf(disk.Primary, disk.Backup)
+	if t := disk.Table(); t != nil {
+		r.before = t.Clone()
+	}
+	return r
+}
+
+// NewRecord starts a record for operation on a device that has no readable
+// GPT yet, such as a blank image about to be partitioned.
+func NewRecord(path, operation string) *Record {
+	r := &Record{
+		Time:      time.Now().UTC(),
+		SudoUser:  os.Getenv("SUDO_USER"),
+		PID:       os.Getpid(),
+		Command:   os.Args,
+		Device:    path,
+		Operation: operation,
+		Writes:    []Write{},
+	}
+	if u, err := user.Current(); err == nil {
+		r.User = u.Username
+	} else {
+		r.User = fmt.Sprint(os.Getuid())
+	}
+	r.Host, _ = os.Hostname()
+	if abs, err := filepath.Abs(path); err == nil {
+		r.Device = abs
+	}
+	return r
+}
+
+func crcsOf(primary, backup *gpt.Table) CRCs {
+	var c CRCs
+	if primary != nil {
+		c.PrimaryHeader, c.PrimaryArray = primary.Header.HeaderCRC32, primary.Header.PartitionTableCRC
+	}
+	if backup != nil {
+		c.BackupHeader, c.BackupArray = backup.Header.HeaderCRC32, backup.Header.PartitionTableCRC
+	}
+	return c
+}
+
+// Wrap wraps dev so every write made through it is added to the record.
+func (r *Record) Wrap(dev gpt.Device) gpt.Device {
+	return gpt.WithHooks(dev, gpt.Hooks{
+		AfterWrite: func(ev *gpt.WriteEvent, err error) {
+			w := Write{
+				Purpose: ev.Purpose,
+				LBA:     ev.LBA,
+				Sectors: ev.Sectors,
+				OldSum:  hex.EncodeToString(ev.OldSum[:]),
+				NewSum:  hex.EncodeToString(ev.NewSum[:]),
+				Skipped: ev.Skipped,
+			}
+			if err != nil {
+				w.Error = err.Error()
+			}
+			r.Writes = append(r.Writes, w)
+		},
+	})
+}
+
+// End completes the record with the table that was written (either copy)
+// and the outcome of the operation.
+func (r *Record) End(after *gpt.Table, err error) {
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if after == nil {
+		return
+	}
+	primary, backup := after, after.Alternate()
+	if !after.Header.IsPrimary() {
+		primary, backup = backup, after
+	}
+	r.After = crcsOf(primary, backup)
+	r.Entries = DiffEntries(r.before, after)
+}
+
+// DiffEntries lists the entry fields that differ between two tables.
+func DiffEntries(before, after *gpt.Table) []EntryChange {
+	if before == nil || after == nil {
+		return nil
+	}
+	var out []EntryChange
+	n := max(len(before.Entries), len(after.Entries))
+	for i := 0; i < n; i++ {
+		var a, b gpt.Entry
+		if i < len(before.Entries) {
+			a = before.Entries[i]
+		}
+		if i < len(after.Entries) {
+			b = after.Entries[i]
+		}
+		if a.Equal(b) {
+			continue
+		}
+		add := func(field, old, new string) {
+			if old != new {
+				out = append(out, EntryChange{Index: i, Field: field, Old: old, New: new})
+			}
+		}
+		add("type_guid", a.PartitionTypeGUID.String(), b.PartitionTypeGUID.String())
+		add("unique_guid", a.UniqueGUID.String(), b.UniqueGUID.String())
+		add("starting_lba", fmt.Sprint(a.StartingLBA), fmt.Sprint(b.StartingLBA))
+		add("ending_lba", fmt.Sprint(a.EndingLBA), fmt.Sprint(b.EndingLBA))
+		add("attributes", fmt.Sprintf("0x%x", a.Attributes), fmt.Sprintf("0x%x", b.Attributes))
+		add("name", a.Name(), b.Name())
+		add("extra", hex.EncodeToString(a.Extra), hex.EncodeToString(b.Extra))
+	}
+	return out
+}
+
+// Log is an append-only destination for records.
+type Log interface {
+	Append(*Record) error
+	Close() error
+}
+
+// Open returns the log named by dest: "journald" for the systemd journal,
+// anything else is a file path that records are appended to as JSON lines.
+func Open(dest string) (Log, error) {
+	if dest == "journald" {
+		if !journald.Available() {
+			return nil, fmt.Errorf("audit: journald socket %s not found", journald.SocketPath)
+		}
+		return journalLog{}, nil
+	}
+	f, err := os.OpenFile(dest, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("audit: %w", err)
+	}
+	return &fileLog{f: f}, nil
+}
+
+type fileLog struct {
+	f *os.File
+}
+
+func (l *fileLog) Append(r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	return l.f.Sync()
+}
+
+func (l *fileLog) Close() error {
+	return l.f.Close()
+}
+
+type journalLog struct{}
+
+func (journalLog) Append(r *Record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	pri := journald.PriNotice
+	msg := fmt.Sprintf("%s on %s by %s", r.Operation, r.Device, r.User)
+	if r.Error != "" {
+		pri = journald.PriErr
+		msg += " failed: " + r.Error
+	}
+	return journald.Send(pri, msg, map[string]string{
+		"SYSLOG_IDENTIFIER": filepath.Base(os.Args[0]),
+		"GPT_AUDIT":         "1",
+		"GPT_DEVICE":        r.Device,
+		"GPT_OPERATION":     r.Operation,
+		"GPT_USER":          r.User,
+		"GPT_RECORD":        string(b),
+	})
+}
+
+func (journalLog) Close() error {
+	return nil
+}
@@ -0,0 +1,6 @@
+// Package blob reads disk images from browser Blobs and Files when built
+// for js/wasm, so a web page can inspect an image the user picked with the
+// same code as the command line tools, without uploading it anywhere.
+//
+// Outside of js/wasm the package is empty.
+package blob
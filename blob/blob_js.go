@@ -0,0 +1,68 @@
+package blob
+
+import (
+	"errors"
+	"io"
+	"syscall/js"
+)
+
+// Reader reads a JavaScript Blob (a File is one) through Blob.slice and
+// arrayBuffer, fetching only the byte ranges asked for. Reads block until
+// the browser delivers the data, so they must not happen on the event
+// loop's goroutine: call into the library from a new goroutine.
+type Reader struct {
+	v    js.Value
+	size int64
+}
+
+// NewReader wraps the Blob v.
+func NewReader(v js.Value) (*Reader, error) {
+	if v.Type() != js.TypeObject || v.Get("slice").Type() != js.TypeFunction {
+		return nil, errors.New("blob: not a Blob or File")
+	}
+	return &Reader{v: v, size: int64(v.Get("size").Float())}, nil
+}
+
+// Size is the size of the Blob in bytes.
+func (r *Reader) Size() int64 { return r.size }
+
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("blob: negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), r.size)
+	buf, err := await(r.v.Call("slice", off, end).Call("arrayBuffer"))
+	if err != nil {
+		return 0, err
+	}
+	n := js.CopyBytesToGo(p, js.Global().Get("Uint8Array").New(buf))
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// await blocks until the Promise p settles.
+func await(p js.Value) (js.Value, error) {
+	type result struct {
+		v   js.Value
+		err error
+	}
+	ch := make(chan result, 1)
+	onOK := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		ch <- result{v: args[0]}
+		return nil
+	})
+	defer onOK.Release()
+	onErr := js.FuncOf(func(_ js.Value, args []js.Value) any {
+		ch <- result{err: errors.New("blob: " + args[0].Call("toString").String())}
+		return nil
+	})
+	defer onErr.Release()
+	p.Call("then", onOK, onErr)
+	res := <-ch
+	return res.v, res.err
+}
@@ -0,0 +1,224 @@
+// Package ceph recognises the partitions ceph-disk created for Ceph OSDs
+// and works out which OSD each one belongs to, so disks holding OSD data,
+// journals and BlueStore block, DB and WAL partitions can be audited
+// together. OSDs deployed by ceph-volume live on LVM and carry none of
+// these partition types.
+//
+// The OSD of a partition is found from what ceph-disk leaves behind: the
+// data partition's unique GUID is the OSD's UUID, BlueStore devices start
+// with a label naming it, and a FileStore journal's header records it.
+// Encrypted partitions keep theirs behind dm-crypt and cannot be assigned.
+package ceph
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// Kinds of Ceph partition.
+const (
+	Data     = "data"
+	Journal  = "journal"
+	Block    = "block"
+	BlockDB  = "block.db"
+	BlockWAL = "block.wal"
+	Lockbox  = "lockbox"
+	Creating = "creating" // ceph-disk had not finished preparing it
+)
+
+// Role is what a Ceph partition type says about the partition.
+type Role struct {
+	Kind string
+	// Encryption is "", "dm-crypt" (plain) or "luks".
+	Encryption string
+	Multipath  bool
+}
+
+func (r Role) String() string {
+	s := r.Kind
+	if r.Encryption != "" {
+		s += " (" + r.Encryption + ")"
+	}
+	if r.Multipath {
+		s += " (multipath)"
+	}
+	return s
+}
+
+var roles = map[string]Role{
+	"4fbd7e29-9d25-41b8-afd0-062c0ceff05d": {Kind: Data},
+	"4fbd7e29-9d25-41b8-afd0-5ec00ceff05d": {Kind: Data, Encryption: "dm-crypt"},
+	"4fbd7e29-9d25-41b8-afd0-35865ceff05d": {Kind: Data, Encryption: "luks"},
+	"4fbd7e29-8ae0-4982-bf9d-5a8d867af560": {Kind: Data, Multipath: true},
+	"45b0969e-9b03-4f30-b4c6-b4b80ceff106": {Kind: Journal},
+	"45b0969e-9b03-4f30-b4c6-5ec00ceff106": {Kind: Journal, Encryption: "dm-crypt"},
+	"45b0969e-9b03-4f30-b4c6-35865ceff106": {Kind: Journal, Encryption: "luks"},
+	"45b0969e-8ae0-4982-bf9d-5a8d867af560": {Kind: Journal, Multipath: true},
+	"cafecafe-9b03-4f30-b4c6-b4b80ceff106": {Kind: Block},
+	"cafecafe-9b03-4f30-b4c6-5ec00ceff106": {Kind: Block, Encryption: "dm-crypt"},
+	"cafecafe-9b03-4f30-b4c6-35865ceff106": {Kind: Block, Encryption: "luks"},
+	"cafecafe-8ae0-4982-bf9d-5a8d867af560": {Kind: Block, Multipath: true},
+	"7f4a666a-16f3-47a2-8445-152ef4d03f6c": {Kind: Block, Multipath: true},
+	"30cd0809-c2b2-499c-8879-2d6b78529876": {Kind: BlockDB},
+	"93b0052d-02d9-4d8a-a43b-33a3ee4dfbc3": {Kind: BlockDB, Encryption: "dm-crypt"},
+	"166418da-c469-4022-adf4-b30afd37f176": {Kind: BlockDB, Encryption: "luks"},
+	"ec6d6385-e346-45dc-be91-da2a7c8b3261": {Kind: BlockDB, Multipath: true},
+	"5ce17fce-4087-4169-b7ff-056cc58473f9": {Kind: BlockWAL},
+	"306e8683-4fe2-4330-b7c0-00a917c16966": {Kind: BlockWAL, Encryption: "dm-crypt"},
+	"86a32090-3647-40b9-bbbd-38d8c573aa86": {Kind: BlockWAL, Encryption: "luks"},
+	"01b41e1b-002a-453c-9f17-88793989ff8f": {Kind: BlockWAL, Multipath: true},
+	"fb3aabf9-d25f-47cc-bf5e-721d1816496b": {Kind: Lockbox},
+	"89c57f98-2fe5-4dc0-89c1-f3ad0ceff2be": {Kind: Creating},
+	"89c57f98-2fe5-4dc0-89c1-5ec00ceff2be": {Kind: Creating, Encryption: "dm-crypt"},
+}
+
+// RoleOf returns the role of a Ceph partition type.
+func RoleOf(typ gpt.GUID) (Role, bool) {
+	r, ok := roles[typ.String()]
+	return r, ok
+}
+
+// bluestoreMagic starts the label of every BlueStore device, followed by
+// the OSD UUID and a newline.
+const bluestoreMagic = "bluestore block device\n"
+
+// BlueStoreOSD returns the OSD UUID in the BlueStore label at byte offset
+// off of r.
+func BlueStoreOSD(r io.ReaderAt, off int64) (string, bool) {
+	b := make([]byte, len(bluestoreMagic)+37)
+	if _, err := r.ReadAt(b, off); err != nil || !bytes.HasPrefix(b, []byte(bluestoreMagic)) {
+		return "", false
+	}
+	id := b[len(bluestoreMagic):]
+	if id[36] != '\n' {
+		return "", false
+	}
+	g, err := gpt.ParseGUID(string(id[:36]))
+	if err != nil {
+		return "", false
+	}
+	return g.String(), true
+}
+
+// JournalOSD returns the OSD UUID in the FileStore journal header at byte
+// offset off of r: an encoded header_t (version, compat version, length)
+// whose fsid follows the 32-bit flags.
+func JournalOSD(r io.ReaderAt, off int64) (string, bool) {
+	b := make([]byte, 26)
+	if _, err := r.ReadAt(b, off); err != nil {
+		return "", false
+	}
+	if b[0] == 0 || b[1] == 0 || b[1] > b[0] {
+		return "", false
+	}
+	// ceph's uuid_d is stored in RFC 4122 byte order
+	g := b[10:26]
+	if bytes.Count(g, []byte{0}) == len(g) {
+		return "", false
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", g[0:4], g[4:6], g[6:8], g[8:10], g[10:16]), true
+}
+
+// Member is one Ceph partition of a disk.
+type Member struct {
+	Disk  string
+	Index int // entry index
+	Entry gpt.Entry
+	Size  int64 // in bytes
+	Role  Role
+	// Evidence says how the OSD was found, empty if it was not.
+	Evidence string
+}
+
+// OSD is the partitions belonging to one OSD.
+type OSD struct {
+	UUID    string
+	Members []Member
+}
+
+// Disk is a disk to inspect: its table and a reader addressing it.
+type Disk struct {
+	Name  string
+	Table *gpt.Table
+	R     io.ReaderAt
+}
+
+// Group sorts the Ceph partitions of disks into OSDs, which may span disks
+// (journals and DB devices usually live on a faster one). Partitions whose
+// OSD cannot be told are returned apart.
+func Group(disks []Disk) (osds []OSD, unassigned []Member) {
+	byID := map[string]*OSD{}
+	assign := func(id string, m Member) {
+		o := byID[id]
+		if o == nil {
+			o = &OSD{UUID: id}
+			byID[id] = o
+		}
+		o.Members = append(o.Members, m)
+	}
+	type journal struct {
+		id string
+		m  Member
+	}
+	var journals []journal
+	for _, d := range disks {
+		ss := int64(d.Table.SectorSize)
+		if ss == 0 {
+			ss = gpt.DefaultSectorSize
+		}
+		for _, i := range d.Table.Used() {
+			e := d.Table.Entries[i]
+			role, ok := RoleOf(e.PartitionTypeGUID)
+			if !ok {
+				continue
+			}
+			m := Member{Disk: d.Name, Index: i, Entry: e, Size: int64(e.SizeBytes(int(ss))), Role: role}
+			off := int64(e.StartingLBA) * ss
+			switch {
+			case role.Kind == Data:
+				m.Evidence = "partition GUID"
+				assign(e.UniqueGUID.String(), m)
+				continue
+			case role.Encryption != "":
+			case role.Kind == Block || role.Kind == BlockDB || role.Kind == BlockWAL:
+				if id, ok := BlueStoreOSD(d.R, off); ok {
+					m.Evidence = "BlueStore label"
+					assign(id, m)
+					continue
+				}
+			case role.Kind == Journal:
+				if id, ok := JournalOSD(d.R, off); ok {
+					journals = append(journals, journal{id, m})
+					continue
+				}
+			}
+			unassigned = append(unassigned, m)
+		}
+	}
+	// a journal header's fsid is only trusted when it names an OSD found
+	// otherwise, since the header has no magic of its own
+	for _, j := range journals {
+		if byID[j.id] == nil {
+			unassigned = append(unassigned, j.m)
+			continue
+		}
+		j.m.Evidence = "journal header"
+		assign(j.id, j.m)
+	}
+	for _, o := range byID {
+		sort.SliceStable(o.Members, func(a, b int) bool { return kindOrder(o.Members[a].Role.Kind) < kindOrder(o.Members[b].Role.Kind) })
+		osds = append(osds, *o)
+	}
+	sort.Slice(osds, func(a, b int) bool { return osds[a].UUID < osds[b].UUID })
+	return osds, unassigned
+}
+
+// kindOrder lists an OSD's data partition first, then its devices.
+func kindOrder(kind string) int {
+	return slices.Index([]string{Data, Block, BlockDB, BlockWAL, Journal}, kind)
+}
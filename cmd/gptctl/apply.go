@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+func runApply(args []string) error {
+	fs := newFlagSet("apply", "<disk|image>")
+	layoutPath := fs.String("layout", "", "layout file (JSON) to write")
+	partedPath := fs.String("parted", "", `parted script (mkpart ...) to write, "-" for stdin`)
+	firstUsable := fs.Uint64("first-usable", 0, "keep sectors below this LBA free of partitions (overrides the layout)")
+	size := fs.String("size", "", "create or resize the image file to this size first, e.g. 8GiB")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*layoutPath == "") == (*partedPath == "") || fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a target and one of -layout or -parted are required")
+	}
+	var l *layout.Layout
+	var err error
+	switch {
+	case *layoutPath != "":
+		l, err = layout.Load(*layoutPath)
+	case *partedPath == "-":
+		l, err = layout.ParseParted(os.Stdin)
+	default:
+		var f *os.File
+		if f, err = os.Open(*partedPath); err == nil {
+			l, err = layout.ParseParted(f)
+			f.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if *firstUsable != 0 {
+		l.FirstUsableLBA = *firstUsable
+	}
+	return writeLayout(l, fs.Arg(0), *size, wo, "apply")
+}
+
+// writeLayout partitions path according to l, first resizing it to size
+// when that is set.
+func writeLayout(l *layout.Layout, path, size string, wo *writeOpts, operation string) error {
+	if size != "" {
+		if overlayPath != "" {
+			return errors.New("-size cannot be used with -overlay: the overlay is made for the image's current size")
+		}
+		n, err := layout.ParseSize(size)
+		if err != nil {
+			return err
+		}
+		if err := resizeImage(path, n); err != nil {
+			return err
+		}
+	}
+
+	s, err := wo.open(path, operation)
+	if err != nil {
+		return err
+	}
+	if l.SectorSize == 0 {
+		l.SectorSize = s.SectorSize
+	}
+	b, closeContent, err := l.Builder(s.Size)
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	defer closeContent()
+	t, err := b.ApplyTo(s.Dev)
+	if err = s.finish(t, err); err != nil {
+		return err
+	}
+	ss := uint64(t.SectorSize)
+	fmt.Printf("wrote GPT to %s: disk GUID %s, %d entries, usable %d-%d\n", path, t.Header.DiskGUID, t.Header.NumPartitions, t.Header.FirstUsableLBA, t.Header.LastUsableLBA)
+	for _, i := range t.Used() {
+		e := t.Entries[i]
+		fmt.Printf("  %3d  %12d %12d  %10s  %s\n", i+1, e.StartingLBA, e.EndingLBA, humanBytes(int64(e.Sectors()*ss)), e.Name())
+	}
+	return nil
+}
+
+// resizeImage creates path or changes its size; block devices are left
+// alone since their size is fixed.
+func resizeImage(path string, size int64) error {
+	if fi, err := os.Stat(path); err == nil && !fi.Mode().IsRegular() {
+		return fmt.Errorf("-size only applies to image files, %s is not one", path)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(size); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
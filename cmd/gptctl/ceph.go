@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/ceph"
+	"github.com/cpuuntery/go-code-and-bin/device"
+)
+
+// runCeph lists the Ceph OSD partitions of the disks grouped by OSD, the
+// way a storage operator audits a node.
+func runCeph(args []string) error {
+	fs := newFlagSet("ceph", "[disk|image...]")
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// without explicit disks, look at everything attached
+	paths := fs.Args()
+	if len(paths) == 0 {
+		devs, err := device.List()
+		if err != nil {
+			return err
+		}
+		for _, d := range devs {
+			paths = append(paths, d.Path)
+		}
+	}
+	var disks []ceph.Disk
+	for _, p := range paths {
+		d, err := openDisk(p)
+		if err != nil {
+			if fs.NArg() > 0 {
+				return err
+			}
+			continue // an attached disk without a GPT
+		}
+		defer d.Close()
+		disks = append(disks, ceph.Disk{Name: p, Table: d.Table(), R: d})
+	}
+	osds, unassigned := ceph.Group(disks)
+	if len(osds) == 0 && len(unassigned) == 0 {
+		return errors.New("no Ceph OSD partitions found")
+	}
+
+	if *asJSON {
+		type member struct {
+			Disk       string `json:"disk"`
+			Partition  int    `json:"partition"`
+			Kind       string `json:"kind"`
+			Encryption string `json:"encryption,omitempty"`
+			Multipath  bool   `json:"multipath,omitempty"`
+			PartUUID   string `json:"partuuid"`
+			Name       string `json:"name"`
+			Size       int64  `json:"size"`
+			Evidence   string `json:"evidence,omitempty"`
+		}
+		type osd struct {
+			UUID    string   `json:"osd_uuid"`
+			Members []member `json:"partitions"`
+		}
+		conv := func(ms []ceph.Member) []member {
+			out := []member{}
+			for _, m := range ms {
+				out = append(out, member{
+					Disk: m.Disk, Partition: m.Index + 1, Kind: m.Role.Kind,
+					Encryption: m.Role.Encryption, Multipath: m.Role.Multipath,
+					PartUUID: m.Entry.UniqueGUID.String(), Name: m.Entry.Name(),
+					Size: m.Size, Evidence: m.Evidence,
+				})
+			}
+			return out
+		}
+		doc := struct {
+			OSDs       []osd    `json:"osds"`
+			Unassigned []member `json:"unassigned"`
+		}{OSDs: []osd{}, Unassigned: conv(unassigned)}
+		for _, o := range osds {
+			doc.OSDs = append(doc.OSDs, osd{o.UUID, conv(o.Members)})
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	}
+
+	show := func(m ceph.Member) {
+		line := fmt.Sprintf("  %-20s %4d  %-24s %10s  %-16q", m.Disk, m.Index+1, m.Role, humanBytes(m.Size), m.Entry.Name())
+		if m.Evidence != "" {
+			line += " (" + m.Evidence + ")"
+		}
+		fmt.Println(strings.TrimRight(line, " "))
+	}
+	for _, o := range osds {
+		fmt.Printf("OSD %s\n", o.UUID)
+		for _, m := range o.Members {
+			show(m)
+		}
+	}
+	if len(unassigned) > 0 {
+		fmt.Printf("OSD unknown (encrypted, or no label or header naming it)\n")
+		for _, m := range unassigned {
+			show(m)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/fsinfo"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// paramOpts are the flags choosing the kernel parameters of an image.
+type paramOpts struct {
+	root      int
+	arch      string
+	rootflags string
+	noResume  bool
+}
+
+func addParamFlags(fs *flag.FlagSet) *paramOpts {
+	o := &paramOpts{}
+	fs.IntVar(&o.root, "root", 0, "partition number of the root filesystem (default: found by type or name)")
+	fs.StringVar(&o.arch, "arch", "", "only take a Discoverable Partitions root partition of this GOARCH, e.g. arm64")
+	fs.StringVar(&o.rootflags, "rootflags", "", "mount options for the root filesystem, e.g. subvol=@ for btrfs")
+	fs.BoolVar(&o.noResume, "no-resume", false, "leave out resume= even if there is a swap partition")
+	return o
+}
+
+// runCmdline prints the kernel parameters that boot the root partition of
+// an image: root=PARTUUID=, rootfstype=, rootflags= and resume= for its
+// swap partition, so image builders need not piece them together.
+func runCmdline(args []string) error {
+	fs := newFlagSet("cmdline", "<disk|image>")
+	po := addParamFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one disk or image is required")
+	}
+	d, err := openDisk(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	params, err := po.params(d)
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.Join(params, " "))
+	return nil
+}
+
+// params works out the kernel parameters for d, saying on stderr which
+// partitions it took.
+func (o *paramOpts) params(d *gpt.Disk) ([]string, error) {
+	t := d.Table()
+	root, why, err := findRoot(t, o.root, o.arch)
+	if err != nil {
+		return nil, err
+	}
+	e := t.Entries[root]
+	params := []string{"root=PARTUUID=" + strings.ToLower(e.UniqueGUID.String())}
+	fmt.Fprintf(os.Stderr, "root: partition %d (%q), %s\n", root+1, e.Name(), why)
+	if u, err := fsinfo.Read(d, int64(e.StartingLBA)*int64(d.SectorSize)); err == nil {
+		params = append(params, "rootfstype="+u.Type)
+	} else {
+		fmt.Fprintf(os.Stderr, "note: no filesystem recognised on partition %d, rootfstype= left out\n", root+1)
+	}
+	if o.rootflags != "" {
+		params = append(params, "rootflags="+o.rootflags)
+	}
+	// a root given by PARTUUID may appear after the kernel looks for it,
+	// on USB and MMC in particular
+	params = append(params, "rootwait")
+
+	if !o.noResume {
+		var swaps []int
+		for _, i := range t.Used() {
+			if t.Entries[i].PartitionTypeGUID == gpt.TypeLinuxSwap {
+				swaps = append(swaps, i)
+			}
+		}
+		if len(swaps) > 0 {
+			s := t.Entries[swaps[0]]
+			params = append(params, "resume=PARTUUID="+strings.ToLower(s.UniqueGUID.String()))
+			fmt.Fprintf(os.Stderr, "resume: partition %d (%q)\n", swaps[0]+1, s.Name())
+			if len(swaps) > 1 {
+				fmt.Fprintf(os.Stderr, "note: %d swap partitions, resuming from the first\n", len(swaps))
+			}
+		}
+	}
+	return params, nil
+}
+
+// findRoot picks the root partition: the one numbered n, else a
+// Discoverable Partitions root (of arch, if given), else one named root or
+// rootfs, else the only Linux filesystem partition. why says how it was
+// found.
+func findRoot(t *gpt.Table, n int, arch string) (int, string, error) {
+	if n > 0 {
+		if n > len(t.Entries) || t.Entries[n-1].IsEmpty() {
+			return 0, "", fmt.Errorf("partition %d does not exist", n)
+		}
+		return n - 1, "as given", nil
+	}
+	var want gpt.GUID
+	if arch != "" {
+		g, ok := gpt.RootType(arch)
+		if !ok {
+			return 0, "", fmt.Errorf("no root partition type known for architecture %q", arch)
+		}
+		want = g
+	}
+	rules := []struct {
+		why   string
+		match func(gpt.Entry) bool
+	}{
+		{"of a Discoverable Partitions root type", func(e gpt.Entry) bool {
+			if arch != "" {
+				return e.PartitionTypeGUID == want
+			}
+			_, ok := gpt.RootArch(e.PartitionTypeGUID)
+			return ok
+		}},
+		{"named root", func(e gpt.Entry) bool {
+			name := strings.ToLower(e.Name())
+			return name == "root" || name == "rootfs"
+		}},
+		{"of the Linux filesystem type", func(e gpt.Entry) bool {
+			return e.PartitionTypeGUID == gpt.TypeLinuxFilesystem
+		}},
+	}
+	for _, r := range rules {
+		var found []int
+		for _, i := range t.Used() {
+			if r.match(t.Entries[i]) {
+				found = append(found, i)
+			}
+		}
+		switch {
+		case len(found) == 1:
+			return found[0], r.why, nil
+		case len(found) > 1:
+			var nums []string
+			for _, i := range found {
+				nums = append(nums, fmt.Sprint(i+1))
+			}
+			return 0, "", fmt.Errorf("partitions %s are all %s; pick the root with -root", strings.Join(nums, ", "), r.why)
+		case arch != "":
+			// asked for an architecture: no falling back on names
+			return 0, "", fmt.Errorf("no partition has the %s root type %s", arch, want)
+		}
+	}
+	return 0, "", errors.New("no root partition found; pick one with -root")
+}
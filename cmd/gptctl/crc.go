@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+func runCRC(args []string) error {
+	fs := newFlagSet("crc", "<disk|image|PARTUUID=...>")
+	startLBA := fs.Int64("start-lba", -1, "first sector of the range, relative to the partition for partition targets")
+	count := fs.Int64("count", 0, "number of sectors; 0 runs to the end of the disk or partition")
+	sectorSize := fs.Int("sector-size", 0, "logical sector size (default: that of the GPT, else 512)")
+	expect := fs.String("expect", "", "fail unless the CRC32 equals this value (hex)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	t, err := device.Resolve(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(t.Disk)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	ss := *sectorSize
+	var part *gpt.Entry
+	if d, err := openDisk(t.Disk); err == nil {
+		if ss == 0 {
+			ss = d.SectorSize
+		}
+		if t.Index >= 0 && t.Index < len(d.Table().Entries) {
+			e := d.Table().Entries[t.Index]
+			part = &e
+		}
+		d.Close()
+	}
+	if ss == 0 {
+		ss = gpt.DefaultSectorSize
+	}
+
+	// a partition target makes the range relative to the partition
+	first, last := int64(0), size/int64(ss)-1
+	if part != nil {
+		first, last = int64(part.StartingLBA), int64(part.EndingLBA)
+	} else if t.Index >= 0 {
+		return fmt.Errorf("%s: partition %d not found", t.Disk, t.Index+1)
+	}
+	start := first
+	if *startLBA >= 0 {
+		start = first + *startLBA
+	}
+	end := last
+	if *count > 0 {
+		end = start + *count - 1
+	}
+	if start > end || end > last {
+		return fmt.Errorf("range %d-%d outside %d-%d", start, end, first, last)
+	}
+
+	h := crc32.NewIEEE()
+	n := (end - start + 1) * int64(ss)
+	if _, err := io.Copy(h, io.NewSectionReader(gpt.WithDeadline(f, ioTimeout), start*int64(ss), n)); err != nil {
+		return err
+	}
+	sum := h.Sum32()
+	fmt.Printf("%08x  LBA %d-%d (%d sectors, %d bytes)\n", sum, start, end, end-start+1, n)
+	if *expect != "" {
+		want, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(*expect), "0x"), 16, 32)
+		if err != nil {
+			return fmt.Errorf("-expect: %w", err)
+		}
+		if uint32(want) != sum {
+			return fmt.Errorf("CRC32 %08x does not match expected %08x", sum, want)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+// runDelete removes a partition from both copies of the GPT, optionally
+// zeroing the ends of its data first so no filesystem or RAID signature
+// turns up again when the space is reused.
+func runDelete(args []string) error {
+	fs := newFlagSet("delete", "<disk|image> <N> | <PARTUUID=...|/dev/sdXN>")
+	wipeFlag := fs.String("wipe", "", "zero this much at the start and at the end of the partition first, e.g. 1MiB, where filesystems and RAID keep their signatures")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	target, n, err := partitionArgs(fs, fs.Args())
+	if err != nil {
+		return err
+	}
+	var wipe int64
+	if *wipeFlag != "" {
+		if wipe, err = layout.ParseSize(*wipeFlag); err != nil {
+			return fmt.Errorf("-wipe: %w", err)
+		}
+	}
+
+	s, err := wo.open(target.Disk, "delete")
+	if err != nil {
+		return err
+	}
+	if s.Disk == nil {
+		return s.finish(nil, fmt.Errorf("%s has no readable GPT", target.Disk))
+	}
+	t := s.Disk.Table()
+	if !t.Header.IsPrimary() {
+		t = t.Alternate()
+	}
+	e, n, err := pickPartition(t, target.Index, n)
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	if isBlockDevice(target.Disk) {
+		if mp, _ := device.MountPoint(device.PartitionPath(target.Disk, n)); mp != "" {
+			return s.finish(nil, fmt.Errorf("partition %d is mounted on %s", n, mp))
+		}
+	}
+	ss := int64(t.SectorSize)
+	if wipe%ss != 0 {
+		return s.finish(nil, fmt.Errorf("-wipe %s is not a multiple of the %d-byte sector size", *wipeFlag, ss))
+	}
+	if wipe > 0 {
+		if err := wipeEnds(s.Dev, int64(e.StartingLBA)*ss, int64(e.SizeBytes(int(ss))), wipe); err != nil {
+			return s.finish(nil, fmt.Errorf("partition %d: %w", n, err))
+		}
+	}
+	t.Entries[n-1] = gpt.Entry{}
+	if err = s.finish(t, t.ApplyTo(s.Dev)); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("deleted partition %d (%d-%d, %s", n, e.StartingLBA, e.EndingLBA, humanBytes(int64(e.SizeBytes(int(ss)))))
+	if name := e.Name(); name != "" {
+		msg += fmt.Sprintf(", %q", name)
+	}
+	switch size := int64(e.SizeBytes(int(ss))); {
+	case wipe > 0 && 2*wipe >= size:
+		msg += ", all of it wiped"
+	case wipe > 0:
+		msg += fmt.Sprintf(", %s wiped at each end", humanBytes(wipe))
+	}
+	fmt.Println(msg + ")")
+	return nil
+}
+
+// partitionArgs resolves the positional arguments args of a command taking
+// "<disk|image> <N>" or a single partition: the target and the partition
+// number, 0 if the target names the partition itself.
+func partitionArgs(fs *flag.FlagSet, args []string) (device.Target, int, error) {
+	if len(args) < 1 || len(args) > 2 {
+		fs.Usage()
+		return device.Target{}, 0, errors.New("a disk and a partition number, or a partition, are required")
+	}
+	target, err := device.Resolve(args[0])
+	if err != nil {
+		return device.Target{}, 0, err
+	}
+	n := 0
+	if len(args) == 2 {
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+			return device.Target{}, 0, fmt.Errorf("partition number %q: want 1 or more", args[1])
+		}
+	}
+	if target.Index < 0 && n == 0 {
+		return device.Target{}, 0, errors.New("a partition number is required for a whole-disk target")
+	}
+	return target, n, nil
+}
+
+// wipeEnds zeroes the first and the last n bytes of the size bytes at off,
+// the whole range if it is shorter than 2n.
+func wipeEnds(dev gpt.Device, off, size, n int64) error {
+	if 2*n >= size {
+		return zeroRange(dev, off, off+size)
+	}
+	if err := zeroRange(dev, off, off+n); err != nil {
+		return err
+	}
+	return zeroRange(dev, off+size-n, off+size)
+}
+
+// zeroRange writes zeros over the bytes from up to, not including, to.
+func zeroRange(dev gpt.Device, from, to int64) error {
+	zero := make([]byte, max(min(to-from, 1<<20), 0))
+	for pos := from; pos < to; {
+		k := min(int64(len(zero)), to-pos)
+		if _, err := dev.WriteAt(zero[:k], pos); err != nil {
+			return fmt.Errorf("wipe at byte %d: %w", pos, err)
+		}
+		pos += k
+	}
+	return nil
+}
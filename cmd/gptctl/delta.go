@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+// deltaMagic starts a delta file. The header goes on with the size of the
+// disk and its sector size, then the number of records; each record is the
+// byte offset and length of a changed range, the SHA-256 of what the range
+// held before and after the edit, and the new bytes. Integers are
+// big-endian, as in overlay files.
+const deltaMagic = "GPTDLT01"
+
+const (
+	deltaHeaderSize = 8 + 8 + 4 + 4
+	deltaRecordHead = 8 + 4 + 2*sha256.Size
+	// maxDeltaBytes bounds what apply-delta reads; a GPT edit takes a few
+	// KiB
+	maxDeltaBytes = 256 << 20
+)
+
+// delta is the changed sectors of a disk, as export-delta writes them.
+type delta struct {
+	size       int64
+	sectorSize int
+	records    []deltaRecord
+}
+
+// deltaRecord is one changed range of at most -chunk bytes.
+type deltaRecord struct {
+	off      int64
+	old, new [sha256.Size]byte
+	data     []byte
+}
+
+func (d *delta) MarshalBinary() ([]byte, error) {
+	b := make([]byte, deltaHeaderSize, deltaHeaderSize+d.bytes()+len(d.records)*deltaRecordHead)
+	copy(b, deltaMagic)
+	binary.BigEndian.PutUint64(b[8:], uint64(d.size))
+	binary.BigEndian.PutUint32(b[16:], uint32(d.sectorSize))
+	binary.BigEndian.PutUint32(b[20:], uint32(len(d.records)))
+	for _, r := range d.records {
+		b = binary.BigEndian.AppendUint64(b, uint64(r.off))
+		b = binary.BigEndian.AppendUint32(b, uint32(len(r.data)))
+		b = append(b, r.old[:]...)
+		b = append(b, r.new[:]...)
+		b = append(b, r.data...)
+	}
+	return b, nil
+}
+
+func (d *delta) UnmarshalBinary(b []byte) error {
+	if len(b) < deltaHeaderSize || string(b[:8]) != deltaMagic {
+		return errors.New("not a delta file")
+	}
+	d.size = int64(binary.BigEndian.Uint64(b[8:]))
+	d.sectorSize = int(binary.BigEndian.Uint32(b[16:]))
+	n := int(binary.BigEndian.Uint32(b[20:]))
+	if d.sectorSize < 512 || d.sectorSize&(d.sectorSize-1) != 0 {
+		return fmt.Errorf("delta file: bad sector size %d", d.sectorSize)
+	}
+	d.records = nil
+	ss := int64(d.sectorSize)
+	for p, i := b[deltaHeaderSize:], 0; i < n; i++ {
+		if len(p) < deltaRecordHead {
+			return fmt.Errorf("delta file: record %d cut short", i)
+		}
+		var r deltaRecord
+		r.off = int64(binary.BigEndian.Uint64(p))
+		length := int64(binary.BigEndian.Uint32(p[8:]))
+		copy(r.old[:], p[12:])
+		copy(r.new[:], p[12+sha256.Size:])
+		p = p[deltaRecordHead:]
+		if int64(len(p)) < length {
+			return fmt.Errorf("delta file: record %d cut short", i)
+		}
+		r.data, p = p[:length], p[length:]
+		if r.off < 0 || r.off%ss != 0 || length == 0 || length%ss != 0 || r.off+length > d.size {
+			return fmt.Errorf("delta file: record %d (%d bytes at %d) is not whole sectors of the disk", i, length, r.off)
+		}
+		if sha256.Sum256(r.data) != r.new {
+			return fmt.Errorf("delta file: record %d is corrupt", i)
+		}
+		d.records = append(d.records, r)
+		if i == n-1 && len(p) != 0 {
+			return fmt.Errorf("delta file: %d bytes after the last record", len(p))
+		}
+	}
+	return nil
+}
+
+// bytes is the number of changed bytes d holds.
+func (d *delta) bytes() int {
+	n := 0
+	for _, r := range d.records {
+		n += len(r.data)
+	}
+	return n
+}
+
+// runExportDelta writes the sectors an edit changed, and what they held
+// before, to a small file apply-delta writes to other disks holding the
+// same contents, so a fix made once on an image or through -overlay need
+// not be shipped to every device as a whole image.
+func runExportDelta(args []string) error {
+	fs := newFlagSet("export-delta", "<before> <after> | -overlay <file> <disk|image>")
+	out := fs.String("o", "-", `output file, "-" for stdout`)
+	chunkFlag := fs.String("chunk", "64KiB", "largest record; longer changed ranges are split, so a delta can be sent and checked piecewise")
+	ho := addHMACFlags(fs)
+	so := addStreamFlags(fs, true)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (overlayPath == "" && fs.NArg() != 2) || (overlayPath != "" && fs.NArg() != 1) {
+		fs.Usage()
+		return errors.New("two images, or an overlay file and a disk, are required")
+	}
+	chunk, err := layout.ParseSize(*chunkFlag)
+	if err != nil {
+		return fmt.Errorf("-chunk: %w", err)
+	}
+
+	// the edit as the rest of gptctl sees it, for the sector size
+	afterPath := fs.Arg(fs.NArg() - 1)
+	ss := gpt.DefaultSectorSize
+	if d, err := openDisk(afterPath); err == nil {
+		ss = d.SectorSize
+		d.Close()
+	}
+	var before, after io.ReaderAt
+	var size int64
+	var ranges []gpt.OverlayRange
+	if overlayPath != "" {
+		ov, devSS, err := openOverlay(afterPath)
+		if err != nil {
+			return err
+		}
+		defer ov.Close()
+		if devSS != 0 {
+			ss = devSS
+		}
+		base, _, _, err := openBase(afterPath)
+		if err != nil {
+			return err
+		}
+		defer base.(io.Closer).Close()
+		before, after, size, ranges = base, ov, ov.Size(), ov.Changed()
+	} else {
+		b, bsize, _, err := openBase(fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer b.(io.Closer).Close()
+		a, asize, _, err := openBase(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		defer a.(io.Closer).Close()
+		if asize != bsize {
+			return fmt.Errorf("%s is %d bytes, %s %d; a delta needs disks of one size", fs.Arg(0), bsize, fs.Arg(1), asize)
+		}
+		before, after, size, ranges = b, a, asize, []gpt.OverlayRange{{Offset: 0, Length: asize}}
+	}
+	if chunk < int64(ss) || chunk%int64(ss) != 0 || chunk > 1<<30 {
+		return fmt.Errorf("-chunk %s: want a multiple of the %d-byte sector size up to 1GiB", *chunkFlag, ss)
+	}
+
+	d := &delta{size: size, sectorSize: ss}
+	if d.records, err = diffRanges(before, after, ranges, int64(ss), chunk); err != nil {
+		return err
+	}
+	b, err := d.MarshalBinary()
+	if err == nil {
+		b, err = ho.sign(b)
+	}
+	if err != nil {
+		return err
+	}
+	w, done, err := so.create(*out)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	if err = errors.Join(err, done()); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "delta: %d records, %s of changed sectors\n", len(d.records), humanBytes(int64(d.bytes())))
+	return nil
+}
+
+// diffRanges compares before and after over ranges, whole sectors of ss
+// bytes, and returns the sectors that differ as records of at most chunk
+// bytes, adjacent sectors merged. Bytes past the end of either reader
+// compare as zeros.
+func diffRanges(before, after io.ReaderAt, ranges []gpt.OverlayRange, ss, chunk int64) ([]deltaRecord, error) {
+	var recs []deltaRecord
+	var cur *deltaRecord
+	var old []byte
+	end := int64(-1) // where cur ends
+	flush := func() {
+		if cur != nil {
+			cur.old, cur.new = sha256.Sum256(old), sha256.Sum256(cur.data)
+			recs = append(recs, *cur)
+			cur, old = nil, nil
+		}
+	}
+	bb, ab := make([]byte, 4<<20), make([]byte, 4<<20)
+	for _, r := range ranges {
+		if r.Offset%ss != 0 || r.Length%ss != 0 {
+			return nil, fmt.Errorf("range of %d bytes at byte %d is not whole %d-byte sectors", r.Length, r.Offset, ss)
+		}
+		for pos := r.Offset; pos < r.Offset+r.Length; {
+			n := min(int64(len(bb)), r.Offset+r.Length-pos)
+			// past the end of a short read, both sides read as zeros
+			got, err := before.ReadAt(bb[:n], pos)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("read before at byte %d: %w", pos, err)
+			}
+			clear(bb[got:n])
+			got, err = after.ReadAt(ab[:n], pos)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("read after at byte %d: %w", pos, err)
+			}
+			clear(ab[got:n])
+			for k := int64(0); k < n; k += ss {
+				sb, sa := bb[k:k+ss], ab[k:k+ss]
+				if bytes.Equal(sb, sa) {
+					flush()
+					continue
+				}
+				if cur == nil || end != pos+k || int64(len(cur.data)) >= chunk {
+					flush()
+					cur = &deltaRecord{off: pos + k}
+				}
+				cur.data = append(cur.data, sa...)
+				old = append(old, sb...)
+				end = pos + k + ss
+			}
+			pos += n
+		}
+	}
+	flush()
+	return recs, nil
+}
+
+// runApplyDelta writes a delta made by export-delta to a disk, after
+// checking that every range of it holds what the delta was made against.
+// Ranges already holding the result are left alone, so a delta can be
+// applied again, e.g. after an interrupted run.
+func runApplyDelta(args []string) error {
+	fs := newFlagSet("apply-delta", "<delta|-> <disk|image>")
+	dryRun := fs.Bool("dry-run", false, "check that the delta applies and say what it would write, without writing")
+	wo := addWriteFlags(fs)
+	ho := addHMACFlags(fs)
+	so := addStreamFlags(fs, false)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("a delta and a target are required")
+	}
+	r, done, err := so.open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	raw, err := io.ReadAll(io.LimitReader(r, maxDeltaBytes+1))
+	done()
+	if err == nil && len(raw) > maxDeltaBytes {
+		err = fmt.Errorf("%s is larger than any delta (%d bytes)", fs.Arg(0), maxDeltaBytes)
+	}
+	if err == nil {
+		// check the HMAC before anything is opened for writing
+		raw, err = ho.open(raw)
+	}
+	var d delta
+	if err == nil {
+		err = d.UnmarshalBinary(raw)
+	}
+	if err != nil {
+		return err
+	}
+
+	path := fs.Arg(1)
+	if *dryRun {
+		dev, size, devSS, err := openBase(path)
+		if err != nil {
+			return err
+		}
+		defer dev.(io.Closer).Close()
+		pending, err := d.pending(dev, size, devSS, path)
+		if err != nil {
+			return err
+		}
+		for _, rec := range pending {
+			fmt.Printf("would write %s\n", d.describe(rec))
+		}
+		if len(pending) == 0 {
+			fmt.Printf("%s already holds the delta\n", path)
+		}
+		return nil
+	}
+
+	s, err := wo.open(path, "apply-delta")
+	if err != nil {
+		return err
+	}
+	pending, err := d.pending(s.Dev, s.Size, s.SectorSize, path)
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	if len(pending) == 0 {
+		fmt.Printf("%s already holds the delta\n", path)
+		return s.finish(nil, nil)
+	}
+	var n int64
+	for _, rec := range pending {
+		if _, err = s.Dev.WriteAt(rec.data, rec.off); err != nil {
+			err = fmt.Errorf("write at byte %d: %w", rec.off, err)
+			break
+		}
+		fmt.Printf("wrote %s\n", d.describe(rec))
+		n += int64(len(rec.data))
+	}
+	if err == nil {
+		err = s.Dev.Sync()
+	}
+	var after *gpt.Table
+	if err == nil {
+		if dd, derr := gpt.OpenDevice(s.Dev, s.Size, path, gpt.WithSectorSize(d.sectorSize)); derr == nil {
+			after = dd.Table()
+		}
+	}
+	if err := s.finish(after, err); err != nil {
+		return err
+	}
+	fmt.Printf("applied %d of %d records (%s) to %s\n", len(pending), len(d.records), humanBytes(n), path)
+	return nil
+}
+
+// pending checks dev, of size bytes and sectorSize bytes a sector (0 if
+// unknown), against d and returns the records it does not hold yet. Every
+// range must hold either what the delta was made against or its result.
+func (d *delta) pending(dev io.ReaderAt, size int64, sectorSize int, path string) ([]deltaRecord, error) {
+	if size != d.size {
+		return nil, fmt.Errorf("the delta is for a disk of %d bytes, %s has %d", d.size, path, size)
+	}
+	if sectorSize != 0 && sectorSize != d.sectorSize {
+		return nil, fmt.Errorf("the delta is for %d-byte sectors, %s has %d", d.sectorSize, path, sectorSize)
+	}
+	var pending []deltaRecord
+	for _, rec := range d.records {
+		b := make([]byte, len(rec.data))
+		if _, err := dev.ReadAt(b, rec.off); err != nil {
+			return nil, fmt.Errorf("read at byte %d: %w", rec.off, err)
+		}
+		switch sha256.Sum256(b) {
+		case rec.new:
+		case rec.old:
+			pending = append(pending, rec)
+		default:
+			return nil, fmt.Errorf("%s of %s holds neither what the delta was made against nor its result; nothing written", d.describe(rec), path)
+		}
+	}
+	return pending, nil
+}
+
+// describe names the sectors of rec.
+func (d *delta) describe(rec deltaRecord) string {
+	ss := int64(d.sectorSize)
+	return fmt.Sprintf("LBA %d-%d (%s)", rec.off/ss, (rec.off+int64(len(rec.data)))/ss-1, humanBytes(int64(len(rec.data))))
+}
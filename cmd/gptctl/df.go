@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/fsinfo"
+	"github.com/cpuuntery/go-code-and-bin/probe"
+)
+
+func runDF(args []string) error {
+	fs := newFlagSet("df", "<disk|image|PARTUUID=...>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	t, err := device.Resolve(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	d, err := openDisk(t.Disk)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	tbl := d.Table()
+	fmt.Printf("%4s %-20s %-6s %10s %10s %10s %10s %5s\n", "PART", "NAME", "FSTYPE", "PART SIZE", "FS SIZE", "USED", "FREE", "USE%")
+	for _, i := range tbl.Used() {
+		if t.Index >= 0 && i != t.Index {
+			continue
+		}
+		e := tbl.Entries[i]
+		size := int64(e.SizeBytes(d.SectorSize))
+		u, err := fsinfo.Read(d, int64(e.StartingLBA)*int64(d.SectorSize))
+		if err != nil {
+			fstype := "-"
+			if res, ok := probe.Identify(d, int64(e.StartingLBA)*int64(d.SectorSize), size); ok {
+				fstype = res.Type
+			}
+			fmt.Printf("%4d %-20s %-6s %10s\n", i+1, e.Name(), fstype, humanBytes(size))
+			continue
+		}
+		pct := 0.0
+		if u.Size() > 0 {
+			pct = 100 * float64(u.UsedBytes()) / float64(u.Size())
+		}
+		fmt.Printf("%4d %-20s %-6s %10s %10s %10s %10s %4.0f%%\n", i+1, e.Name(), u.Type,
+			humanBytes(size), humanBytes(u.Size()), humanBytes(u.UsedBytes()), humanBytes(u.FreeBytes()), pct)
+	}
+	return nil
+}
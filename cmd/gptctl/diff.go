@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cpuuntery/go-code-and-bin/audit"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// runDiff compares the partition tables of two disks or images, and the
+// boot code in their MBRs, so a boot loader that changed between two
+// builds of an image shows up next to the partition changes.
+func runDiff(args []string) error {
+	fs := newFlagSet("diff", "<disk|image> <disk|image>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("two disks or images are required")
+	}
+	a, err := openDisk(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := openDisk(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	var lines []string
+	add := func(format string, args ...any) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	ha, hb := a.Table().Header, b.Table().Header
+	if a.Size != b.Size {
+		add("size: %d -> %d bytes", a.Size, b.Size)
+	}
+	if a.SectorSize != b.SectorSize {
+		add("sector size: %d -> %d", a.SectorSize, b.SectorSize)
+	}
+	if ha.DiskGUID != hb.DiskGUID {
+		add("disk GUID: %s -> %s", ha.DiskGUID, hb.DiskGUID)
+	}
+	if ha.FirstUsableLBA != hb.FirstUsableLBA || ha.LastUsableLBA != hb.LastUsableLBA {
+		add("usable LBAs: %d-%d -> %d-%d", ha.FirstUsableLBA, ha.LastUsableLBA, hb.FirstUsableLBA, hb.LastUsableLBA)
+	}
+	if ha.NumPartitions != hb.NumPartitions || ha.PartitionEntrySize != hb.PartitionEntrySize {
+		add("entry array: %d x %d bytes -> %d x %d bytes", ha.NumPartitions, ha.PartitionEntrySize, hb.NumPartitions, hb.PartitionEntrySize)
+	}
+	for _, c := range audit.DiffEntries(a.Table(), b.Table()) {
+		add("partition %d %s: %q -> %q", c.Index+1, c.Field, c.Old, c.New)
+	}
+	sa, err := bootCodeSum(a)
+	if err != nil {
+		return err
+	}
+	sb, err := bootCodeSum(b)
+	if err != nil {
+		return err
+	}
+	if sa != sb {
+		add("MBR boot code: %s -> %s", sa, sb)
+	}
+
+	if len(lines) == 0 {
+		fmt.Printf("%s and %s have the same partition table and boot code\n", fs.Arg(0), fs.Arg(1))
+		return nil
+	}
+	fmt.Printf("--- %s\n+++ %s\n", fs.Arg(0), fs.Arg(1))
+	for _, l := range lines {
+		fmt.Println(l)
+	}
+	return nil
+}
+
+// bootCodeSum is the SHA-256 of the MBR boot code of d, "none" when blank.
+func bootCodeSum(d *gpt.Disk) (string, error) {
+	mbr := make([]byte, gpt.BootCodeSize)
+	if _, err := d.ReadAt(mbr, 0); err != nil {
+		return "", fmt.Errorf("read MBR of %s: %w", d.Path, err)
+	}
+	if s := gpt.BootCodeSum(mbr); s != "" {
+		return "sha256:" + s, nil
+	}
+	return "none", nil
+}
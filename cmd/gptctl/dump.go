@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+func runDump(args []string) error {
+	fs := newFlagSet("dump", "<disk|image>")
+	text := fs.Bool("text", false, "write the canonical text form (for version control) instead of the raw header sector and entry array")
+	sgdisk := fs.Bool("sgdisk", false, "write the MBR and both headers with the entry array, as sgdisk --backup does")
+	out := fs.String("o", "-", `output file, "-" for stdout`)
+	ho := addHMACFlags(fs)
+	so := addStreamFlags(fs, true)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	if *text && *sgdisk {
+		return errors.New("-text and -sgdisk are different formats; pick one")
+	}
+	d, err := openDisk(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	t := d.Table()
+	if !t.Header.IsPrimary() {
+		t = t.Alternate()
+	}
+	var b []byte
+	switch {
+	case *text:
+		b, err = t.MarshalText()
+	case *sgdisk:
+		mbr := make([]byte, sgdiskSector)
+		if _, err = d.ReadAt(mbr, 0); err == nil {
+			b, err = marshalSgdisk(mbr, t)
+		}
+	default:
+		b, err = t.MarshalBinary()
+	}
+	if err == nil {
+		b, err = ho.sign(b)
+	}
+	if err != nil {
+		return err
+	}
+	w, done, err := so.create(*out)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return errors.Join(err, done())
+}
+
+// maxDumpBytes bounds what load reads: a header sector and the largest
+// entry array -max-table-bytes allows would fit many times over.
+const maxDumpBytes = 64 << 20
+
+func runLoad(args []string) error {
+	fs := newFlagSet("load", "<dump|-> <disk|image>")
+	text := fs.Bool("text", false, "the dump is in the text form written by dump -text")
+	sgdisk := fs.Bool("sgdisk", false, "the dump is an sgdisk --backup file, or one written by dump -sgdisk; its MBR is restored too")
+	sectorSize := fs.Int("sector-size", 0, "sector size of a raw dump when the target has no GPT or device to take it from (default 512)")
+	wo := addWriteFlags(fs)
+	ho := addHMACFlags(fs)
+	so := addStreamFlags(fs, false)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("a dump and a target are required")
+	}
+	if *text && *sgdisk {
+		return errors.New("-text and -sgdisk are different formats; pick one")
+	}
+	r, done, err := so.open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	raw, err := io.ReadAll(io.LimitReader(r, maxDumpBytes+1))
+	done()
+	if err == nil && len(raw) > maxDumpBytes {
+		err = fmt.Errorf("%s is larger than any dump (%d bytes)", fs.Arg(0), maxDumpBytes)
+	}
+	if err == nil {
+		// check the HMAC before anything is opened for writing
+		raw, err = ho.open(raw)
+	}
+	if err != nil {
+		return err
+	}
+
+	s, err := wo.open(fs.Arg(1), "load")
+	if err != nil {
+		return err
+	}
+	ss := *sectorSize
+	if ss == 0 {
+		ss = s.SectorSize
+	}
+	t := &gpt.Table{SectorSize: ss}
+	var mbr []byte
+	switch {
+	case *text:
+		err = t.UnmarshalText(raw)
+		if err == nil && ss != 0 && t.SectorSize != ss {
+			err = fmt.Errorf("dump is for %d-byte sectors, the target has %d", t.SectorSize, ss)
+		}
+	case *sgdisk:
+		mbr, t, err = unmarshalSgdisk(raw, ss)
+	default:
+		err = t.UnmarshalBinary(raw)
+	}
+	if err == nil && wo.normalize {
+		t.Header.Normalize()
+	}
+	if err == nil {
+		err = loadTable(s, t, mbr)
+	}
+	if err = s.finish(t, err); err != nil {
+		return err
+	}
+	fmt.Printf("loaded GPT with %d partitions into %s\n", len(t.Used()), fs.Arg(1))
+	return nil
+}
+
+// loadTable writes t to the session's target. A primary copy whose backup
+// is not in the target's last sector, as in a dump of a disk of another
+// size, has its backup moved there. mbr, if not nil, is written to sector
+// 0 with its protective record resized to the target; otherwise a
+// protective MBR is added when sector 0 holds no MBR at all.
+func loadTable(s *writeSession, t *gpt.Table, mbr []byte) error {
+	ss := int64(t.SectorSize)
+	if ss == 0 {
+		ss = gpt.DefaultSectorSize
+	}
+	last := uint64(s.Size/ss) - 1
+	if h := t.Header; h.IsPrimary() && h.BackupLBA != last {
+		if err := t.MoveBackup(last); err != nil {
+			return fmt.Errorf("dump places the backup GPT at LBA %d, the target ends at LBA %d: %w", h.BackupLBA, last, err)
+		}
+		fmt.Printf("backup GPT moved from LBA %d to %d, the target's last sector\n", h.BackupLBA, last)
+	}
+	if max(t.Header.CurrentLBA, t.Header.BackupLBA) > last {
+		return fmt.Errorf("dump places a header at LBA %d, the target ends at LBA %d", max(t.Header.CurrentLBA, t.Header.BackupLBA), last)
+	}
+	if err := t.ApplyTo(s.Dev); err != nil {
+		return err
+	}
+	if mbr != nil {
+		mbr = append([]byte(nil), mbr...)
+		gpt.ResizeProtective(mbr, last+1)
+		if _, err := s.Dev.WriteAt(mbr, 0); err != nil {
+			return err
+		}
+		return s.Dev.Sync()
+	}
+	mbr = make([]byte, ss)
+	if _, err := s.Dev.ReadAt(mbr, 0); err != nil {
+		return err
+	}
+	if mbr[510] != 0x55 || mbr[511] != 0xAA {
+		if _, err := s.Dev.WriteAt(gpt.ProtectiveMBR(last+1, int(ss)), 0); err != nil {
+			return err
+		}
+	}
+	return s.Dev.Sync()
+}
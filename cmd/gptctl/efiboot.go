@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/efivar"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// bootPart is a partition found on one of the scanned disks.
+type bootPart struct {
+	disk  string
+	index int
+	entry gpt.Entry
+	refs  []string // Boot#### variables pointing at it
+}
+
+func runEFIBoot(args []string) error {
+	fs := newFlagSet("efiboot", "[disk|image...]")
+	dir := fs.String("efivars", efivar.Dir, "efivarfs directory to read, or a copy of one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	bv, err := efivar.Read(*dir)
+	if err != nil {
+		return err
+	}
+
+	paths := fs.Args()
+	if len(paths) == 0 {
+		devs, err := device.List()
+		if err != nil {
+			return err
+		}
+		for _, d := range devs {
+			paths = append(paths, d.Path)
+		}
+	}
+	var parts []*bootPart
+	byGUID := map[gpt.GUID]*bootPart{}
+	for _, p := range paths {
+		d, err := openDisk(p)
+		if err != nil {
+			// disks without a GPT cannot hold what a GPT boot entry names
+			fmt.Fprintf(os.Stderr, "gptctl efiboot: %s: %v\n", p, err)
+			continue
+		}
+		t := d.Table()
+		for _, i := range t.Used() {
+			bp := &bootPart{disk: p, index: i, entry: t.Entries[i]}
+			parts = append(parts, bp)
+			byGUID[bp.entry.UniqueGUID] = bp
+		}
+		d.Close()
+	}
+
+	if bv.Current >= 0 {
+		fmt.Printf("BootCurrent: Boot%04X\n", bv.Current)
+	}
+	order := make([]string, len(bv.Order))
+	for i, n := range bv.Order {
+		order[i] = fmt.Sprintf("%04X", n)
+	}
+	fmt.Printf("BootOrder:   %s\n\n", strings.Join(order, ","))
+
+	// entries in BootOrder first, in that order, then the rest
+	var opts []efivar.LoadOption
+	for _, n := range bv.Order {
+		o, ok := bv.Option(n)
+		if !ok {
+			fmt.Printf("Boot%04X  is in BootOrder but the variable does not exist\n", n)
+			continue
+		}
+		opts = append(opts, o)
+	}
+	for _, o := range bv.Options {
+		if !slices.Contains(bv.Order, o.Number) {
+			opts = append(opts, o)
+		}
+	}
+
+	stale := 0
+	for _, o := range opts {
+		mark := " "
+		if o.Active() {
+			mark = "*"
+		}
+		inOrder := slices.Contains(bv.Order, o.Number)
+		fmt.Printf("%s%s %q\n", o.Name(), mark, o.Description)
+		if !o.Disk {
+			what := "no GPT partition in its device path"
+			if len(o.Other) > 0 {
+				what += " (" + strings.Join(o.Other, ", ") + ")"
+			}
+			fmt.Printf("    %s\n", what)
+			continue
+		}
+		fmt.Printf("    HD(%d,GPT,%s,%d,%d)%s\n", o.PartitionNumber, o.PartitionGUID, o.PartitionStart, o.PartitionSize, o.File)
+		bp := byGUID[o.PartitionGUID]
+		if bp == nil {
+			fmt.Printf("    STALE: no partition with PARTUUID %s on the scanned disks\n", o.PartitionGUID)
+			if inOrder {
+				stale++
+			}
+			continue
+		}
+		bp.refs = append(bp.refs, o.Name())
+		fmt.Printf("    -> %s partition %d %q\n", bp.disk, bp.index+1, bp.entry.Name())
+		if bp.entry.StartingLBA != o.PartitionStart || bp.entry.Sectors() != o.PartitionSize || uint32(bp.index+1) != o.PartitionNumber {
+			fmt.Printf("    warning: the entry records partition %d at %d+%d, the GPT has %d at %d+%d; some firmware matches on these too\n",
+				o.PartitionNumber, o.PartitionStart, o.PartitionSize, bp.index+1, bp.entry.StartingLBA, bp.entry.Sectors())
+		}
+	}
+
+	fmt.Println("\nEFI System Partitions and referenced partitions:")
+	for _, bp := range parts {
+		if bp.entry.PartitionTypeGUID != gpt.TypeEFISystem && len(bp.refs) == 0 {
+			continue
+		}
+		refs := "not referenced by any boot entry"
+		if len(bp.refs) > 0 {
+			refs = "referenced by " + strings.Join(bp.refs, ", ")
+		}
+		fmt.Printf("  %s partition %d %q (%s): %s\n", bp.disk, bp.index+1, bp.entry.Name(), bp.entry.Type(), refs)
+	}
+
+	if stale > 0 {
+		return fmt.Errorf("%d boot entries in BootOrder point at partitions that no longer exist", stale)
+	}
+	if len(opts) == 0 {
+		return errors.New("no boot entries")
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+)
+
+func runEntropy(args []string) error {
+	fs := newFlagSet("entropy", "<disk|image|PARTUUID=...>")
+	samples := fs.Int("samples", 64, "samples taken per partition, spread evenly")
+	sampleSize := fs.Int("sample-size", 64<<10, "bytes per sample")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	if *samples < 1 || *sampleSize < 1 {
+		return errors.New("-samples and -sample-size must be positive")
+	}
+	t, err := device.Resolve(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	d, err := openDisk(t.Disk)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	tbl := d.Table()
+	fmt.Printf("%4s %-20s %10s %8s %8s %8s  %s\n", "PART", "NAME", "SIZE", "AVG", "MIN", "MAX", "LOOKS LIKE")
+	buf := make([]byte, *sampleSize)
+	for _, i := range tbl.Used() {
+		if t.Index >= 0 && i != t.Index {
+			continue
+		}
+		e := tbl.Entries[i]
+		off := int64(e.StartingLBA) * int64(d.SectorSize)
+		size := int64(e.SizeBytes(d.SectorSize))
+		avg, lo, hi, err := sampleEntropy(d, off, size, *samples, buf)
+		if err != nil {
+			return fmt.Errorf("partition %d: %w", i+1, err)
+		}
+		fmt.Printf("%4d %-20s %10s %8.3f %8.3f %8.3f  %s\n", i+1, e.Name(), humanBytes(size), avg, lo, hi, entropyClass(avg, lo, hi))
+	}
+	return nil
+}
+
+// sampleEntropy reads n samples spread over [off, off+size) and returns
+// the average, minimum and maximum Shannon entropy in bits per byte.
+func sampleEntropy(r io.ReaderAt, off, size int64, n int, buf []byte) (avg, lo, hi float64, err error) {
+	if int64(len(buf)) > size {
+		buf = buf[:size]
+	}
+	if len(buf) == 0 {
+		return 0, 0, 0, nil
+	}
+	step := (size - int64(len(buf))) / int64(max(n-1, 1))
+	if n == 1 || step == 0 {
+		n = 1
+	}
+	lo = 8
+	for k := 0; k < n; k++ {
+		if _, err := r.ReadAt(buf, off+int64(k)*step); err != nil && err != io.EOF {
+			return 0, 0, 0, err
+		}
+		h := shannon(buf)
+		avg += h
+		lo, hi = min(lo, h), max(hi, h)
+	}
+	return avg / float64(n), lo, hi, nil
+}
+
+func shannon(b []byte) float64 {
+	var counts [256]int
+	for _, c := range b {
+		counts[c]++
+	}
+	var h float64
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(len(b))
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// entropyClass gives a rough reading of the sampled entropy.
+func entropyClass(avg, lo, hi float64) string {
+	switch {
+	case avg < 0.01:
+		return "blank (zeroed or erased)"
+	case lo > 7.9:
+		return "encrypted or compressed"
+	case lo < 0.01 && hi > 7.9:
+		return "partly blank, partly encrypted/compressed"
+	case avg > 7.5:
+		return "mostly encrypted/compressed"
+	default:
+		return "plaintext data / filesystem"
+	}
+}
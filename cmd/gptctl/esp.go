@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/cpuuntery/go-code-and-bin/fat"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// runESP edits the FAT32 filesystem of the EFI System Partition in place,
+// without mounting it.
+func runESP(args []string) error {
+	sub := map[string]func([]string) error{
+		"cp":     runESPCopy,
+		"loader": runESPLoader,
+		"ls":     runESPList,
+		"mkdir":  runESPMkdir,
+	}
+	if len(args) == 0 || sub[args[0]] == nil {
+		fmt.Fprintf(os.Stderr, "usage: gptctl esp cp [flags] <disk|image> <src|-> <dst>\n"+
+			"       gptctl esp loader [flags] <disk|image>\n"+
+			"       gptctl esp ls [flags] <disk|image> [dir]\n"+
+			"       gptctl esp mkdir [flags] <disk|image> <dir>\n")
+		return errors.New("esp needs a subcommand: cp, loader, ls or mkdir")
+	}
+	return sub[args[0]](args[1:])
+}
+
+func runESPCopy(args []string) error {
+	fs := newFlagSet("esp cp", "<disk|image> <src|-> <dst>")
+	part := fs.Int("partition", 0, "partition number of the ESP (default: the first ESP)")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 3 {
+		fs.Usage()
+		return errors.New("a target, a source file and a destination path are required")
+	}
+	var data []byte
+	var err error
+	if src := fs.Arg(1); src == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(src)
+	}
+	if err != nil {
+		return err
+	}
+	dst := fs.Arg(2)
+	return editESP(wo, fs.Arg(0), *part, "esp cp", func(f *fat.FS) error {
+		if dir := path.Dir(path.Clean("/" + dst)); dir != "/" {
+			if err := f.MkdirAll(dir); err != nil {
+				return err
+			}
+		}
+		return f.WriteFile(dst, data)
+	})
+}
+
+func runESPMkdir(args []string) error {
+	fs := newFlagSet("esp mkdir", "<disk|image> <dir>")
+	part := fs.Int("partition", 0, "partition number of the ESP (default: the first ESP)")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("a target and a directory are required")
+	}
+	dir := fs.Arg(1)
+	return editESP(wo, fs.Arg(0), *part, "esp mkdir", func(f *fat.FS) error {
+		return f.MkdirAll(dir)
+	})
+}
+
+func runESPList(args []string) error {
+	fs := newFlagSet("esp ls", "<disk|image> [dir]")
+	part := fs.Int("partition", 0, "partition number of the ESP (default: the first ESP)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	d, err := openDisk(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	off, size, err := espExtent(d, *part)
+	if err != nil {
+		return err
+	}
+	f, err := fat.Open(d, off, size)
+	if err != nil {
+		return err
+	}
+	ents, err := f.ReadDir(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	for _, e := range ents {
+		if e.IsDir {
+			fmt.Printf("%10s  %s/\n", "-", e.Name)
+		} else {
+			fmt.Printf("%10d  %s\n", e.Size, e.Name)
+		}
+	}
+	return nil
+}
+
+// editESP opens the ESP of path for writing, runs edit on its filesystem
+// and flushes the FAT. Writes are audited like any other.
+func editESP(wo *writeOpts, path string, part int, op string, edit func(*fat.FS) error) error {
+	s, err := wo.open(path, op)
+	if err != nil {
+		return err
+	}
+	if s.Disk == nil {
+		return s.finish(nil, fmt.Errorf("no GPT on %s", path))
+	}
+	off, size, err := espExtent(s.Disk, part)
+	if err == nil {
+		var f *fat.FS
+		if f, err = fat.Open(s.Dev, off, size); err == nil {
+			f.Time = buildTime()
+			if err = edit(f); err == nil {
+				err = f.Flush()
+			}
+			if err == nil {
+				err = s.Dev.Sync()
+			}
+		}
+	}
+	return s.finish(nil, err)
+}
+
+// espExtent returns the byte offset and size of partition n, which must be
+// an ESP, or of the first ESP the firmware can see when n is 0.
+func espExtent(d *gpt.Disk, n int) (off, size int64, err error) {
+	t := d.Table()
+	if n > 0 {
+		if n > len(t.Entries) || t.Entries[n-1].IsEmpty() {
+			return 0, 0, fmt.Errorf("partition %d does not exist", n)
+		}
+		e := t.Entries[n-1]
+		if e.PartitionTypeGUID != gpt.TypeEFISystem {
+			return 0, 0, fmt.Errorf("partition %d is not an EFI System Partition", n)
+		}
+		return int64(e.StartingLBA) * int64(d.SectorSize), int64(e.SizeBytes(d.SectorSize)), nil
+	}
+	hidden := false
+	for _, i := range t.Used() {
+		if e := t.Entries[i]; e.PartitionTypeGUID == gpt.TypeEFISystem {
+			if !e.FirmwareVisible() {
+				hidden = true
+				continue
+			}
+			return int64(e.StartingLBA) * int64(d.SectorSize), int64(e.SizeBytes(d.SectorSize)), nil
+		}
+	}
+	if hidden {
+		return 0, 0, errors.New("every EFI System Partition has the EFI-ignore attribute set; pick one with -partition")
+	}
+	return 0, 0, errors.New("no EFI System Partition on the disk")
+}
+
+// buildTime honours SOURCE_DATE_EPOCH so CI builds produce identical images.
+func buildTime() time.Time {
+	if s := os.Getenv("SOURCE_DATE_EPOCH"); s != "" {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return time.Unix(n, 0).UTC()
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/verify"
+)
+
+// fieldDoc is what the UEFI specification says a header or entry field
+// means, and what gptctl does with it.
+type fieldDoc struct {
+	spec, tool string
+}
+
+// fieldDocs documents the fields of gpt.FieldLayout, by specification
+// name.
+var fieldDocs = map[string]fieldDoc{
+	"Signature": {
+		`"EFI PART" (45 46 49 20 50 41 52 54), identifying the sector as a GPT header.`,
+		"Compared byte for byte; any other value and the copy is not a GPT header at all."},
+	"Revision": {
+		"The revision of the header format; 0x00010000 for revision 1.0, the only one defined so far.",
+		"Other values are read but only the revision 1.0 fields are interpreted; bytes a later revision adds are kept in Header.Extra and written back unchanged."},
+	"HeaderSize": {
+		"Size of the header in bytes, at least 92 and at most the logical block size. The bytes past 92 are reserved and must be zero.",
+		"Values below 92 make the copy invalid. The header CRC is computed over exactly this many bytes."},
+	"HeaderCRC32": {
+		"CRC32 of the HeaderSize bytes of the header, computed with this field set to zero.",
+		"Computed with the IEEE polynomial over the header as it would be written, HeaderCRC32 zeroed; a mismatch makes that copy invalid and the other one is used. Every write recomputes it after the entry array CRC."},
+	"Reserved": {
+		"Must be zero.",
+		"Kept as read, so the CRC still matches, unless a write is made with -normalize."},
+	"MyLBA": {
+		"The LBA of the sector holding this header: 1 for the primary, the last LBA for the backup.",
+		"Tells the primary from the backup copy; must be the AlternateLBA of the other copy."},
+	"AlternateLBA": {
+		"The LBA of the other header copy.",
+		"The primary's AlternateLBA is where the backup is looked for. A backup before the last sector means the disk grew (realign -move-backup-to-end); one past it means the disk or image was truncated."},
+	"FirstUsableLBA": {
+		"The first LBA a partition may use, after the primary header and entry array.",
+		"Must not be past LastUsableLBA; every entry must lie within the usable range."},
+	"LastUsableLBA": {
+		"The last LBA a partition may use, before the backup entry array and header.",
+		"Must not be before FirstUsableLBA; every entry must lie within the usable range. Moving the backup (grow, realign) moves it along."},
+	"DiskGUID": {
+		"Unique identifier of the disk.",
+		"Must be the same in both copies. Printed in the canonical form, with the first three groups byte-swapped from how they are stored."},
+	"PartitionEntryLBA": {
+		"The first LBA of this copy's partition entry array: usually 2 for the primary and LastUsableLBA+1 for the backup.",
+		"The entry array is read from here; each copy has its own."},
+	"NumberOfPartitionEntries": {
+		"The number of entries in the array, usually 128.",
+		"Zero makes the copy invalid; arrays larger than -max-table-bytes are refused."},
+	"SizeOfPartitionEntry": {
+		"The size of one entry in bytes, 128 × 2^n; usually 128.",
+		"Other sizes make the copy invalid. Bytes past 128 in each entry are vendor data, kept in Entry.Extra and written back unchanged."},
+	"PartitionEntryArrayCRC32": {
+		"CRC32 of the NumberOfPartitionEntries × SizeOfPartitionEntry bytes of the entry array.",
+		"Computed over the whole array, unused entries included; a mismatch makes that copy invalid. Recomputed on every write before the header CRC."},
+	"PartitionTypeGUID": {
+		"What the partition is for; all zeros marks an unused entry.",
+		"Named through the known types table, whose names -type of new and settype accept; verify compares it with the content probed in the partition."},
+	"UniquePartitionGUID": {
+		"Unique identifier of the partition, the PARTUUID of Linux.",
+		"PARTUUID= arguments are resolved against it; new and the mirror commands generate fresh ones."},
+	"StartingLBA": {
+		"The first LBA of the partition.",
+		"Must be within the usable range and not inside another partition."},
+	"EndingLBA": {
+		"The last LBA of the partition, inclusive.",
+		"Must not be before StartingLBA, past LastUsableLBA or inside another partition; resize moves it."},
+	"Attributes": {
+		"Attribute bits: 0-2 defined by UEFI, 3-47 reserved, 48-63 defined by the partition type.",
+		"See gptctl explain attr:N for each bit."},
+	"PartitionName": {
+		"A human-readable name of up to 36 UTF-16 code units.",
+		"Decoded up to the first NUL; setname encodes and truncates it. PARTLABEL= arguments are resolved against it."},
+}
+
+// attrBit describes a partition attribute bit, or a field of width bits
+// starting at bit.
+type attrBit struct {
+	bit, width int
+	name       string
+	spec       string
+	tool       string
+	rules      []verify.Rule
+}
+
+var attrBits = []attrBit{
+	{0, 1, "platform-required", "Required Partition: the platform needs the partition to function; partitioning tools must not delete or modify it.",
+		"Printed as platform-required; not enforced by the write commands.", nil},
+	{1, 1, "efi-ignore", "No Block IO Protocol: the firmware produces no block I/O protocol for the partition, so it never reads its content.",
+		"An EFI System Partition with this bit is invisible to the boot manager; verify warns when every ESP has it.", []verify.Rule{verify.RuleESPIgnored}},
+	{2, 1, "legacy-bios-bootable", "Legacy BIOS Bootable: the partition may be bootable by legacy BIOS firmware, the equivalent of the MBR active flag.",
+		"Printed as legacy-bios-bootable, legacy_boot in parted form; what U-Boot's distro boot and syslinux scan for.", nil},
+	{48, 4, "chromeos-priority", "ChromeOS kernel partitions: boot priority, 0-15; 0 means not bootable and the highest wins.",
+		"Only meaningful on the ChromeOS kernel type.", nil},
+	{52, 4, "chromeos-tries", "ChromeOS kernel partitions: boot attempts left, 0-15, before the partition is given up on.",
+		"Only meaningful on the ChromeOS kernel type.", nil},
+	{56, 1, "chromeos-successful", "ChromeOS kernel partitions: the partition has booted successfully.",
+		"Only meaningful on the ChromeOS kernel type.", nil},
+	{59, 1, "growfs", "systemd partitions: systemd-growfs grows the filesystem to the partition on first mount.",
+		"Only meaningful on the Discoverable Partitions types.", nil},
+	{60, 1, "read-only", "Microsoft basic data and systemd partitions: mount read-only.",
+		"Only meaningful on those types.", nil},
+	{61, 1, "shadow-copy", "Microsoft basic data partitions: the partition is a shadow copy of another.",
+		"Only meaningful on that type.", nil},
+	{62, 1, "hidden", "Microsoft basic data partitions: no drive letter is assigned.",
+		"Printed as hidden in parted form; only meaningful on that type.", nil},
+	{63, 1, "no-automount", "Microsoft basic data and systemd partitions: not mounted automatically.",
+		"Printed as no_automount in parted form; only meaningful on those types.", nil},
+}
+
+// runExplain prints what a header or entry field, attribute bit or verify
+// rule means and how gptctl handles it, from the tables verify uses.
+func runExplain(args []string) error {
+	fs := newFlagSet("explain", "<field> | attr:<bit|name> | <rule>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fmt.Println("header fields:")
+		for _, f := range gpt.FieldLayout() {
+			if !f.Entry {
+				fmt.Printf("  %s\n", f.Name)
+			}
+		}
+		fmt.Println("partition entry fields:")
+		for _, f := range gpt.FieldLayout() {
+			if f.Entry {
+				fmt.Printf("  %s\n", f.Name)
+			}
+		}
+		fmt.Println("attribute bits, as attr:<bit> or attr:<name>:")
+		for _, a := range attrBits {
+			fmt.Printf("  %s %s\n", bitRange(a), a.name)
+		}
+		fmt.Println("verify rules, by ID or name: see gptctl verify -rules")
+		return nil
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one topic is required")
+	}
+	topic := fs.Arg(0)
+	if v, ok := strings.CutPrefix(strings.ToLower(topic), "attr:"); ok {
+		return explainAttr(v)
+	}
+	if f, ok := gpt.LookupField(topic); ok {
+		explainField(f)
+		return nil
+	}
+	if r, ok := verify.LookupRule(topic); ok {
+		fmt.Printf("%s: verify checks that %s\n", r, r.Doc())
+		return nil
+	}
+	return fmt.Errorf("%q is no header or entry field, attribute bit or verify rule; gptctl explain lists them", topic)
+}
+
+func explainField(f gpt.Field) {
+	where := "GPT header"
+	if f.Entry {
+		where = "partition entry"
+	}
+	name := f.Name
+	if f.GoName != f.Name {
+		name += " (" + f.GoName + ")"
+	}
+	fmt.Printf("%s: %s bytes %d-%d (0x%02x), %d bytes, %s\n", name, where, f.Offset, f.Offset+f.Size-1, f.Offset, f.Size, f.Encoding)
+	doc := fieldDocs[f.Name]
+	fmt.Printf("  spec:   %s\n", doc.spec)
+	fmt.Printf("  gptctl: %s\n", doc.tool)
+	printRules(verify.FieldRules(f.Name))
+}
+
+func explainAttr(v string) error {
+	var a attrBit
+	if n, err := strconv.Atoi(v); err == nil {
+		if n < 0 || n > 63 {
+			return fmt.Errorf("attr:%d: bits are 0-63", n)
+		}
+		a = lookupAttrBit(n)
+	} else if a = lookupAttrName(v); a.name == "" {
+		return fmt.Errorf("attr:%s: no such attribute; gptctl explain lists them", v)
+	}
+	mask := (uint64(1)<<a.width - 1) << a.bit
+	label := fmt.Sprintf("attr:%d", a.bit)
+	if a.name != "" {
+		label += " " + a.name
+	}
+	fmt.Printf("%s: partition entry Attributes %s, mask 0x%016x\n", label, bitRange(a), mask)
+	fmt.Printf("  spec:   %s\n", a.spec)
+	fmt.Printf("  gptctl: %s\n", a.tool)
+	printRules(append(a.rules, verify.RuleLayoutAttrs))
+	return nil
+}
+
+// lookupAttrBit returns the attribute bit n belongs to, or a description
+// of the unnamed bit.
+func lookupAttrBit(n int) attrBit {
+	for _, a := range attrBits {
+		if n >= a.bit && n < a.bit+a.width {
+			return a
+		}
+	}
+	if n < 48 {
+		return attrBit{bit: n, width: 1, spec: "Reserved by UEFI for future use; must be zero.",
+			tool: "Kept as read."}
+	}
+	return attrBit{bit: n, width: 1, spec: "Defined by the partition type; no type this tool knows uses it.",
+		tool: "Kept as read."}
+}
+
+// attrAliases are other names of attrBits, as parted and sgdisk call them.
+var attrAliases = map[string]string{
+	"required":     "platform-required",
+	"no-block-io":  "efi-ignore",
+	"legacy-boot":  "legacy-bios-bootable",
+	"priority":     "chromeos-priority",
+	"tries":        "chromeos-tries",
+	"successful":   "chromeos-successful",
+	"no_automount": "no-automount",
+	"legacy_boot":  "legacy-bios-bootable",
+}
+
+// lookupAttrName finds an attribute by name or alias, ignoring case; the
+// zero attrBit if there is none.
+func lookupAttrName(name string) attrBit {
+	name = strings.ToLower(name)
+	if n, ok := attrAliases[name]; ok {
+		name = n
+	}
+	for _, a := range attrBits {
+		if a.name == name {
+			return a
+		}
+	}
+	return attrBit{}
+}
+
+// bitRange is "bit N" or "bits N-M".
+func bitRange(a attrBit) string {
+	if a.width == 1 {
+		return fmt.Sprintf("bit %d", a.bit)
+	}
+	return fmt.Sprintf("bits %d-%d", a.bit, a.bit+a.width-1)
+}
+
+func printRules(rules []verify.Rule) {
+	if len(rules) == 0 {
+		return
+	}
+	fmt.Println("  checked by verify:")
+	for _, r := range rules {
+		fmt.Printf("    %s: %s\n", r, r.Doc())
+	}
+}
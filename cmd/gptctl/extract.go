@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+func runExtract(args []string) error {
+	fs := newFlagSet("extract", "<disk|image|PARTUUID=...>")
+	part := fs.Int("partition", 0, "partition number (not needed for partition targets like PARTUUID=...)")
+	out := fs.String("o", "-", `output file, "-" for stdout`)
+	so := addStreamFlags(fs, true)
+	resume := fs.String("resume", "", "map file recording the progress of the extraction; an interrupted one run again with it continues where it stopped (plain output files only)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	if *resume != "" {
+		// a compressed or encrypted stream cannot be picked up half way
+		if method, err := so.compression(*out); err != nil || method != "none" || so.encrypt || *out == "-" {
+			return errors.New("-resume needs -o to name a file, written without -compress or -encrypt")
+		}
+	}
+	t, err := device.Resolve(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	d, err := openDisk(t.Disk)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	e, n, err := pickPartition(d.Table(), t.Index, *part)
+	if err != nil {
+		return err
+	}
+	size := int64(e.SizeBytes(d.SectorSize))
+	off := int64(e.StartingLBA) * int64(d.SectorSize)
+	if *resume != "" {
+		return extractResumable(d, off, size, *out, *resume, fmt.Sprintf("%s partition %d", t.Disk, n))
+	}
+	w, done, err := so.create(*out)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, io.NewSectionReader(d, off, size))
+	if err = errors.Join(err, done()); err != nil {
+		return fmt.Errorf("partition %d: %w", n, err)
+	}
+	return nil
+}
+
+// extractResumable copies size bytes of d at off to the file out, from
+// where the map file says an earlier run stopped. source names the
+// partition in the map file.
+func extractResumable(d *gpt.Disk, off, size int64, out, mapPath, source string) error {
+	m, err := loadCopyMap(mapPath, source, size)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(out, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = copyResumable(f, d, off, size, m, ctx.Done())
+	if err = errors.Join(err, f.Close()); err != nil {
+		if errors.Is(err, errInterrupted) {
+			return fmt.Errorf("%w; continue with -resume %s", err, mapPath)
+		}
+		return err
+	}
+	return m.remove()
+}
+
+func runInject(args []string) error {
+	fs := newFlagSet("inject", "<file|-> <disk|image|PARTUUID=...>")
+	part := fs.Int("partition", 0, "partition number (not needed for partition targets like PARTUUID=...)")
+	so := addStreamFlags(fs, false)
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("a source file and a target are required")
+	}
+	t, err := device.Resolve(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	r, done, err := so.open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer done()
+	s, err := wo.open(t.Disk, "inject")
+	if err != nil {
+		return err
+	}
+	if s.Disk == nil {
+		return s.finish(nil, fmt.Errorf("no GPT on %s", t.Disk))
+	}
+	var written int64
+	e, n, err := pickPartition(s.Disk.Table(), t.Index, *part)
+	if err == nil {
+		ss := s.Disk.SectorSize
+		written, err = copyInto(s.Dev, r, int64(e.StartingLBA)*int64(ss), int64(e.SizeBytes(ss)))
+		if err == nil {
+			err = s.Dev.Sync()
+		}
+		if err != nil {
+			err = fmt.Errorf("partition %d: %w", n, err)
+		}
+	}
+	if err = s.finish(nil, err); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s into partition %d\n", humanBytes(written), n)
+	return nil
+}
+
+// pickPartition returns the entry selected by a partition target (index
+// >= 0) or by -partition n, and its 1-based number.
+func pickPartition(t *gpt.Table, index, n int) (gpt.Entry, int, error) {
+	switch {
+	case index >= 0 && n != 0 && n != index+1:
+		return gpt.Entry{}, 0, fmt.Errorf("target names partition %d, -partition %d", index+1, n)
+	case index >= 0:
+		n = index + 1
+	case n == 0:
+		return gpt.Entry{}, 0, errors.New("-partition is required for a whole-disk target")
+	}
+	if n < 1 || n > len(t.Entries) || t.Entries[n-1].IsEmpty() {
+		return gpt.Entry{}, 0, fmt.Errorf("partition %d does not exist", n)
+	}
+	return t.Entries[n-1], n, nil
+}
+
+// copyInto copies r to dev at off, refusing to go past limit bytes.
+func copyInto(dev io.WriterAt, r io.Reader, off, limit int64) (int64, error) {
+	buf := make([]byte, 1<<20)
+	var done int64
+	for {
+		n, rerr := io.ReadFull(r, buf)
+		if n > 0 {
+			if done+int64(n) > limit {
+				return done, fmt.Errorf("input larger than the partition (%s)", humanBytes(limit))
+			}
+			if _, err := dev.WriteAt(buf[:n], off+done); err != nil {
+				return done, err
+			}
+			done += int64(n)
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			return done, nil
+		}
+		if rerr != nil {
+			return done, rerr
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+)
+
+// runFingerprint prints a SHA-256 over the content of the GPT of each
+// disk, see gpt.Table.Fingerprint. It stays the same across scans until a
+// header field or an entry changes, so drift is a string comparison; a
+// repair that only fixes CRCs or restores one copy from the other leaves
+// it as it was.
+func runFingerprint(args []string) error {
+	fs := newFlagSet("fingerprint", "<disk|image>...")
+	expect := fs.String("expect", "", "fail unless the fingerprint of the one disk given equals this value")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no disk given")
+	}
+	if *expect != "" && fs.NArg() != 1 {
+		return errors.New("-expect checks a single disk")
+	}
+	var failed int
+	for _, arg := range fs.Args() {
+		sum, err := fingerprint(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: error: %v\n", arg, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s  %s\n", sum, arg)
+		if *expect != "" && !strings.EqualFold(*expect, sum) {
+			return fmt.Errorf("fingerprint %s does not match expected %s", sum, *expect)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d disks could not be fingerprinted", failed, fs.NArg())
+	}
+	return nil
+}
+
+// fingerprint returns the fingerprint of the GPT of the disk arg names.
+func fingerprint(arg string) (string, error) {
+	t, err := device.Resolve(arg)
+	if err != nil {
+		return "", err
+	}
+	d, err := openDisk(t.Disk)
+	if err != nil {
+		return "", err
+	}
+	defer d.Close()
+	return d.Table().Fingerprint()
+}
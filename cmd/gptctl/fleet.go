@@ -0,0 +1,466 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+	"github.com/cpuuntery/go-code-and-bin/verify"
+)
+
+// fleetScript runs on every host under sh. It lists the disks (or takes
+// them as arguments), then prints for each one a DISK line followed by the
+// first and last sectors in base64, so nothing needs to be installed
+// remotely and only the sectors holding the GPT cross the network.
+const fleetScript = `n=$1; shift
+if [ $# -eq 0 ]; then
+	for d in /sys/block/*; do
+		case ${d##*/} in loop*|ram*|zram*|sr*|fd*|dm-*|md*|nbd*) continue;; esac
+		set -- "$@" /dev/${d##*/}
+	done
+fi
+for p in "$@"; do
+	if [ -b "$p" ]; then
+		s=$(cat /sys/class/block/${p##*/}/size 2>/dev/null)
+	else
+		s=$(($(stat -L -c %s "$p" 2>/dev/null || echo 0) / 512))
+	fi
+	if [ -z "$s" ] || [ "$s" -eq 0 ]; then echo "ERR $p cannot determine size"; continue; fi
+	c=$n; [ "$c" -gt "$s" ] && c=$s
+	echo "DISK $p $((s * 512))"
+	echo HEAD; dd if="$p" bs=512 count=$c 2>/dev/null | base64; echo --
+	echo TAIL; dd if="$p" bs=512 skip=$((s - c)) count=$c 2>/dev/null | base64; echo --
+done
+`
+
+// fleetDisk is one disk in the fleet report.
+type fleetDisk struct {
+	Host     string   `json:"host"`
+	Disk     string   `json:"disk,omitempty"`
+	Size     int64    `json:"size,omitempty"`
+	Status   string   `json:"status"` // ok, warning, error, no-gpt, unreadable, unreachable; repaired, would-repair
+	Findings []string `json:"findings,omitempty"`
+	// Fingerprint is gpt.Table.Fingerprint of the GPT as scanned, to tell
+	// tables that changed between scans.
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+func runFleet(args []string) error {
+	sub := map[string]func([]string) error{
+		"scan":   runFleetScan,
+		"repair": runFleetRepair,
+	}
+	if len(args) == 0 || sub[args[0]] == nil {
+		fmt.Fprintf(os.Stderr, "usage: gptctl fleet scan [flags] [host]...\n"+
+			"       gptctl fleet repair [flags] [host]...\n")
+		return errors.New("fleet needs a subcommand: scan or repair")
+	}
+	return sub[args[0]](args[1:])
+}
+
+// remoteOpts are the flags of the fleet commands saying which hosts and
+// disks to reach, and how.
+type remoteOpts struct {
+	hostsFile string
+	parallel  int
+	ssh       string
+	sudo      bool
+	disks     string
+	fetch     string
+	retries   int
+	backoff   time.Duration
+	rate      float64
+	timeout   time.Duration
+
+	sshCmd  []string
+	sectors int64 // read from each end of every disk
+	limiter <-chan time.Time
+}
+
+// addRemoteFlags adds the flags of remoteOpts, retrying a host that cannot
+// be reached up to retries times by default.
+func addRemoteFlags(fs *flag.FlagSet, retries int) *remoteOpts {
+	o := &remoteOpts{}
+	fs.StringVar(&o.hostsFile, "hosts", "", "file with one [user@]host per line (# comments allowed)")
+	fs.IntVar(&o.parallel, "parallel", 16, "hosts worked on at the same time")
+	fs.StringVar(&o.ssh, "ssh", "ssh -o BatchMode=yes -o ConnectTimeout=10", "command used to reach a host; the host and a remote command are appended")
+	fs.BoolVar(&o.sudo, "sudo", false, "read (and write) the disks through sudo -n on the remote side")
+	fs.StringVar(&o.disks, "disks", "", "comma separated disks or images on every host (default: all disks in /sys/block)")
+	fs.StringVar(&o.fetch, "fetch", "1MiB", "bytes read from each end of every disk")
+	fs.IntVar(&o.retries, "retries", retries, "times a host is tried again when ssh cannot reach it or -timeout expires")
+	fs.DurationVar(&o.backoff, "backoff", 2*time.Second, "wait before the first retry; it doubles with each one, up to a minute")
+	fs.Float64Var(&o.rate, "rate", 0, "most ssh connections started per second across all hosts; 0 for no limit")
+	fs.DurationVar(&o.timeout, "timeout", 2*time.Minute, "give up on a single ssh command after this long; 0 waits forever")
+	return o
+}
+
+// hosts returns the hosts named by the arguments and -hosts, and readies
+// the options for use.
+func (o *remoteOpts) hosts(fs *flag.FlagSet) ([]string, error) {
+	hosts := fs.Args()
+	if o.hostsFile != "" {
+		more, err := readHosts(o.hostsFile)
+		if err != nil {
+			return nil, err
+		}
+		hosts = append(hosts, more...)
+	}
+	if len(hosts) == 0 {
+		fs.Usage()
+		return nil, errors.New("no hosts given")
+	}
+	for _, h := range hosts {
+		// ssh would take it for an option
+		if strings.HasPrefix(h, "-") {
+			return nil, fmt.Errorf("host %q starts with -", h)
+		}
+	}
+	if o.sshCmd = strings.Fields(o.ssh); len(o.sshCmd) == 0 {
+		return nil, errors.New("-ssh: empty command")
+	}
+	n, err := layout.ParseSize(o.fetch)
+	if err != nil {
+		return nil, fmt.Errorf("-fetch: %w", err)
+	}
+	o.sectors = max(n/512, 64)
+	if o.rate < 0 {
+		return nil, fmt.Errorf("-rate %g: want 0 or more", o.rate)
+	}
+	if o.rate > 0 {
+		o.limiter = time.Tick(time.Duration(float64(time.Second) / o.rate))
+	}
+	return hosts, nil
+}
+
+// each runs fn for every host, -parallel at a time, and returns what they
+// report in the order of hosts.
+func (o *remoteOpts) each(hosts []string, fn func(host string) []fleetDisk) []fleetDisk {
+	results := make([][]fleetDisk, len(hosts))
+	sem := make(chan struct{}, max(o.parallel, 1))
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = fn(h)
+		}()
+	}
+	wg.Wait()
+	var all []fleetDisk
+	for _, r := range results {
+		all = append(all, r...)
+	}
+	return all
+}
+
+// remote returns the remote command running a script from stdin with args,
+// through sudo if asked for. ssh joins it into one line for the remote
+// shell, so every word is quoted for it.
+func (o *remoteOpts) remote(args ...string) []string {
+	cmd := append([]string{"sh", "-s", "--"}, args...)
+	if o.sudo {
+		cmd = append([]string{"sudo", "-n"}, cmd...)
+	}
+	for i, w := range cmd {
+		cmd[i] = shellQuote(w)
+	}
+	return cmd
+}
+
+// shellQuote quotes s as one word for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// run runs script on host under sh with args and returns its output and
+// standard error. Unless once is set, a run that failed to reach the host
+// is tried again -retries times, waiting -backoff, doubled each time, in
+// between.
+func (o *remoteOpts) run(host, script string, once bool, args ...string) ([]byte, string, error) {
+	wait := o.backoff
+	for attempt := 0; ; attempt++ {
+		if o.limiter != nil {
+			<-o.limiter
+		}
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if o.timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		}
+		cmd := exec.CommandContext(ctx, o.sshCmd[0], append(append(o.sshCmd[1:len(o.sshCmd):len(o.sshCmd)], host), o.remote(args...)...)...)
+		cmd.Stdin = strings.NewReader(script)
+		// ssh killed on timeout may leave children holding its output open
+		cmd.WaitDelay = time.Second
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%w within -timeout %s", errNoAnswer, o.timeout)
+		}
+		cancel()
+		if err == nil || once || !unreachable(err) || attempt >= o.retries {
+			return out, strings.TrimSpace(stderr.String()), err
+		}
+		time.Sleep(wait)
+		wait = min(2*wait, time.Minute)
+	}
+}
+
+// errNoAnswer is a remote command running past -timeout.
+var errNoAnswer = errors.New("no answer")
+
+// unreachable reports whether err is ssh failing to reach the host, which
+// it reports with exit status 255, or a timeout, rather than the remote
+// command failing.
+func unreachable(err error) bool {
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitCode() == 255
+	}
+	return errors.Is(err, errNoAnswer)
+}
+
+func runFleetScan(args []string) error {
+	fs := newFlagSet("fleet scan", "[host]...")
+	ro := addRemoteFlags(fs, 0)
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	hosts, err := ro.hosts(fs)
+	if err != nil {
+		return err
+	}
+	all := ro.each(hosts, func(h string) []fleetDisk {
+		fetched, fail := ro.fetchHost(h, nil)
+		if fail != nil {
+			return []fleetDisk{*fail}
+		}
+		res := make([]fleetDisk, len(fetched))
+		for i, f := range fetched {
+			res[i] = checkFetched(h, f)
+		}
+		return res
+	})
+	return reportFleet(all, *asJSON)
+}
+
+// reportFleet prints the results of a fleet command, and fails if any disk
+// or host needs attention.
+func reportFleet(all []fleetDisk, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(all); err != nil {
+			return err
+		}
+	} else {
+		printFleet(all)
+	}
+	bad := 0
+	for _, d := range all {
+		if d.Status == "error" || d.Status == "unreachable" || d.Status == "unreadable" {
+			bad++
+		}
+	}
+	if bad > 0 {
+		return fmt.Errorf("%d of %d disks or hosts need attention", bad, len(all))
+	}
+	return nil
+}
+
+func readHosts(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			hosts = append(hosts, line)
+		}
+	}
+	return hosts, nil
+}
+
+// fetchedDisk is what fleetScript reported for one disk: its ends, or why
+// they could not be read.
+type fetchedDisk struct {
+	disk       string
+	size       int64
+	head, tail []byte
+	err        string
+}
+
+// fetchHost runs fleetScript on host for disks, or -disks if nil, and
+// returns what it reports; if the host cannot be reached, the result to
+// report for it instead.
+func (o *remoteOpts) fetchHost(host string, disks []string) ([]fetchedDisk, *fleetDisk) {
+	if disks == nil && o.disks != "" {
+		disks = strings.Split(o.disks, ",")
+	}
+	out, stderr, err := o.run(host, fleetScript, false, append([]string{strconv.FormatInt(o.sectors, 10)}, disks...)...)
+	if err != nil && len(out) == 0 {
+		msg := stderr
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, &fleetDisk{Host: host, Status: "unreachable", Findings: []string{msg}}
+	}
+	var res []fetchedDisk
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	readB64 := func() []byte {
+		var b64 strings.Builder
+		for sc.Scan() && sc.Text() != "--" {
+			b64.WriteString(sc.Text())
+		}
+		raw, _ := base64.StdEncoding.DecodeString(b64.String())
+		return raw
+	}
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		switch {
+		case len(f) >= 2 && f[0] == "ERR":
+			res = append(res, fetchedDisk{disk: f[1], err: strings.Join(f[2:], " ")})
+		case len(f) == 3 && f[0] == "DISK":
+			fd := fetchedDisk{disk: f[1]}
+			fd.size, _ = strconv.ParseInt(f[2], 10, 64)
+			if sc.Scan() && sc.Text() == "HEAD" {
+				fd.head = readB64()
+			}
+			if sc.Scan() && sc.Text() == "TAIL" {
+				fd.tail = readB64()
+			}
+			res = append(res, fd)
+		}
+	}
+	if len(res) == 0 {
+		return nil, &fleetDisk{Host: host, Status: "unreachable", Findings: []string{"no disks reported: " + stderr}}
+	}
+	return res, nil
+}
+
+// checkFetched verifies the GPT of a disk from its first and last sectors.
+func checkFetched(host string, f fetchedDisk) fleetDisk {
+	d, r := openFetched(host, f)
+	if d == nil {
+		return r
+	}
+	findings := verify.Disk(d, verify.Options{})
+	r.Fingerprint, _ = d.Table().Fingerprint()
+	r.Status = "ok"
+	for _, f := range findings {
+		r.Findings = append(r.Findings, f.String())
+		if r.Status == "ok" {
+			r.Status = "warning"
+		}
+	}
+	if verify.HasErrors(findings) {
+		r.Status = "error"
+	}
+	return r
+}
+
+// openFetched reads the GPT of a disk from its first and last sectors. If
+// it has none, or they could not be read, the Disk is nil and the result
+// says why.
+func openFetched(host string, f fetchedDisk) (*gpt.Disk, fleetDisk) {
+	r := fleetDisk{Host: host, Disk: f.disk, Size: f.size}
+	if f.err != "" {
+		r.Status, r.Findings = "unreadable", []string{f.err}
+		return nil, r
+	}
+	if len(f.head) == 0 || len(f.tail) == 0 {
+		r.Status, r.Findings = "unreadable", []string{"no data read (permission denied? try -sudo)"}
+		return nil, r
+	}
+	d, err := gpt.OpenReaderAt(&endsReader{size: f.size, head: f.head, tail: f.tail}, f.size, host+":"+f.disk, gpt.WithMaxTableBytes(maxTableBytes))
+	if err != nil {
+		if errors.Is(err, gpt.ErrSignature) {
+			r.Status = "no-gpt"
+			return nil, r
+		}
+		r.Status, r.Findings = "error", []string{err.Error()}
+		return nil, r
+	}
+	return d, r
+}
+
+// endsReader is a disk of which only the first and last bytes are known;
+// everything in between reads as zeros.
+type endsReader struct {
+	size       int64
+	head, tail []byte
+}
+
+func (e *endsReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= e.size {
+		return 0, io.EOF
+	}
+	n := len(p)
+	if rest := e.size - off; int64(n) > rest {
+		n = int(rest)
+	}
+	clear(p[:n])
+	if off < int64(len(e.head)) {
+		copy(p[:n], e.head[off:])
+	}
+	tailStart := e.size - int64(len(e.tail))
+	if end := off + int64(n); end > tailStart {
+		from := max(off, tailStart)
+		copy(p[from-off:n], e.tail[from-tailStart:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func printFleet(all []fleetDisk) {
+	counts := map[string]int{}
+	hosts := map[string]bool{}
+	fmt.Printf("%-24s %-16s %10s %s\n", "HOST", "DISK", "SIZE", "STATUS")
+	for _, d := range all {
+		hosts[d.Host] = true
+		counts[d.Status]++
+		size := "-"
+		if d.Size > 0 {
+			size = humanBytes(d.Size)
+		}
+		disk := d.Disk
+		if disk == "" {
+			disk = "-"
+		}
+		fmt.Printf("%-24s %-16s %10s %s\n", d.Host, disk, size, d.Status)
+		for _, f := range d.Findings {
+			fmt.Printf("%-24s %-16s %10s   %s\n", "", "", "", f)
+		}
+	}
+	fmt.Printf("\n%d hosts: %d unreachable; %d disks ok, %d with warnings, %d with errors, %d unreadable, %d without GPT",
+		len(hosts), counts["unreachable"], counts["ok"], counts["warning"], counts["error"], counts["unreadable"], counts["no-gpt"])
+	if n := counts["repaired"]; n > 0 {
+		fmt.Printf(", %d repaired", n)
+	}
+	if n := counts["would-repair"]; n > 0 {
+		fmt.Printf(", %d to repair", n)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// fleetWriteStep is one step of the script writeCopy runs: it writes the
+// base64 data of its here-document to the disk $1 at a 512-byte sector and
+// syncs it.
+const fleetWriteStep = `base64 -d <<'EOF' | dd of="$1" bs=512 seek=%d conv=notrunc,fsync 2>/dev/null || exit 1
+%sEOF
+`
+
+// runFleetRepair is repair for the disks of many hosts over SSH, for field
+// devices behind flaky links: each disk is read as by fleet scan, the
+// damaged GPT copy rebuilt locally and written back with dd. After a write
+// fails, or to confirm one that went through, the disk is read and checked
+// again before anything is written a second time, so a write that reached
+// the disk is never repeated blindly and a disk that changed in between is
+// left alone.
+func runFleetRepair(args []string) error {
+	fs := newFlagSet("fleet repair", "[host]...")
+	ro := addRemoteFlags(fs, 5)
+	from := fs.String("from", "", `copy to repair from when both are valid but differ: "primary" or "backup"`)
+	dryRun := fs.Bool("dry-run", false, "report what would be rewritten without writing")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch *from {
+	case "", "primary", "backup":
+	default:
+		return fmt.Errorf("-from %q: want primary or backup", *from)
+	}
+	hosts, err := ro.hosts(fs)
+	if err != nil {
+		return err
+	}
+	all := ro.each(hosts, func(h string) []fleetDisk {
+		fetched, fail := ro.fetchHost(h, nil)
+		if fail != nil {
+			return []fleetDisk{*fail}
+		}
+		res := make([]fleetDisk, len(fetched))
+		for i, f := range fetched {
+			res[i] = ro.repairFetched(h, f, *from, *dryRun)
+		}
+		return res
+	})
+	return reportFleet(all, *asJSON)
+}
+
+// repairFetched repairs the disk f of host, if it needs it, and checks the
+// result by reading the disk again.
+func (o *remoteOpts) repairFetched(host string, f fetchedDisk, from string, dryRun bool) fleetDisk {
+	var planned []byte // the copy written, fixed by the first look at the disk
+	var findings []string
+	wait := o.backoff
+	for attempt := 0; ; attempt++ {
+		d, r := openFetched(host, f)
+		if d == nil {
+			r.Findings = append(findings, r.Findings...)
+			return r
+		}
+		var notes strings.Builder
+		t, err := repairCopy(d, from, &notes)
+		if planned == nil {
+			findings = strings.Split(strings.TrimSpace(notes.String()), "\n")
+		}
+		r.Findings = findings
+		switch {
+		case err != nil:
+			r.Status, r.Findings = "error", append(r.Findings, err.Error())
+			return r
+		case t == nil && planned == nil:
+			r.Status = "ok"
+			return r
+		case t == nil:
+			r.Status = "repaired"
+			r.Findings = append(r.Findings, fmt.Sprintf("rewrote the %s GPT, checked by reading it back", copyName(d.Table())))
+			return r
+		}
+		b, err := t.MarshalBinary()
+		if err != nil {
+			r.Status, r.Findings = "error", append(r.Findings, err.Error())
+			return r
+		}
+		switch {
+		case planned != nil && !bytes.Equal(b, planned):
+			r.Status, r.Findings = "error", append(r.Findings, "the disk changed between attempts; left alone")
+			return r
+		case attempt > o.retries:
+			r.Status, r.Findings = "error", append(r.Findings, fmt.Sprintf("the %s GPT still reads damaged after %d attempts to write it", copyName(t), attempt))
+			return r
+		case dryRun:
+			r.Status = "would-repair"
+			return r
+		}
+		planned = b
+
+		if err := o.writeCopy(host, f.disk, t); err != nil {
+			if !unreachable(err) {
+				r.Status, r.Findings = "error", append(r.Findings, err.Error())
+				return r
+			}
+			// the write may or may not have reached the disk: look again
+			time.Sleep(wait)
+			wait = min(2*wait, time.Minute)
+		}
+		fetched, fail := o.fetchHost(host, []string{f.disk})
+		if fail != nil {
+			fail.Disk, fail.Findings = f.disk, append(findings, fail.Findings...)
+			return *fail
+		}
+		f = fetched[0]
+	}
+}
+
+// writeCopy writes the entry array and then the header sector of t to
+// disk on host, in one ssh command and once: repairFetched decides whether
+// to try again.
+func (o *remoteOpts) writeCopy(host, disk string, t *gpt.Table) error {
+	ss := int64(t.SectorSize)
+	hdr, err := t.Header.Sector(int(ss))
+	if err != nil {
+		return err
+	}
+	array := t.EntryArray()
+	if pad := len(array) % int(ss); pad != 0 {
+		array = append(array, make([]byte, int(ss)-pad)...)
+	}
+	var script strings.Builder
+	for _, w := range []struct {
+		b   []byte
+		lba uint64
+	}{{array, t.Header.PartitionTableLBA}, {hdr, t.Header.CurrentLBA}} {
+		var b64 strings.Builder
+		s := base64.StdEncoding.EncodeToString(w.b)
+		for len(s) > 76 {
+			b64.WriteString(s[:76] + "\n")
+			s = s[76:]
+		}
+		b64.WriteString(s + "\n")
+		fmt.Fprintf(&script, fleetWriteStep, int64(w.lba)*ss/512, b64.String())
+	}
+	_, stderr, err := o.run(host, script.String(), true, disk)
+	if err != nil {
+		if stderr != "" {
+			err = fmt.Errorf("%w: %s", err, stderr)
+		}
+		return fmt.Errorf("write the %s GPT of %s: %w", copyName(t), disk, err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+func runFree(args []string) error {
+	fs := newFlagSet("free", "<disk|image>")
+	align := fs.String("align", "1MiB", "alignment a new partition's start would need, e.g. 4KiB; 0 for none")
+	largest := fs.Bool("largest", false, "print only the largest region a new partition could use")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	alignBytes, err := layout.ParseSize(*align)
+	if err != nil {
+		return fmt.Errorf("-align: %w", err)
+	}
+	d, err := openDisk(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	ss := int64(d.SectorSize)
+	if alignBytes%ss != 0 {
+		return fmt.Errorf("-align %d is not a multiple of the %d-byte sector size", alignBytes, ss)
+	}
+	t := d.Table()
+	if *largest {
+		g, ok := t.LargestGap(uint64(alignBytes / ss))
+		if !ok {
+			return errors.New("no free space")
+		}
+		fmt.Printf("%d-%d %d sectors %s\n", g.First, g.Last, g.Sectors(), humanBytes(int64(g.Sectors())*ss))
+		return nil
+	}
+	fmt.Printf("%12s %12s %12s %10s\n", "FIRST", "LAST", "SECTORS", "SIZE")
+	for _, x := range t.Free() {
+		fmt.Printf("%12d %12d %12d %10s\n", x.First, x.Last, x.Sectors(), humanBytes(int64(x.Sectors())*ss))
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/fat"
+	"github.com/cpuuntery/go-code-and-bin/fsinfo"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+func runGrow(args []string) error {
+	fs := newFlagSet("grow", "<PARTUUID=...|/dev/sdXN|disk -partition N>")
+	partNum := fs.Int("partition", 0, "partition number (1-based) when the target is a whole disk")
+	size := fs.String("size", "", "new partition size, e.g. 20GiB (default: up to the next partition or the end of the disk)")
+	withFS := fs.Bool("with-fs", false, "grow the filesystem too: FAT32 natively, ext2/3/4, XFS and btrfs with their tools")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	target, err := device.Resolve(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	idx := target.Index
+	if *partNum > 0 {
+		idx = *partNum - 1
+	}
+	if idx < 0 {
+		return errors.New("name a partition, or a disk and -partition")
+	}
+
+	s, err := wo.open(target.Disk, "grow")
+	if err != nil {
+		return err
+	}
+	if s.Disk == nil {
+		return s.finish(nil, fmt.Errorf("%s has no readable GPT", target.Disk))
+	}
+	s.KeepKernelTable = true // partx below updates just this partition
+	t, err := growEntry(s.Disk, idx, *size)
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	e := t.Entries[idx]
+	ss := int64(t.SectorSize)
+	off := int64(e.StartingLBA) * ss
+
+	// find out what to grow before touching the table
+	var fsType string
+	if *withFS {
+		u, err := fsinfo.Read(s.Dev, off)
+		if err != nil {
+			return s.finish(nil, fmt.Errorf("partition %d: %w", idx+1, err))
+		}
+		switch fsType = u.Type; fsType {
+		case "vfat":
+		case "ext2", "ext3", "ext4", "xfs", "btrfs":
+			if overlayPath != "" {
+				// their tools would write to the disk itself
+				return s.finish(nil, fmt.Errorf("growing %s is not possible through an overlay", fsType))
+			}
+		default:
+			return s.finish(nil, fmt.Errorf("growing %s is not supported", fsType))
+		}
+	}
+
+	// FAT32 is grown through the audited device; the others need tools
+	err = t.ApplyTo(s.Dev)
+	if err == nil {
+		err = resizeProtective(s.Dev, s.Size/ss, int(ss))
+	}
+	if err == nil && fsType == "vfat" {
+		var n int64
+		if n, err = fat.Grow(s.Dev, off, int64(e.SizeBytes(int(ss)))); err == nil {
+			fmt.Printf("FAT32 filesystem grown to %s\n", humanBytes(n))
+			if n < int64(e.SizeBytes(int(ss)))-1<<20 {
+				fmt.Println("  (limited by the size of its FATs; reformat to use the whole partition)")
+			}
+			err = s.Dev.Sync()
+		}
+	}
+	isDev := isBlockDevice(target.Disk) && overlayPath == ""
+	if err = s.finish(t, err); err != nil {
+		return err
+	}
+	fmt.Printf("partition %d now %d-%d (%s)\n", idx+1, e.StartingLBA, e.EndingLBA, humanBytes(int64(e.SizeBytes(int(ss)))))
+
+	if isDev {
+		// tell the kernel about the new size; a busy disk cannot re-read
+		// its whole table, partx updates just this partition
+		if err := run("partx", "-u", "--nr", strconv.Itoa(idx+1), target.Disk); err != nil {
+			fmt.Fprintf(os.Stderr, "gptctl grow: updating the kernel's view: %v\n", err)
+		}
+	}
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		return growExt(target.Disk, isDev, idx, off, int64(e.SizeBytes(int(ss))))
+	case "xfs":
+		return growMounted(target.Disk, isDev, idx, "xfs_growfs")
+	case "btrfs":
+		return growMounted(target.Disk, isDev, idx, "btrfs", "filesystem", "resize", "max")
+	}
+	return nil
+}
+
+// resizeProtective makes the protective MBR cover a disk that grew,
+// capping its size at 0xFFFFFFFF sectors past 2 TiB.
+func resizeProtective(dev gpt.Device, totalSectors int64, sectorSize int) error {
+	mbr := make([]byte, sectorSize)
+	if _, err := dev.ReadAt(mbr, 0); err != nil {
+		return err
+	}
+	if !gpt.ResizeProtective(mbr, uint64(totalSectors)) {
+		return nil
+	}
+	if _, err := dev.WriteAt(mbr, 0); err != nil {
+		return err
+	}
+	return dev.Sync()
+}
+
+// growEntry returns the primary table of d with entry idx extended to size
+// (or as far as it can go), moving the backup GPT to the end of a disk that
+// grew first.
+func growEntry(d *gpt.Disk, idx int, size string) (*gpt.Table, error) {
+	t := d.Table()
+	if !t.Header.IsPrimary() {
+		t = t.Alternate()
+	}
+	if idx >= len(t.Entries) || t.Entries[idx].IsEmpty() {
+		return nil, fmt.Errorf("partition %d does not exist", idx+1)
+	}
+	if last := d.LastLBA(); last > t.Header.BackupLBA {
+		if err := t.MoveBackup(last); err != nil {
+			return nil, err
+		}
+	}
+	e := &t.Entries[idx]
+	limit, _ := endLimit(t, e)
+	end := limit
+	if size != "" {
+		n, err := layout.ParseSize(size)
+		if err != nil {
+			return nil, err
+		}
+		ss := uint64(t.SectorSize)
+		end = e.StartingLBA + (uint64(n)+ss-1)/ss - 1
+		if end > limit {
+			return nil, fmt.Errorf("%s does not fit: at most %s available", size, humanBytes(int64((limit-e.StartingLBA+1)*ss)))
+		}
+	}
+	if end < e.EndingLBA {
+		return nil, fmt.Errorf("partition %d would shrink (ends at %d, new end %d)", idx+1, e.EndingLBA, end)
+	}
+	e.EndingLBA = end
+	return t, nil
+}
+
+// endLimit returns the last LBA e can grow to: the sector before the next
+// partition or reserved region on the disk, which is named too, or the
+// LastUsableLBA, with "".
+func endLimit(t *gpt.Table, e *gpt.Entry) (uint64, string) {
+	limit, next := t.Header.LastUsableLBA, ""
+	for _, i := range t.Used() {
+		if s := t.Entries[i].StartingLBA; s > e.StartingLBA && s-1 < limit {
+			limit, next = s-1, fmt.Sprintf("partition %d", i+1)
+		}
+	}
+	for _, r := range t.Reserved {
+		if s, _ := r.Sectors(t.SectorSize); r.Size > 0 && s > e.StartingLBA && s-1 < limit {
+			limit, next = s-1, "reserved region "+r.String()
+		}
+	}
+	return limit, next
+}
+
+// growExt runs resize2fs on the partition: directly on the partition node of
+// a block device, through a loop device for an image.
+func growExt(disk string, isDev bool, idx int, off, size int64) error {
+	dev := device.PartitionPath(disk, idx+1)
+	if !isDev {
+		out, err := exec.Command("losetup", "--find", "--show", "--offset", strconv.FormatInt(off, 10),
+			"--sizelimit", strconv.FormatInt(size, 10), disk).Output()
+		if err != nil {
+			return fmt.Errorf("losetup: %w", err)
+		}
+		dev = strings.TrimSpace(string(out))
+		defer run("losetup", "-d", dev)
+	}
+	if mp, _ := device.MountPoint(dev); mp == "" {
+		// resize2fs insists on a freshly checked filesystem when offline
+		if err := run("e2fsck", "-f", "-p", dev); err != nil {
+			return err
+		}
+	}
+	return run("resize2fs", dev)
+}
+
+// growMounted runs tool with args and the mount point of the partition;
+// XFS and btrfs only grow while mounted.
+func growMounted(disk string, isDev bool, idx int, tool string, args ...string) error {
+	if !isDev {
+		return fmt.Errorf("%s needs the filesystem mounted; attach the image first", tool)
+	}
+	mp, err := device.MountPoint(device.PartitionPath(disk, idx+1))
+	if err != nil {
+		return err
+	}
+	if mp == "" {
+		return fmt.Errorf("%s needs the filesystem mounted", tool)
+	}
+	return run(tool, append(args, mp)...)
+}
+
+func run(name string, args ...string) error {
+	if _, err := exec.LookPath(name); err != nil {
+		return fmt.Errorf("%s is not installed", name)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+func isBlockDevice(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode()&os.ModeDevice != 0
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// hmacPrefix starts the trailer dump appends to a signed file: a comment
+// line, so text dumps stay valid as they are, followed by the hex
+// HMAC-SHA256 of everything before it.
+const hmacPrefix = "\n# hmac-sha256 "
+
+var hmacTrailerLen = len(hmacPrefix) + 2*sha256.Size + 1
+
+type hmacOpts struct {
+	key     string
+	keyFile string
+}
+
+// addHMACFlags registers the flags selecting the HMAC key. The key comes
+// from -hmac-key-file, then -hmac-key, then $GPT_HMAC_KEY.
+func addHMACFlags(fs *flag.FlagSet) *hmacOpts {
+	o := &hmacOpts{}
+	fs.StringVar(&o.keyFile, "hmac-key-file", "", "file holding the HMAC key (surrounding whitespace is ignored)")
+	fs.StringVar(&o.key, "hmac-key", os.Getenv("GPT_HMAC_KEY"), "HMAC key; prefer -hmac-key-file, arguments are visible to other users (default $GPT_HMAC_KEY)")
+	return o
+}
+
+// secret returns the configured key, or nil when there is none.
+func (o *hmacOpts) secret() ([]byte, error) {
+	if o.keyFile != "" {
+		b, err := os.ReadFile(o.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		k := bytes.TrimSpace(b)
+		if len(k) == 0 {
+			return nil, fmt.Errorf("%s: empty HMAC key", o.keyFile)
+		}
+		return k, nil
+	}
+	if o.key != "" {
+		return []byte(o.key), nil
+	}
+	return nil, nil
+}
+
+func hmacSum(key, data []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// sign appends the HMAC trailer to data when a key is configured.
+func (o *hmacOpts) sign(data []byte) ([]byte, error) {
+	key, err := o.secret()
+	if key == nil || err != nil {
+		return data, err
+	}
+	return fmt.Appendf(data, "%s%x\n", hmacPrefix, hmacSum(key, data)), nil
+}
+
+// open strips the trailer from a dump and checks it. With a key the
+// trailer is mandatory; without one a signed dump is accepted unverified.
+func (o *hmacOpts) open(data []byte) ([]byte, error) {
+	key, err := o.secret()
+	if err != nil {
+		return nil, err
+	}
+	payload, sum, signed := splitTrailer(data)
+	switch {
+	case key == nil:
+		if signed {
+			fmt.Fprintln(os.Stderr, "warning: dump carries an HMAC but no key was given; not verified")
+		}
+		return payload, nil
+	case !signed:
+		return nil, errors.New("dump is not signed but an HMAC key was given")
+	case !hmac.Equal(sum, hmacSum(key, payload)):
+		return nil, errors.New("HMAC mismatch: the dump was modified or signed with another key")
+	}
+	return payload, nil
+}
+
+func splitTrailer(data []byte) (payload, sum []byte, ok bool) {
+	if len(data) < hmacTrailerLen {
+		return data, nil, false
+	}
+	tail := string(data[len(data)-hmacTrailerLen:])
+	if !strings.HasPrefix(tail, hmacPrefix) || !strings.HasSuffix(tail, "\n") {
+		return data, nil, false
+	}
+	sum, err := hex.DecodeString(tail[len(hmacPrefix) : len(tail)-1])
+	if err != nil {
+		return data, nil, false
+	}
+	return data[:len(data)-hmacTrailerLen], sum, true
+}
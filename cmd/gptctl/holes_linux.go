@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lseek whence values for sparse files, missing from package syscall.
+const (
+	seekData = 3
+	seekHole = 4
+)
+
+// dataExtents returns the byte ranges of f below size that hold data,
+// anything between them being holes. A file system without SEEK_DATA
+// support reports the whole file as data.
+func dataExtents(f *os.File, size int64) ([][2]int64, error) {
+	var extents [][2]int64
+	for off := int64(0); off < size; {
+		start, err := f.Seek(off, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			break // only a hole is left
+		}
+		if errors.Is(err, syscall.EINVAL) && off == 0 {
+			return [][2]int64{{0, size}}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		end, err := f.Seek(start, seekHole)
+		if err != nil {
+			return nil, err
+		}
+		end = min(end, size)
+		if start < end {
+			extents = append(extents, [2]int64{start, end})
+		}
+		off = end
+	}
+	return extents, nil
+}
+
+// punchHole deallocates n bytes of f at off, which then read as zeros; the
+// file keeps its size.
+func punchHole(f *os.File, off, n int64) error {
+	const keepSize, punchHole = 0x01, 0x02 // FALLOC_FL_*
+	return syscall.Fallocate(int(f.Fd()), keepSize|punchHole, off, n)
+}
+
+// allocatedBytes is the space f takes on its file system.
+func allocatedBytes(f *os.File) (int64, bool) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return st.Blocks * 512, true
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// dataExtents reports all of f as data where holes cannot be found; its
+// zeros are still told apart by reading them.
+func dataExtents(f *os.File, size int64) ([][2]int64, error) {
+	return [][2]int64{{0, size}}, nil
+}
+
+func punchHole(f *os.File, off, n int64) error {
+	return errors.New("punching holes into a file is only supported on Linux; write a sparse copy with -o")
+}
+
+func allocatedBytes(f *os.File) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+// runImageCopy copies a whole disk or image to another, the dd step of a
+// repair workflow done with the checks dd leaves out: the system disk
+// guard, a destination big enough, and a SHA-256 of the source compared
+// with one read back from the destination.
+func runImageCopy(args []string) error {
+	fs := newFlagSet("image-copy", "<src disk|image> <dst disk|image>")
+	bsFlag := fs.String("bs", "4MiB", "block size to read and write")
+	jobs := fs.Int("jobs", 4, "blocks read and written concurrently")
+	sparse := fs.Bool("sparse", true, "leave all-zero blocks as holes in a destination file instead of writing them")
+	verifyFlag := fs.Bool("verify", true, "read the destination back and compare its SHA-256 with the source's")
+	var progress autoBool
+	fs.Var(&progress, "progress", "draw a progress bar on stderr (default: when stderr is a terminal)")
+	force := fs.Bool("force-system-disk", false, "allow overwriting the disk holding / or active swap")
+	resume := fs.String("resume", "", "map file recording the progress of the copy; an interrupted copy run again with it continues where it stopped")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("a source and a destination are required")
+	}
+	bs, err := layout.ParseSize(*bsFlag)
+	if err != nil {
+		return fmt.Errorf("-bs: %w", err)
+	}
+	if bs < 512 || bs%512 != 0 || bs > 1<<30 {
+		return fmt.Errorf("-bs %s: want a multiple of 512 bytes up to 1GiB", *bsFlag)
+	}
+	if *jobs < 1 {
+		return fmt.Errorf("-jobs %d: want at least 1", *jobs)
+	}
+	srcPath, dstPath := fs.Arg(0), fs.Arg(1)
+
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	size, err := gpt.DeviceSize(src)
+	if err != nil {
+		return fmt.Errorf("size of %s: %w", srcPath, err)
+	}
+	var m *copyMap
+	var resumedAt int64
+	if *resume != "" {
+		if m, err = loadCopyMap(*resume, srcPath, size); err != nil {
+			return err
+		}
+		resumedAt = m.done
+	}
+	dst, isFile, err := openCopyDest(src, dstPath, size, *force, m != nil && m.done > 0)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	if m != nil && m.done > 0 {
+		if isFile {
+			// past the recorded range, blocks skipped as zero must read
+			// back as zero whatever the last run left there
+			if err := dst.Truncate(m.done); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(os.Stderr, "resuming at byte %d of %d\n", m.done, size)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := &imageCopy{
+		src:    gpt.WithDeadline(src, ioTimeout),
+		dst:    gpt.WithDeadline(dst, ioTimeout),
+		size:   size,
+		bs:     bs,
+		jobs:   *jobs,
+		sparse: *sparse && isFile,
+		m:      m,
+		stop:   ctx.Done(),
+	}
+	if progress.value(isTerminal(os.Stderr)) {
+		c.bar = newProgressBar(os.Stderr, "copy", size)
+		if m != nil {
+			c.bar.done = m.done
+		}
+	}
+	start := time.Now()
+	sum, err := c.run()
+	if err == nil && isFile {
+		// the last blocks may have been holes
+		err = dst.Truncate(size)
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if errors.Is(err, errInterrupted) {
+		return fmt.Errorf("copy %s to %s: %w; continue it with -resume %s", srcPath, dstPath, err, *resume)
+	}
+	if err != nil {
+		return fmt.Errorf("copy %s to %s: %w", srcPath, dstPath, err)
+	}
+	if err := m.remove(); err != nil {
+		return err
+	}
+	copied := size - resumedAt
+	elapsed := time.Since(start)
+	fmt.Printf("copied %s in %s (%s/s)", humanBytes(copied), elapsed.Round(time.Second), humanBytes(int64(float64(copied)/max(elapsed.Seconds(), 0.001))))
+	if c.holes > 0 {
+		fmt.Printf(", %s left sparse", humanBytes(c.holes))
+	}
+	fmt.Printf("\nsha256 %x  %s\n", sum, srcPath)
+	if !*verifyFlag {
+		return nil
+	}
+	var bar *progressBar
+	if c.bar != nil {
+		bar = newProgressBar(os.Stderr, "verify", size)
+	}
+	back, err := hashRange(gpt.WithDeadline(dst, ioTimeout), size, bs, bar)
+	if err != nil {
+		return fmt.Errorf("read back %s: %w", dstPath, err)
+	}
+	if !bytes.Equal(back, sum) {
+		return fmt.Errorf("%s reads back with sha256 %x, not the source's", dstPath, back)
+	}
+	fmt.Printf("sha256 %x  %s (verified)\n", back, dstPath)
+	return nil
+}
+
+// openCopyDest opens the destination of image-copy: a block device, which
+// must be at least size bytes and is not the source, or a file, created or
+// truncated to empty so that skipped blocks are holes, unless keep asks
+// for the file of a copy being resumed. An existing destination has to
+// pass the system disk guard.
+func openCopyDest(src *os.File, path string, size int64, force, keep bool) (f *os.File, isFile bool, err error) {
+	fi, err := os.Stat(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+		return f, true, err
+	case err != nil:
+		return nil, false, err
+	}
+	if si, err := src.Stat(); err == nil && os.SameFile(si, fi) {
+		return nil, false, fmt.Errorf("%s is the source", path)
+	}
+	if err := device.GuardSystemDisk(path, force); err != nil {
+		return nil, false, err
+	}
+	if fi.Mode().IsRegular() {
+		flags := os.O_RDWR | os.O_TRUNC
+		if keep {
+			flags = os.O_RDWR
+		}
+		f, err = os.OpenFile(path, flags, 0)
+		return f, true, err
+	}
+	if f, err = os.OpenFile(path, os.O_RDWR, 0); err != nil {
+		return nil, false, err
+	}
+	n, err := gpt.DeviceSize(f)
+	if err == nil && n < size {
+		err = fmt.Errorf("%s holds %s, the source %s", path, humanBytes(n), humanBytes(size))
+	}
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+	return f, false, nil
+}
+
+// imageCopy copies size bytes from src to dst in blocks of bs, jobs of
+// them in flight at once, hashing them in order as they complete.
+type imageCopy struct {
+	src    io.ReaderAt
+	dst    gpt.Device
+	size   int64
+	bs     int64
+	jobs   int
+	sparse bool
+	bar    *progressBar
+	// m, with -resume, is where the copy starts and gets its progress
+	// recorded; stop ends it early with errInterrupted
+	m    *copyMap
+	stop <-chan struct{}
+
+	holes int64 // bytes not written for -sparse
+}
+
+// copyBlock is one block of an imageCopy, done once it is written.
+type copyBlock struct {
+	off  int64
+	buf  []byte
+	hole bool
+	err  error
+	done chan struct{}
+}
+
+// run copies and returns the SHA-256 of the source.
+func (c *imageCopy) run() ([]byte, error) {
+	h := sha256.New()
+	var start int64
+	if c.m != nil {
+		if err := c.m.restoreHash(h); err != nil {
+			return nil, err
+		}
+		start = c.m.done
+	}
+	pool := sync.Pool{New: func() any { return make([]byte, c.bs) }}
+	work := make(chan *copyBlock)
+	// ordered bounds the blocks in memory: those in flight and those
+	// finished but waiting for an earlier one to be hashed
+	ordered := make(chan *copyBlock, 2*c.jobs)
+	stop := make(chan struct{})
+
+	go func() {
+		defer close(work)
+		defer close(ordered)
+		for off := start; off < c.size; off += c.bs {
+			b := &copyBlock{off: off, buf: pool.Get().([]byte)[:min(c.bs, c.size-off)], done: make(chan struct{})}
+			select {
+			case ordered <- b:
+			case <-stop:
+				return
+			}
+			select {
+			case work <- b:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for range c.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range work {
+				c.copyBlock(b)
+				close(b.done)
+			}
+		}()
+	}
+
+	var err error
+	hashed := start
+	for b := range ordered {
+		if err != nil {
+			// drain what was queued before stop, without waiting on
+			// blocks no worker will take
+			continue
+		}
+		select {
+		case <-b.done:
+			err = b.err
+		case <-c.stop:
+			err = errInterrupted
+		}
+		if err != nil {
+			close(stop)
+			continue
+		}
+		h.Write(b.buf)
+		hashed += int64(len(b.buf))
+		if b.hole {
+			c.holes += int64(len(b.buf))
+		}
+		c.bar.add(int64(len(b.buf)))
+		pool.Put(b.buf[:cap(b.buf)])
+		if err = c.m.checkpoint(c.dst, hashed, h, false); err != nil {
+			close(stop)
+		}
+	}
+	wg.Wait()
+	c.bar.finish()
+	if err != nil {
+		// what was hashed is written: the next run starts after it
+		return nil, errors.Join(err, c.m.checkpoint(c.dst, hashed, h, true))
+	}
+	return h.Sum(nil), nil
+}
+
+func (c *imageCopy) copyBlock(b *copyBlock) {
+	if _, err := c.src.ReadAt(b.buf, b.off); err != nil {
+		b.err = fmt.Errorf("read at byte %d: %w", b.off, err)
+		return
+	}
+	if c.sparse && isZero(b.buf) {
+		b.hole = true
+		return
+	}
+	if _, err := c.dst.WriteAt(b.buf, b.off); err != nil {
+		b.err = fmt.Errorf("write at byte %d: %w", b.off, err)
+	}
+}
+
+// hashRange is the SHA-256 of the first size bytes of r.
+func hashRange(r io.ReaderAt, size, bs int64, bar *progressBar) ([]byte, error) {
+	h := sha256.New()
+	buf := make([]byte, bs)
+	for off := int64(0); off < size; off += bs {
+		b := buf[:min(bs, size-off)]
+		if _, err := r.ReadAt(b, off); err != nil {
+			return nil, fmt.Errorf("read at byte %d: %w", off, err)
+		}
+		h.Write(b)
+		bar.add(int64(len(b)))
+	}
+	bar.finish()
+	return h.Sum(nil), nil
+}
+
+func isZero(b []byte) bool {
+	for len(b) >= 8 {
+		if b[0]|b[1]|b[2]|b[3]|b[4]|b[5]|b[6]|b[7] != 0 {
+			return false
+		}
+		b = b[8:]
+	}
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isTerminal reports whether f is a character device, which for stderr
+// means someone is watching.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBar redraws one line of w with how much of total is done, at
+// most a few times a second. A nil bar draws nothing.
+type progressBar struct {
+	w     io.Writer
+	label string
+	total int64
+	done  int64
+	start time.Time
+	drawn time.Time
+}
+
+func newProgressBar(w io.Writer, label string, total int64) *progressBar {
+	return &progressBar{w: w, label: label, total: total, start: time.Now()}
+}
+
+func (p *progressBar) add(n int64) {
+	if p == nil {
+		return
+	}
+	p.done += n
+	if time.Since(p.drawn) >= 200*time.Millisecond {
+		p.draw()
+	}
+}
+
+func (p *progressBar) finish() {
+	if p == nil {
+		return
+	}
+	p.draw()
+	fmt.Fprintln(p.w)
+}
+
+func (p *progressBar) draw() {
+	p.drawn = time.Now()
+	const width = 30
+	frac := 1.0
+	if p.total > 0 {
+		frac = float64(p.done) / float64(p.total)
+	}
+	fill := int(frac * width)
+	rate := float64(p.done) / max(time.Since(p.start).Seconds(), 0.001)
+	fmt.Fprintf(p.w, "\r%-6s [%s%s] %5.1f%% %10s %10s/s", p.label, strings.Repeat("=", fill), strings.Repeat(" ", width-fill), 100*frac, humanBytes(p.done), humanBytes(int64(rate)))
+}
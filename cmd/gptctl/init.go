@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+// runInit writes a fresh GPT to a blank disk or image: a protective MBR,
+// primary and backup headers with a new random DiskGUID and a zeroed
+// 128-entry array, with the usable range worked out from the target's
+// size, plus the partitions of -preset. A target that already holds
+// partitions is refused without -overwrite.
+func runInit(args []string) error {
+	fs := newFlagSet("init", "<disk|image>")
+	preset := fs.String("preset", "", `start from a built-in board layout ("list" shows them)`)
+	firstUsable := fs.Uint64("first-usable", 0, "keep sectors below this LBA free of partitions")
+	size := fs.String("size", "", "create or resize the image file to this size first, e.g. 8GiB")
+	overwrite := fs.Bool("overwrite", false, "replace a GPT or MBR partition table the target already has")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *preset == "list" {
+		for _, n := range layout.PresetNames() {
+			fmt.Printf("%-12s %s\n", n, layout.PresetSummary(n))
+		}
+		return nil
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("a target is required")
+	}
+
+	if !*overwrite {
+		if err := checkBlank(fs.Arg(0)); err != nil {
+			return err
+		}
+	}
+
+	l := &layout.Layout{}
+	if *preset != "" {
+		var err error
+		if l, err = layout.Preset(*preset); err != nil {
+			return err
+		}
+	}
+	if *firstUsable != 0 {
+		l.FirstUsableLBA = *firstUsable
+	}
+	return writeLayout(l, fs.Arg(0), *size, wo, "init")
+}
+
+// checkBlank returns an error unless path is blank: a target that does not
+// exist yet, an empty file, a disk with no GPT signature in either copy and
+// no MBR partitions, or a GPT with no entries in use. A GPT that cannot be
+// read, damaged or not, is not blank.
+func checkBlank(path string) error {
+	fi, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) || err == nil && fi.Mode().IsRegular() && fi.Size() == 0 {
+		return nil
+	}
+	d, err := openDisk(path)
+	var mbr *gpt.MBRDiskError
+	switch {
+	case errors.As(err, &mbr):
+		return fmt.Errorf("%s holds an MBR partition table with %d records in use; pass -overwrite to replace it", path, len(mbr.Partitions))
+	case errors.Is(err, gpt.ErrNoGPT):
+		return nil
+	case err != nil:
+		return fmt.Errorf("%w; pass -overwrite to replace whatever is on %s", err, path)
+	}
+	defer d.Close()
+	if n := len(d.Table().Used()); n > 0 {
+		return fmt.Errorf("%s already has a GPT with %d entries in use; pass -overwrite to replace it", path, n)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/fat"
+)
+
+// runESPLoader writes a boot entry for the image's root partition into its
+// ESP: a Boot Loader Specification entry for systemd-boot, or a grub.cfg
+// stub. The kernel and initrd are expected on the ESP.
+func runESPLoader(args []string) error {
+	fs := newFlagSet("esp loader", "<disk|image>")
+	part := fs.Int("partition", 0, "partition number of the ESP (default: the first ESP)")
+	format := fs.String("format", "bls", `"bls" for a loader/entries/<id>.conf, or "grub" for a grub.cfg`)
+	id := fs.String("id", "linux", "entry file name without .conf (bls)")
+	title := fs.String("title", "Linux", "title shown in the boot menu")
+	linux := fs.String("linux", "/vmlinuz", "path of the kernel on the ESP")
+	initrd := fs.String("initrd", "", "path of the initrd on the ESP, if any")
+	options := fs.String("options", "", "more kernel parameters, e.g. \"quiet rw\"")
+	grubCfg := fs.String("grub-cfg", "/EFI/BOOT/grub.cfg", "where to write the grub.cfg (grub)")
+	dryRun := fs.Bool("dry-run", false, "print the file instead of writing it")
+	po := addParamFlags(fs)
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one disk or image is required")
+	}
+	target := fs.Arg(0)
+
+	d, err := openDisk(target)
+	if err != nil {
+		return err
+	}
+	params, err := po.params(d)
+	d.Close()
+	if err != nil {
+		return err
+	}
+	if *options != "" {
+		params = append(params, *options)
+	}
+	cmdline := strings.Join(params, " ")
+
+	var dst, content string
+	switch *format {
+	case "bls":
+		if *id == "" || strings.ContainsAny(*id, `/\`) {
+			return fmt.Errorf("invalid entry id %q", *id)
+		}
+		dst = "/loader/entries/" + *id + ".conf"
+		content = blsEntry(*title, *linux, *initrd, cmdline)
+	case "grub":
+		dst = path.Clean("/" + *grubCfg)
+		content = grubStub(*title, *linux, *initrd, cmdline)
+	default:
+		return fmt.Errorf("unknown format %q: bls or grub", *format)
+	}
+	if *dryRun {
+		fmt.Printf("# %s\n%s", dst, content)
+		return nil
+	}
+	err = editESP(wo, target, *part, "esp loader", func(f *fat.FS) error {
+		for _, p := range []string{*linux, *initrd} {
+			if p == "" {
+				continue
+			}
+			if _, err := f.ReadFile(p); err != nil {
+				fmt.Fprintf(os.Stderr, "warning: %s is not on the ESP yet (gptctl esp cp puts it there)\n", p)
+			}
+		}
+		if err := f.MkdirAll(path.Dir(dst)); err != nil {
+			return err
+		}
+		return f.WriteFile(dst, []byte(content))
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s to the ESP of %s\n", dst, target)
+	return nil
+}
+
+// blsEntry is a Boot Loader Specification type #1 entry.
+func blsEntry(title, linux, initrd, options string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "title   %s\n", title)
+	fmt.Fprintf(&b, "linux   %s\n", linux)
+	if initrd != "" {
+		fmt.Fprintf(&b, "initrd  %s\n", initrd)
+	}
+	fmt.Fprintf(&b, "options %s\n", options)
+	return b.String()
+}
+
+// grubStub is a grub.cfg with one menu entry booting the kernel from the
+// ESP, which GRUB finds by the kernel file.
+func grubStub(title, linux, initrd, options string) string {
+	var b strings.Builder
+	b.WriteString("# written by gptctl esp loader\n")
+	fmt.Fprintf(&b, "search --no-floppy --set=root --file %s\n", linux)
+	b.WriteString("set default=0\nset timeout=3\n\n")
+	fmt.Fprintf(&b, "menuentry '%s' {\n", strings.ReplaceAll(title, "'", `'\''`))
+	fmt.Fprintf(&b, "\tlinux %s %s\n", linux, options)
+	if initrd != "" {
+		fmt.Fprintf(&b, "\tinitrd %s\n", initrd)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// runLocate searches the start of a disk for GPT headers that broken
+// imaging tools left shifted, written for another sector size or
+// byte-swapped, and reports the geometry that reads each one.
+func runLocate(args []string) error {
+	fs := newFlagSet("locate", "<disk|image>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one disk or image is required")
+	}
+	path := fs.Arg(0)
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, err := gpt.DeviceSize(f)
+	if err != nil {
+		return err
+	}
+	logical := 0
+	if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeDevice != 0 {
+		logical, _, _ = gpt.BlockSizes(f)
+	}
+
+	found, err := gpt.ScanHeaders(gpt.WithDeadline(f, ioTimeout), size)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("no valid GPT header in the first %s of %s", humanBytes(gpt.ScanLimit), path)
+	}
+	for _, g := range found {
+		h := g.Header
+		which := "backup"
+		if h.IsPrimary() {
+			which = "primary"
+		}
+		fmt.Printf("%s header at byte %d (MyLBA %d), disk GUID %s, %d entries\n", which, g.At, h.CurrentLBA, h.DiskGUID, h.NumPartitions)
+		if g.ByteSwapped {
+			fmt.Printf("  byte-swapped: integer fields are big-endian\n")
+		}
+		if g.SectorSize == 0 {
+			fmt.Printf("  entry array not found with a matching CRC under any sector size\n")
+			continue
+		}
+		fmt.Printf("  sector size %d, LBA 0 at byte %d\n", g.SectorSize, g.Offset)
+		switch {
+		case g.Standard() && (logical == 0 || logical == g.SectorSize):
+			fmt.Printf("  standard geometry: gptctl reads this table as it is\n")
+		case logical != 0 && logical != g.SectorSize:
+			fmt.Printf("  the table was written for %d-byte sectors; this device has %d-byte sectors\n", g.SectorSize, logical)
+		}
+		if g.Offset != 0 {
+			fmt.Printf("  shifted by %d bytes\n", g.Offset)
+			if g.SectorSize == 512 && !g.ByteSwapped {
+				fmt.Printf("  all_gpt_info -offset %d %s reads it\n", g.Offset, path)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Command gptctl inspects, validates and modifies GUID Partition Tables on
+// disks and disk images. Each operation is a subcommand:
+//
+//	gptctl <command> [flags] [args]
+//
+// Run "gptctl help" for the list of commands.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"apply", "partition a disk or image from a layout file", runApply},
+	{"apply-delta", "write a delta made by export-delta to a disk holding what it was made against", runApplyDelta},
+	{"ceph", "group the Ceph OSD partitions of disks by OSD", runCeph},
+	{"cmdline", "print the root=, rootfstype= and resume= kernel parameters for an image", runCmdline},
+	{"crc", "CRC32 of a sector range, e.g. a bootloader region", runCRC},
+	{"delete", "remove a partition from both GPT copies, optionally zeroing the ends of its data", runDelete},
+	{"df", "used and free space of the filesystems in each partition", runDF},
+	{"diff", "compare the partition tables and MBR boot code of two disks or images", runDiff},
+	{"dump", "write the GPT to a file, raw or as canonical text", runDump},
+	{"efiboot", "match UEFI Boot#### entries against the partitions on the disks", runEFIBoot},
+	{"entropy", "sample partitions for encrypted, compressed or blank content", runEntropy},
+	{"esp", "copy files into, list or write boot entries to the EFI System Partition without mounting it", runESP},
+	{"export-delta", "write just the sectors an edit changed, from two images or an -overlay file, for apply-delta", runExportDelta},
+	{"explain", "describe a GPT header or entry field, attribute bit or verify rule", runExplain},
+	{"extract", "copy a partition to a file, optionally encrypted", runExtract},
+	{"fingerprint", "SHA-256 of the GPT content, CRCs excluded, to detect partition table changes", runFingerprint},
+	{"fleet", "check or repair the partition tables of many machines over SSH, retrying flaky links", runFleet},
+	{"free", "list the unallocated regions, or with -largest the biggest usable one", runFree},
+	{"grow", "extend a partition (and with -with-fs its filesystem) into free space", runGrow},
+	{"image-copy", "copy a whole disk or image, skipping zero blocks, with a verified SHA-256", runImageCopy},
+	{"init", "write a new GPT, optionally from a board preset", runInit},
+	{"inject", "write a file produced by extract back into a partition", runInject},
+	{"load", "write a GPT saved by dump back to a disk or image", runLoad},
+	{"locate", "search the first 64 KiB for a GPT shifted, byte-swapped or written for another sector size", runLocate},
+	{"mkesp", "add an EFI System Partition and format it FAT32", runMkESP},
+	{"new", "add a partition at a start and size, or in the first or largest free region", runNew},
+	{"overlay", "show, commit or discard the writes an -overlay file collected", runOverlay},
+	{"patch", "apply a JSON document of entry edits in one transaction", runPatch},
+	{"policy", "check disks or images against an acceptance policy file, for CI", runPolicy},
+	{"realign", "lay the partitions out again with a chosen alignment and order, or move a stranded backup GPT to the end", runRealign},
+	{"repair", "rewrite a damaged or missing GPT copy from the valid one", runRepair},
+	{"resize", "grow or shrink a partition entry in place", runResize},
+	{"setattr", "set or clear partition attribute bits, by number or name", runSetattr},
+	{"setname", "rename a partition", runSetname},
+	{"settype", "change the type of a partition, by GUID or alias", runSettype},
+	{"simulate-boot", "report which GPT copy and partitions UEFI firmware would use, and why", runSimulateBoot},
+	{"sparsify", "punch the zero blocks out of an image, or write it as a sparse or Android sparse copy", runSparsify},
+	{"snapshots", "list or restore the GPT snapshots saved with -snapshot-dir", runSnapshots},
+	{"verify", "check a GPT and site requirements, reporting every problem", runVerify},
+	{"verify-flash", "compare a flashed disk with its image over the GPT and partitions only", runVerifyFlash},
+	{"watch", "periodically validate disks and report changes", runWatch},
+	{"which", "find the disk holding a partition by PARTUUID or PARTLABEL", runWhich},
+	{"zap", "zero the MBR and both GPT copies, like sgdisk -Z, optionally the filesystem signatures too", runZap},
+	{"zeromap", "map the holes and all-zero runs of an image against its partitions", runZeromap},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: gptctl <command> [flags] [args]\n\ncommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nrun \"gptctl <command> -h\" for the flags of a command\n")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if err := c.run(os.Args[2:]); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				os.Exit(0)
+			}
+			fmt.Fprintf(os.Stderr, "gptctl %s: %v\n", name, err)
+			var mbr *gpt.MBRDiskError
+			if errors.As(err, &mbr) {
+				printMBR(os.Stderr, mbr.Partitions)
+			} else if errors.Is(err, gpt.ErrSignature) {
+				fmt.Fprintf(os.Stderr, "gptctl locate searches for a GPT shifted or written for another sector size\n")
+			}
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "gptctl: unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// Flags every command accepts.
+var (
+	maxTableBytes int64 = gpt.DefaultMaxTableBytes
+	ioTimeout     time.Duration
+	overlayPath   = os.Getenv("GPT_OVERLAY")
+)
+
+// openDisk is gpt.Open honouring -max-table-bytes and -io-timeout. Images
+// in a container format registered with device.RegisterFormat are opened
+// through it, read-only. With -overlay the disk is read through the
+// overlay file, and writes go there instead.
+func openDisk(path string, opts ...gpt.Option) (*gpt.Disk, error) {
+	opts = append(opts, gpt.WithMaxTableBytes(maxTableBytes), gpt.WithIOTimeout(ioTimeout))
+	if overlayPath != "" {
+		ov, ss, err := openOverlay(path)
+		if err != nil {
+			return nil, err
+		}
+		if ss > 0 {
+			opts = append([]gpt.Option{gpt.WithSectorSize(ss)}, opts...)
+		}
+		d, err := gpt.OpenDevice(ov, ov.Size(), path, opts...)
+		if err != nil {
+			ov.Close()
+			return nil, err
+		}
+		return d, nil
+	}
+	img, format, err := device.OpenImage(path)
+	if err != nil {
+		return nil, err
+	}
+	if img == nil {
+		return gpt.Open(path, opts...)
+	}
+	d, err := gpt.OpenReaderAt(img, img.Size(), path, opts...)
+	if err != nil {
+		img.Close()
+		return nil, fmt.Errorf("%s image: %w", format, err)
+	}
+	return d, nil
+}
+
+// newFlagSet returns a flag set for a subcommand with a usage line listing
+// its positional arguments, plus the flags common to all commands.
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Func("max-table-bytes", "largest partition entry array to read, e.g. 64MiB; 0 for no limit (default 4MiB)", func(s string) error {
+		n, err := layout.ParseSize(s)
+		maxTableBytes = n
+		return err
+	})
+	fs.DurationVar(&ioTimeout, "io-timeout", 0, "fail any single device read, write or sync taking longer than this, e.g. 30s; 0 waits forever")
+	fs.BoolFunc("si", "print sizes in decimal units (kB, MB, GB) instead of binary ones (KiB, MiB, GiB)", func(string) error {
+		sizeUnits = siUnits
+		return nil
+	})
+	fs.StringVar(&overlayPath, "overlay", overlayPath, "leave the disk untouched: read it through this overlay file and write there instead, for gptctl overlay commit (default $GPT_OVERLAY)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: gptctl %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// printMBR lists the partitions of a disk partitioned with a classic MBR,
+// which is what gptctl finds instead of a GPT on older installs.
+func printMBR(w io.Writer, parts []gpt.MBRPartition) {
+	fmt.Fprintf(w, "MBR-partitioned disk:\n")
+	fmt.Fprintf(w, "  %-3s %-4s %12s %12s %10s  %s\n", "#", "boot", "start", "sectors", "size", "type")
+	for _, p := range parts {
+		boot := ""
+		if p.Bootable {
+			boot = "*"
+		}
+		fmt.Fprintf(w, "  %-3d %-4s %12d %12d %10s  0x%02x %s\n", p.Index+1, boot, p.Start, p.Sectors, humanBytes(int64(p.Sectors)*512), p.Type, p.TypeName())
+	}
+}
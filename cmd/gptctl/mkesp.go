@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/cpuuntery/go-code-and-bin/fat"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+func runMkESP(args []string) error {
+	fs := newFlagSet("mkesp", "<disk|image>")
+	size := fs.String("size", "512MiB", "size of the ESP")
+	name := fs.String("name", "EFI System Partition", "partition name")
+	strict := fs.Bool("strict", false, strictNameUsage)
+	label := fs.String("label", "ESP", "FAT volume label")
+	attrs := fs.String("attributes", "0", "partition attribute bits, e.g. 0x1 for platform-required")
+	ro := addReservedFlags(fs)
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	n, err := layout.ParseSize(*size)
+	if err != nil {
+		return err
+	}
+	attributes, err := strconv.ParseUint(*attrs, 0, 64)
+	if err != nil {
+		return fmt.Errorf("-attributes: %w", err)
+	}
+	encoded, err := partitionName(*name, *strict)
+	if err != nil {
+		return err
+	}
+	reserved, err := ro.regions()
+	if err != nil {
+		return err
+	}
+	path := fs.Arg(0)
+
+	s, err := wo.open(path, "mkesp")
+	if err != nil {
+		return err
+	}
+	var t *gpt.Table
+	var idx int
+	if s.Disk == nil {
+		// blank target: a new GPT holding just the ESP
+		b := gpt.NewBuilder(s.Size)
+		if s.SectorSize != 0 {
+			b.SectorSize = s.SectorSize
+		}
+		b.Reserved = reserved
+		b.Add(gpt.Partition{Type: gpt.TypeEFISystem, Name: *name, Size: n, Attributes: attributes})
+		t, err = b.ApplyTo(s.Dev)
+	} else {
+		t, idx, err = addESP(s.Disk, reserved, n, encoded, attributes)
+		if err == nil {
+			err = t.ApplyTo(s.Dev)
+		}
+	}
+	if err == nil {
+		e := t.Entries[idx]
+		ss := t.SectorSize
+		err = fat.Format(s.Dev, int64(e.StartingLBA)*int64(ss), int64(e.SizeBytes(ss)), fat.Options{
+			SectorSize:    ss,
+			Label:         *label,
+			HiddenSectors: uint32(min(e.StartingLBA, 0xFFFFFFFF)),
+		})
+		if err == nil {
+			err = s.Dev.Sync()
+		}
+	}
+	if err = s.finish(t, err); err != nil {
+		return err
+	}
+	e := t.Entries[idx]
+	fmt.Printf("created ESP as partition %d: %d-%d (%s), formatted FAT32\n", idx+1, e.StartingLBA, e.EndingLBA, humanBytes(int64(e.SizeBytes(t.SectorSize))))
+	return nil
+}
+
+// addESP returns the primary table of d with an ESP of size bytes added in
+// the first 1 MiB aligned free space clear of reserved that fits it, and
+// the entry index used.
+func addESP(d *gpt.Disk, reserved []gpt.Reserved, size int64, name [72]byte, attributes uint64) (*gpt.Table, int, error) {
+	t := d.Table()
+	if !t.Header.IsPrimary() {
+		t = t.Alternate()
+	}
+	t.Reserved = reserved
+	idx := t.FreeSlot()
+	if idx < 0 {
+		return nil, 0, errors.New("no free partition entry")
+	}
+	ss := uint64(t.SectorSize)
+	sectors := (uint64(size) + ss - 1) / ss
+	start, ok := t.FindFree(sectors, (1<<20)/ss)
+	if !ok {
+		return nil, 0, fmt.Errorf("no free space of %s", humanBytes(size))
+	}
+	g, err := gpt.NewGUID()
+	if err != nil {
+		return nil, 0, err
+	}
+	t.Entries[idx] = gpt.Entry{
+		PartitionTypeGUID: gpt.TypeEFISystem,
+		UniqueGUID:        g,
+		StartingLBA:       start,
+		EndingLBA:         start + sectors - 1,
+		Attributes:        attributes,
+		PartitionName:     name,
+	}
+	return t, idx, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+// runNew adds one partition to an existing GPT, at a given start or in the
+// first free region that fits, and writes both copies of the table.
+func runNew(args []string) error {
+	fs := newFlagSet("new", "<disk|image>")
+	startFlag := fs.String("start", "", "first sector: an LBA, or a byte offset with a unit such as 1MiB (default: the first aligned free sector with room)")
+	sizeFlag := fs.String("size", "largest", `size, e.g. 512M or 2G, or "largest" for the whole free region`)
+	typ := fs.String("type", "linux", "partition type GUID or alias, e.g. esp, linux, swap")
+	name := fs.String("name", "", "partition name")
+	strict := fs.Bool("strict", false, strictNameUsage)
+	attrs := fs.String("attributes", "0", "partition attribute bits, e.g. 0x1 for platform-required")
+	align := fs.String("align", "1MiB", "alignment of a start picked for you, e.g. 4KiB; 0 for none")
+	number := fs.Int("partition", 0, "partition number (1-based) to use (default: the first free entry)")
+	ro := addReservedFlags(fs)
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	typeGUID, err := gpt.LookupType(*typ)
+	if err != nil {
+		return fmt.Errorf("-type: %s", trimPkg(err))
+	}
+	attributes, err := strconv.ParseUint(*attrs, 0, 64)
+	if err != nil {
+		return fmt.Errorf("-attributes: %w", err)
+	}
+	alignBytes, err := layout.ParseSize(*align)
+	if err != nil {
+		return fmt.Errorf("-align: %w", err)
+	}
+	encoded, err := partitionName(*name, *strict)
+	if err != nil {
+		return err
+	}
+	reserved, err := ro.regions()
+	if err != nil {
+		return err
+	}
+	path := fs.Arg(0)
+
+	s, err := wo.open(path, "new")
+	if err != nil {
+		return err
+	}
+	if s.Disk == nil {
+		return s.finish(nil, fmt.Errorf("%s has no readable GPT; write one with init first", path))
+	}
+	t := s.Disk.Table()
+	if !t.Header.IsPrimary() {
+		t = t.Alternate()
+	}
+	t.Reserved = reserved
+	ss := int64(t.SectorSize)
+	if alignBytes%ss != 0 {
+		return s.finish(nil, fmt.Errorf("-align %d is not a multiple of the %d-byte sector size", alignBytes, ss))
+	}
+	idx, err := newEntrySlot(t, *number)
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	first, last, err := placeEntry(t, *startFlag, *sizeFlag, uint64(max(alignBytes/ss, 1)))
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	g, err := uniqueGUID(t)
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	t.Entries[idx] = gpt.Entry{
+		PartitionTypeGUID: typeGUID,
+		UniqueGUID:        g,
+		StartingLBA:       first,
+		EndingLBA:         last,
+		Attributes:        attributes,
+		PartitionName:     encoded,
+	}
+	if err = s.finish(t, t.ApplyTo(s.Dev)); err != nil {
+		return err
+	}
+	e := t.Entries[idx]
+	fmt.Printf("created partition %d: %d-%d (%s), type %s, PARTUUID %s\n", idx+1, e.StartingLBA, e.EndingLBA,
+		humanBytes(int64(e.SizeBytes(int(ss)))), typeLabel(typeGUID), g)
+	return nil
+}
+
+// newEntrySlot returns the index of the entry a new partition goes in:
+// that of partition number n if it is free, or the first free one for 0.
+func newEntrySlot(t *gpt.Table, n int) (int, error) {
+	if n == 0 {
+		if idx := t.FreeSlot(); idx >= 0 {
+			return idx, nil
+		}
+		return 0, fmt.Errorf("all %d partition entries are in use", len(t.Entries))
+	}
+	if n < 0 || n > len(t.Entries) {
+		return 0, fmt.Errorf("-partition %d: the table has entries 1-%d", n, len(t.Entries))
+	}
+	if !t.Entries[n-1].IsEmpty() {
+		return 0, fmt.Errorf("-partition %d is in use", n)
+	}
+	return n - 1, nil
+}
+
+// placeEntry picks the sectors of a new partition from the free space of t.
+// start is an LBA, a byte offset with a unit, or "" to pick the first start
+// aligned to align sectors; size is a size with a unit, or "largest" for
+// the rest of the free region at start, or the largest one.
+func placeEntry(t *gpt.Table, start, size string, align uint64) (first, last uint64, err error) {
+	ss := int64(t.SectorSize)
+	largest := size == "largest"
+	var n uint64
+	if !largest {
+		b, err := layout.ParseSize(size)
+		if err != nil {
+			return 0, 0, fmt.Errorf("-size: %w", err)
+		}
+		if b == 0 {
+			return 0, 0, errors.New("-size must not be 0")
+		}
+		n = uint64((b + ss - 1) / ss)
+	}
+	if start == "" {
+		if largest {
+			g, ok := t.LargestGap(align)
+			if !ok {
+				return 0, 0, errors.New("no free space")
+			}
+			return g.First, g.Last, nil
+		}
+		first, ok := t.FindFree(n, align)
+		if !ok {
+			return 0, 0, fmt.Errorf("no aligned free region of %s", humanBytes(int64(n)*ss))
+		}
+		return first, first + n - 1, nil
+	}
+
+	first, err = parseStart(start, ss)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, x := range t.Free() {
+		if first < x.First || first > x.Last {
+			continue
+		}
+		if first%align != 0 {
+			fmt.Fprintf(os.Stderr, "warning: LBA %d is not aligned to %s\n", first, humanBytes(int64(align)*ss))
+		}
+		if largest {
+			return first, x.Last, nil
+		}
+		if x.Last-first+1 < n {
+			return 0, 0, fmt.Errorf("only %s is free from LBA %d, up to LBA %d", humanBytes(int64(x.Last-first+1)*ss), first, x.Last)
+		}
+		return first, first + n - 1, nil
+	}
+	if first < t.Header.FirstUsableLBA || first > t.Header.LastUsableLBA {
+		return 0, 0, fmt.Errorf("LBA %d is outside the usable area %d-%d", first, t.Header.FirstUsableLBA, t.Header.LastUsableLBA)
+	}
+	for _, i := range t.Used() {
+		if e := t.Entries[i]; e.StartingLBA <= first && first <= e.EndingLBA {
+			return 0, 0, fmt.Errorf("LBA %d is in partition %d (%d-%d)", first, i+1, e.StartingLBA, e.EndingLBA)
+		}
+	}
+	for _, r := range t.Reserved {
+		if r.Overlaps(first, first, int(ss)) {
+			return 0, 0, fmt.Errorf("LBA %d is in reserved region %s", first, r)
+		}
+	}
+	return 0, 0, fmt.Errorf("LBA %d is not free", first)
+}
+
+// parseStart parses -start: a plain number is an LBA, one with a unit a
+// byte offset, which must fall on a sector boundary.
+func parseStart(s string, ss int64) (uint64, error) {
+	if lba, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return lba, nil
+	}
+	b, err := layout.ParseSize(s)
+	if err != nil {
+		return 0, fmt.Errorf("-start: %w", err)
+	}
+	if b%ss != 0 {
+		return 0, fmt.Errorf("-start %s is not a multiple of the %d-byte sector size", s, ss)
+	}
+	return uint64(b / ss), nil
+}
+
+// uniqueGUID returns a random GUID not already used by t for the disk or
+// any partition.
+func uniqueGUID(t *gpt.Table) (gpt.GUID, error) {
+	for {
+		g, err := gpt.NewGUID()
+		if err != nil {
+			return g, err
+		}
+		taken := g == t.Header.DiskGUID
+		for _, i := range t.Used() {
+			taken = taken || t.Entries[i].UniqueGUID == g
+		}
+		if !taken {
+			return g, nil
+		}
+	}
+}
+
+// typeLabel names a partition type by its friendly name, or its GUID.
+func typeLabel(g gpt.GUID) string {
+	if n := gpt.TypeName(g); n != "" {
+		return n
+	}
+	return g.String()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cpuuntery/go-code-and-bin/audit"
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// runOverlay deals with the overlay file commands write to under -overlay:
+// what it changes, writing it to the disk, or throwing it away.
+func runOverlay(args []string) error {
+	sub := map[string]func([]string) error{
+		"status":  runOverlayStatus,
+		"commit":  runOverlayCommit,
+		"discard": runOverlayDiscard,
+	}
+	if len(args) == 0 || sub[args[0]] == nil {
+		fmt.Fprintf(os.Stderr, "usage: gptctl overlay status -overlay <file> <disk|image>\n"+
+			"       gptctl overlay commit [flags] -overlay <file> <disk|image>\n"+
+			"       gptctl overlay discard -overlay <file>\n")
+		return errors.New("overlay needs a subcommand: status, commit or discard")
+	}
+	return sub[args[0]](args[1:])
+}
+
+// openOverlay opens path read-only beneath the -overlay file. The sector
+// size is that of a block device, else 0.
+func openOverlay(path string) (*gpt.Overlay, int, error) {
+	base, size, ss, err := openBase(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	ov, err := gpt.OpenOverlay(base, size, overlayPath)
+	if err != nil {
+		if c, ok := base.(io.Closer); ok {
+			c.Close()
+		}
+		return nil, 0, err
+	}
+	return ov, ss, nil
+}
+
+// openBase opens path read-only as the disk it holds, through its
+// container format if it has one, without regard to -overlay. The reader
+// has a Close. The sector size is that of a block device, else 0.
+func openBase(path string) (io.ReaderAt, int64, int, error) {
+	img, _, err := device.OpenImage(path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if img != nil {
+		return img, img.Size(), 0, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	size, err := gpt.DeviceSize(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, 0, fmt.Errorf("size of %s: %w", path, err)
+	}
+	ss := 0
+	if isBlockDevice(path) {
+		ss, _, _ = gpt.BlockSizes(f)
+	}
+	return f, size, ss, nil
+}
+
+func runOverlayStatus(args []string) error {
+	fs := newFlagSet("overlay status", "-overlay <file> <disk|image>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if overlayPath == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("an overlay file and a disk are required")
+	}
+	path := fs.Arg(0)
+	if _, err := os.Stat(overlayPath); err != nil {
+		return err
+	}
+	ov, ss, err := openOverlay(path)
+	if err != nil {
+		return err
+	}
+	defer ov.Close()
+	// the disk itself, for its sector size and to compare the tables
+	file := overlayPath
+	overlayPath = ""
+	orig, origErr := openDisk(path)
+	if origErr == nil {
+		defer orig.Close()
+		ss = orig.SectorSize
+	} else if ss == 0 {
+		ss = gpt.DefaultSectorSize
+	}
+
+	ranges := ov.Changed()
+	if len(ranges) == 0 {
+		fmt.Printf("%s: no changes to %s\n", file, path)
+		return nil
+	}
+	var total int64
+	fmt.Printf("%s changes %s at:\n", file, path)
+	for _, r := range ranges {
+		fmt.Printf("  LBA %d-%d (%s)\n", r.Offset/int64(ss), (r.Offset+r.Length-1)/int64(ss), humanBytes(r.Length))
+		total += r.Length
+	}
+	fmt.Printf("%s in %d regions\n", humanBytes(total), len(ranges))
+
+	d, err := gpt.OpenDevice(ov, ov.Size(), path, gpt.WithSectorSize(ss), gpt.WithMaxTableBytes(maxTableBytes))
+	switch {
+	case err != nil:
+		fmt.Printf("no readable GPT through the overlay: %v\n", err)
+		return nil
+	case origErr != nil:
+		fmt.Printf("the disk itself has no readable GPT: %v\n", origErr)
+		return nil
+	}
+	before, after := orig.Table(), d.Table()
+	if g0, g1 := before.Header.DiskGUID, after.Header.DiskGUID; g0 != g1 {
+		fmt.Printf("  disk GUID: %s -> %s\n", g0, g1)
+	}
+	for _, c := range audit.DiffEntries(before, after) {
+		fmt.Printf("  partition %d %s: %q -> %q\n", c.Index+1, c.Field, c.Old, c.New)
+	}
+	s0, err := bootCodeSum(orig)
+	if err != nil {
+		return err
+	}
+	s1, err := bootCodeSum(d)
+	if err != nil {
+		return err
+	}
+	if s0 != s1 {
+		fmt.Printf("  MBR boot code: %s -> %s\n", s0, s1)
+	}
+	return nil
+}
+
+func runOverlayCommit(args []string) error {
+	fs := newFlagSet("overlay commit", "-overlay <file> <disk|image>")
+	keep := fs.Bool("keep", false, "keep the overlay file after committing it")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if overlayPath == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("an overlay file and a disk are required")
+	}
+	path, file := fs.Arg(0), overlayPath
+	if _, err := os.Stat(file); err != nil {
+		return err
+	}
+	// from here on the disk itself is the target
+	overlayPath = ""
+	s, err := wo.open(path, "overlay commit")
+	if err != nil {
+		return err
+	}
+	ss := s.SectorSize
+	if ss == 0 {
+		ss = gpt.DefaultSectorSize
+	}
+	ov, err := gpt.OpenOverlay(s.Dev, s.Size, file)
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	n := len(ov.Changed())
+	err = ov.Commit(s.Dev, ss)
+	ov.Close()
+	var after *gpt.Table
+	if err == nil {
+		if d, derr := gpt.OpenDevice(s.Dev, s.Size, path, gpt.WithSectorSize(ss)); derr == nil {
+			after = d.Table()
+		}
+	}
+	if err := s.finish(after, err); err != nil {
+		return err
+	}
+	fmt.Printf("committed %s to %s (%d regions)\n", file, path, n)
+	if !*keep {
+		return os.Remove(file)
+	}
+	return nil
+}
+
+func runOverlayDiscard(args []string) error {
+	fs := newFlagSet("overlay discard", "-overlay <file>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if overlayPath == "" || fs.NArg() != 0 {
+		fs.Usage()
+		return errors.New("an overlay file is required")
+	}
+	// refuse to delete something that is not an overlay
+	if ok, err := gpt.IsOverlayFile(overlayPath); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("%s is not an overlay file", overlayPath)
+	}
+	if err := os.Remove(overlayPath); err != nil {
+		return err
+	}
+	fmt.Printf("discarded %s\n", overlayPath)
+	return nil
+}
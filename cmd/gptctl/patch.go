@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// patchOp is one mutation of a patch document, which is a JSON array of
+// them applied in order:
+//
+//	[
+//	  {"op": "set-name", "partition": 2, "value": "root"},
+//	  {"op": "set-type", "partition": 2, "value": "linux"},
+//	  {"op": "set-attribute", "partition": 1, "bit": 2},
+//	  {"op": "delete", "partition": 4}
+//	]
+//
+// Attribute ops are set-attribute, clear-attribute and toggle-attribute.
+type patchOp struct {
+	Op        string  `json:"op"`
+	Partition int     `json:"partition"`
+	Value     *string `json:"value,omitempty"`
+	Bit       *int    `json:"bit,omitempty"`
+}
+
+func runPatch(args []string) error {
+	fs := newFlagSet("patch", "<patch.json|-> <disk|image>")
+	dryRun := fs.Bool("dry-run", false, "print what the patch would change without writing")
+	mirror := fs.String("mirror", "", "apply the same patch to this second disk of a manually mirrored pair; the two layouts must match")
+	newGUIDs := fs.Bool("mirror-new-guids", false, "also give the -mirror disk fresh disk and partition GUIDs, e.g. when it was cloned with dd")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("a patch document and a target are required")
+	}
+	if *newGUIDs && *mirror == "" {
+		return errors.New("-mirror-new-guids needs -mirror")
+	}
+	if *mirror == fs.Arg(1) {
+		return errors.New("-mirror names the target itself")
+	}
+	ops, err := readPatch(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		d, err := openDisk(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+		if *mirror == "" {
+			_, err = patchTable(d.Table(), ops)
+			return err
+		}
+		md, err := openDisk(*mirror)
+		if err != nil {
+			return err
+		}
+		defer md.Close()
+		_, _, err = patchMirrored(d, md, fs.Arg(1), *mirror, ops, *newGUIDs)
+		return err
+	}
+
+	s, err := wo.open(fs.Arg(1), "patch")
+	if err != nil {
+		return err
+	}
+	if s.Disk == nil {
+		return s.finish(nil, fmt.Errorf("%s has no readable GPT", fs.Arg(1)))
+	}
+	if *mirror == "" {
+		// every op is checked before anything is written, so a patch
+		// applies completely or not at all
+		t, err := patchTable(s.Disk.Table(), ops)
+		if err == nil {
+			err = t.ApplyTo(s.Dev)
+		}
+		if err = s.finish(t, err); err != nil {
+			return err
+		}
+		fmt.Printf("applied %d changes to %s\n", len(ops), fs.Arg(1))
+		return nil
+	}
+
+	ms, err := wo.open(*mirror, "patch")
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	if ms.Disk == nil {
+		err = fmt.Errorf("%s has no readable GPT", *mirror)
+		return errors.Join(ms.finish(nil, err), s.finish(nil, err))
+	}
+	// both tables are patched and checked before either disk is written;
+	// the mirror is only written once the first disk took the change
+	t, mt, err := patchMirrored(s.Disk, ms.Disk, fs.Arg(1), *mirror, ops, *newGUIDs)
+	if err == nil {
+		err = t.ApplyTo(s.Dev)
+	}
+	if err = s.finish(t, err); err != nil {
+		return errors.Join(err, ms.finish(nil, fmt.Errorf("%s was not written", *mirror)))
+	}
+	if err = ms.finish(mt, mt.ApplyTo(ms.Dev)); err != nil {
+		return fmt.Errorf("%s was patched but its mirror was not, the layouts now differ: %w", fs.Arg(1), err)
+	}
+	fmt.Printf("applied %d changes to %s and %s\n", len(ops), fs.Arg(1), *mirror)
+	return nil
+}
+
+// patchMirrored patches the tables of both disks of a mirror after checking
+// their layouts match, printing the changes per disk. With newGUIDs the
+// mirror's table also gets fresh disk and partition GUIDs.
+func patchMirrored(d, md *gpt.Disk, name, mirrorName string, ops []patchOp, newGUIDs bool) (*gpt.Table, *gpt.Table, error) {
+	if err := sameLayout(d.Table(), md.Table()); err != nil {
+		return nil, nil, fmt.Errorf("%s and %s are not mirrors: %w", name, mirrorName, err)
+	}
+	fmt.Printf("%s:\n", name)
+	t, err := patchTable(d.Table(), ops)
+	if err != nil {
+		return nil, nil, err
+	}
+	fmt.Printf("%s:\n", mirrorName)
+	mt, err := patchTable(md.Table(), ops)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", mirrorName, err)
+	}
+	if newGUIDs {
+		if err := regenerateGUIDs(mt); err != nil {
+			return nil, nil, err
+		}
+	} else if mt.Header.DiskGUID == t.Header.DiskGUID {
+		fmt.Fprintf(os.Stderr, "note: both disks have disk GUID %s; -mirror-new-guids gives %s its own\n", t.Header.DiskGUID, mirrorName)
+	}
+	return t, mt, nil
+}
+
+// sameLayout reports the first partition whose place or type differs
+// between a and b.
+func sameLayout(a, b *gpt.Table) error {
+	if len(a.Entries) != len(b.Entries) {
+		return fmt.Errorf("%d entries against %d", len(a.Entries), len(b.Entries))
+	}
+	for i := range a.Entries {
+		ea, eb := a.Entries[i], b.Entries[i]
+		if ea.IsEmpty() != eb.IsEmpty() ||
+			!ea.IsEmpty() && (ea.StartingLBA != eb.StartingLBA || ea.EndingLBA != eb.EndingLBA || ea.PartitionTypeGUID != eb.PartitionTypeGUID) {
+			return fmt.Errorf("partition %d differs", i+1)
+		}
+	}
+	return nil
+}
+
+// regenerateGUIDs gives t a new disk GUID and every used entry a new
+// unique GUID, printing each change.
+func regenerateGUIDs(t *gpt.Table) error {
+	g, err := gpt.NewGUID()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("disk GUID %s -> %s\n", t.Header.DiskGUID, g)
+	t.Header.DiskGUID = g
+	for _, i := range t.Used() {
+		if g, err = gpt.NewGUID(); err != nil {
+			return err
+		}
+		fmt.Printf("partition %d: GUID %s -> %s\n", i+1, t.Entries[i].UniqueGUID, g)
+		t.Entries[i].UniqueGUID = g
+	}
+	return nil
+}
+
+func readPatch(path string) ([]patchOp, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var ops []patchOp
+	if err := dec.Decode(&ops); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return ops, nil
+}
+
+// patchTable returns the primary copy of t with ops applied, printing each
+// change. t itself is not modified.
+func patchTable(t *gpt.Table, ops []patchOp) (*gpt.Table, error) {
+	if t.Header.IsPrimary() {
+		t = t.Clone()
+	} else {
+		t = t.Alternate()
+	}
+	for i, op := range ops {
+		if err := applyPatchOp(t, op); err != nil {
+			return nil, fmt.Errorf("op %d (%s): %w", i+1, op.Op, err)
+		}
+	}
+	return t, nil
+}
+
+func applyPatchOp(t *gpt.Table, op patchOp) error {
+	if op.Partition < 1 || op.Partition > len(t.Entries) {
+		return fmt.Errorf("partition %d out of range 1-%d", op.Partition, len(t.Entries))
+	}
+	e := &t.Entries[op.Partition-1]
+	if e.IsEmpty() {
+		return fmt.Errorf("partition %d does not exist", op.Partition)
+	}
+	value := func() (string, error) {
+		if op.Value == nil {
+			return "", errors.New(`"value" is required`)
+		}
+		return *op.Value, nil
+	}
+	bit := func() (uint64, error) {
+		if op.Bit == nil {
+			return 0, errors.New(`"bit" is required`)
+		}
+		if *op.Bit < 0 || *op.Bit > 63 {
+			return 0, fmt.Errorf("bit %d out of range 0-63", *op.Bit)
+		}
+		return 1 << *op.Bit, nil
+	}
+	switch op.Op {
+	case "set-name":
+		v, err := value()
+		if err != nil {
+			return err
+		}
+		// a patch applies as written or not at all
+		name, err := partitionName(v, true)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("partition %d: name %q -> %q\n", op.Partition, e.Name(), v)
+		e.PartitionName = name
+	case "set-type":
+		v, err := value()
+		if err != nil {
+			return err
+		}
+		g, err := gpt.LookupType(v)
+		if err != nil {
+			return err
+		}
+		if g.IsZero() {
+			return errors.New(`the zero type GUID marks an unused entry, use "delete"`)
+		}
+		fmt.Printf("partition %d: type %s -> %s\n", op.Partition, e.Type(), gpt.TypeName(g))
+		e.PartitionTypeGUID = g
+	case "set-attribute", "clear-attribute", "toggle-attribute":
+		m, err := bit()
+		if err != nil {
+			return err
+		}
+		old := e.Attributes
+		switch op.Op {
+		case "set-attribute":
+			e.Attributes |= m
+		case "clear-attribute":
+			e.Attributes &^= m
+		default:
+			e.Attributes ^= m
+		}
+		fmt.Printf("partition %d: attributes 0x%016x -> 0x%016x\n", op.Partition, old, e.Attributes)
+	case "delete":
+		fmt.Printf("partition %d: deleted (%s, %q)\n", op.Partition, e.Type(), e.Name())
+		*e = gpt.Entry{}
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+package main
+
+// Out-of-tree image container formats (device.RegisterFormat) and content
+// probes (probe.Register) are linked into gptctl by importing their
+// packages here for their side effects, e.g.
+//
+//	import _ "example.com/acme/gptplugins/acmeota"
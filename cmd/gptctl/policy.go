@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cpuuntery/go-code-and-bin/policy"
+)
+
+// runPolicy evaluates acceptance policies; check is its only subcommand so
+// far, leaving room for others.
+func runPolicy(args []string) error {
+	if len(args) == 0 || args[0] != "check" {
+		fmt.Fprintf(os.Stderr, "usage: gptctl policy check -policy <policy.json> <disk|image>...\n")
+		return errors.New("policy needs a subcommand: check")
+	}
+	fs := newFlagSet("policy check", "-policy <policy.json> <disk|image>...")
+	path := fs.String("policy", "", "policy file (see package policy for the format)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *path == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("a policy and at least one disk are required")
+	}
+	p, err := policy.Load(*path)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, disk := range fs.Args() {
+		d, err := openDisk(disk)
+		if err != nil {
+			fmt.Printf("%s: FAIL %v\n", disk, err)
+			failed++
+			continue
+		}
+		results, err := p.Check(d.Table())
+		d.Close()
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			fmt.Printf("%s: %s\n", disk, r)
+		}
+		if !policy.Passed(results) {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d disks failed the policy", failed, fs.NArg())
+	}
+	return nil
+}
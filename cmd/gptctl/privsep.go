@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// Privilege separation splits watch into two processes. The privileged
+// helper, which keeps root, only opens disks read-only and returns bytes
+// from their first and last sectors. The front-end runs as an unprivileged
+// user and does everything else: parsing GPTs, verifying them and sending
+// events. A parser bug triggered by a hostile image then only gains the
+// rights of that user and the narrow read interface of the helper.
+
+// privsepEnv names the inherited descriptor of the helper's socket in the
+// environment of the front-end.
+const privsepEnv = "GPTCTL_PRIVSEP_FD"
+
+// privsepMaxRead bounds one read request.
+const privsepMaxRead = 1 << 20
+
+type privsepRequest struct {
+	Op     string // open, read or close
+	Path   string
+	Handle int
+	Off    int64
+	Len    int
+}
+
+type privsepResponse struct {
+	Handle int
+	Size   int64
+	Data   []byte
+	Err    string
+}
+
+// privsep is the connection to the helper in a front-end, nil otherwise.
+var privsep *privsepClient
+
+type privsepClient struct {
+	mu  sync.Mutex
+	enc *gob.Encoder
+	dec *gob.Decoder
+}
+
+func newPrivsepClient(c io.ReadWriter) *privsepClient {
+	return &privsepClient{enc: gob.NewEncoder(c), dec: gob.NewDecoder(c)}
+}
+
+func (c *privsepClient) call(req privsepRequest) (privsepResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var resp privsepResponse
+	if err := c.enc.Encode(req); err != nil {
+		return resp, fmt.Errorf("privsep helper: %w", err)
+	}
+	if err := c.dec.Decode(&resp); err != nil {
+		return resp, fmt.Errorf("privsep helper: %w", err)
+	}
+	if resp.Err != "" {
+		return resp, errors.New(resp.Err)
+	}
+	return resp, nil
+}
+
+// openDisk reads the GPT of path through the helper.
+func (c *privsepClient) openDisk(path string) (*gpt.Disk, error) {
+	resp, err := c.call(privsepRequest{Op: "open", Path: path})
+	if err != nil {
+		return nil, err
+	}
+	r := &privsepReader{c: c, handle: resp.Handle}
+	// Open reads both copies up front, so the handle is not needed after
+	defer c.call(privsepRequest{Op: "close", Handle: resp.Handle})
+	return gpt.OpenReaderAt(r, resp.Size, path, gpt.WithMaxTableBytes(maxTableBytes))
+}
+
+type privsepReader struct {
+	c      *privsepClient
+	handle int
+}
+
+func (r *privsepReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		k := min(len(p)-n, privsepMaxRead)
+		resp, err := r.c.call(privsepRequest{Op: "read", Handle: r.handle, Off: off + int64(n), Len: k})
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], resp.Data)
+		if len(resp.Data) < k {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
+
+// privsepServer is the helper's side. It serves one front-end until the
+// connection closes.
+type privsepServer struct {
+	fixed   []string // the only disks the front-end may open, if set
+	window  int64    // readable bytes at each end of a disk; 0 for all
+	files   map[int]*privsepFile
+	handles int
+}
+
+type privsepFile struct {
+	f    *os.File
+	r    io.ReaderAt
+	size int64
+}
+
+func (s *privsepServer) serve(c io.ReadWriter) error {
+	s.files = map[int]*privsepFile{}
+	defer func() {
+		for _, pf := range s.files {
+			pf.f.Close()
+		}
+	}()
+	enc, dec := gob.NewEncoder(c), gob.NewDecoder(c)
+	for {
+		var req privsepRequest
+		if err := dec.Decode(&req); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		resp, err := s.handle(req)
+		if err != nil {
+			resp = privsepResponse{Err: err.Error()}
+		}
+		if err := enc.Encode(resp); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *privsepServer) handle(req privsepRequest) (privsepResponse, error) {
+	switch req.Op {
+	case "open":
+		if !s.allowed(req.Path) {
+			return privsepResponse{}, fmt.Errorf("%s is not a disk being watched", req.Path)
+		}
+		f, err := os.Open(req.Path)
+		if err != nil {
+			return privsepResponse{}, err
+		}
+		size, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			f.Close()
+			return privsepResponse{}, err
+		}
+		s.handles++
+		s.files[s.handles] = &privsepFile{f: f, r: gpt.WithDeadline(f, ioTimeout), size: size}
+		return privsepResponse{Handle: s.handles, Size: size}, nil
+	case "read":
+		pf := s.files[req.Handle]
+		if pf == nil {
+			return privsepResponse{}, errors.New("bad handle")
+		}
+		if req.Len < 0 || req.Len > privsepMaxRead || req.Off < 0 {
+			return privsepResponse{}, errors.New("bad read request")
+		}
+		end := req.Off + int64(req.Len)
+		if s.window > 0 && end > s.window && req.Off < pf.size-s.window {
+			return privsepResponse{}, fmt.Errorf("read at %d is outside the GPT areas", req.Off)
+		}
+		b := make([]byte, req.Len)
+		n, err := pf.r.ReadAt(b, req.Off)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return privsepResponse{}, err
+		}
+		return privsepResponse{Data: b[:n]}, nil
+	case "close":
+		if pf := s.files[req.Handle]; pf != nil {
+			pf.f.Close()
+			delete(s.files, req.Handle)
+		}
+		return privsepResponse{}, nil
+	}
+	return privsepResponse{}, fmt.Errorf("unknown request %q", req.Op)
+}
+
+// allowed reports whether the front-end may open path: one of the disks
+// named on the command line, else any disk currently attached.
+func (s *privsepServer) allowed(path string) bool {
+	if len(s.fixed) > 0 {
+		for _, p := range s.fixed {
+			if p == path {
+				return true
+			}
+		}
+		return false
+	}
+	devs, err := device.List()
+	if err != nil {
+		return false
+	}
+	for _, d := range devs {
+		if d.Path == path {
+			return true
+		}
+	}
+	return false
+}
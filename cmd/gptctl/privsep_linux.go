@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// runPrivsepHelper starts "gptctl watch args" as username, connected to
+// this process over a socket pair, and serves its disk reads until it
+// exits.
+func runPrivsepHelper(username string, fixed, args []string) error {
+	if os.Geteuid() != 0 {
+		return errors.New("-privsep-user needs to be started as root")
+	}
+	u, err := user.Lookup(username)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("user %s: uid %q", username, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return fmt.Errorf("user %s: gid %q", username, u.Gid)
+	}
+	if uid == 0 {
+		return fmt.Errorf("user %s is root", username)
+	}
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	ours := os.NewFile(uintptr(fds[0]), "privsep helper")
+	theirs := os.NewFile(uintptr(fds[1]), "privsep front-end")
+	defer ours.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		theirs.Close()
+		return err
+	}
+	cmd := exec.Command(exe, append([]string{"watch"}, args...)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = nil, os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{theirs} // descriptor 3
+	cmd.Env = append(os.Environ(), privsepEnv+"=3")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		// an empty group list drops root's supplementary groups too
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: []uint32{}},
+		Pdeathsig:  syscall.SIGKILL,
+	}
+	err = cmd.Start()
+	theirs.Close()
+	if err != nil {
+		return err
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		for s := range sig {
+			cmd.Process.Signal(s)
+		}
+	}()
+	srv := &privsepServer{fixed: fixed}
+	if maxTableBytes > 0 {
+		srv.window = maxTableBytes + 1<<20
+	}
+	go func() {
+		if err := srv.serve(ours); err != nil {
+			fmt.Fprintf(os.Stderr, "gptctl watch: privsep helper: %v\n", err)
+			cmd.Process.Kill()
+		}
+	}()
+	return cmd.Wait()
+}
+
+// connectPrivsep is called in the front-end to reach its helper.
+func connectPrivsep(fd string) error {
+	n, err := strconv.Atoi(fd)
+	if err != nil || n < 3 {
+		return fmt.Errorf("%s=%q is not a descriptor", privsepEnv, fd)
+	}
+	if os.Geteuid() == 0 {
+		return errors.New("privsep front-end is running as root")
+	}
+	privsep = newPrivsepClient(os.NewFile(uintptr(n), "privsep helper"))
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func runPrivsepHelper(username string, fixed, args []string) error {
+	return errors.New("-privsep-user is only supported on Linux")
+}
+
+func connectPrivsep(fd string) error {
+	return errors.New("privilege separation is only supported on Linux")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+func runRealign(args []string) error {
+	fs := newFlagSet("realign", "<disk|image>")
+	align := fs.String("align", "1MiB", "alignment of every partition start, e.g. 4KiB; 0 packs them back to back")
+	keepOrder := fs.Bool("keep-order", false, "keep the partitions in their current on-disk order (the default)")
+	bySize := fs.Bool("sort-by-size", false, "place the partitions largest first")
+	startAt := fs.Uint64("start-at", 0, "LBA the first partition starts at, at least (default: the first usable LBA)")
+	dryRun := fs.Bool("dry-run", false, "print the new layout without writing")
+	toEnd := fs.Bool("move-backup-to-end", false, "only move the backup GPT to the last sector of a disk that grew, leaving every partition where it is")
+	metadataOnly := fs.Bool("metadata-only", false, "only rewrite the partition table, leaving the partitions' contents where they were (this corrupts every partition that moves unless its data is moved some other way)")
+	ro := addReservedFlags(fs)
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	if *keepOrder && *bySize {
+		return errors.New("use either -keep-order or -sort-by-size")
+	}
+	if *toEnd {
+		var repack string
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "align", "keep-order", "sort-by-size", "start-at", "metadata-only", "layout", "preset":
+				repack = f.Name
+			}
+		})
+		if repack != "" {
+			return fmt.Errorf("-move-backup-to-end does not lay out partitions; drop -%s", repack)
+		}
+	}
+	alignBytes, err := layout.ParseSize(*align)
+	if err != nil {
+		return fmt.Errorf("-align: %w", err)
+	}
+	reserved, err := ro.regions()
+	if err != nil {
+		return err
+	}
+	path := fs.Arg(0)
+
+	if *dryRun {
+		d, err := openDisk(path)
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+		if *toEnd {
+			_, err := backupToEnd(d)
+			return err
+		}
+		_, moves, err := realignTable(d.Table(), reserved, alignBytes, *startAt, *bySize)
+		if err == nil && !*metadataOnly {
+			_, err = gpt.MoveOrder(moves)
+		}
+		return err
+	}
+	s, err := wo.open(path, "realign")
+	if err != nil {
+		return err
+	}
+	if s.Disk == nil {
+		return s.finish(nil, fmt.Errorf("%s has no readable GPT", path))
+	}
+	if *toEnd {
+		t, err := backupToEnd(s.Disk)
+		if err == nil && t != nil {
+			if err = t.ApplyTo(s.Dev); err == nil {
+				ss := int64(s.Disk.SectorSize)
+				err = resizeProtective(s.Dev, s.Size/ss, int(ss))
+			}
+		}
+		return s.finish(t, err)
+	}
+	t, moves, err := realignTable(s.Disk.Table(), reserved, alignBytes, *startAt, *bySize)
+	if err == nil && !*metadataOnly {
+		// the data goes first: should the move fail half way, the old
+		// table still describes the partitions not yet moved
+		err = moveData(s, moves)
+	}
+	if err == nil {
+		err = t.ApplyTo(s.Dev)
+	}
+	if err = s.finish(t, err); err != nil {
+		return err
+	}
+	if *metadataOnly {
+		fmt.Println("partition table rewritten; partition contents were not moved")
+	}
+	return nil
+}
+
+// moveData copies the contents of every partition that moves to its new
+// place, in an order that never overwrites data still to be copied.
+func moveData(s *writeSession, moves []gpt.Move) error {
+	order, err := gpt.MoveOrder(moves)
+	if err != nil {
+		return err
+	}
+	ss := uint64(s.Disk.SectorSize)
+	for _, m := range order {
+		fmt.Printf("moving partition %d: %s from LBA %d to %d\n", m.Index+1, humanBytes(int64(m.Sectors*ss)), m.OldStart, m.NewStart)
+		purpose := fmt.Sprintf("partition %d data", m.Index+1)
+		if err := gpt.CopySectors(s.Dev, m.OldStart, m.NewStart, m.Sectors, int(ss), purpose); err != nil {
+			return fmt.Errorf("moving partition %d: %w", m.Index+1, err)
+		}
+	}
+	return nil
+}
+
+// realignTable returns the primary copy of t realigned, printing where
+// each partition goes, clear of the reserved regions. t itself is not
+// modified.
+func realignTable(t *gpt.Table, reserved []gpt.Reserved, alignBytes int64, startAt uint64, bySize bool) (*gpt.Table, []gpt.Move, error) {
+	if t.Header.IsPrimary() {
+		t = t.Clone()
+	} else {
+		t = t.Alternate()
+	}
+	t.Reserved = reserved
+	ss := int64(t.SectorSize)
+	if alignBytes%ss != 0 {
+		return nil, nil, fmt.Errorf("-align %d is not a multiple of the %d-byte sector size", alignBytes, ss)
+	}
+	moves, err := t.Realign(gpt.RealignOptions{Align: uint64(alignBytes / ss), StartAt: startAt, SortBySize: bySize})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, m := range moves {
+		e := t.Entries[m.Index]
+		what := "unchanged"
+		if m.NewStart != m.OldStart {
+			what = fmt.Sprintf("moves from %d", m.OldStart)
+		}
+		fmt.Printf("partition %d %q: %d-%d (%s)\n", m.Index+1, e.Name(), e.StartingLBA, e.EndingLBA, what)
+	}
+	return t, moves, nil
+}
+
+// backupToEnd returns the primary copy of d's table with its backup moved to
+// the last LBA, printing the change, or nil if the backup is there already.
+func backupToEnd(d *gpt.Disk) (*gpt.Table, error) {
+	t := d.Table()
+	if t.Header.IsPrimary() {
+		t = t.Clone()
+	} else {
+		t = t.Alternate()
+	}
+	h := t.Header
+	last := d.LastLBA()
+	if h.BackupLBA == last {
+		fmt.Printf("backup GPT is already at the last LBA %d\n", last)
+		return nil, nil
+	}
+	if err := t.MoveBackup(last); err != nil {
+		return nil, err
+	}
+	fmt.Printf("backup GPT header: LBA %d -> %d\n", h.BackupLBA, t.Header.BackupLBA)
+	fmt.Printf("last usable LBA: %d -> %d\n", h.LastUsableLBA, t.Header.LastUsableLBA)
+	return t, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// runRepair rewrites a damaged or missing GPT copy from the other one, like
+// the recovery menu of gdisk: the header and entry array CRCs of both
+// copies are checked and, when exactly one copy is valid, the other is
+// derived from it with its own CurrentLBA, BackupLBA and PartitionEntryLBA.
+// The valid copy is not written. With -interactive it walks through the
+// findings of verify instead, offering a fix for each.
+func runRepair(args []string) error {
+	fs := newFlagSet("repair", "<disk|image>")
+	from := fs.String("from", "", `copy to repair from when both are valid but differ: "primary" or "backup"`)
+	dryRun := fs.Bool("dry-run", false, "report what would be rewritten without writing")
+	interactive := fs.Bool("interactive", false, "go through the verify findings one by one, choosing a fix for each, and write the chosen fixes at the end")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	switch *from {
+	case "", "primary", "backup":
+	default:
+		return fmt.Errorf("-from %q: want primary or backup", *from)
+	}
+	path := fs.Arg(0)
+
+	if *interactive {
+		if *from != "" {
+			return errors.New("-from and -interactive do not mix; the wizard asks which copy to keep")
+		}
+		return repairInteractive(path, wo, *dryRun)
+	}
+	if *dryRun {
+		d, err := openDisk(path)
+		if err != nil {
+			return err
+		}
+		defer d.Close()
+		_, err = repairCopy(d, *from, os.Stdout)
+		return err
+	}
+	s, err := wo.open(path, "repair")
+	if err != nil {
+		return err
+	}
+	if s.Disk == nil {
+		return s.finish(nil, fmt.Errorf("%s has no GPT copy to repair from", path))
+	}
+	t, err := repairCopy(s.Disk, *from, os.Stdout)
+	if err == nil && t != nil {
+		err = t.WriteCopy(s.Dev)
+	}
+	if err = s.finish(t, err); err != nil {
+		return err
+	}
+	if t != nil {
+		fmt.Printf("rewrote the %s GPT\n", copyName(t))
+	}
+	return nil
+}
+
+// repairCopy works out which copy of d's table to rewrite and returns it,
+// derived from the good copy, printing why to w; nil if both copies are
+// fine.
+func repairCopy(d *gpt.Disk, from string, w io.Writer) (*gpt.Table, error) {
+	pOK := d.Primary != nil && d.PrimaryErr == nil
+	bOK := d.Backup != nil && d.BackupErr == nil
+	var good *gpt.Table
+	switch {
+	case !pOK && !bOK:
+		return nil, fmt.Errorf("neither GPT copy is valid, nothing to repair from: primary: %v; backup: %v", d.PrimaryErr, d.BackupErr)
+	case pOK && bOK:
+		cerr := gpt.CompareCopies(d.Primary, d.Backup)
+		if cerr == nil {
+			fmt.Fprintln(w, "both GPT copies are valid and agree; nothing to repair")
+			return nil, nil
+		}
+		if from == "" {
+			return nil, fmt.Errorf("both GPT copies are valid but %s; choose the one to keep with -from primary or -from backup",
+				trimPkg(cerr))
+		}
+		fmt.Fprintf(w, "both GPT copies are valid but %s\n", trimPkg(cerr))
+		good = d.Primary
+		if from == "backup" {
+			good = d.Backup
+		}
+	case pOK:
+		if from == "backup" {
+			return nil, fmt.Errorf("-from backup: the backup GPT is not valid: %v", d.BackupErr)
+		}
+		fmt.Fprintf(w, "backup GPT: %s\n", trimPkg(d.BackupErr))
+		good = d.Primary
+	default:
+		if from == "primary" {
+			return nil, fmt.Errorf("-from primary: the primary GPT is not valid: %v", d.PrimaryErr)
+		}
+		fmt.Fprintf(w, "primary GPT: %s\n", trimPkg(d.PrimaryErr))
+		good = d.Backup
+	}
+
+	t := good.Alternate()
+	h := t.Header
+	if last := d.LastLBA(); h.CurrentLBA > last {
+		return nil, fmt.Errorf("the %s GPT belongs at LBA %d, past the last LBA %d: the disk or image was truncated", copyName(t), h.CurrentLBA, last)
+	}
+	fmt.Fprintf(w, "rebuilding the %s GPT from the %s: header at LBA %d, entry array at LBA %d\n", copyName(t), copyName(good), h.CurrentLBA, h.PartitionTableLBA)
+	return t, nil
+}
+
+// copyName is "primary" or "backup", after the header of t.
+func copyName(t *gpt.Table) string {
+	if t.Header.IsPrimary() {
+		return "primary"
+	}
+	return "backup"
+}
+
+// trimPkg drops the "gpt: " prefix of a library error printed mid-sentence.
+func trimPkg(err error) string {
+	return strings.TrimPrefix(err.Error(), "gpt: ")
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/verify"
+)
+
+// repairPlan collects the fixes chosen in the repair wizard. Nothing is
+// written until the end, when the table they describe is written as both
+// copies in one go.
+type repairPlan struct {
+	src        *gpt.Table // the copy to build the result from
+	srcNote    string
+	srcChosen  bool // src was picked by a fix rather than gpt.Open
+	moveBackup bool
+	fixPMBR    bool
+	deleted    map[int]bool
+	chosen     int // fixes chosen
+}
+
+// fixChoice is one answer offered for a finding.
+type fixChoice struct {
+	label string
+	apply func(p *repairPlan)
+}
+
+// repairInteractive runs verify on path and walks through its findings,
+// offering the fixes that apply to each, then writes the chosen ones after
+// a last confirmation; with dryRun it stops at the plan.
+func repairInteractive(path string, wo *writeOpts, dryRun bool) error {
+	var d *gpt.Disk
+	var s *writeSession
+	if dryRun {
+		var err error
+		if d, err = openDisk(path); err != nil {
+			return err
+		}
+		defer d.Close()
+	} else {
+		var err error
+		if s, err = wo.open(path, "repair"); err != nil {
+			return err
+		}
+		if s.Disk == nil {
+			return s.finish(nil, fmt.Errorf("%s has no GPT copy to repair from", path))
+		}
+		d = s.Disk
+	}
+	finish := func(t *gpt.Table, err error) error {
+		if s == nil {
+			return err
+		}
+		return s.finish(t, err)
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	findings := verify.Disk(d, verify.Options{})
+	if len(findings) == 0 {
+		fmt.Printf("%s: no findings; nothing to repair\n", path)
+		return finish(nil, nil)
+	}
+	p := &repairPlan{src: d.Table(), srcNote: "the " + copyName(d.Table()) + " GPT as read", deleted: map[int]bool{}}
+	for k, f := range findings {
+		fmt.Printf("\n[%d/%d] %s\n", k+1, len(findings), f)
+		choices, rec := fixChoices(d, f)
+		if len(choices) == 0 {
+			fmt.Printf("  no automatic fix; gptctl explain %s says what is checked\n", f.Rule.ID)
+			continue
+		}
+		for i, c := range choices {
+			mark := ""
+			if i == rec {
+				mark = " (recommended)"
+			}
+			fmt.Printf("  %d) %s%s\n", i+1, c.label, mark)
+		}
+		fmt.Println("  s) skip this finding")
+		fmt.Println("  q) quit without writing anything")
+		c, err := askChoice(in, len(choices), rec)
+		if err != nil {
+			return finish(nil, err)
+		}
+		switch {
+		case c == -2:
+			fmt.Println("nothing written")
+			return finish(nil, nil)
+		case c >= 0:
+			choices[c].apply(p)
+			p.chosen++
+		}
+	}
+
+	t, changes, err := p.build(d)
+	if err != nil {
+		return finish(nil, err)
+	}
+	if len(changes) == 0 {
+		fmt.Println("\nno fixes chosen; nothing written")
+		return finish(nil, nil)
+	}
+	fmt.Println("\nto write, the GPT as both copies:")
+	for _, c := range changes {
+		fmt.Printf("  - %s\n", c)
+	}
+	if dryRun {
+		return nil
+	}
+	fmt.Printf("write it to %s? [y/N] ", path)
+	line, err := in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return finish(nil, err)
+	}
+	if a := strings.ToLower(strings.TrimSpace(line)); a != "y" && a != "yes" {
+		fmt.Println("nothing written")
+		return finish(nil, nil)
+	}
+	err = t.ApplyTo(s.Dev)
+	if err == nil && p.fixPMBR {
+		err = resizeProtective(s.Dev, int64(d.LastLBA())+1, d.SectorSize)
+	}
+	if err = finish(t, err); err != nil {
+		return err
+	}
+	fmt.Printf("wrote the primary and backup GPT to %s\n", path)
+	return nil
+}
+
+// askChoice reads an answer: the 0-based choice, -1 to skip or -2 to quit.
+// An empty answer takes rec, or skips when there is no recommendation.
+func askChoice(in *bufio.Reader, n, rec int) (int, error) {
+	for {
+		fmt.Print("  choice: ")
+		line, err := in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return 0, errors.New("input ended before the repair was confirmed; nothing written")
+			}
+			return 0, err
+		}
+		switch a := strings.ToLower(strings.TrimSpace(line)); a {
+		case "":
+			return rec, nil
+		case "s":
+			return -1, nil
+		case "q":
+			return -2, nil
+		default:
+			if i, err := strconv.Atoi(a); err == nil && i >= 1 && i <= n {
+				return i - 1, nil
+			}
+		}
+		fmt.Printf("  answer 1-%d, s or q\n", n)
+	}
+}
+
+// fixChoices returns the fixes offered for f and the index of the one
+// recommended, -1 for none.
+func fixChoices(d *gpt.Disk, f verify.Finding) ([]fixChoice, int) {
+	restore := func(good *gpt.Table, bad string) fixChoice {
+		return fixChoice{fmt.Sprintf("restore the %s GPT from the %s", bad, copyName(good)), func(p *repairPlan) {
+			p.src, p.srcChosen = good, true
+			p.srcNote = "the " + copyName(good) + " GPT"
+		}}
+	}
+	keepCRC := func(t *gpt.Table) fixChoice {
+		return fixChoice{fmt.Sprintf("fix the CRCs: keep the %s GPT as read and recompute them, if its content is known good", copyName(t)), func(p *repairPlan) {
+			p.src, p.srcChosen = t, true
+			p.srcNote = fmt.Sprintf("the %s GPT as read, CRCs recomputed", copyName(t))
+		}}
+	}
+	deleteEntry := func(i int) fixChoice {
+		return fixChoice{fmt.Sprintf("delete partition %d (%s), leaving its data in place", i+1, describeEntry(d.Table().Entries[i], d.SectorSize)), func(p *repairPlan) {
+			p.deleted[i] = true
+		}}
+	}
+	pOK := d.Primary != nil && d.PrimaryErr == nil
+	bOK := d.Backup != nil && d.BackupErr == nil
+
+	switch f.Rule {
+	case verify.RuleHeaderCRC, verify.RuleEntriesCRC, verify.RuleSignature, verify.RuleHeaderInvalid:
+		// verify names the copy at the start of the message
+		bad, good, goodOK := d.Primary, d.Backup, bOK
+		name := "primary"
+		if strings.HasPrefix(f.Message, "backup:") {
+			bad, good, goodOK, name = d.Backup, d.Primary, pOK, "backup"
+		}
+		var out []fixChoice
+		rec := -1
+		if goodOK {
+			out, rec = append(out, restore(good, name)), 0
+		}
+		if bad != nil && (f.Rule == verify.RuleHeaderCRC || f.Rule == verify.RuleEntriesCRC) {
+			out = append(out, keepCRC(bad))
+		}
+		return out, rec
+	case verify.RuleCopiesDiffer:
+		return []fixChoice{restore(d.Primary, "backup"), restore(d.Backup, "primary")}, 0
+	case verify.RuleBackupLocation:
+		return []fixChoice{{fmt.Sprintf("relocate the backup GPT to the last LBA %d", d.LastLBA()), func(p *repairPlan) {
+			p.moveBackup = true
+		}}}, 0
+	case verify.RulePMBRSize:
+		return []fixChoice{{"resize the protective MBR record to cover the disk", func(p *repairPlan) {
+			p.fixPMBR = true
+		}}}, 0
+	case verify.RuleEntryInverted:
+		return []fixChoice{deleteEntry(f.Entry)}, 0
+	case verify.RuleEntryRange, verify.RuleOverlap:
+		return []fixChoice{deleteEntry(f.Entry)}, -1
+	}
+	return nil, -1
+}
+
+// build applies the plan to a copy of its source table and returns the
+// table to write, in primary form, with a line per change; no lines when
+// no fix was chosen.
+func (p *repairPlan) build(d *gpt.Disk) (*gpt.Table, []string, error) {
+	if p.chosen == 0 {
+		return nil, nil, nil
+	}
+	t := p.src.Clone()
+	if !t.Header.IsPrimary() {
+		t = t.Alternate()
+	}
+	var changes []string
+	// both copies are written from t, so a damaged copy is replaced even
+	// when its finding was skipped
+	if p.srcChosen || d.PrimaryErr != nil || d.BackupErr != nil || gpt.CompareCopies(d.Primary, d.Backup) != nil {
+		changes = append(changes, "both copies from "+p.srcNote)
+	}
+	if p.moveBackup {
+		last := d.LastLBA()
+		if err := t.MoveBackup(last); err != nil {
+			return nil, nil, fmt.Errorf("relocate the backup GPT: %w", err)
+		}
+		changes = append(changes, fmt.Sprintf("backup GPT at LBA %d, LastUsableLBA %d", last, t.Header.LastUsableLBA))
+	}
+	for i := range t.Entries {
+		if p.deleted[i] {
+			changes = append(changes, fmt.Sprintf("partition %d deleted (%s)", i+1, describeEntry(t.Entries[i], t.SectorSize)))
+			t.Entries[i] = gpt.Entry{}
+		}
+	}
+	if p.fixPMBR {
+		changes = append(changes, fmt.Sprintf("protective MBR covering LBA 1-%d", d.LastLBA()))
+	}
+	if err := t.CheckWritable(); err != nil {
+		return nil, nil, fmt.Errorf("the repaired GPT could not be written: %s; nothing written", trimPkg(err))
+	}
+	return t, changes, nil
+}
+
+// describeEntry is the extent, size and name of e, for the wizard.
+func describeEntry(e gpt.Entry, ss int) string {
+	s := fmt.Sprintf("%d-%d, %s", e.StartingLBA, e.EndingLBA, humanBytes(int64(e.SizeBytes(ss))))
+	if name := e.Name(); name != "" {
+		s += fmt.Sprintf(", %q", name)
+	}
+	return s
+}
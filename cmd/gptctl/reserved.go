@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"flag"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+// reservedOpts are the flags of the commands that place partitions on an
+// existing table, naming a layout whose reserved regions they keep clear.
+type reservedOpts struct {
+	layout, preset string
+}
+
+func addReservedFlags(fs *flag.FlagSet) *reservedOpts {
+	o := &reservedOpts{}
+	fs.StringVar(&o.layout, "layout", "", "keep partitions clear of the reserved regions of this layout file")
+	fs.StringVar(&o.preset, "preset", "", "like -layout, with a built-in preset (see gptctl init -preset list)")
+	return o
+}
+
+// regions returns the reserved regions of the layout given, or none.
+func (o *reservedOpts) regions() ([]gpt.Reserved, error) {
+	var l *layout.Layout
+	var err error
+	switch {
+	case o.layout != "" && o.preset != "":
+		return nil, errors.New("use either -layout or -preset")
+	case o.layout != "":
+		l, err = layout.Load(o.layout)
+	case o.preset != "":
+		l, err = layout.Preset(o.preset)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return l.ReservedRegions()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/cpuuntery/go-code-and-bin/fsinfo"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+// runResize moves the end of a partition, out into the free space after it
+// or in to a smaller size, in both copies of the GPT. The start stays put
+// and the data is not touched: a filesystem in the partition is not
+// resized, so shrinking below the filesystem found there is refused unless
+// -force is given.
+func runResize(args []string) error {
+	fs := newFlagSet("resize", "<disk|image> <N> | <PARTUUID=...|/dev/sdXN>")
+	size := fs.String("size", "max", `new size, e.g. 20GiB, or "max" for all the free space up to the next partition`)
+	force := fs.Bool("force", false, "shrink even below the filesystem in the partition")
+	ro := addReservedFlags(fs)
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	target, n, err := partitionArgs(fs, fs.Args())
+	if err != nil {
+		return err
+	}
+	var want int64
+	if *size != "max" {
+		if want, err = layout.ParseSize(*size); err != nil {
+			return fmt.Errorf("-size: %w", err)
+		}
+		if want <= 0 {
+			return fmt.Errorf("-size %s: want more than 0", *size)
+		}
+	}
+	reserved, err := ro.regions()
+	if err != nil {
+		return err
+	}
+
+	s, err := wo.open(target.Disk, "resize")
+	if err != nil {
+		return err
+	}
+	if s.Disk == nil {
+		return s.finish(nil, fmt.Errorf("%s has no readable GPT", target.Disk))
+	}
+	t := s.Disk.Table()
+	if !t.Header.IsPrimary() {
+		t = t.Alternate()
+	}
+	t.Reserved = reserved
+	e, n, err := pickPartition(t, target.Index, n)
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	ss := uint64(t.SectorSize)
+	end, err := resizeEnd(t, &e, want)
+	if err != nil {
+		return s.finish(nil, fmt.Errorf("partition %d: %w", n, err))
+	}
+	if end == e.EndingLBA {
+		fmt.Printf("partition %d already ends at LBA %d (%s)\n", n, end, humanBytes(int64(e.SizeBytes(int(ss)))))
+		return s.finish(nil, nil)
+	}
+	newSize := int64((end - e.StartingLBA + 1) * ss)
+	if end < e.EndingLBA && !*force {
+		if u, err := fsinfo.Read(s.Dev, int64(e.StartingLBA*ss)); err == nil && u.Size() > newSize {
+			return s.finish(nil, fmt.Errorf("partition %d holds a %s filesystem of %s, more than %s; shrink the filesystem first, or pass -force",
+				n, u.Type, humanBytes(u.Size()), humanBytes(newSize)))
+		}
+	}
+	t.Entries[n-1].EndingLBA = end
+	if err = s.finish(t, t.ApplyTo(s.Dev)); err != nil {
+		return err
+	}
+	fmt.Printf("resized partition %d: %d-%d (%s) -> %d-%d (%s)\n", n,
+		e.StartingLBA, e.EndingLBA, humanBytes(int64(e.SizeBytes(int(ss)))),
+		e.StartingLBA, end, humanBytes(newSize))
+	return nil
+}
+
+// resizeEnd returns the EndingLBA that gives e size bytes, rounded up to
+// whole sectors, or the most the free space after it allows for size 0.
+// The end must stay before the next partition or reserved region and within
+// LastUsableLBA.
+func resizeEnd(t *gpt.Table, e *gpt.Entry, size int64) (uint64, error) {
+	ss := uint64(t.SectorSize)
+	limit, next := endLimit(t, e)
+	if limit < e.StartingLBA {
+		return 0, fmt.Errorf("starts at LBA %d, past the usable area ending at LBA %d", e.StartingLBA, limit)
+	}
+	if size == 0 {
+		return limit, nil
+	}
+	end := e.StartingLBA + (uint64(size)+ss-1)/ss - 1
+	if end > limit {
+		room := humanBytes(int64((limit - e.StartingLBA + 1) * ss))
+		if next != "" {
+			return 0, fmt.Errorf("%s does not fit: %s starts at LBA %d, leaving at most %s", humanBytes(size), next, limit+1, room)
+		}
+		return 0, fmt.Errorf("%s does not fit: the usable area ends at LBA %d, leaving at most %s", humanBytes(size), limit, room)
+	}
+	return end, nil
+}
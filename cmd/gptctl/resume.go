@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// copyMap is the map file of a resumable copy, like ddrescue's: the range
+// of the source, from its start, known to be in the destination, and for
+// image-copy the SHA-256 state over that range, so a copy run again with
+// the same map file continues where the last run stopped.
+//
+// Only a completed prefix is recorded. Blocks finished out of order past
+// it are copied again, which costs at most the blocks in flight.
+type copyMap struct {
+	path   string
+	source string
+	size   int64
+	done   int64
+	hash   []byte // marshalled hash state, if the copy hashes
+	saved  time.Time
+}
+
+// copyMapInterval is how often a running copy syncs its destination and
+// records its progress.
+const copyMapInterval = 5 * time.Second
+
+// loadCopyMap reads the map file at path, which must describe a copy of
+// source, size bytes long; a map file that does not exist yet starts one.
+func loadCopyMap(path, source string, size int64) (*copyMap, error) {
+	m := &copyMap{path: path, source: source, size: size, saved: time.Now()}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var src string
+	var n int64 = -1
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		key, val, _ := strings.Cut(strings.TrimSpace(sc.Text()), " ")
+		switch key {
+		case "", "#":
+			continue
+		case "source":
+			src = val
+		case "size":
+			n, err = strconv.ParseInt(val, 10, 64)
+		case "done":
+			var start string
+			start, val, _ = strings.Cut(val, " ")
+			if start != "0" {
+				err = fmt.Errorf("range must start at 0, not %s", start)
+				break
+			}
+			m.done, err = strconv.ParseInt(val, 10, 64)
+		case "sha256":
+			m.hash, err = hex.DecodeString(val)
+		default:
+			err = fmt.Errorf("unknown key %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if src != source || n != size {
+		return nil, fmt.Errorf("%s is the map file of a copy of %s (%d bytes), not of %s (%d bytes)", path, src, n, source, size)
+	}
+	if m.done < 0 || m.done > size {
+		return nil, fmt.Errorf("%s: done %d is outside the source", path, m.done)
+	}
+	return m, nil
+}
+
+// save writes the map file, replacing the old one only once the new one is
+// complete.
+func (m *copyMap) save() error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# gptctl copy map file: run the same command with -resume %s to continue\n", m.path)
+	fmt.Fprintf(&b, "source %s\nsize %d\ndone 0 %d\n", m.source, m.size, m.done)
+	if m.hash != nil {
+		fmt.Fprintf(&b, "sha256 %x\n", m.hash)
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0o644); err != nil {
+		return err
+	}
+	m.saved = time.Now()
+	return os.Rename(tmp, m.path)
+}
+
+// checkpoint records that the first done bytes are copied, with h the hash
+// over them if not nil, once dst has them on stable storage. Unless force
+// is set it does so at most every copyMapInterval.
+func (m *copyMap) checkpoint(dst interface{ Sync() error }, done int64, h hash.Hash, force bool) error {
+	if m == nil || (!force && time.Since(m.saved) < copyMapInterval) || done == m.done {
+		return nil
+	}
+	if err := dst.Sync(); err != nil {
+		return err
+	}
+	if h != nil {
+		state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		m.hash = state
+	}
+	m.done = done
+	return m.save()
+}
+
+// restoreHash loads the recorded hash state into h.
+func (m *copyMap) restoreHash(h hash.Hash) error {
+	if m.done == 0 {
+		return nil
+	}
+	if m.hash == nil {
+		return fmt.Errorf("%s records no sha256 state to resume from", m.path)
+	}
+	return h.(encoding.BinaryUnmarshaler).UnmarshalBinary(m.hash)
+}
+
+// remove deletes the map file of a finished copy.
+func (m *copyMap) remove() error {
+	if m == nil {
+		return nil
+	}
+	err := os.Remove(m.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// errInterrupted stops a resumable copy on SIGINT or SIGTERM once its
+// progress is recorded.
+var errInterrupted = errors.New("interrupted")
+
+// copyResumable copies size bytes of r at off to w from where m says the
+// last run stopped, recording its progress in m. stop, when closed, ends
+// the copy with errInterrupted.
+func copyResumable(w *os.File, r io.ReaderAt, off, size int64, m *copyMap, stop <-chan struct{}) error {
+	if err := w.Truncate(m.done); err != nil {
+		return err
+	}
+	if m.done > 0 {
+		fmt.Fprintf(os.Stderr, "resuming at byte %d of %d\n", m.done, size)
+	}
+	buf := make([]byte, 1<<20)
+	done := m.done
+	for done < size {
+		select {
+		case <-stop:
+			return errors.Join(errInterrupted, m.checkpoint(w, done, nil, true))
+		default:
+		}
+		b := buf[:min(int64(len(buf)), size-done)]
+		if _, err := r.ReadAt(b, off+done); err != nil {
+			return errors.Join(fmt.Errorf("read at byte %d: %w", off+done, err), m.checkpoint(w, done, nil, true))
+		}
+		if _, err := w.WriteAt(b, done); err != nil {
+			return errors.Join(fmt.Errorf("write at byte %d: %w", done, err), m.checkpoint(w, done, nil, true))
+		}
+		done += int64(len(b))
+		if err := m.checkpoint(w, done, nil, false); err != nil {
+			return err
+		}
+	}
+	return w.Sync()
+}
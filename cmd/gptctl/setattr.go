@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// runSetattr changes attribute bits of a partition in both copies of the
+// GPT. Each change is +bit or -bit to set or clear one bit, by number or
+// name (+legacy-boot, -2), or name=value for the multi-bit fields of
+// ChromeOS kernel partitions (chromeos-priority=3); gptctl explain lists
+// the names. Changes apply in order, so A/B boot flows can be scripted
+// without working out the hex.
+func runSetattr(args []string) error {
+	fs := newFlagSet("setattr", "<disk|image> <N> <change>... | <PARTUUID=...|/dev/sdXN> <change>...")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	pos := fs.Args()
+	k := 1
+	if len(pos) > 1 && isDigits(pos[1]) {
+		k = 2
+	}
+	if len(pos) <= k {
+		fs.Usage()
+		return errors.New("a partition and at least one change, e.g. +legacy-boot, are required")
+	}
+	target, n, err := partitionArgs(fs, pos[:k])
+	if err != nil {
+		return err
+	}
+	var changes []attrChange
+	for _, a := range pos[k:] {
+		c, err := parseAttrChange(a)
+		if err != nil {
+			return err
+		}
+		changes = append(changes, c)
+	}
+
+	s, err := wo.open(target.Disk, "setattr")
+	if err != nil {
+		return err
+	}
+	if s.Disk == nil {
+		return s.finish(nil, fmt.Errorf("%s has no readable GPT", target.Disk))
+	}
+	t := s.Disk.Table()
+	if !t.Header.IsPrimary() {
+		t = t.Alternate()
+	}
+	e, n, err := pickPartition(t, target.Index, n)
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	v := e.Attributes
+	for _, c := range changes {
+		v = v&^c.mask | c.value
+	}
+	if v == e.Attributes {
+		fmt.Printf("partition %d already has attributes 0x%016x [%s]\n", n, v, attrNames(v))
+		return s.finish(nil, nil)
+	}
+	t.Entries[n-1].Attributes = v
+	if err = s.finish(t, t.ApplyTo(s.Dev)); err != nil {
+		return err
+	}
+	fmt.Printf("partition %d: attributes 0x%016x [%s] -> 0x%016x [%s]\n", n, e.Attributes, attrNames(e.Attributes), v, attrNames(v))
+	return nil
+}
+
+// attrChange replaces the bits of mask in the attributes with value.
+type attrChange struct {
+	mask, value uint64
+}
+
+// parseAttrChange parses +bit, -bit or name=value, a bit given by number
+// or by name.
+func parseAttrChange(s string) (attrChange, error) {
+	if name, val, ok := strings.Cut(s, "="); ok {
+		if strings.HasPrefix(name, "+") || strings.HasPrefix(name, "-") {
+			return attrChange{}, fmt.Errorf("attribute change %q: want +bit, -bit or name=value", s)
+		}
+		a, err := lookupAttr(name)
+		if err != nil {
+			return attrChange{}, err
+		}
+		n, err := strconv.ParseUint(val, 0, 64)
+		if err != nil || n >= 1<<a.width {
+			return attrChange{}, fmt.Errorf("%s: %s is %s, so 0-%d", s, name, bitRange(a), uint64(1)<<a.width-1)
+		}
+		mask := (uint64(1)<<a.width - 1) << a.bit
+		return attrChange{mask, n << a.bit}, nil
+	}
+	if len(s) < 2 || s[0] != '+' && s[0] != '-' {
+		return attrChange{}, fmt.Errorf("attribute change %q: want +bit, -bit or name=value", s)
+	}
+	a, err := lookupAttr(s[1:])
+	if err != nil {
+		return attrChange{}, err
+	}
+	if a.width > 1 {
+		return attrChange{}, fmt.Errorf("%s: %s is %s, give a value with %s=N", s, a.name, bitRange(a), a.name)
+	}
+	mask := uint64(1) << a.bit
+	if s[0] == '-' {
+		return attrChange{mask, 0}, nil
+	}
+	return attrChange{mask, mask}, nil
+}
+
+// lookupAttr finds an attribute bit by number, 0-63, or name.
+func lookupAttr(s string) (attrBit, error) {
+	if isDigits(s) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n > 63 {
+			return attrBit{}, fmt.Errorf("attribute bit %s: bits are 0-63", s)
+		}
+		// by number it is always the one bit, even inside a field
+		a := lookupAttrBit(n)
+		a.bit, a.width = n, 1
+		return a, nil
+	}
+	a := lookupAttrName(s)
+	if a.name == "" {
+		return attrBit{}, fmt.Errorf("unknown attribute %q; gptctl explain lists them", s)
+	}
+	return a, nil
+}
+
+// attrNames lists the attributes set in v by name, the multi-bit fields
+// with their value and unnamed bits by number.
+func attrNames(v uint64) string {
+	var out []string
+	for n := 0; n < 64; n++ {
+		if v&(1<<n) == 0 {
+			continue
+		}
+		a := lookupAttrBit(n)
+		switch {
+		case a.name == "":
+			out = append(out, strconv.Itoa(n))
+		case a.width == 1:
+			out = append(out, a.name)
+		default:
+			out = append(out, fmt.Sprintf("%s=%d", a.name, v>>a.bit&(1<<a.width-1)))
+			n = a.bit + a.width - 1
+		}
+	}
+	return strings.Join(out, ",")
+}
+
+// isDigits reports whether s is a non-empty run of decimal digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// runSetname gives a partition a new name in both copies of the GPT. The
+// name is stored as UTF-16LE in the 72-byte PartitionName field, 36 code
+// units at most; a longer name is cut short with a warning, or refused
+// with -strict.
+func runSetname(args []string) error {
+	fs := newFlagSet("setname", "<disk|image> <N> <name> | <PARTUUID=...|/dev/sdXN> <name>")
+	strict := fs.Bool("strict", false, strictNameUsage)
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("a partition and a name are required")
+	}
+	target, n, err := partitionArgs(fs, fs.Args()[:fs.NArg()-1])
+	if err != nil {
+		return err
+	}
+	name := fs.Arg(fs.NArg() - 1)
+	raw, err := partitionName(name, *strict)
+	if err != nil {
+		return err
+	}
+
+	s, err := wo.open(target.Disk, "setname")
+	if err != nil {
+		return err
+	}
+	if s.Disk == nil {
+		return s.finish(nil, fmt.Errorf("%s has no readable GPT", target.Disk))
+	}
+	t := s.Disk.Table()
+	if !t.Header.IsPrimary() {
+		t = t.Alternate()
+	}
+	e, n, err := pickPartition(t, target.Index, n)
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	if e.PartitionName == raw {
+		fmt.Printf("partition %d is already named %q\n", n, e.Name())
+		return s.finish(nil, nil)
+	}
+	t.Entries[n-1].PartitionName = raw
+	if err = s.finish(t, t.ApplyTo(s.Dev)); err != nil {
+		return err
+	}
+	fmt.Printf("partition %d: name %q -> %q\n", n, e.Name(), gpt.DecodeName(raw))
+	return nil
+}
+
+// strictNameUsage documents the -strict flag of the commands that name a
+// partition.
+const strictNameUsage = "refuse a name longer than 36 UTF-16 units instead of truncating it"
+
+// partitionName checks name and encodes it for the PartitionName field, for
+// every command that names a partition. A NUL would end the name early for
+// every reader, and bytes that are not UTF-8 have no UTF-16 form. A name
+// over 36 UTF-16 units is truncated with a warning, or refused if strict.
+func partitionName(name string, strict bool) ([72]byte, error) {
+	if !utf8.ValidString(name) {
+		return [72]byte{}, fmt.Errorf("name %q is not valid UTF-8", name)
+	}
+	if strings.ContainsRune(name, 0) {
+		return [72]byte{}, fmt.Errorf("name %q contains a NUL", name)
+	}
+	raw, truncated := gpt.EncodeName(name)
+	if truncated {
+		msg := fmt.Sprintf("name %q is longer than 36 UTF-16 units", name)
+		if strict {
+			return [72]byte{}, fmt.Errorf("%s; it would be stored as %q", msg, gpt.DecodeName(raw))
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s; stored as %q\n", msg, gpt.DecodeName(raw))
+	}
+	return raw, nil
+}
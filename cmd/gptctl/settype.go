@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// runSettype changes the type GUID of a partition in both copies of the
+// GPT. The type is a GUID, an alias such as esp, linux, swap or msr, or
+// the friendly name gptctl prints for it.
+func runSettype(args []string) error {
+	fs := newFlagSet("settype", "<disk|image> <N> <type> | <PARTUUID=...|/dev/sdXN> <type>")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("a partition and a type are required")
+	}
+	target, n, err := partitionArgs(fs, fs.Args()[:fs.NArg()-1])
+	if err != nil {
+		return err
+	}
+	typ, err := gpt.LookupType(fs.Arg(fs.NArg() - 1))
+	if err != nil {
+		return errors.New(trimPkg(err))
+	}
+	if typ.IsZero() {
+		return errors.New("the zero type GUID marks an unused entry, use gptctl delete")
+	}
+
+	s, err := wo.open(target.Disk, "settype")
+	if err != nil {
+		return err
+	}
+	if s.Disk == nil {
+		return s.finish(nil, fmt.Errorf("%s has no readable GPT", target.Disk))
+	}
+	t := s.Disk.Table()
+	if !t.Header.IsPrimary() {
+		t = t.Alternate()
+	}
+	e, n, err := pickPartition(t, target.Index, n)
+	if err != nil {
+		return s.finish(nil, err)
+	}
+	if e.PartitionTypeGUID == typ {
+		fmt.Printf("partition %d already has type %s\n", n, typeLabel(typ))
+		return s.finish(nil, nil)
+	}
+	t.Entries[n-1].PartitionTypeGUID = typ
+	if err = s.finish(t, t.ApplyTo(s.Dev)); err != nil {
+		return err
+	}
+	fmt.Printf("partition %d: type %s -> %s\n", n, typeLabel(e.PartitionTypeGUID), typeLabel(typ))
+	return nil
+}
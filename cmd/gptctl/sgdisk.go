@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// sgdiskSector is the block size of an sgdisk backup file, whatever the
+// sector size of the disk it was taken from.
+const sgdiskSector = 512
+
+// marshalSgdisk lays out a backup file as sgdisk --backup writes it: the
+// MBR, the primary header, the backup header, each in a 512-byte block,
+// then the entry array. t is the primary copy.
+func marshalSgdisk(mbr []byte, t *gpt.Table) ([]byte, error) {
+	t = t.Clone()
+	t.UpdateCRCs()
+	alt := t.Alternate()
+	out := make([]byte, 0, 3*sgdiskSector+len(t.EntryArray()))
+	out = append(out, mbr[:sgdiskSector]...)
+	for _, h := range []*gpt.Header{&t.Header, &alt.Header} {
+		b, err := h.Sector(sgdiskSector)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	return append(out, t.EntryArray()...), nil
+}
+
+// unmarshalSgdisk reads a backup file written by sgdisk --backup, or by
+// marshalSgdisk, returning its MBR and the primary copy of its table for
+// sectors of sectorSize bytes. The backup header in the file is ignored:
+// it is derived from the primary, and load places it anew anyway.
+func unmarshalSgdisk(b []byte, sectorSize int) ([]byte, *gpt.Table, error) {
+	if len(b) < 3*sgdiskSector {
+		return nil, nil, fmt.Errorf("%d bytes are too short for an sgdisk backup (MBR and two headers take %d)", len(b), 3*sgdiskSector)
+	}
+	mbr := b[:sgdiskSector]
+	if mbr[510] != 0x55 || mbr[511] != 0xAA {
+		return nil, nil, errors.New("not an sgdisk backup: its MBR block has no boot signature")
+	}
+	t := &gpt.Table{SectorSize: sgdiskSector}
+	primary := append(append([]byte(nil), b[sgdiskSector:2*sgdiskSector]...), b[3*sgdiskSector:]...)
+	if err := t.UnmarshalBinary(primary); err != nil {
+		return nil, nil, err
+	}
+	if err := t.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if !t.Header.IsPrimary() {
+		return nil, nil, fmt.Errorf("the first header of the backup is at LBA %d, not a primary header", t.Header.CurrentLBA)
+	}
+	t.SectorSize = sectorSize
+	return mbr, t, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/verify"
+)
+
+func runSimulateBoot(args []string) error {
+	fs := newFlagSet("simulate-boot", "<disk|image>")
+	sectorSize := fs.Int("sector-size", 0, "logical block size the firmware sees (default: the device's, 512 for images)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	target, err := device.Resolve(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	r, size, ss, done, err := openRaw(target.Disk)
+	if err != nil {
+		return err
+	}
+	defer done()
+	if *sectorSize != 0 {
+		ss = *sectorSize
+	}
+
+	rep := verify.SimulateBoot(r, size, ss, maxTableBytes)
+	fmt.Printf("%s: %d-byte logical blocks, last LBA %d\n\n", target.Disk, ss, size/int64(ss)-1)
+	for _, s := range rep.Steps {
+		fmt.Println(s)
+	}
+	fmt.Printf("\n%s.\n", rep.Conclusion)
+	if rep.Table == nil {
+		return errors.New("firmware would find no usable GPT")
+	}
+
+	t := rep.Table
+	if len(rep.Exposed) > 0 {
+		fmt.Println("\npartitions firmware exposes:")
+		for _, i := range rep.Exposed {
+			e := t.Entries[i]
+			esp := ""
+			if e.PartitionTypeGUID == gpt.TypeEFISystem {
+				esp = "  (boot candidate)"
+			}
+			fmt.Printf("  %3d  %12d-%-12d %-24s %q%s\n", i+1, e.StartingLBA, e.EndingLBA, e.Type(), e.Name(), esp)
+		}
+	}
+	if len(rep.Hidden) > 0 {
+		fmt.Println("\npartitions firmware skips:")
+		hidden := make([]int, 0, len(rep.Hidden))
+		for i := range rep.Hidden {
+			hidden = append(hidden, i)
+		}
+		sort.Ints(hidden)
+		for _, i := range hidden {
+			fmt.Printf("  %3d  %q %s\n", i+1, t.Entries[i].Name(), rep.Hidden[i])
+		}
+	}
+	return nil
+}
+
+// openRaw opens path for reading without interpreting any GPT on it and
+// returns its size and logical sector size, which for anything but a
+// block device is 512.
+func openRaw(path string) (io.ReaderAt, int64, int, func() error, error) {
+	img, _, err := device.OpenImage(path)
+	if err != nil {
+		return nil, 0, 0, nil, err
+	}
+	if img != nil {
+		return img, img.Size(), gpt.DefaultSectorSize, img.Close, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, 0, nil, err
+	}
+	size, err := gpt.DeviceSize(f)
+	if err != nil {
+		f.Close()
+		return nil, 0, 0, nil, err
+	}
+	ss := gpt.DefaultSectorSize
+	if logical, _, err := gpt.BlockSizes(f); err == nil && logical > 0 {
+		ss = logical
+	}
+	return gpt.WithDeadline(f, ioTimeout), size, ss, f.Close, nil
+}
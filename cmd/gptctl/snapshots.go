@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/snapshot"
+)
+
+// runSnapshots browses and restores the snapshots modifying commands save
+// with -snapshot-dir.
+func runSnapshots(args []string) error {
+	sub := map[string]func([]string) error{
+		"list":    runSnapshotsList,
+		"restore": runSnapshotsRestore,
+	}
+	if len(args) == 0 || sub[args[0]] == nil {
+		fmt.Fprintf(os.Stderr, "usage: gptctl snapshots list [flags] [disk|image]\n"+
+			"       gptctl snapshots restore [flags] <id> <disk|image>\n")
+		return errors.New("snapshots needs a subcommand: list or restore")
+	}
+	return sub[args[0]](args[1:])
+}
+
+func runSnapshotsList(args []string) error {
+	fs := newFlagSet("snapshots list", "[disk|image]")
+	dir := fs.String("snapshot-dir", os.Getenv("GPT_SNAPSHOT_DIR"), "directory holding the snapshots (default $GPT_SNAPSHOT_DIR)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *dir == "" || fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("-snapshot-dir is required")
+	}
+	snaps, err := snapshot.List(*dir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%-36s %-20s %-24s %12s %s\n", "ID", "OPERATION", "DEVICE", "SIZE", "DISK GUID")
+	for _, s := range snaps {
+		if fs.NArg() == 1 && s.Identity.Path != fs.Arg(0) {
+			continue
+		}
+		guid := s.Identity.DiskGUID
+		if guid == "" {
+			guid = "-"
+		}
+		fmt.Printf("%-36s %-20s %-24s %12s %s\n", s.ID, s.Operation, s.Identity.Path, humanBytes(s.Identity.Size), guid)
+	}
+	return nil
+}
+
+func runSnapshotsRestore(args []string) error {
+	fs := newFlagSet("snapshots restore", "<id> <disk|image>")
+	anyDisk := fs.Bool("any-disk", false, "restore even if the target's size, sector size, model or serial differ from the snapshot's")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 || wo.snapshotDir == "" {
+		fs.Usage()
+		return errors.New("-snapshot-dir, a snapshot id and a target are required")
+	}
+	snap, err := snapshot.Load(wo.snapshotDir, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	path := fs.Arg(1)
+	// the current state is snapshotted too, so a restore can be undone,
+	// but only once the target turned out to be the right disk
+	dir := wo.snapshotDir
+	wo.snapshotDir = ""
+	s, err := wo.open(path, "snapshots restore")
+	if err != nil {
+		return err
+	}
+	ss := s.SectorSize
+	if ss == 0 {
+		ss = gpt.DefaultSectorSize
+	}
+	if err := snap.Matches(identify(path, s.Size, ss)); err != nil && !*anyDisk {
+		return s.finish(nil, fmt.Errorf("%w (-any-disk restores anyway)", err))
+	}
+	var primary, backup *gpt.Table
+	if s.Disk != nil {
+		primary, backup = s.Disk.Primary, s.Disk.Backup
+	}
+	wo.snapshotDir = dir
+	if err := wo.snapshot(path, s.Dev, s.Size, ss, "snapshots restore", primary, backup); err != nil {
+		return s.finish(nil, err)
+	}
+	if err := snap.Restore(s.Dev); err != nil {
+		return s.finish(nil, err)
+	}
+	var after *gpt.Table
+	if d, err := gpt.OpenDevice(s.Dev, s.Size, path, gpt.WithSectorSize(ss)); err == nil {
+		after = d.Table()
+	}
+	if err := s.finish(after, nil); err != nil {
+		return err
+	}
+	fmt.Printf("restored snapshot %s (%s, %s) to %s\n", snap.ID, snap.Operation, snap.Time.Local().Format("2006-01-02 15:04:05"), path)
+	return nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+	"github.com/cpuuntery/go-code-and-bin/simg"
+)
+
+// runSparsify shrinks the storage an image takes without changing what it
+// reads as: all-zero blocks are punched out of the file in place, or left
+// out of a sparse copy, or the image is written as an Android sparse image.
+// The GPT is read before and after so a damaged image is not passed on as
+// a good one.
+func runSparsify(args []string) error {
+	fs := newFlagSet("sparsify", "<image>")
+	bsFlag := fs.String("bs", "4KiB", "size of the blocks checked for zeros; holes are punched, and Android sparse blocks written, in these")
+	out := fs.String("o", "", "write a sparse copy to this file instead of punching holes into the image")
+	android := fs.Bool("android-sparse", false, "with -o, write an Android sparse image (as img2simg does) instead of a sparse raw file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one image is required")
+	}
+	if *android && *out == "" {
+		return errors.New("-android-sparse needs -o")
+	}
+	bs, err := layout.ParseSize(*bsFlag)
+	if err != nil {
+		return fmt.Errorf("-bs: %w", err)
+	}
+	if bs < 512 || bs%512 != 0 || bs > 64<<20 {
+		return fmt.Errorf("-bs %s: want a multiple of 512 bytes up to 64MiB", *bsFlag)
+	}
+	path := fs.Arg(0)
+	if isBlockDevice(path) {
+		return fmt.Errorf("%s is a block device; sparsify works on image files", path)
+	}
+	if format, err := device.DetectFormat(path); err != nil {
+		return err
+	} else if format != "raw" {
+		return fmt.Errorf("%s is a %s image, not a raw one", path, format)
+	}
+	d, err := openDisk(path)
+	if err != nil {
+		return err
+	}
+	before := d.Table().Header
+	d.Close()
+
+	switch {
+	case *android:
+		err = writeAndroidSparse(path, *out, bs)
+	case *out != "":
+		err = writeSparseCopy(path, *out, bs)
+	default:
+		err = punchZeros(path, bs)
+	}
+	if err != nil {
+		return err
+	}
+	if *android {
+		return nil
+	}
+	check := path
+	if *out != "" {
+		check = *out
+	}
+	d, err = openDisk(check)
+	if err != nil {
+		return fmt.Errorf("%s after sparsifying: %w", check, err)
+	}
+	defer d.Close()
+	if after := d.Table().Header; after.HeaderCRC32 != before.HeaderCRC32 || after.PartitionTableCRC != before.PartitionTableCRC {
+		return fmt.Errorf("%s: the GPT reads differently after sparsifying", check)
+	}
+	return nil
+}
+
+// punchZeros deallocates the all-zero blocks of the file at path.
+func punchZeros(path string, bs int64) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	allocBefore, haveAlloc := allocatedBytes(f)
+	extents, err := dataExtents(f, size)
+	if err != nil {
+		return err
+	}
+	var punched int64
+	runStart, runEnd := int64(-1), int64(-1)
+	punch := func() error {
+		if runStart < 0 {
+			return nil
+		}
+		if err := punchHole(f, runStart, runEnd-runStart); err != nil {
+			return fmt.Errorf("punch hole at byte %d: %w", runStart, err)
+		}
+		punched += runEnd - runStart
+		runStart = -1
+		return nil
+	}
+	buf := make([]byte, max(bs, 1<<20/bs*bs))
+	for _, e := range extents {
+		// whole blocks only: a partial one may share a file system block
+		// with data
+		for off := (e[0] + bs - 1) / bs * bs; off+bs <= e[1]; {
+			n := min(int64(len(buf)), (e[1]-off)/bs*bs)
+			b := buf[:n]
+			if _, err := f.ReadAt(b, off); err != nil {
+				return fmt.Errorf("read at byte %d: %w", off, err)
+			}
+			for k := int64(0); k < n; k += bs {
+				if !isZero(b[k : k+bs]) {
+					if err := punch(); err != nil {
+						return err
+					}
+					continue
+				}
+				if runStart < 0 {
+					runStart = off + k
+				}
+				runEnd = off + k + bs
+			}
+			off += n
+		}
+		if err := punch(); err != nil {
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	fmt.Printf("punched %s of zeros out of %s\n", humanBytes(punched), path)
+	if allocAfter, ok := allocatedBytes(f); ok && haveAlloc {
+		fmt.Printf("allocated: %s -> %s of %s\n", humanBytes(allocBefore), humanBytes(allocAfter), humanBytes(size))
+	}
+	return nil
+}
+
+// writeSparseCopy copies the image at path to out, leaving holes for its
+// all-zero blocks.
+func writeSparseCopy(path, out string, bs int64) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(out, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	c := &imageCopy{src: src, dst: dst, size: fi.Size(), bs: bs, jobs: 4, sparse: true}
+	if _, err := c.run(); err != nil {
+		return err
+	}
+	if err := dst.Truncate(fi.Size()); err != nil {
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s: %s of data, %s left as holes\n", out, humanBytes(fi.Size()-c.holes), humanBytes(c.holes))
+	return nil
+}
+
+// writeAndroidSparse writes the image at path to out as an Android sparse
+// image with blocks of bs bytes.
+func writeAndroidSparse(path, out string, bs int64) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	size, err := gpt.DeviceSize(src)
+	if err != nil {
+		return err
+	}
+	if size%bs != 0 {
+		return fmt.Errorf("%s is %d bytes, not a multiple of -bs %d; pick a block size dividing it, e.g. -bs 512", path, size, bs)
+	}
+	dst, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	st, err := simg.Write(dst, src, size, int(bs))
+	if err == nil {
+		err = dst.Sync()
+	}
+	if err = errors.Join(err, dst.Close()); err != nil {
+		os.Remove(out)
+		return err
+	}
+	fmt.Printf("wrote %s: %d chunks, %s raw, %s as fill, %s in all (%.1f%% of %s)\n", out, st.Chunks,
+		humanBytes(st.RawBytes), humanBytes(st.FillBytes), humanBytes(st.CompressedBytes),
+		100*float64(st.CompressedBytes)/float64(max(size, 1)), humanBytes(size))
+	return nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/seal"
+)
+
+// streamOpts are the flags of commands that write or read back dumps and
+// partition images: optional compression and encryption of what they
+// write. Input is recognised by its magic and unpacked the same way.
+type streamOpts struct {
+	encrypt  bool
+	compress string
+	passFile string
+}
+
+func addStreamFlags(fs *flag.FlagSet, output bool) *streamOpts {
+	o := &streamOpts{}
+	if output {
+		fs.BoolVar(&o.encrypt, "encrypt", false, "encrypt the output with AES-256-GCM under the passphrase")
+		fs.StringVar(&o.compress, "compress", "", `gzip, zstd or none (default: from the output name, ".gz" or ".zst")`)
+	}
+	fs.StringVar(&o.passFile, "passphrase-file", "", "file holding the encryption passphrase (default $GPT_PASSPHRASE)")
+	return o
+}
+
+func (o *streamOpts) passphrase() ([]byte, error) {
+	if o.passFile != "" {
+		b, err := os.ReadFile(o.passFile)
+		if err != nil {
+			return nil, err
+		}
+		if b = bytes.TrimRight(b, "\r\n"); len(b) == 0 {
+			return nil, errors.New(o.passFile + ": empty passphrase")
+		}
+		return b, nil
+	}
+	if p := os.Getenv("GPT_PASSPHRASE"); p != "" {
+		return []byte(p), nil
+	}
+	return nil, errors.New("a passphrase is needed: use -passphrase-file or set GPT_PASSPHRASE")
+}
+
+// compression returns the compressor for path: -compress, else the file
+// name extension.
+func (o *streamOpts) compression(path string) (string, error) {
+	switch o.compress {
+	case "gzip", "zstd", "none":
+		return o.compress, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown -compress %q", o.compress)
+	}
+	switch {
+	case strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".gz.sealed"):
+		return "gzip", nil
+	case strings.HasSuffix(path, ".zst") || strings.HasSuffix(path, ".zst.sealed"):
+		return "zstd", nil
+	}
+	return "none", nil
+}
+
+// create opens path ("-" for stdout) for writing through the selected
+// compression, then encryption. The returned close func finishes the
+// streams and the file.
+func (o *streamOpts) create(path string) (io.Writer, func() error, error) {
+	method, err := o.compression(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, closeSealed, err := o.createSealed(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch method {
+	case "gzip":
+		zw := gzip.NewWriter(w)
+		return zw, func() error { return errors.Join(zw.Close(), closeSealed()) }, nil
+	case "zstd":
+		zw, wait, err := pipeThrough(w, "zstd", "-q", "-c", "-T0")
+		if err != nil {
+			closeSealed()
+			return nil, nil, err
+		}
+		return zw, func() error { return errors.Join(zw.Close(), wait(), closeSealed()) }, nil
+	}
+	return w, closeSealed, nil
+}
+
+func (o *streamOpts) createSealed(path string) (io.Writer, func() error, error) {
+	var f *os.File
+	if path == "-" {
+		f = os.Stdout
+	} else {
+		var err error
+		if f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600); err != nil {
+			return nil, nil, err
+		}
+	}
+	closeFile := func() error {
+		if f == os.Stdout {
+			return nil
+		}
+		return f.Close()
+	}
+	if !o.encrypt {
+		return f, closeFile, nil
+	}
+	pass, err := o.passphrase()
+	if err == nil {
+		var w *seal.Writer
+		if w, err = seal.NewWriter(f, pass); err == nil {
+			return w, func() error { return errors.Join(w.Close(), closeFile()) }, nil
+		}
+	}
+	closeFile()
+	return nil, nil, err
+}
+
+// open opens path ("-" for stdin), decrypting and decompressing it as
+// needed.
+func (o *streamOpts) open(path string) (io.Reader, func() error, error) {
+	r, closeSealed, err := o.openSealed(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			closeSealed()
+			return nil, nil, err
+		}
+		return zr, func() error { return errors.Join(zr.Close(), closeSealed()) }, nil
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		cmd := exec.Command("zstd", "-q", "-d", "-c")
+		cmd.Stdin, cmd.Stderr = br, os.Stderr
+		out, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			closeSealed()
+			return nil, nil, fmt.Errorf("zstd: %w", err)
+		}
+		zr := &eofReader{r: out}
+		return zr, func() error {
+			// a caller that stops reading early leaves zstd blocked on a
+			// full pipe: closing it ends zstd, whose complaint about the
+			// broken pipe is then of no interest
+			out.Close()
+			err := cmd.Wait()
+			if !zr.eof {
+				err = nil
+			}
+			return errors.Join(err, closeSealed())
+		}, nil
+	}
+	return br, closeSealed, nil
+}
+
+// eofReader remembers whether r was read to the end.
+type eofReader struct {
+	r   io.Reader
+	eof bool
+}
+
+func (e *eofReader) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err == io.EOF {
+		e.eof = true
+	}
+	return n, err
+}
+
+// pipeThrough starts name with args, feeding what is written to the
+// returned writer to its stdin and copying its stdout to w. Close the
+// writer, then call wait.
+func pipeThrough(w io.Writer, name string, args ...string) (io.WriteCloser, func() error, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, nil, fmt.Errorf("%s is not installed", name)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdout, cmd.Stderr = w, os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return in, func() error {
+		if err := cmd.Wait(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		return nil
+	}, nil
+}
+
+func (o *streamOpts) openSealed(path string) (io.Reader, func() error, error) {
+	f := os.Stdin
+	if path != "-" {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return nil, nil, err
+		}
+	}
+	closeFile := func() error {
+		if f == os.Stdin {
+			return nil
+		}
+		return f.Close()
+	}
+	br := bufio.NewReader(f)
+	if magic, _ := br.Peek(len(seal.Magic)); !seal.IsSealed(magic) {
+		return br, closeFile, nil
+	}
+	pass, err := o.passphrase()
+	if err == nil {
+		var r io.Reader
+		if r, err = seal.NewReader(br, pass); err == nil {
+			return r, closeFile, nil
+		}
+	}
+	closeFile()
+	return nil, nil, err
+}
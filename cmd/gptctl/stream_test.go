@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// An inject that fails before reading its zstd input must return, not wait
+// for zstd to finish writing into a pipe nobody reads.
+func TestInjectZstdEarlyError(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd is not installed")
+	}
+	dir := t.TempDir()
+	img := filepath.Join(dir, "disk.img")
+	if err := runInit([]string{"-size", "8MiB", img}); err != nil {
+		t.Fatal(err)
+	}
+	// incompressible, so zstd's output overflows the pipe buffer
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	cmd := exec.Command("zstd", "-q", "-c")
+	cmd.Stdin = bytes.NewReader(data)
+	src := filepath.Join(dir, "part.zst")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(src, out, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- runInject([]string{src, img}) }()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("inject without a partition succeeded")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("inject with a bad argument hung")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import "fmt"
+
+// unitSystem is a way of printing human-readable sizes.
+type unitSystem struct {
+	base  int64
+	units []string // for base^0, base^1, ...
+}
+
+var (
+	iecUnits = unitSystem{1024, []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}}
+	// siUnits are the decimal units storage vendors and cloud consoles
+	// quote capacities in.
+	siUnits = unitSystem{1000, []string{"B", "kB", "MB", "GB", "TB", "PB", "EB"}}
+)
+
+// sizeUnits is what humanBytes prints in; -si selects siUnits.
+var sizeUnits = iecUnits
+
+// humanBytes formats n bytes with one decimal in the largest unit of
+// sizeUnits it reaches.
+func humanBytes(n int64) string {
+	u := sizeUnits
+	f := float64(n)
+	i := 0
+	for f >= float64(u.base) && i < len(u.units)-1 {
+		f /= float64(u.base)
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", f, u.units[i])
+}
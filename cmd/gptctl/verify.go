@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+	"github.com/cpuuntery/go-code-and-bin/sandbox"
+	"github.com/cpuuntery/go-code-and-bin/verify"
+)
+
+func runVerify(args []string) error {
+	fs := newFlagSet("verify", "<disk|image>...")
+	firstUsable := fs.Uint64("first-usable", 0, "require sectors below this LBA to be free of partitions")
+	layoutPath := fs.String("layout", "", "also check the disk against this layout file: partitions, reserved regions, first usable LBA")
+	zeroSamples := fs.Int("check-zeroed", 0, "sample each partition this many times and warn when it reads as all zeros")
+	preset := fs.String("preset", "", "like -layout, with a built-in preset (see gptctl init -preset list)")
+	jsonOut := fs.Bool("json", false, "print the findings of every disk as JSON")
+	ignore := map[string]bool{}
+	fs.Func("ignore", "skip findings of these rules, by ID or name, e.g. GPT017,zeroed (repeatable; see -rules)", func(v string) error {
+		for _, id := range strings.Split(v, ",") {
+			r, ok := verify.LookupRule(strings.TrimSpace(id))
+			if !ok {
+				return fmt.Errorf("unknown rule %q", id)
+			}
+			ignore[r.ID] = true
+		}
+		return nil
+	})
+	listRules := fs.Bool("rules", false, "list the rule IDs and exit")
+	sandboxed := fs.Bool("sandbox", false, "confine the process to reading the targets before parsing them (Linux: seccomp, and Landlock where possible)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *listRules {
+		for _, r := range verify.Rules {
+			fmt.Println(r)
+		}
+		return nil
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("no disk given")
+	}
+	var l *layout.Layout
+	var err error
+	switch {
+	case *layoutPath != "" && *preset != "":
+		return errors.New("use either -layout or -preset")
+	case *layoutPath != "":
+		l, err = layout.Load(*layoutPath)
+	case *preset != "":
+		l, err = layout.Preset(*preset)
+	}
+	if err != nil {
+		return err
+	}
+	opts := verify.Options{FirstUsableLBA: *firstUsable, ZeroSamples: *zeroSamples}
+	if l != nil {
+		if opts.Reserved, err = l.ReservedRegions(); err != nil {
+			return err
+		}
+		if opts.FirstUsableLBA == 0 {
+			opts.FirstUsableLBA = l.FirstUsableLBA
+		}
+	}
+	// resolve everything first: with -sandbox, /dev/disk and /sys are out
+	// of reach afterwards
+	var disks []string
+	for _, arg := range fs.Args() {
+		t, err := device.Resolve(arg)
+		if err != nil {
+			return err
+		}
+		disks = append(disks, t.Disk)
+	}
+	if *sandboxed {
+		st, err := sandbox.Enter(disks...)
+		if err != nil {
+			return err
+		}
+		if !st.Landlock {
+			fmt.Fprintf(os.Stderr, "gptctl verify: sandbox without Landlock: %v\n", st.LandlockErr)
+		}
+	}
+	type diskResult struct {
+		Disk     string           `json:"disk"`
+		OK       bool             `json:"ok"`
+		Error    string           `json:"error,omitempty"`
+		Findings []verify.Finding `json:"findings"`
+	}
+	var results []diskResult
+	failed := 0
+	for _, disk := range disks {
+		d, err := openDisk(disk)
+		if err != nil {
+			if *jsonOut {
+				results = append(results, diskResult{Disk: disk, Error: err.Error(), Findings: []verify.Finding{}})
+			} else {
+				fmt.Printf("%s: error: %v\n", disk, err)
+			}
+			failed++
+			continue
+		}
+		findings := verify.Disk(d, opts)
+		if tbl := d.Table(); l != nil && tbl != nil {
+			findings = append(findings, verify.Layout(tbl, l)...)
+		}
+		d.Close()
+		findings = verify.Ignore(findings, ignore)
+		if verify.HasErrors(findings) {
+			failed++
+		}
+		if *jsonOut {
+			results = append(results, diskResult{Disk: disk, OK: !verify.HasErrors(findings), Findings: append([]verify.Finding{}, findings...)})
+			continue
+		}
+		for _, f := range findings {
+			fmt.Printf("%s: %s\n", disk, f)
+		}
+		if len(findings) == 0 {
+			fmt.Printf("%s: ok\n", disk)
+		}
+	}
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d disks failed verification", failed, fs.NArg())
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// flashRegion is a byte range of an image that a flashed device must hold.
+type flashRegion struct {
+	name      string
+	off, size int64
+}
+
+// runVerifyFlash checks a device against the image flashed onto it, for
+// flashing lines where reading back the whole device takes too long: only
+// the GPT structures and the partitions of the image are compared, not
+// the unallocated space between and after them.
+func runVerifyFlash(args []string) error {
+	fs := newFlagSet("verify-flash", "<image> <disk>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errors.New("an image and a disk are required")
+	}
+	img, err := openDisk(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+	t, err := device.Resolve(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(t.Disk)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, err := gpt.DeviceSize(f)
+	if err != nil {
+		return fmt.Errorf("size of %s: %w", t.Disk, err)
+	}
+	if size < img.Size {
+		return fmt.Errorf("%s holds %s, smaller than the %s image", t.Disk, humanBytes(size), humanBytes(img.Size))
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "REGION\tSIZE\tSPEED\tRESULT\n")
+	var failed int
+	dev := gpt.WithDeadline(f, ioTimeout)
+	for _, r := range flashRegions(img) {
+		start := time.Now()
+		at, err := compareRange(img, dev, r.off, r.size)
+		speed := humanBytes(int64(float64(r.size)/max(time.Since(start).Seconds(), 0.001))) + "/s"
+		result := "ok"
+		switch {
+		case err != nil:
+			result, speed = "error: "+err.Error(), "-"
+			failed++
+		case at >= 0:
+			result, speed = fmt.Sprintf("FAIL at byte %d", at), "-"
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.name, humanBytes(r.size), speed, result)
+	}
+	tw.Flush()
+	if failed > 0 {
+		return fmt.Errorf("%d region(s) of %s differ from %s", failed, t.Disk, fs.Arg(0))
+	}
+	return nil
+}
+
+// flashRegions lists the protective MBR and primary GPT, each partition and
+// the backup GPT of img, in disk order.
+func flashRegions(img *gpt.Disk) []flashRegion {
+	tbl := img.Table()
+	h := tbl.Header
+	ss := int64(img.SectorSize)
+	primary, backup := h, h
+	if !h.IsPrimary() {
+		primary = tbl.Alternate().Header
+	} else {
+		backup = tbl.Alternate().Header
+	}
+	regions := []flashRegion{{"MBR+primary GPT", 0, int64(primary.PartitionTableLBA)*ss + h.TableBytes()}}
+	for _, i := range tbl.Used() {
+		e := tbl.Entries[i]
+		name := fmt.Sprintf("partition %d", i+1)
+		if n := e.Name(); n != "" {
+			name += fmt.Sprintf(" %q", n)
+		}
+		regions = append(regions, flashRegion{name, int64(e.StartingLBA) * ss, int64(e.SizeBytes(int(ss)))})
+	}
+	arrayAt := int64(backup.PartitionTableLBA) * ss
+	return append(regions, flashRegion{"backup GPT", arrayAt, int64(backup.CurrentLBA+1)*ss - arrayAt})
+}
+
+// compareRange compares size bytes at off of a and b and returns the
+// position of the first byte that differs, -1 if none does.
+func compareRange(a, b io.ReaderAt, off, size int64) (int64, error) {
+	const chunk = 4 << 20
+	ba, bb := make([]byte, min(chunk, size)), make([]byte, min(chunk, size))
+	for done := int64(0); done < size; {
+		n := min(int64(len(ba)), size-done)
+		if _, err := a.ReadAt(ba[:n], off+done); err != nil {
+			return -1, fmt.Errorf("read image at byte %d: %w", off+done, err)
+		}
+		if _, err := b.ReadAt(bb[:n], off+done); err != nil {
+			return -1, fmt.Errorf("read disk at byte %d: %w", off+done, err)
+		}
+		if !bytes.Equal(ba[:n], bb[:n]) {
+			for i := range n {
+				if ba[i] != bb[i] {
+					return off + done + i, nil
+				}
+			}
+		}
+		done += n
+	}
+	return -1, nil
+}
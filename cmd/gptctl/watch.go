@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/event"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// diskState is what watch remembers about a disk between rounds.
+type diskState struct {
+	problem string // "" when both copies are valid
+}
+
+func runWatch(args []string) error {
+	fs := newFlagSet("watch", "[device|image|PARTUUID=...]...")
+	interval := fs.Duration("interval", time.Minute, "time between checks")
+	logTo := fs.String("log", "stdout", "where events go: stdout, journald or syslog")
+	once := fs.Bool("once", false, "check once and exit")
+	var webhooks []string
+	fs.Func("webhook", "also POST every event as JSON to this URL (repeatable)", func(u string) error {
+		webhooks = append(webhooks, u)
+		return nil
+	})
+	webhookTimeout := fs.Duration("webhook-timeout", 10*time.Second, "give up on a webhook request after this long")
+	privsepUser := fs.String("privsep-user", "", "parse disks as this user; only a small helper keeps root to read their GPT areas")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	frontEnd := os.Getenv(privsepEnv)
+	if frontEnd != "" {
+		if err := connectPrivsep(frontEnd); err != nil {
+			return err
+		}
+	}
+
+	// partition specs (PARTUUID=..., /dev/disk/by-...) watch their parent disk
+	var fixed []string
+	seen := map[string]bool{}
+	for _, arg := range fs.Args() {
+		t, err := device.Resolve(arg)
+		if err != nil {
+			return err
+		}
+		if !seen[t.Disk] {
+			seen[t.Disk] = true
+			fixed = append(fixed, t.Disk)
+		}
+	}
+
+	if *privsepUser != "" && frontEnd == "" {
+		// the front-end gets the resolved disks, which it can open
+		// without privileges through the helper
+		flags := args[:len(args)-fs.NArg()]
+		return runPrivsepHelper(*privsepUser, fixed, append(slices.Clip(flags), fixed...))
+	}
+
+	sink, err := event.Open(*logTo)
+	if err != nil {
+		return err
+	}
+	sinks := []event.Sink{sink}
+	for _, u := range webhooks {
+		hook, err := event.NewWebhook(u, *webhookTimeout)
+		if err != nil {
+			sink.Close()
+			return err
+		}
+		sinks = append(sinks, hook)
+	}
+	sink = event.Tee(sinks...)
+	defer sink.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w := &watcher{sink: sink, fixed: fixed, state: map[string]diskState{}}
+	for {
+		if err := w.round(); err != nil {
+			return err
+		}
+		if *once {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(*interval):
+		}
+	}
+}
+
+type watcher struct {
+	sink  event.Sink
+	fixed []string // explicit targets; attached disks are scanned when empty
+	state map[string]diskState
+}
+
+func (w *watcher) emit(kind string, sev event.Severity, dev, msg string, fields map[string]string) {
+	e := event.Event{Time: time.Now(), Kind: kind, Severity: sev, Device: dev, Message: msg, Fields: fields}
+	if err := w.sink.Emit(e); err != nil {
+		fmt.Fprintf(os.Stderr, "gptctl watch: emit event: %v\n", err)
+	}
+}
+
+func (w *watcher) targets() ([]string, error) {
+	if len(w.fixed) > 0 {
+		return w.fixed, nil
+	}
+	devs, err := device.List()
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(devs))
+	for i, d := range devs {
+		paths[i] = d.Path
+	}
+	return paths, nil
+}
+
+// round checks every target once and emits events for anything that
+// changed since the previous round.
+func (w *watcher) round() error {
+	paths, err := w.targets()
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, p := range paths {
+		seen[p] = true
+		problem, fields := checkDisk(p)
+		old, known := w.state[p]
+		w.state[p] = diskState{problem: problem}
+		if !known && len(w.fixed) == 0 {
+			w.emit(event.DiskAdded, event.Notice, p, "disk attached", fields)
+		}
+		switch {
+		case problem != "" && (!known || old.problem != problem):
+			w.emit(event.ValidationFailed, event.Warning, p, problem, fields)
+		case problem == "" && known && old.problem != "":
+			w.emit(event.ValidationOK, event.Notice, p, "GPT valid again", fields)
+		}
+	}
+	var gone []string
+	for p := range w.state {
+		if !seen[p] {
+			gone = append(gone, p)
+		}
+	}
+	sort.Strings(gone)
+	for _, p := range gone {
+		delete(w.state, p)
+		w.emit(event.DiskRemoved, event.Notice, p, "disk detached", nil)
+	}
+	return nil
+}
+
+// checkDisk validates both copies of the GPT on path. It returns "" when all
+// is well, otherwise a one-line description, plus fields for the event.
+func checkDisk(path string) (string, map[string]string) {
+	var d *gpt.Disk
+	var err error
+	if privsep != nil {
+		d, err = privsep.openDisk(path)
+	} else {
+		d, err = openDisk(path)
+	}
+	if err != nil {
+		return err.Error(), map[string]string{"primary": "unreadable", "backup": "unreadable"}
+	}
+	defer d.Close()
+	fields := map[string]string{
+		"disk-guid": d.Table().Header.DiskGUID.String(),
+		"primary":   status(d.PrimaryErr),
+		"backup":    status(d.BackupErr),
+	}
+	switch {
+	case d.PrimaryErr != nil && d.BackupErr != nil:
+		return fmt.Sprintf("both GPT copies invalid: %v; %v", d.PrimaryErr, d.BackupErr), fields
+	case d.PrimaryErr != nil:
+		return "primary GPT invalid: " + d.PrimaryErr.Error(), fields
+	case d.BackupErr != nil:
+		return "backup GPT invalid: " + d.BackupErr.Error(), fields
+	}
+	return "", fields
+}
+
+func status(err error) string {
+	if err != nil {
+		return "invalid"
+	}
+	return "ok"
+}
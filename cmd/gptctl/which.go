@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+)
+
+func runWhich(args []string) error {
+	fs := newFlagSet("which", "[disk|image...]")
+	partuuid := fs.String("partuuid", "", "unique partition GUID to look for")
+	partlabel := fs.String("partlabel", "", "partition name to look for")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var spec string
+	switch {
+	case *partuuid != "" && *partlabel != "":
+		return errors.New("use either -partuuid or -partlabel")
+	case *partuuid != "":
+		spec = "PARTUUID=" + *partuuid
+	case *partlabel != "":
+		spec = "PARTLABEL=" + *partlabel
+	default:
+		fs.Usage()
+		return errors.New("-partuuid or -partlabel is required")
+	}
+
+	// without explicit disks, look at everything attached
+	paths := fs.Args()
+	if len(paths) == 0 {
+		devs, err := device.List()
+		if err != nil {
+			return err
+		}
+		for _, d := range devs {
+			paths = append(paths, d.Path)
+		}
+	}
+	found, err := device.Find(spec, paths)
+	if err != nil {
+		return err
+	}
+	if len(found) == 0 {
+		return fmt.Errorf("no partition matches %s", spec)
+	}
+	fmt.Printf("%-20s %4s %12s %12s %16s %16s  %s\n", "DISK", "PART", "START_LBA", "END_LBA", "START_BYTE", "END_BYTE", "NAME")
+	for _, m := range found {
+		ss := uint64(m.SectorSize)
+		fmt.Printf("%-20s %4d %12d %12d %16d %16d  %s\n", m.Disk, m.Index+1,
+			m.Entry.StartingLBA, m.Entry.EndingLBA,
+			m.Entry.StartingLBA*ss, (m.Entry.EndingLBA+1)*ss-1, m.Entry.Name())
+	}
+	return nil
+}
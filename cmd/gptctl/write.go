@@ -0,0 +1,348 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/audit"
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/fsinfo"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/snapshot"
+)
+
+// writeOpts are the flags shared by every command that modifies a disk.
+type writeOpts struct {
+	force           bool
+	forceHibernated bool
+	normalize       bool
+	auditLog        string
+	snapshotDir     string
+	verifyWrites    autoBool
+}
+
+func addWriteFlags(fs *flag.FlagSet) *writeOpts {
+	o := &writeOpts{}
+	fs.BoolVar(&o.force, "force-system-disk", false, "allow writing to the disk holding / or active swap")
+	fs.BoolVar(&o.forceHibernated, "force-hibernated", false, "allow writing to a disk with an NTFS volume Windows left hibernated (Fast Startup) or dirty")
+	fs.BoolVar(&o.normalize, "normalize", false, "zero the header's Reserved field and everything after its 92 defined bytes instead of keeping vendor data there")
+	fs.StringVar(&o.auditLog, "audit-log", os.Getenv("GPT_AUDIT_LOG"), `append an audit record to this file, or "journald" (default $GPT_AUDIT_LOG)`)
+	fs.StringVar(&o.snapshotDir, "snapshot-dir", os.Getenv("GPT_SNAPSHOT_DIR"), "save the GPT state to this directory before writing, for gptctl snapshots restore (default $GPT_SNAPSHOT_DIR)")
+	fs.Var(&o.verifyWrites, "verify-writes", "read back everything written and fail on any difference (default: on for block devices)")
+	return o
+}
+
+// autoBool is a boolean flag whose default depends on the target.
+type autoBool struct {
+	set, v bool
+}
+
+func (b *autoBool) String() string {
+	if b == nil || !b.set {
+		return "auto"
+	}
+	return strconv.FormatBool(b.v)
+}
+
+func (b *autoBool) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	b.set, b.v = true, v
+	return err
+}
+
+func (b *autoBool) IsBoolFlag() bool { return true }
+
+// value is the flag's value, or def when it was not given.
+func (b *autoBool) value(def bool) bool {
+	if b.set {
+		return b.v
+	}
+	return def
+}
+
+// writeSession is an open target of a modifying command. Disk is nil when
+// the target has no readable GPT yet; Dev then addresses the raw file.
+type writeSession struct {
+	Path string
+	Size int64
+	Disk *gpt.Disk
+	Dev  gpt.Device
+	// SectorSize is that of the GPT, else the logical sector size of a
+	// block device; 0 for an image without a GPT.
+	SectorSize int
+
+	// KeepKernelTable skips asking the kernel to re-read the table of a
+	// block device after a write, for commands that update it themselves.
+	KeepKernelTable bool
+
+	file     *os.File
+	overlay  *gpt.Overlay // the raw overlay when there is no Disk
+	rec      *audit.Record
+	log      audit.Log
+	readBack *gpt.ReadBackDevice
+}
+
+// open checks the target against the system disk guard, opens the audit log
+// and the target for writing. Writes must go through Dev to be audited.
+//
+// With -overlay nothing reaches the target: the guards are left to
+// gptctl overlay commit, which writes it for real.
+func (o *writeOpts) open(path, operation string) (*writeSession, error) {
+	if overlayPath != "" {
+		return o.openOverlay(path, operation)
+	}
+	if err := device.GuardSystemDisk(path, o.force); err != nil {
+		return nil, err
+	}
+	s := &writeSession{Path: path}
+	if o.auditLog != "" {
+		l, err := audit.Open(o.auditLog)
+		if err != nil {
+			return nil, err
+		}
+		s.log = l
+	}
+	if format, err := device.DetectFormat(path); err == nil && format != "raw" {
+		s.close()
+		return nil, fmt.Errorf("%s is a %s image, which can only be read", path, format)
+	}
+	d, err := openDisk(path, gpt.ReadWrite())
+	if err == nil && !o.forceHibernated {
+		if herr := guardHibernated(d); herr != nil {
+			d.Close()
+			s.close()
+			return nil, herr
+		}
+	}
+	if err == nil {
+		s.Disk, s.Size, s.SectorSize = d, d.Size, d.SectorSize
+		if err := o.snapshot(path, d, d.Size, d.SectorSize, operation, d.Primary, d.Backup); err != nil {
+			d.Close()
+			s.close()
+			return nil, err
+		}
+		s.rec = audit.Begin(d, operation)
+		o.normalizeHeaders(d)
+		s.Dev = s.rec.Wrap(o.wrapReadBack(s, d, d.File()))
+		return s, nil
+	}
+	if errors.Is(err, gpt.ErrTableSize) {
+		// there is a GPT, just a big one: never treat it as a blank disk
+		s.close()
+		return nil, fmt.Errorf("%w (raise -max-table-bytes to accept it)", err)
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	if s.Size, err = gpt.DeviceSize(f); err != nil {
+		f.Close()
+		s.close()
+		return nil, fmt.Errorf("size of %s: %w", path, err)
+	}
+	if isBlockDevice(path) {
+		s.SectorSize, _, _ = gpt.BlockSizes(f)
+	}
+	if err := o.snapshot(path, f, s.Size, s.SectorSize, operation, nil, nil); err != nil {
+		f.Close()
+		s.close()
+		return nil, err
+	}
+	s.file = f
+	s.rec = audit.NewRecord(path, operation)
+	s.Dev = s.rec.Wrap(o.wrapReadBack(s, gpt.WithDeadline(f, ioTimeout), f))
+	return s, nil
+}
+
+// openOverlay is open with -overlay: the target is opened read-only
+// beneath the overlay file, which receives every write.
+func (o *writeOpts) openOverlay(path, operation string) (*writeSession, error) {
+	s := &writeSession{Path: path, KeepKernelTable: true}
+	if o.auditLog != "" {
+		l, err := audit.Open(o.auditLog)
+		if err != nil {
+			return nil, err
+		}
+		s.log = l
+	}
+	d, err := openDisk(path, gpt.ReadWrite())
+	if errors.Is(err, gpt.ErrTableSize) {
+		s.close()
+		return nil, fmt.Errorf("%w (raise -max-table-bytes to accept it)", err)
+	}
+	if err == nil {
+		s.Disk, s.Size, s.SectorSize = d, d.Size, d.SectorSize
+		if err := o.snapshot(path, d, d.Size, d.SectorSize, operation, d.Primary, d.Backup); err != nil {
+			s.close()
+			return nil, err
+		}
+		s.rec = audit.Begin(d, operation+" (overlay)")
+		o.normalizeHeaders(d)
+		s.Dev = s.rec.Wrap(o.wrapReadBack(s, d, nil))
+		return s, nil
+	}
+	ov, ss, err := openOverlay(path)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+	s.overlay, s.Size, s.SectorSize = ov, ov.Size(), ss
+	if err := o.snapshot(path, ov, s.Size, s.SectorSize, operation, nil, nil); err != nil {
+		s.close()
+		return nil, err
+	}
+	s.rec = audit.NewRecord(path, operation+" (overlay)")
+	s.Dev = s.rec.Wrap(o.wrapReadBack(s, ov, nil))
+	return s, nil
+}
+
+// normalizeHeaders applies -normalize to the tables read from d, so the
+// next write of either copy drops the vendor data.
+func (o *writeOpts) normalizeHeaders(d *gpt.Disk) {
+	if !o.normalize {
+		return
+	}
+	for _, t := range []*gpt.Table{d.Primary, d.Backup} {
+		if t != nil {
+			t.Header.Normalize()
+		}
+	}
+}
+
+// snapshot saves the GPT state of the target to -snapshot-dir, if given,
+// before anything is written.
+func (o *writeOpts) snapshot(path string, r io.ReaderAt, size int64, sectorSize int, operation string, primary, backup *gpt.Table) error {
+	if o.snapshotDir == "" {
+		return nil
+	}
+	id := identify(path, size, sectorSize)
+	if t := primary; t != nil || backup != nil {
+		if t == nil {
+			t = backup
+		}
+		id.DiskGUID = t.Header.DiskGUID.String()
+	}
+	snap, err := snapshot.Take(r, id, operation, primary, backup)
+	if err == nil {
+		err = snap.Save(o.snapshotDir)
+	}
+	if err != nil {
+		return fmt.Errorf("snapshot before %s: %w", operation, err)
+	}
+	fmt.Fprintf(os.Stderr, "snapshot %s saved in %s\n", snap.ID, o.snapshotDir)
+	return nil
+}
+
+// identify describes the target for a snapshot.
+func identify(path string, size int64, sectorSize int) snapshot.Identity {
+	id := snapshot.Identity{Path: path, Size: size, SectorSize: sectorSize}
+	if isBlockDevice(path) {
+		if bd, err := device.Describe(path); err == nil {
+			id.Model, id.Serial = bd.Model, bd.Serial
+		}
+	}
+	return id
+}
+
+// guardHibernated refuses a disk holding an NTFS volume that Windows
+// hibernated, by choice or through Fast Startup, or left dirty. Windows
+// resumes with the volume's metadata cached and writes it back regardless
+// of what changed meanwhile, so a moved or resized partition, or a hybrid
+// MBR rewritten underneath it, corrupts the filesystem.
+func guardHibernated(d *gpt.Disk) error {
+	t := d.Table()
+	ss := int64(d.SectorSize)
+	var reasons []string
+	for _, i := range t.Used() {
+		e := t.Entries[i]
+		st, err := fsinfo.ReadNTFSState(d, int64(e.StartingLBA)*ss)
+		switch {
+		case errors.Is(err, fsinfo.ErrUnknown):
+			continue
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "gptctl: warning: partition %d: cannot read NTFS state: %v\n", i+1, err)
+		case st.Hibernated:
+			reasons = append(reasons, fmt.Sprintf("partition %d (%q) is hibernated", i+1, e.Name()))
+		case st.Dirty:
+			reasons = append(reasons, fmt.Sprintf("partition %d (%q) is marked dirty", i+1, e.Name()))
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s holds NTFS volumes Windows is not done with: %s. Windows Fast Startup or hibernation "+
+		"will write cached metadata back on resume and corrupt them if the partition table changes; "+
+		"shut Windows down fully (shutdown /s /t 0, or disable Fast Startup) or pass -force-hibernated",
+		d.Path, strings.Join(reasons, "; "))
+}
+
+// wrapReadBack adds read-back verification to dev if -verify-writes asks
+// for it. It goes beneath the audit hooks, which need to see the purpose
+// of each write.
+func (o *writeOpts) wrapReadBack(s *writeSession, dev gpt.Device, f *os.File) gpt.Device {
+	if !o.verifyWrites.value(isBlockDevice(s.Path) && overlayPath == "") {
+		return dev
+	}
+	s.readBack = gpt.WithReadBack(dev, f)
+	return s.readBack
+}
+
+// finish records the outcome, appends the audit record and closes the
+// target. It returns err, joined with any error closing the target.
+func (s *writeSession) finish(after *gpt.Table, err error) error {
+	if err == nil && s.readBack != nil {
+		// whatever was written without a Sync after it
+		if err = s.Dev.Sync(); err == nil {
+			err = s.readBack.Check()
+		}
+	}
+	if err == nil && after != nil && !s.KeepKernelTable {
+		s.reread()
+	}
+	s.rec.End(after, err)
+	if s.log != nil {
+		if aerr := s.log.Append(s.rec); aerr != nil {
+			fmt.Fprintf(os.Stderr, "audit log: %v\n", aerr)
+		}
+	}
+	return errors.Join(err, s.close())
+}
+
+// reread has the kernel pick up the table just written to a block device.
+// A disk with mounted partitions refuses; that is worth a note, not an
+// error, since the table on the disk is already correct.
+func (s *writeSession) reread() {
+	f := s.file
+	if s.Disk != nil {
+		f = s.Disk.File()
+	}
+	if f == nil || !isBlockDevice(s.Path) {
+		return
+	}
+	if err := gpt.RereadPartitions(f); err != nil && !errors.Is(err, gpt.ErrNotSupported) {
+		fmt.Fprintf(os.Stderr, "note: the kernel keeps using the old partition table of %s until partx -u or a reboot: %v\n", s.Path, err)
+	}
+}
+
+func (s *writeSession) close() error {
+	var err error
+	if s.Disk != nil {
+		err = s.Disk.Close()
+	}
+	if s.file != nil {
+		err = s.file.Close()
+	}
+	if s.overlay != nil {
+		err = s.overlay.Close()
+	}
+	if s.log != nil {
+		s.log.Close()
+	}
+	return err
+}
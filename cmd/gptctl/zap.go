@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// signatureBytes is how much zap -wipe-signatures zeroes at the start of a
+// partition: enough for the superblocks and labels of filesystems, LUKS,
+// swap, bcache and md 1.1/1.2, the furthest in being the ZFS labels.
+const signatureBytes = 1 << 20
+
+// runZap destroys the partition tables of a disk, as sgdisk -Z does: the
+// MBR, the primary GPT in the sectors after it and the backup GPT at the
+// end of the disk are zeroed, along with both copies wherever their
+// headers put them. The data of the partitions stays where it was; with
+// -wipe-signatures the start of each is zeroed too, so blkid and udev no
+// longer find the filesystems when the disk is partitioned again.
+func runZap(args []string) error {
+	fs := newFlagSet("zap", "<disk|image>")
+	wipeSigs := fs.Bool("wipe-signatures", false, "also zero the first MiB of every partition in the old tables, where filesystems keep their signatures")
+	wo := addWriteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one target is required")
+	}
+	target, err := device.Resolve(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if target.Index >= 0 {
+		return fmt.Errorf("%s is a partition; zap takes the whole disk, %s", fs.Arg(0), target.Disk)
+	}
+	path := target.Disk
+
+	s, err := wo.open(path, "zap")
+	if err != nil {
+		return err
+	}
+	ss := int64(s.SectorSize)
+	if ss == 0 {
+		ss = gpt.DefaultSectorSize
+	}
+	// only copies that validated: the LBAs of a damaged header are noise
+	var tables []*gpt.Table
+	if d := s.Disk; d != nil {
+		if d.Primary != nil && d.PrimaryErr == nil {
+			tables = append(tables, d.Primary)
+		}
+		if d.Backup != nil && d.BackupErr == nil {
+			tables = append(tables, d.Backup)
+		}
+	}
+	mbr := make([]byte, ss)
+	if _, err := s.Dev.ReadAt(mbr, 0); err != nil {
+		return s.finish(nil, fmt.Errorf("read the MBR: %w", err))
+	}
+	starts := partitionStarts(tables, mbr, s.Size, ss)
+	if isBlockDevice(path) {
+		for _, p := range starts {
+			if mp, _ := device.MountPoint(device.PartitionPath(path, p.n)); mp != "" {
+				return s.finish(nil, fmt.Errorf("partition %d is mounted on %s", p.n, mp))
+			}
+		}
+	}
+
+	regions := zapRegions(tables, s.Size, ss)
+	for _, r := range regions {
+		if err := zeroRange(s.Dev, r.from, r.to); err != nil {
+			return s.finish(nil, err)
+		}
+	}
+	if *wipeSigs {
+		for _, p := range starts {
+			if err := zeroRange(s.Dev, p.off, min(p.off+p.size, s.Size)); err != nil {
+				return s.finish(nil, fmt.Errorf("partition %d: %w", p.n, err))
+			}
+		}
+	}
+	if err := s.Dev.Sync(); err != nil {
+		return s.finish(nil, err)
+	}
+	if !s.KeepKernelTable {
+		s.reread()
+	}
+	if err := s.finish(nil, nil); err != nil {
+		return err
+	}
+	fmt.Printf("zapped %s: MBR and GPT zeroed at LBA 0-%d and %d-%d", path, regions[0].to/ss-1, regions[1].from/ss, s.Size/ss-1)
+	if n := len(regions) - 2; n > 0 {
+		fmt.Printf(", and %d more ranges the GPT headers pointed at", n)
+	}
+	fmt.Println()
+	switch {
+	case !*wipeSigs:
+	case len(starts) == 0:
+		fmt.Println("no partitions in the old tables; no signatures wiped")
+	case len(starts) == 1:
+		fmt.Printf("zeroed the first %s of partition %d\n", humanBytes(signatureBytes), starts[0].n)
+	default:
+		var ns []string
+		for _, p := range starts {
+			ns = append(ns, strconv.Itoa(p.n))
+		}
+		fmt.Printf("zeroed the first %s of partitions %s\n", humanBytes(signatureBytes), strings.Join(ns, ", "))
+	}
+	return nil
+}
+
+// byteRange is the bytes from up to, not including, to.
+type byteRange struct {
+	from, to int64
+}
+
+// zapHead and zapTail are the bytes at the start and at the end of a disk
+// that a default GPT with 128 entries occupies, the MBR included: LBA 0-33
+// and the last 33 sectors with 512-byte sectors.
+func zapHead(ss int64) int64 { return (2 + defaultTableSectors(ss)) * ss }
+func zapTail(ss int64) int64 { return (1 + defaultTableSectors(ss)) * ss }
+
+func defaultTableSectors(ss int64) int64 {
+	return (gpt.DefaultNumEntries*gpt.EntrySize + ss - 1) / ss
+}
+
+// zapRegions lists the byte ranges of a disk of size bytes that hold its
+// MBR and GPT: the default places at both ends first, then the headers and
+// entry arrays the copies in tables point at where they lie elsewhere, as
+// after a disk grew or for a larger array. LBAs past the end of the disk are
+// ignored.
+func zapRegions(tables []*gpt.Table, size, ss int64) []byteRange {
+	out := []byteRange{{0, min(zapHead(ss), size)}, {max(size-zapTail(ss), 0), size}}
+	lbas := uint64(size / ss)
+	covered := func(from, to int64) bool {
+		for _, r := range out {
+			if from >= r.from && to <= r.to {
+				return true
+			}
+		}
+		return false
+	}
+	for _, t := range tables {
+		if t == nil {
+			continue
+		}
+		// the other copy too, where this one expects it: it may not have
+		// been found there
+		for _, c := range []*gpt.Table{t, t.Alternate()} {
+			h := &c.Header
+			for _, x := range []struct{ lba, sectors uint64 }{
+				{h.CurrentLBA, 1},
+				{h.PartitionTableLBA, h.TableSectors(int(ss))},
+			} {
+				if x.lba >= lbas || x.sectors == 0 {
+					continue
+				}
+				r := byteRange{int64(x.lba) * ss, int64(x.lba+min(x.sectors, lbas-x.lba)) * ss}
+				if !covered(r.from, r.to) {
+					out = append(out, r)
+				}
+			}
+		}
+	}
+	return out
+}
+
+// partStart is where a partition of the old tables begins, and how much of
+// it -wipe-signatures zeroes.
+type partStart struct {
+	n         int // partition number, 1-based
+	off, size int64
+}
+
+// partitionStarts lists the partitions of the GPT copies in tables and of a
+// classic MBR in mbr, each start once, in disk order. Partitions that start
+// past the end of a disk of size bytes, or end before they start, are left
+// out.
+func partitionStarts(tables []*gpt.Table, mbr []byte, size, ss int64) []partStart {
+	lbas := uint64(size / ss)
+	seen := map[uint64]bool{}
+	var out []partStart
+	add := func(n int, start, sectors uint64) {
+		if sectors == 0 || start >= lbas || seen[start] {
+			return
+		}
+		seen[start] = true
+		sectors = min(sectors, lbas-start, uint64(signatureBytes/ss))
+		out = append(out, partStart{n, int64(start) * ss, int64(sectors) * ss})
+	}
+	for _, t := range tables {
+		for _, i := range t.Used() {
+			if e := t.Entries[i]; e.EndingLBA >= e.StartingLBA {
+				add(i+1, e.StartingLBA, e.Sectors())
+			}
+		}
+	}
+	if parts, ok := gpt.ParseMBR(mbr); ok && gpt.ProtectiveRecord(mbr) < 0 {
+		for _, p := range parts {
+			add(p.Index+1, uint64(p.Start), uint64(p.Sectors))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].off < out[j].off })
+	return out
+}
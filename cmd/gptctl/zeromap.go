@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+// Kinds of zeroRun.
+const (
+	runHole = "hole" // not allocated in the image file
+	runZero = "zero" // allocated, reads as zeros
+	runData = "data"
+)
+
+// zeroRun is a range of sectors [start, end) of one kind.
+type zeroRun struct {
+	start, end uint64
+	kind       string
+}
+
+// runZeromap maps the holes and all-zero sectors of an image against its
+// partitions, to tell before distributing it how much of it would be left
+// out by sparsifying or squeezed out by compression.
+func runZeromap(args []string) error {
+	fs := newFlagSet("zeromap", "<image|disk>")
+	ranges := fs.Bool("ranges", false, "also list each hole and zero run, by LBA")
+	minRunFlag := fs.String("min-run", "1MiB", "with -ranges, leave out runs shorter than this")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("one image or disk is required")
+	}
+	minRun, err := layout.ParseSize(*minRunFlag)
+	if err != nil {
+		return fmt.Errorf("-min-run: %w", err)
+	}
+	path := fs.Arg(0)
+	d, err := openDisk(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	ss := uint64(d.SectorSize)
+
+	extents := [][2]int64{{0, d.Size}}
+	if f := d.File(); f != nil && d.Offset == 0 {
+		if extents, err = dataExtents(f, d.Size); err != nil {
+			return fmt.Errorf("holes of %s: %w", path, err)
+		}
+	}
+	runs, err := scanZeroRuns(d, extents, ss, uint64(d.Size)/ss)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-36s %10s %10s %10s %10s\n", "REGION", "SIZE", "HOLE", "ZERO", "DATA")
+	total := map[string]uint64{}
+	for _, r := range diskRegions(d.Table(), uint64(d.Size)/ss) {
+		n := map[string]uint64{}
+		for _, z := range runs {
+			if lo, hi := max(z.start, r.start), min(z.end, r.end); lo < hi {
+				n[z.kind] += hi - lo
+				total[z.kind] += hi - lo
+			}
+		}
+		fmt.Printf("%-36s %10s %10s %10s %10s\n", r.name, humanBytes(int64((r.end-r.start)*ss)),
+			humanBytes(int64(n[runHole]*ss)), humanBytes(int64(n[runZero]*ss)), humanBytes(int64(n[runData]*ss)))
+	}
+	all := total[runHole] + total[runZero] + total[runData]
+	fmt.Printf("%-36s %10s %10s %10s %10s\n", "total", humanBytes(int64(all*ss)),
+		humanBytes(int64(total[runHole]*ss)), humanBytes(int64(total[runZero]*ss)), humanBytes(int64(total[runData]*ss)))
+	if all > 0 {
+		fmt.Printf("\n%.1f%% of the image is holes or zeros; a sparse copy stores %s\n",
+			100*float64(total[runHole]+total[runZero])/float64(all), humanBytes(int64(total[runData]*ss)))
+	}
+
+	if *ranges {
+		fmt.Println()
+		regions := diskRegions(d.Table(), uint64(d.Size)/ss)
+		for _, z := range runs {
+			if z.kind == runData || int64((z.end-z.start)*ss) < minRun {
+				continue
+			}
+			fmt.Printf("%12d-%-12d %-4s %10s  %s\n", z.start, z.end-1, z.kind, humanBytes(int64((z.end-z.start)*ss)), regionsOf(regions, z))
+		}
+	}
+	return nil
+}
+
+// scanZeroRuns classifies every sector below sectors: those outside the
+// data extents are holes, the others are read to tell zeros from data.
+func scanZeroRuns(d *gpt.Disk, extents [][2]int64, ss, sectors uint64) ([]zeroRun, error) {
+	var runs []zeroRun
+	add := func(lba, n uint64, kind string) {
+		if n == 0 {
+			return
+		}
+		if l := len(runs) - 1; l >= 0 && runs[l].kind == kind && runs[l].end == lba {
+			runs[l].end += n
+			return
+		}
+		runs = append(runs, zeroRun{lba, lba + n, kind})
+	}
+	buf := make([]byte, 4<<20)
+	next := uint64(0)
+	for _, e := range extents {
+		// extents of a file system are block aligned, which sectors are too
+		start, end := max(uint64(e[0])/ss, next), min((uint64(e[1])+ss-1)/ss, sectors)
+		add(next, start-next, runHole)
+		for lba := start; lba < end; {
+			n := min(uint64(len(buf))/ss, end-lba)
+			b := buf[:n*ss]
+			if _, err := d.ReadAt(b, int64(lba*ss)); err != nil {
+				return nil, fmt.Errorf("read at LBA %d: %w", lba, err)
+			}
+			for i := uint64(0); i < n; i++ {
+				kind := runData
+				if isZero(b[i*ss : (i+1)*ss]) {
+					kind = runZero
+				}
+				add(lba+i, 1, kind)
+			}
+			lba += n
+		}
+		next = end
+	}
+	add(next, sectors-next, runHole)
+	return runs, nil
+}
+
+// diskRegion is a named range of sectors [start, end) of a disk.
+type diskRegion struct {
+	name       string
+	start, end uint64
+}
+
+// diskRegions divides a disk of sectors sectors into its GPT structures,
+// partitions and the free space between them.
+func diskRegions(t *gpt.Table, sectors uint64) []diskRegion {
+	h := t.Header
+	first, last := h.FirstUsableLBA, h.LastUsableLBA
+	regions := []diskRegion{{"MBR+primary GPT", 0, min(first, sectors)}}
+	used := t.Used()
+	sort.Slice(used, func(a, b int) bool { return t.Entries[used[a]].StartingLBA < t.Entries[used[b]].StartingLBA })
+	next := first
+	for _, i := range used {
+		e := t.Entries[i]
+		if e.StartingLBA > next {
+			regions = append(regions, diskRegion{"free", next, e.StartingLBA})
+		}
+		name := fmt.Sprintf("partition %d", i+1)
+		if n := e.Name(); n != "" {
+			name += fmt.Sprintf(" %q", n)
+		}
+		regions = append(regions, diskRegion{name, e.StartingLBA, e.EndingLBA + 1})
+		next = max(next, e.EndingLBA+1)
+	}
+	if next <= last {
+		regions = append(regions, diskRegion{"free", next, last + 1})
+	}
+	if last+1 < sectors {
+		regions = append(regions, diskRegion{"backup GPT", last + 1, min(max(h.CurrentLBA, h.BackupLBA)+1, sectors)})
+		if end := max(h.CurrentLBA, h.BackupLBA) + 1; end < sectors {
+			regions = append(regions, diskRegion{"past the backup GPT", end, sectors})
+		}
+	}
+	return regions
+}
+
+// regionsOf names the regions z overlaps.
+func regionsOf(regions []diskRegion, z zeroRun) string {
+	var s string
+	for _, r := range regions {
+		if max(z.start, r.start) < min(z.end, r.end) {
+			if s != "" {
+				s += ", "
+			}
+			s += r.name
+		}
+	}
+	return s
+}
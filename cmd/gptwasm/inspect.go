@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/verify"
+)
+
+// result is what gptInspect resolves to, as JSON.
+type result struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	SectorSize int       `json:"sector_size,omitempty"`
+	PrimaryErr string    `json:"primary_error,omitempty"`
+	BackupErr  string    `json:"backup_error,omitempty"`
+	Table      string    `json:"table,omitempty"`
+	Findings   []finding `json:"findings"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type finding struct {
+	ID        string `json:"id"`
+	Severity  string `json:"severity"`
+	Partition int    `json:"partition,omitempty"`
+	Message   string `json:"message"`
+}
+
+// inspect reads and verifies the GPT of r, which holds size bytes.
+func inspect(r io.ReaderAt, size int64, name string) result {
+	res := result{Name: name, Size: size, Findings: []finding{}}
+	d, err := gpt.OpenReaderAt(r, size, name)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.SectorSize = d.SectorSize
+	if d.PrimaryErr != nil {
+		res.PrimaryErr = d.PrimaryErr.Error()
+	}
+	if d.BackupErr != nil {
+		res.BackupErr = d.BackupErr.Error()
+	}
+	t := d.Table()
+	if !t.Header.IsPrimary() {
+		t = t.Alternate()
+	}
+	if text, err := t.MarshalText(); err == nil {
+		res.Table = string(text)
+	}
+	for _, f := range verify.Disk(d, verify.Options{}) {
+		res.Findings = append(res.Findings, finding{ID: f.Rule.ID, Severity: f.Severity.String(), Partition: f.Entry + 1, Message: f.Message})
+	}
+	return res
+}
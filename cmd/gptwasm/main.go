@@ -0,0 +1,13 @@
+// Command gptwasm is the GPT inspector built for the browser:
+//
+//	GOOS=js GOARCH=wasm go build -o gpt.wasm ./cmd/gptwasm
+//
+// Loaded with wasm_exec.js from the Go distribution, it defines
+//
+//	gptInspect(image) -> Promise<object>
+//
+// where image is a File, Blob or Uint8Array. The result holds the sector
+// size, both copies' errors, the primary table in the text form of gptctl
+// dump -text and the findings of gptctl verify. Only the sectors holding
+// the GPT are read from a File, so multi-gigabyte images stay on disk.
+package main
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"syscall/js"
+
+	"github.com/cpuuntery/go-code-and-bin/blob"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+func main() {
+	js.Global().Set("gptInspect", js.FuncOf(func(_ js.Value, args []js.Value) any {
+		if len(args) != 1 {
+			return reject(errors.New("gptInspect takes one File, Blob or Uint8Array"))
+		}
+		image := args[0]
+		return js.Global().Get("Promise").New(js.FuncOf(func(_ js.Value, cb []js.Value) any {
+			resolve, rejectFn := cb[0], cb[1]
+			// reading a Blob waits for the browser, which must not happen
+			// on the event loop
+			go func() {
+				res, err := inspectValue(image)
+				if err != nil {
+					rejectFn.Invoke(js.Global().Get("Error").New(err.Error()))
+					return
+				}
+				resolve.Invoke(res)
+			}()
+			return nil
+		}))
+	}))
+	select {}
+}
+
+func inspectValue(v js.Value) (js.Value, error) {
+	var r io.ReaderAt
+	var size int64
+	name := "image"
+	if v.InstanceOf(js.Global().Get("Uint8Array")) {
+		b := make([]byte, v.Get("length").Int())
+		js.CopyBytesToGo(b, v)
+		r, size = gpt.MemDevice(b), int64(len(b))
+	} else {
+		br, err := blob.NewReader(v)
+		if err != nil {
+			return js.Undefined(), err
+		}
+		if n := v.Get("name"); n.Type() == js.TypeString {
+			name = n.String()
+		}
+		r, size = br, br.Size()
+	}
+	b, err := json.Marshal(inspect(r, size, name))
+	if err != nil {
+		return js.Undefined(), err
+	}
+	return js.Global().Get("JSON").Call("parse", string(b)), nil
+}
+
+func reject(err error) js.Value {
+	return js.Global().Get("Promise").Call("reject", js.Global().Get("Error").New(err.Error()))
+}
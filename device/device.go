@@ -0,0 +1,18 @@
+// Package device finds and describes the block devices attached to the host,
+// and opens disk images in the container formats registered with
+// RegisterFormat.
+package device
+
+// BlockDevice is a whole disk as seen by the operating system.
+type BlockDevice struct {
+	Name string // kernel name, e.g. "sda"
+	Path string // device node, e.g. "/dev/sda"
+	Size int64  // bytes, 0 if unknown
+
+	Model     string // e.g. "Samsung SSD 860", "" if unknown
+	Serial    string // serial number or WWID, "" if unknown
+	Transport string // parted-style: scsi, nvme, virtblk, sd/mmc, loopback, usb, unknown
+	// LogicalSectorSize and PhysicalSectorSize are 0 if unknown.
+	LogicalSectorSize  int
+	PhysicalSectorSize int
+}
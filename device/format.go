@@ -0,0 +1,114 @@
+package device
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Image is a disk image opened through its container format: reads
+// address the disk it holds, not the container file.
+type Image interface {
+	io.ReaderAt
+	io.Closer
+	// Size is the size of the contained disk in bytes.
+	Size() int64
+}
+
+// A Prober reports whether the file r, size bytes long, is in its format.
+// It reads only what it needs, typically a magic number at either end.
+type Prober func(r io.ReaderAt, size int64) bool
+
+// An Opener opens path, a file its Prober accepted, as an Image.
+type Opener func(path string) (Image, error)
+
+type format struct {
+	name  string
+	probe Prober
+	open  Opener
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   []format
+)
+
+// RegisterFormat makes an image container format known to OpenImage, and
+// so to every command reading disks. Out-of-tree formats register from an
+// init function. Formats are probed in registration order; registering a
+// name twice panics.
+func RegisterFormat(name string, p Prober, o Opener) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if p == nil || o == nil {
+		panic("device: RegisterFormat " + name + " with nil prober or opener")
+	}
+	for _, f := range formats {
+		if f.name == name {
+			panic("device: RegisterFormat called twice for " + name)
+		}
+	}
+	formats = append(formats, format{name, p, o})
+}
+
+// Formats returns the names of the registered formats, sorted.
+func Formats() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.name
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DetectFormat returns the name of the registered format of the file at
+// path, or "raw" when no format claims it. Block devices are always raw.
+func DetectFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !fi.Mode().IsRegular() {
+		return "raw", nil
+	}
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, fm := range formats {
+		if fm.probe(f, fi.Size()) {
+			return fm.name, nil
+		}
+	}
+	return "raw", nil
+}
+
+// OpenImage opens path through its container format. It returns nil and
+// "raw" for plain images and devices, which callers open directly so they
+// can be written to.
+func OpenImage(path string) (Image, string, error) {
+	name, err := DetectFormat(path)
+	if err != nil || name == "raw" {
+		return nil, name, err
+	}
+	formatsMu.RLock()
+	var open Opener
+	for _, fm := range formats {
+		if fm.name == name {
+			open = fm.open
+		}
+	}
+	formatsMu.RUnlock()
+	img, err := open(path)
+	if err != nil {
+		return nil, name, fmt.Errorf("%s image %s: %w", name, path, err)
+	}
+	return img, name, nil
+}
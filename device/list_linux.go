@@ -0,0 +1,108 @@
+package device
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// List returns the whole-disk block devices from /sys/block, skipping RAM
+// disks and empty loop devices.
+func List() ([]BlockDevice, error) {
+	ents, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return nil, err
+	}
+	var out []BlockDevice
+	for _, e := range ents {
+		name := e.Name()
+		if strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "zram") {
+			continue
+		}
+		if d := describe(name); d.Size != 0 {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+// Describe returns what sysfs knows about the whole disk at path, which
+// may be a symlink such as /dev/disk/by-id/....
+func Describe(path string) (BlockDevice, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return BlockDevice{}, err
+	}
+	name := filepath.Base(real)
+	if _, err := os.Stat(filepath.Join("/sys/block", name)); err != nil {
+		return BlockDevice{}, fmt.Errorf("device: %s is not a whole disk", path)
+	}
+	return describe(name), nil
+}
+
+func describe(name string) BlockDevice {
+	dir := filepath.Join("/sys/block", name)
+	d := BlockDevice{Name: name, Path: "/dev/" + name, Transport: "unknown"}
+	// always in 512-byte units regardless of the logical sector size
+	d.Size = readSysInt(filepath.Join(dir, "size")) * 512
+	d.LogicalSectorSize = int(readSysInt(filepath.Join(dir, "queue/logical_block_size")))
+	d.PhysicalSectorSize = int(readSysInt(filepath.Join(dir, "queue/physical_block_size")))
+	if b, err := os.ReadFile(filepath.Join(dir, "device/model")); err == nil {
+		d.Model = strings.TrimSpace(string(b))
+	}
+	// NVMe and virtio expose a serial, SCSI disks a WWID
+	for _, f := range []string{"device/serial", "serial", "device/wwid", "wwid"} {
+		if b, err := os.ReadFile(filepath.Join(dir, f)); err == nil && len(bytes.TrimSpace(b)) > 0 {
+			d.Serial = string(bytes.TrimSpace(b))
+			break
+		}
+	}
+	link, _ := filepath.EvalSymlinks(dir)
+	switch {
+	case strings.Contains(link, "/usb"):
+		d.Transport = "usb"
+	case strings.HasPrefix(name, "nvme"):
+		d.Transport = "nvme"
+	case strings.HasPrefix(name, "sd"):
+		d.Transport = "scsi"
+	case strings.HasPrefix(name, "vd"):
+		d.Transport = "virtblk"
+	case strings.HasPrefix(name, "mmcblk"):
+		d.Transport = "sd/mmc"
+	case strings.HasPrefix(name, "loop"):
+		d.Transport = "loopback"
+	case strings.HasPrefix(name, "md"):
+		d.Transport = "md"
+	}
+	return d
+}
+
+func readSysInt(path string) int64 {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, _ := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	return n
+}
+
+// partitionParent maps a partition's kernel name (e.g. "sda2", "nvme0n1p2")
+// to its disk and 1-based partition number using sysfs.
+func partitionParent(name string) (disk string, num int, ok bool) {
+	b, err := os.ReadFile(filepath.Join("/sys/class/block", name, "partition"))
+	if err != nil {
+		return "", 0, false
+	}
+	num, err = strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return "", 0, false
+	}
+	link, err := filepath.EvalSymlinks(filepath.Join("/sys/class/block", name))
+	if err != nil {
+		return "", 0, false
+	}
+	return filepath.Base(filepath.Dir(link)), num, true
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package device
+
+import "errors"
+
+// List is only implemented on Linux.
+func List() ([]BlockDevice, error) {
+	return nil, errors.New("device: listing block devices is not supported on this platform")
+}
+
+// Describe is only implemented on Linux.
+func Describe(path string) (BlockDevice, error) {
+	return BlockDevice{}, errors.New("device: describing block devices is not supported on this platform")
+}
+
+func partitionParent(name string) (string, int, bool) {
+	return "", 0, false
+}
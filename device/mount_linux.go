@@ -0,0 +1,57 @@
+package device
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// MountPoint returns where the block device at path is mounted, or "" when
+// it is not mounted.
+func MountPoint(path string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", err
+	}
+	want := devNumber(uint64(st.Rdev))
+	mi, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", err
+	}
+	defer mi.Close()
+	sc := bufio.NewScanner(mi)
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) >= 5 && f[2] == want {
+			return unescapeMountinfo(f[4]), nil
+		}
+	}
+	return "", sc.Err()
+}
+
+// unescapeMountinfo undoes the octal escapes (\040 for space etc.) of
+// /proc/self/mountinfo.
+func unescapeMountinfo(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			v := 0
+			ok := true
+			for _, c := range s[i+1 : i+4] {
+				if c < '0' || c > '7' {
+					ok = false
+					break
+				}
+				v = v*8 + int(c-'0')
+			}
+			if ok {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
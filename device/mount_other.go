@@ -0,0 +1,10 @@
+//go:build !linux
+
+package device
+
+import "errors"
+
+// MountPoint is only implemented on Linux.
+func MountPoint(path string) (string, error) {
+	return "", errors.New("device: mount points are not supported on this platform")
+}
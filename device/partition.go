@@ -0,0 +1,12 @@
+package device
+
+import "fmt"
+
+// PartitionPath returns the device node the kernel creates for partition n
+// (1-based) of disk: /dev/sda -> /dev/sda1, /dev/nvme0n1 -> /dev/nvme0n1p1.
+func PartitionPath(disk string, n int) string {
+	if last := disk[len(disk)-1]; last >= '0' && last <= '9' {
+		return fmt.Sprintf("%sp%d", disk, n)
+	}
+	return fmt.Sprintf("%s%d", disk, n)
+}
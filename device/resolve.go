@@ -0,0 +1,146 @@
+package device
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// Target is a resolved command line argument: the whole disk (or image) that
+// holds the GPT and, if the argument named a partition, its entry index.
+type Target struct {
+	Disk  string
+	Index int // -1 when the argument names a whole disk
+}
+
+// IsSpec reports whether arg is a partition spec that needs resolving rather
+// than a plain path.
+func IsSpec(arg string) bool {
+	return strings.HasPrefix(arg, "PARTUUID=") || strings.HasPrefix(arg, "PARTLABEL=") ||
+		strings.HasPrefix(arg, "/dev/disk/by-")
+}
+
+// Resolve turns arg into a Target. Accepted forms:
+//
+//	PARTUUID=<guid>                  unique partition GUID
+//	PARTLABEL=<name>                 partition name
+//	/dev/disk/by-partuuid/<guid>     same as PARTUUID=
+//	/dev/disk/by-partlabel/<name>    same as PARTLABEL=
+//	/dev/disk/by-*/..., /dev/sda2    any node of a partition (via sysfs)
+//	anything else                    a whole disk or image
+//
+// PARTUUID and PARTLABEL are looked up by reading the GPT of every attached
+// disk, so they work even without udev.
+func Resolve(arg string) (Target, error) {
+	switch {
+	case strings.HasPrefix(arg, "/dev/disk/by-partuuid/"):
+		arg = "PARTUUID=" + filepath.Base(arg)
+	case strings.HasPrefix(arg, "/dev/disk/by-partlabel/"):
+		arg = "PARTLABEL=" + unescapeUdev(filepath.Base(arg))
+	}
+	if strings.HasPrefix(arg, "PARTUUID=") || strings.HasPrefix(arg, "PARTLABEL=") {
+		devs, err := List()
+		if err != nil {
+			return Target{}, err
+		}
+		paths := make([]string, len(devs))
+		for i, d := range devs {
+			paths[i] = d.Path
+		}
+		return ResolveAmong(arg, paths)
+	}
+
+	node := arg
+	if strings.HasPrefix(arg, "/dev/") {
+		if p, err := filepath.EvalSymlinks(arg); err == nil {
+			node = p
+		}
+	}
+	if fi, err := os.Stat(node); err == nil && fi.Mode()&os.ModeDevice != 0 {
+		if disk, num, ok := partitionParent(filepath.Base(node)); ok {
+			return Target{Disk: "/dev/" + disk, Index: num - 1}, nil
+		}
+	}
+	return Target{Disk: arg, Index: -1}, nil
+}
+
+// ResolveAmong resolves a PARTUUID= or PARTLABEL= spec by searching the GPTs
+// of the given disks or images. It fails if the spec matches nothing or
+// more than one partition.
+func ResolveAmong(spec string, paths []string) (Target, error) {
+	found, err := Find(spec, paths)
+	if err != nil {
+		return Target{}, err
+	}
+	switch len(found) {
+	case 0:
+		return Target{}, fmt.Errorf("device: no partition matches %s", spec)
+	case 1:
+		return found[0].Target, nil
+	}
+	var where []string
+	for _, m := range found {
+		where = append(where, fmt.Sprintf("%s#%d", m.Disk, m.Index))
+	}
+	return Target{}, fmt.Errorf("device: %s is ambiguous: %s", spec, strings.Join(where, ", "))
+}
+
+// Match is a partition found by Find.
+type Match struct {
+	Target
+	SectorSize int
+	Entry      gpt.Entry
+}
+
+// Find returns every partition on the given disks or images that matches a
+// PARTUUID= or PARTLABEL= spec. Disks without a readable GPT are skipped.
+func Find(spec string, paths []string) ([]Match, error) {
+	key, val, _ := strings.Cut(spec, "=")
+	var want gpt.GUID
+	if key == "PARTUUID" {
+		g, err := gpt.ParseGUID(val)
+		if err != nil {
+			return nil, err
+		}
+		want = g
+	} else if key != "PARTLABEL" {
+		return nil, fmt.Errorf("device: unsupported spec %q", spec)
+	}
+
+	var found []Match
+	for _, p := range paths {
+		d, err := gpt.Open(p)
+		if err != nil {
+			continue
+		}
+		t := d.Table()
+		for _, i := range t.Used() {
+			e := t.Entries[i]
+			if (key == "PARTUUID" && e.UniqueGUID == want) || (key == "PARTLABEL" && e.Name() == val) {
+				found = append(found, Match{Target: Target{Disk: p, Index: i}, SectorSize: d.SectorSize, Entry: e})
+			}
+		}
+		d.Close()
+	}
+	return found, nil
+}
+
+// unescapeUdev undoes the \xNN escaping udev applies to by-partlabel names.
+func unescapeUdev(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+			if c, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
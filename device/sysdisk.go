@@ -0,0 +1,25 @@
+package device
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSystemDisk is returned by GuardSystemDisk for the disk the running
+// system lives on.
+var ErrSystemDisk = errors.New("device: target hosts the running system")
+
+// GuardSystemDisk refuses path when it holds the mounted root filesystem or
+// active swap, unless force is set. Every tool that writes to a disk calls
+// this before opening it.
+func GuardSystemDisk(path string, force bool) error {
+	reasons, err := SystemUse(path)
+	if err != nil {
+		return fmt.Errorf("device: checking whether %s is the system disk: %w", path, err)
+	}
+	if len(reasons) == 0 || force {
+		return nil
+	}
+	return fmt.Errorf("%w (%s); pass -force-system-disk to write anyway", ErrSystemDisk, strings.Join(reasons, "; "))
+}
@@ -0,0 +1,121 @@
+package device
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// SystemUse lists why path must be treated as the running system's disk: it
+// (or a partition, LVM/dm or md device stacked on it) holds "/" or active
+// swap. Regular files other than loop-backed ones are never system disks.
+func SystemUse(path string) ([]string, error) {
+	disk, err := wholeDiskOf(path)
+	if err != nil || disk == "" {
+		return nil, err
+	}
+	var reasons []string
+
+	mi, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer mi.Close()
+	sc := bufio.NewScanner(mi)
+	for sc.Scan() {
+		f := strings.Fields(sc.Text())
+		if len(f) < 5 || f[4] != "/" {
+			continue
+		}
+		if name := nameFromDevNumber(f[2]); name != "" && underlyingDisks(name)[disk] {
+			reasons = append(reasons, "/ is mounted from "+name)
+		}
+	}
+
+	if b, err := os.ReadFile("/proc/swaps"); err == nil {
+		for _, line := range strings.Split(string(b), "\n")[1:] {
+			f := strings.Fields(line)
+			if len(f) == 0 {
+				continue
+			}
+			var st syscall.Stat_t
+			if err := syscall.Stat(f[0], &st); err != nil {
+				continue
+			}
+			dev := st.Rdev
+			if f[1] == "file" {
+				dev = st.Dev
+			}
+			name := nameFromDevNumber(devNumber(uint64(dev)))
+			if name != "" && underlyingDisks(name)[disk] {
+				reasons = append(reasons, "swap "+f[0]+" is active")
+			}
+		}
+	}
+	return reasons, nil
+}
+
+// wholeDiskOf returns the kernel name of the disk behind path, or "" for
+// things that are not block devices.
+func wholeDiskOf(path string) (string, error) {
+	p, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	if fi.Mode()&os.ModeDevice == 0 {
+		return "", nil
+	}
+	name := filepath.Base(p)
+	if disk, _, ok := partitionParent(name); ok {
+		return disk, nil
+	}
+	return name, nil
+}
+
+// devNumber renders a Linux dev_t as "major:minor".
+func devNumber(dev uint64) string {
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	return fmt.Sprintf("%d:%d", major, minor)
+}
+
+// nameFromDevNumber maps "major:minor" to a kernel block device name.
+func nameFromDevNumber(mm string) string {
+	link, err := filepath.EvalSymlinks(filepath.Join("/sys/dev/block", mm))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(link)
+}
+
+// underlyingDisks returns the whole disks a block device is built from,
+// following partitions to their disk and dm/md devices to their slaves.
+func underlyingDisks(name string) map[string]bool {
+	out := map[string]bool{}
+	var walk func(n string, depth int)
+	walk = func(n string, depth int) {
+		if depth > 8 {
+			return
+		}
+		if disk, _, ok := partitionParent(n); ok {
+			n = disk
+		}
+		slaves, _ := os.ReadDir(filepath.Join("/sys/class/block", n, "slaves"))
+		if len(slaves) == 0 {
+			out[n] = true
+			return
+		}
+		for _, s := range slaves {
+			walk(s.Name(), depth+1)
+		}
+	}
+	walk(name, 0)
+	return out
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package device
+
+// SystemUse is only implemented on Linux; elsewhere nothing is reported.
+func SystemUse(path string) ([]string, error) {
+	return nil, nil
+}
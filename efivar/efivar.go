@@ -0,0 +1,224 @@
+// Package efivar reads the UEFI boot manager variables (BootOrder,
+// BootCurrent and the Boot#### load options) as Linux exposes them in
+// efivarfs, and decodes the parts of their device paths that name a GPT
+// partition and a file on it.
+package efivar
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// Dir is where Linux mounts efivarfs.
+const Dir = "/sys/firmware/efi/efivars"
+
+// GlobalVariable is the vendor GUID of the boot manager variables.
+const GlobalVariable = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+
+// ErrNoEFI means the directory holds no efivarfs, usually because the
+// system was booted in legacy BIOS mode.
+var ErrNoEFI = errors.New("efivar: no EFI variables (not booted via UEFI, or efivarfs not mounted)")
+
+// LoadOptionActive is the LOAD_OPTION_ACTIVE attribute.
+const LoadOptionActive = 0x00000001
+
+// LoadOption is one decoded Boot#### variable.
+type LoadOption struct {
+	Number      uint16
+	Attributes  uint32
+	Description string
+	// Disk is set when the device path contains a hard drive node with a
+	// GPT partition signature; the fields below describe that node.
+	Disk            bool
+	PartitionGUID   gpt.GUID
+	PartitionNumber uint32
+	PartitionStart  uint64 // LBA
+	PartitionSize   uint64 // sectors
+	// File is the path of the file path node, e.g. \EFI\BOOT\BOOTX64.EFI.
+	File string
+	// Other lists the device path node types not decoded, e.g. "3/18"
+	// for a SATA messaging node.
+	Other []string
+}
+
+// Active reports whether the boot manager considers the option at all.
+func (o LoadOption) Active() bool {
+	return o.Attributes&LoadOptionActive != 0
+}
+
+// Name returns the variable name, e.g. "Boot0003".
+func (o LoadOption) Name() string {
+	return fmt.Sprintf("Boot%04X", o.Number)
+}
+
+// BootVars is the state of the boot manager.
+type BootVars struct {
+	Order   []uint16
+	Current int // -1 when BootCurrent is unset
+	Options []LoadOption
+}
+
+// Read reads BootOrder, BootCurrent and every Boot#### variable from the
+// efivarfs mounted at dir.
+func Read(dir string) (*BootVars, error) {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNoEFI
+		}
+		return nil, err
+	}
+	bv := &BootVars{Current: -1}
+	if b, err := readVar(dir, "BootOrder"); err == nil {
+		for i := 0; i+2 <= len(b); i += 2 {
+			bv.Order = append(bv.Order, binary.LittleEndian.Uint16(b[i:]))
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if b, err := readVar(dir, "BootCurrent"); err == nil && len(b) >= 2 {
+		bv.Current = int(binary.LittleEndian.Uint16(b))
+	}
+	for _, e := range ents {
+		name, vendor, ok := strings.Cut(e.Name(), "-")
+		if !ok || vendor != GlobalVariable || len(name) != 8 || !strings.HasPrefix(name, "Boot") {
+			continue
+		}
+		n, err := strconv.ParseUint(name[4:], 16, 16)
+		if err != nil {
+			continue
+		}
+		b, err := readVar(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		o, err := ParseLoadOption(b)
+		if err != nil {
+			return nil, fmt.Errorf("efivar: %s: %w", name, err)
+		}
+		o.Number = uint16(n)
+		bv.Options = append(bv.Options, o)
+	}
+	if len(bv.Options) == 0 && bv.Order == nil {
+		return nil, ErrNoEFI
+	}
+	sort.Slice(bv.Options, func(i, j int) bool { return bv.Options[i].Number < bv.Options[j].Number })
+	return bv, nil
+}
+
+// Option returns the option numbered n.
+func (bv *BootVars) Option(n uint16) (LoadOption, bool) {
+	for _, o := range bv.Options {
+		if o.Number == n {
+			return o, true
+		}
+	}
+	return LoadOption{}, false
+}
+
+// readVar returns the value of a global variable without the 4-byte
+// attribute prefix efivarfs puts in front of it.
+func readVar(dir, name string) ([]byte, error) {
+	b, err := os.ReadFile(filepath.Join(dir, name+"-"+GlobalVariable))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 4 {
+		return nil, fmt.Errorf("efivar: %s: %d bytes, shorter than its attributes", name, len(b))
+	}
+	return b[4:], nil
+}
+
+// ParseLoadOption decodes an EFI_LOAD_OPTION (UEFI 3.1.3): attributes,
+// the length of the device path list, a NUL-terminated UCS-2
+// description and the device paths. Optional data after them is ignored.
+func ParseLoadOption(b []byte) (LoadOption, error) {
+	var o LoadOption
+	if len(b) < 6 {
+		return o, errors.New("load option too short")
+	}
+	o.Attributes = binary.LittleEndian.Uint32(b)
+	pathLen := int(binary.LittleEndian.Uint16(b[4:]))
+	desc, rest, err := ucs2String(b[6:])
+	if err != nil {
+		return o, fmt.Errorf("description: %w", err)
+	}
+	o.Description = desc
+	if pathLen > len(rest) {
+		return o, fmt.Errorf("device path list of %d bytes, only %d left", pathLen, len(rest))
+	}
+	return o, o.parseDevicePath(rest[:pathLen])
+}
+
+// Device path node types and subtypes (UEFI 10.3).
+const (
+	typeMedia     = 0x04
+	typeEnd       = 0x7f
+	subHardDrive  = 0x01
+	subFilePath   = 0x04
+	sigTypeGUID   = 0x02
+	hardDriveSize = 42
+)
+
+func (o *LoadOption) parseDevicePath(p []byte) error {
+	for len(p) > 0 {
+		if len(p) < 4 {
+			return errors.New("truncated device path node")
+		}
+		typ, sub := p[0], p[1]
+		n := int(binary.LittleEndian.Uint16(p[2:]))
+		if n < 4 || n > len(p) {
+			return fmt.Errorf("device path node %d/%d has bad length %d", typ, sub, n)
+		}
+		node := p[4:n]
+		switch {
+		case typ == typeEnd:
+			// end of this instance; a multi-instance path goes on
+		case typ == typeMedia && sub == subHardDrive && n >= hardDriveSize && node[37] == sigTypeGUID:
+			o.Disk = true
+			o.PartitionNumber = binary.LittleEndian.Uint32(node)
+			o.PartitionStart = binary.LittleEndian.Uint64(node[4:])
+			o.PartitionSize = binary.LittleEndian.Uint64(node[12:])
+			copy(o.PartitionGUID[:], node[20:36])
+		case typ == typeMedia && sub == subFilePath:
+			s, _, err := ucs2String(node)
+			if err != nil {
+				return fmt.Errorf("file path: %w", err)
+			}
+			o.File += s
+		default:
+			o.Other = append(o.Other, fmt.Sprintf("%d/%d", typ, sub))
+		}
+		p = p[n:]
+	}
+	return nil
+}
+
+// ucs2String decodes a NUL-terminated little-endian UCS-2 string and
+// returns what follows the terminator. A missing terminator ends the
+// string at the end of b.
+func ucs2String(b []byte) (string, []byte, error) {
+	var u []uint16
+	for i := 0; ; i += 2 {
+		if i+2 > len(b) {
+			if i != len(b) {
+				return "", nil, errors.New("odd length")
+			}
+			return string(utf16.Decode(u)), nil, nil
+		}
+		c := binary.LittleEndian.Uint16(b[i:])
+		if c == 0 {
+			return string(utf16.Decode(u)), b[i+2:], nil
+		}
+		u = append(u, c)
+	}
+}
@@ -0,0 +1,119 @@
+// Package event delivers notable things the long-running tool modes observe
+// (disks appearing, validation failures, repairs) to a log destination with
+// structured fields: stdout, the systemd journal or syslog, and optionally
+// to webhooks for push notifications.
+package event
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cpuuntery/go-code-and-bin/journald"
+)
+
+// Severity follows syslog levels.
+type Severity int
+
+const (
+	Error   Severity = journald.PriErr
+	Warning Severity = journald.PriWarning
+	Notice  Severity = journald.PriNotice
+	Info    Severity = journald.PriInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Error:
+		return "error"
+	case Warning:
+		return "warning"
+	case Notice:
+		return "notice"
+	}
+	return "info"
+}
+
+// Kinds of events.
+const (
+	DiskAdded        = "disk-added"
+	DiskRemoved      = "disk-removed"
+	ValidationFailed = "validation-failed"
+	ValidationOK     = "validation-ok"
+	Repair           = "repair"
+)
+
+// Event is one observation.
+type Event struct {
+	Time     time.Time
+	Kind     string
+	Severity Severity
+	Device   string
+	Message  string
+	// Fields carries additional key/value data; keys are lower case.
+	Fields map[string]string
+}
+
+// Sink is a destination for events.
+type Sink interface {
+	Emit(Event) error
+	Close() error
+}
+
+// Open returns the sink named by spec: "stdout", "journald" or "syslog".
+func Open(spec string) (Sink, error) {
+	switch spec {
+	case "", "stdout":
+		return stdoutSink{}, nil
+	case "journald":
+		if !journald.Available() {
+			return nil, fmt.Errorf("event: journald socket %s not found", journald.SocketPath)
+		}
+		return journalSink{}, nil
+	case "syslog":
+		return openSyslog()
+	}
+	return nil, fmt.Errorf("event: unknown log destination %q", spec)
+}
+
+// sortedFields renders Fields as "key=value" pairs in a stable order.
+func (e Event) sortedFields() string {
+	keys := make([]string, 0, len(e.Fields))
+	for k := range e.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, " %s=%q", k, e.Fields[k])
+	}
+	return b.String()
+}
+
+type stdoutSink struct{}
+
+func (stdoutSink) Emit(e Event) error {
+	_, err := fmt.Printf("%s %-7s %-18s %s: %s%s\n", e.Time.Format(time.RFC3339), e.Severity, e.Kind, e.Device, e.Message, e.sortedFields())
+	return err
+}
+
+func (stdoutSink) Close() error { return nil }
+
+type journalSink struct{}
+
+func (journalSink) Emit(e Event) error {
+	fields := map[string]string{
+		"SYSLOG_IDENTIFIER": filepath.Base(os.Args[0]),
+		"GPT_EVENT":         e.Kind,
+		"GPT_DEVICE":        e.Device,
+	}
+	for k, v := range e.Fields {
+		fields["GPT_"+strings.ToUpper(strings.ReplaceAll(k, "-", "_"))] = v
+	}
+	return journald.Send(int(e.Severity), e.Device+": "+e.Message, fields)
+}
+
+func (journalSink) Close() error { return nil }
@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package event
+
+import "errors"
+
+func openSyslog() (Sink, error) {
+	return nil, errors.New("event: syslog is not available on this platform")
+}
@@ -0,0 +1,40 @@
+//go:build !windows && !plan9
+
+package event
+
+import (
+	"log/syslog"
+	"os"
+	"path/filepath"
+)
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func openSyslog() (Sink, error) {
+	w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_NOTICE, filepath.Base(os.Args[0]))
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w}, nil
+}
+
+// Emit sends the event with its fields as key="value" pairs, which most
+// syslog pipelines can split without further configuration.
+func (s *syslogSink) Emit(e Event) error {
+	msg := e.Device + ": " + e.Message + " event=" + e.Kind + e.sortedFields()
+	switch e.Severity {
+	case Error:
+		return s.w.Err(msg)
+	case Warning:
+		return s.w.Warning(msg)
+	case Notice:
+		return s.w.Notice(msg)
+	}
+	return s.w.Info(msg)
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,119 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// webhookPayload is the JSON body POSTed for every event.
+type webhookPayload struct {
+	Time     time.Time         `json:"time"`
+	Host     string            `json:"host,omitempty"`
+	Kind     string            `json:"kind"`
+	Severity string            `json:"severity"`
+	Device   string            `json:"device"`
+	Message  string            `json:"message"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+type webhookSink struct {
+	url    string
+	shown  string // url as errors may show it
+	host   string
+	client *http.Client
+}
+
+// NewWebhook returns a sink that POSTs each event as a JSON object to the
+// http or https URL u. Any status other than 2xx is an error; a slow or
+// unreachable endpoint fails the Emit after timeout instead of blocking.
+func NewWebhook(u string, timeout time.Duration) (Sink, error) {
+	p, err := url.Parse(u)
+	if err != nil {
+		// not err itself, which quotes the whole URL
+		return nil, fmt.Errorf("event: webhook: invalid URL: %w", errors.Unwrap(err))
+	}
+	if (p.Scheme != "http" && p.Scheme != "https") || p.Host == "" {
+		return nil, fmt.Errorf("event: webhook %s: need an http or https URL", redactURL(p))
+	}
+	host, _ := os.Hostname()
+	return &webhookSink{url: u, shown: redactURL(p), host: host, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// redactURL returns u fit for logs: the user info, query and fragment, where
+// webhook tokens go, are masked or dropped.
+func redactURL(u *url.URL) string {
+	c := *u
+	if c.User != nil {
+		c.User = url.User("xxxxx")
+	}
+	c.RawQuery, c.ForceQuery, c.Fragment, c.RawFragment = "", false, "", ""
+	return c.Redacted()
+}
+
+func (s *webhookSink) Emit(e Event) error {
+	body, err := json.Marshal(webhookPayload{
+		Time:     e.Time.UTC(),
+		Host:     s.host,
+		Kind:     e.Kind,
+		Severity: e.Severity.String(),
+		Device:   e.Device,
+		Message:  e.Message,
+		Fields:   e.Fields,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			ue.URL = s.shown
+		}
+		return fmt.Errorf("event: webhook: %w", err)
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("event: webhook %s: %s", s.shown, resp.Status)
+	}
+	return nil
+}
+
+func (s *webhookSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+type teeSink []Sink
+
+// Tee returns a sink delivering every event to all of sinks. A sink that
+// fails does not keep the event from the others.
+func Tee(sinks ...Sink) Sink {
+	if len(sinks) == 1 {
+		return sinks[0]
+	}
+	return teeSink(sinks)
+}
+
+func (t teeSink) Emit(e Event) error {
+	var errs []error
+	for _, s := range t {
+		errs = append(errs, s.Emit(e))
+	}
+	return errors.Join(errs...)
+}
+
+func (t teeSink) Close() error {
+	var errs []error
+	for _, s := range t {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
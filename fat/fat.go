@@ -0,0 +1,150 @@
+// Package fat creates FAT32 filesystems and modifies them in place: enough
+// to format an EFI System Partition, grow one after its partition was
+// extended and copy bootloaders into it without mounting it.
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrNotFAT32 is returned for anything but a FAT32 boot sector.
+var ErrNotFAT32 = errors.New("fat: not a FAT32 filesystem")
+
+// Device is what the filesystem lives on.
+type Device interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// bpb holds the BIOS parameter block fields used here.
+type bpb struct {
+	bytesPerSector    int64
+	sectorsPerCluster int64
+	reserved          int64
+	numFATs           int64
+	totalSectors      int64
+	fatSize           int64 // sectors per FAT
+	fsInfo            int64 // sector of the FSInfo structure
+	backupBoot        int64 // sector of the backup boot sector, 0 if none
+}
+
+// maxClusters is the largest cluster count a FAT32 volume can have.
+const maxClusters = 0x0FFFFFF5
+
+// readBPB parses the boot sector bs, refusing geometry that is not
+// consistent: odd sector or cluster sizes, or FATs that leave no room for
+// data within the sector count.
+func readBPB(bs []byte) (bpb, error) {
+	le := binary.LittleEndian
+	if bs[510] != 0x55 || bs[511] != 0xAA || !bytes.Equal(bs[82:87], []byte("FAT32")) {
+		return bpb{}, ErrNotFAT32
+	}
+	b := bpb{
+		bytesPerSector:    int64(le.Uint16(bs[11:])),
+		sectorsPerCluster: int64(bs[13]),
+		reserved:          int64(le.Uint16(bs[14:])),
+		numFATs:           int64(bs[16]),
+		totalSectors:      int64(le.Uint32(bs[32:])),
+		fatSize:           int64(le.Uint32(bs[36:])),
+		fsInfo:            int64(le.Uint16(bs[48:])),
+		backupBoot:        int64(le.Uint16(bs[50:])),
+	}
+	switch {
+	case b.bytesPerSector < 512 || b.bytesPerSector > 4096 || b.bytesPerSector&(b.bytesPerSector-1) != 0,
+		b.sectorsPerCluster == 0 || b.sectorsPerCluster&(b.sectorsPerCluster-1) != 0,
+		b.reserved == 0, b.numFATs == 0, b.fatSize == 0:
+		return bpb{}, ErrNotFAT32
+	}
+	if c := b.clusters(b.totalSectors); c < 1 || c > maxClusters {
+		return bpb{}, fmt.Errorf("%w: %d reserved and %d×%d FAT sectors in %d sectors leave %d clusters",
+			ErrNotFAT32, b.reserved, b.numFATs, b.fatSize, b.totalSectors, c)
+	}
+	return b, nil
+}
+
+// clusters returns the number of data clusters for a given total size.
+func (b bpb) clusters(totalSectors int64) int64 {
+	return (totalSectors - b.reserved - b.numFATs*b.fatSize) / b.sectorsPerCluster
+}
+
+// Grow extends the FAT32 filesystem at byte offset off of dev to size bytes
+// (normally the new partition size). The FATs keep their size, so growth is
+// capped by the clusters they can describe; Grow returns the size the
+// filesystem ended up with. Shrinking is refused.
+func Grow(dev Device, off, size int64) (int64, error) {
+	bs := make([]byte, 512)
+	if _, err := dev.ReadAt(bs, off); err != nil {
+		return 0, err
+	}
+	b, err := readBPB(bs)
+	if err != nil {
+		return 0, err
+	}
+	newTotal := size / b.bytesPerSector
+	if newTotal < b.totalSectors {
+		return 0, fmt.Errorf("fat: refusing to shrink from %d to %d sectors", b.totalSectors, newTotal)
+	}
+	// entries 0 and 1 are reserved, so a FAT of n entries maps n-2 clusters
+	fatClusters := min(b.fatSize*b.bytesPerSector/4-2, maxClusters)
+	oldClusters := b.clusters(b.totalSectors)
+	newClusters := min(b.clusters(newTotal), fatClusters)
+	if newClusters <= oldClusters {
+		return b.totalSectors * b.bytesPerSector, nil
+	}
+	newTotal = min(newTotal, b.reserved+b.numFATs*b.fatSize+newClusters*b.sectorsPerCluster)
+
+	// the FAT entries of the new clusters must read as free
+	zero := make([]byte, (newClusters-oldClusters)*4)
+	for i := int64(0); i < b.numFATs; i++ {
+		at := off + (b.reserved+i*b.fatSize)*b.bytesPerSector + (oldClusters+2)*4
+		if _, err := dev.WriteAt(zero, at); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := updateFSInfo(dev, off, b, newClusters-oldClusters); err != nil {
+		return 0, err
+	}
+	binary.LittleEndian.PutUint32(bs[32:], uint32(newTotal))
+	if _, err := dev.WriteAt(bs, off); err != nil {
+		return 0, err
+	}
+	if b.backupBoot != 0 {
+		if _, err := dev.WriteAt(bs, off+b.backupBoot*b.bytesPerSector); err != nil {
+			return 0, err
+		}
+	}
+	return newTotal * b.bytesPerSector, nil
+}
+
+// updateFSInfo adds the new clusters to the free count of the FSInfo sector
+// (and its backup copy), leaving an unknown count unknown.
+func updateFSInfo(dev Device, off int64, b bpb, added int64) error {
+	sectors := []int64{b.fsInfo}
+	if b.backupBoot != 0 {
+		sectors = append(sectors, b.backupBoot+b.fsInfo)
+	}
+	info := make([]byte, 512)
+	for _, sec := range sectors {
+		at := off + sec*b.bytesPerSector
+		if _, err := dev.ReadAt(info, at); err != nil {
+			return err
+		}
+		if !bytes.Equal(info[0:4], []byte("RRaA")) || !bytes.Equal(info[484:488], []byte("rrAa")) {
+			continue
+		}
+		free := binary.LittleEndian.Uint32(info[488:])
+		if free == 0xFFFFFFFF {
+			continue
+		}
+		binary.LittleEndian.PutUint32(info[488:], free+uint32(added))
+		if _, err := dev.WriteAt(info, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
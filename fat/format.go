@@ -0,0 +1,145 @@
+package fat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Format options.
+type Options struct {
+	// SectorSize is the logical sector size; 0 means 512.
+	SectorSize int
+	// Label is the volume label, at most 11 characters; "" gives "NO NAME".
+	Label string
+	// VolumeID is the serial number; 0 derives one from the size.
+	VolumeID uint32
+	// HiddenSectors is the LBA of the partition on its disk.
+	HiddenSectors uint32
+}
+
+// minClusters is the smallest cluster count that makes a volume FAT32.
+const minClusters = 65525
+
+// clusterSectors picks the cluster size Microsoft's format uses for size.
+func clusterSectors(size int64, bps int64) int64 {
+	var cluster int64
+	switch {
+	case size <= 260<<20:
+		cluster = 512
+	case size <= 8<<30:
+		cluster = 4 << 10
+	case size <= 16<<30:
+		cluster = 8 << 10
+	case size <= 32<<30:
+		cluster = 16 << 10
+	default:
+		cluster = 32 << 10
+	}
+	return max(cluster/bps, 1)
+}
+
+// Format writes an empty FAT32 filesystem of size bytes at byte offset off
+// of dev: boot sector and FSInfo (with backups at sectors 6 and 7), two
+// FATs and a root directory holding the volume label.
+func Format(dev Device, off, size int64, o Options) error {
+	bps := int64(o.SectorSize)
+	if bps == 0 {
+		bps = 512
+	}
+	total := size / bps
+	if total > 0xFFFFFFFF {
+		return fmt.Errorf("fat: %d sectors too many for FAT32", total)
+	}
+	spc := clusterSectors(size, bps)
+	const reserved, numFATs = 32, 2
+	// sectors per FAT, sized for the clusters there would be without any
+	// FAT; slightly generous, never short
+	fatSize := (((total-reserved)/spc+2)*4 + bps - 1) / bps
+	b := bpb{bytesPerSector: bps, sectorsPerCluster: spc, reserved: reserved, numFATs: numFATs,
+		totalSectors: total, fatSize: fatSize, fsInfo: 1, backupBoot: 6}
+	clusters := b.clusters(total)
+	if clusters < minClusters {
+		return fmt.Errorf("fat: %d bytes is too small for FAT32 (needs %d clusters of %d bytes)", size, minClusters, spc*bps)
+	}
+
+	label := strings.ToUpper(o.Label)
+	if label == "" {
+		label = "NO NAME"
+	}
+	if len(label) > 11 {
+		return fmt.Errorf("fat: label %q longer than 11 characters", o.Label)
+	}
+	label = fmt.Sprintf("%-11s", label)
+	id := o.VolumeID
+	if id == 0 {
+		id = uint32(size>>9) ^ 0x5EED5EED
+	}
+
+	le := binary.LittleEndian
+	boot := make([]byte, bps)
+	copy(boot[0:3], []byte{0xEB, 0x58, 0x90})
+	copy(boot[3:11], "GPTCTL  ")
+	le.PutUint16(boot[11:], uint16(bps))
+	boot[13] = byte(spc)
+	le.PutUint16(boot[14:], reserved)
+	boot[16] = numFATs
+	boot[21] = 0xF8 // fixed disk
+	le.PutUint16(boot[24:], 63)
+	le.PutUint16(boot[26:], 255)
+	le.PutUint32(boot[28:], o.HiddenSectors)
+	le.PutUint32(boot[32:], uint32(total))
+	le.PutUint32(boot[36:], uint32(fatSize))
+	le.PutUint32(boot[44:], 2) // root directory cluster
+	le.PutUint16(boot[48:], 1) // FSInfo sector
+	le.PutUint16(boot[50:], 6) // backup boot sector
+	boot[64] = 0x80
+	boot[66] = 0x29
+	le.PutUint32(boot[67:], id)
+	copy(boot[71:82], label)
+	copy(boot[82:90], "FAT32   ")
+	boot[510], boot[511] = 0x55, 0xAA
+
+	info := make([]byte, bps)
+	copy(info[0:4], "RRaA")
+	copy(info[484:488], "rrAa")
+	le.PutUint32(info[488:], uint32(clusters-1)) // all but the root directory
+	le.PutUint32(info[492:], 3)
+	le.PutUint32(info[508:], 0xAA550000)
+
+	// the reserved area and FATs start out zeroed
+	zero := make([]byte, 1<<20)
+	end := (reserved + numFATs*fatSize + spc) * bps
+	for at := int64(0); at < end; at += int64(len(zero)) {
+		n := min(int64(len(zero)), end-at)
+		if _, err := dev.WriteAt(zero[:n], off+at); err != nil {
+			return err
+		}
+	}
+	for _, w := range []struct {
+		sector int64
+		data   []byte
+	}{{0, boot}, {1, info}, {6, boot}, {7, info}} {
+		if _, err := dev.WriteAt(w.data, off+w.sector*bps); err != nil {
+			return err
+		}
+	}
+	head := make([]byte, 12)
+	le.PutUint32(head[0:], 0x0FFFFFF8)
+	le.PutUint32(head[4:], 0x0FFFFFFF)
+	le.PutUint32(head[8:], 0x0FFFFFFF) // root directory, one cluster
+	for i := int64(0); i < numFATs; i++ {
+		if _, err := dev.WriteAt(head, off+(reserved+i*fatSize)*bps); err != nil {
+			return err
+		}
+	}
+	if o.Label != "" {
+		ent := make([]byte, 32)
+		copy(ent[0:11], label)
+		ent[11] = 0x08 // volume ID
+		if _, err := dev.WriteAt(ent, off+(reserved+numFATs*fatSize)*bps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,692 @@
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// FS is an opened FAT32 filesystem. The FAT is held in memory; changes to
+// it reach the disk on Flush.
+type FS struct {
+	dev  Device
+	off  int64
+	b    bpb
+	fat  []uint32
+	root uint32
+	free int64
+	next uint32 // allocation hint
+	// Time stamps new files and directories; zero means time.Now().
+	Time time.Time
+}
+
+// Entry describes one directory entry.
+type Entry struct {
+	Name  string
+	IsDir bool
+	Size  int64
+}
+
+type dirent struct {
+	Entry
+	short   [11]byte
+	cluster uint32
+	// slots are the byte offsets of the entry's LFN slots and 8.3 slot
+	slots []int64
+}
+
+const (
+	attrReadOnly  = 0x01
+	attrVolumeID  = 0x08
+	attrDirectory = 0x10
+	attrArchive   = 0x20
+	attrLFN       = 0x0F
+	eoc           = 0x0FFFFFFF
+)
+
+// Open reads the FAT32 filesystem at byte offset off of dev, refusing one
+// larger than size bytes (normally its partition).
+func Open(dev Device, off, size int64) (*FS, error) {
+	bs := make([]byte, 512)
+	if _, err := dev.ReadAt(bs, off); err != nil {
+		return nil, err
+	}
+	b, err := readBPB(bs)
+	if err != nil {
+		return nil, err
+	}
+	if b.totalSectors*b.bytesPerSector > size {
+		return nil, fmt.Errorf("fat: filesystem of %d bytes does not fit in %d bytes", b.totalSectors*b.bytesPerSector, size)
+	}
+	// only the entries of clusters that exist: the FAT may be larger
+	n := min(b.fatSize*b.bytesPerSector/4, b.clusters(b.totalSectors)+2)
+	root := binary.LittleEndian.Uint32(bs[44:])
+	if root < 2 || int64(root) >= n {
+		return nil, fmt.Errorf("fat: root directory cluster %d outside clusters 2-%d", root, n-1)
+	}
+	raw := make([]byte, 4*n)
+	if _, err := dev.ReadAt(raw, off+b.reserved*b.bytesPerSector); err != nil {
+		return nil, err
+	}
+	f := &FS{dev: dev, off: off, b: b, fat: make([]uint32, n), root: root, next: 2}
+	for i := range f.fat {
+		f.fat[i] = binary.LittleEndian.Uint32(raw[4*i:]) & 0x0FFFFFFF
+		if i >= 2 && f.fat[i] == 0 {
+			f.free++
+		}
+	}
+	return f, nil
+}
+
+func (f *FS) clusterSize() int64 { return f.b.sectorsPerCluster * f.b.bytesPerSector }
+
+func (f *FS) clusterOffset(c uint32) int64 {
+	data := f.b.reserved + f.b.numFATs*f.b.fatSize
+	return f.off + (data+int64(c-2)*f.b.sectorsPerCluster)*f.b.bytesPerSector
+}
+
+// chain returns the clusters of the chain starting at c.
+func (f *FS) chain(c uint32) ([]uint32, error) {
+	var out []uint32
+	for c >= 2 && c < 0x0FFFFFF8 {
+		if int(c) >= len(f.fat) || len(out) > len(f.fat) {
+			return nil, fmt.Errorf("fat: corrupt cluster chain at %d", c)
+		}
+		out = append(out, c)
+		c = f.fat[c]
+	}
+	return out, nil
+}
+
+// alloc takes n free clusters, links them into a chain and returns them.
+func (f *FS) alloc(n int) ([]uint32, error) {
+	if int64(n) > f.free {
+		return nil, errors.New("fat: filesystem is full")
+	}
+	out := make([]uint32, 0, n)
+	for c := f.next; len(out) < n; c++ {
+		if int(c) >= len(f.fat) {
+			c = 2
+		}
+		if f.fat[c] == 0 {
+			out = append(out, c)
+			f.fat[c] = eoc
+		}
+	}
+	for i := 0; i+1 < len(out); i++ {
+		f.fat[out[i]] = out[i+1]
+	}
+	f.free -= int64(n)
+	if n > 0 {
+		f.next = out[n-1] + 1
+	}
+	return out, nil
+}
+
+func (f *FS) release(c uint32) error {
+	cs, err := f.chain(c)
+	if err != nil {
+		return err
+	}
+	for _, c := range cs {
+		f.fat[c] = 0
+		f.free++
+	}
+	return nil
+}
+
+// readDir parses the directory whose chain starts at c.
+func (f *FS) readDir(c uint32) ([]dirent, error) {
+	cs, err := f.chain(c)
+	if err != nil {
+		return nil, err
+	}
+	var out []dirent
+	var lfn []uint16
+	var lfnAt []int64
+	buf := make([]byte, f.clusterSize())
+	for _, c := range cs {
+		at := f.clusterOffset(c)
+		if _, err := f.dev.ReadAt(buf, at); err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(buf); i += 32 {
+			e := buf[i : i+32]
+			switch {
+			case e[0] == 0:
+				return out, nil
+			case e[0] == 0xE5:
+				lfn, lfnAt = nil, nil
+				continue
+			case e[11] == attrLFN:
+				if e[0]&0x40 != 0 {
+					lfn, lfnAt = nil, nil
+				}
+				lfnAt = append(lfnAt, at+int64(i))
+				part := make([]uint16, 0, 13)
+				for _, o := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+					part = append(part, binary.LittleEndian.Uint16(e[o:]))
+				}
+				lfn = append(part, lfn...)
+				continue
+			case e[11]&attrVolumeID != 0:
+				lfn, lfnAt = nil, nil
+				continue
+			}
+			d := dirent{slots: []int64{at + int64(i)}}
+			copy(d.short[:], e[0:11])
+			d.IsDir = e[11]&attrDirectory != 0
+			d.Size = int64(binary.LittleEndian.Uint32(e[28:]))
+			d.cluster = uint32(binary.LittleEndian.Uint16(e[20:]))<<16 | uint32(binary.LittleEndian.Uint16(e[26:]))
+			d.Name = shortName(e)
+			if lfn != nil {
+				if end := indexOf(lfn, 0); end >= 0 {
+					lfn = lfn[:end]
+				}
+				d.Name = string(utf16.Decode(lfn))
+				d.slots = append(lfnAt, d.slots...)
+			}
+			lfn, lfnAt = nil, nil
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func indexOf(s []uint16, v uint16) int {
+	for i, c := range s {
+		if c == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// shortName turns an 8.3 entry into "NAME.EXT", honouring the lowercase
+// flags Windows NT stores in byte 12.
+func shortName(e []byte) string {
+	base := strings.TrimRight(string(e[0:8]), " ")
+	ext := strings.TrimRight(string(e[8:11]), " ")
+	if e[12]&0x08 != 0 {
+		base = strings.ToLower(base)
+	}
+	if e[12]&0x10 != 0 {
+		ext = strings.ToLower(ext)
+	}
+	if base != "" && base[0] == 0x05 {
+		base = "\xe5" + base[1:]
+	}
+	if ext == "" {
+		return base
+	}
+	return base + "." + ext
+}
+
+// lookup walks p from the root and returns the cluster of the directory
+// holding the last element and, when found, its entry.
+func (f *FS) lookup(p string) (uint32, *dirent, error) {
+	dir := f.root
+	parts := splitPath(p)
+	for i, name := range parts {
+		ents, err := f.readDir(dir)
+		if err != nil {
+			return 0, nil, err
+		}
+		var found *dirent
+		for k := range ents {
+			if strings.EqualFold(ents[k].Name, name) {
+				found = &ents[k]
+				break
+			}
+		}
+		if i == len(parts)-1 {
+			return dir, found, nil
+		}
+		if found == nil {
+			return 0, nil, &fs.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+		}
+		if !found.IsDir {
+			return 0, nil, &fs.PathError{Op: "open", Path: p, Err: errors.New("not a directory")}
+		}
+		dir = found.cluster
+		if dir == 0 {
+			dir = f.root
+		}
+	}
+	return dir, nil, nil
+}
+
+func splitPath(p string) []string {
+	var out []string
+	for _, s := range strings.Split(path.Clean("/"+strings.ReplaceAll(p, "\\", "/")), "/") {
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// ReadDir lists the directory at p ("" or "/" for the root).
+func (f *FS) ReadDir(p string) ([]Entry, error) {
+	dir := f.root
+	if len(splitPath(p)) > 0 {
+		_, d, err := f.lookup(p)
+		if err != nil {
+			return nil, err
+		}
+		if d == nil || !d.IsDir {
+			return nil, &fs.PathError{Op: "readdir", Path: p, Err: fs.ErrNotExist}
+		}
+		if d.cluster != 0 {
+			dir = d.cluster
+		}
+	}
+	ents, err := f.readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []Entry
+	for _, e := range ents {
+		if e.Name != "." && e.Name != ".." {
+			out = append(out, e.Entry)
+		}
+	}
+	return out, nil
+}
+
+// ReadFile returns the contents of the file at p.
+func (f *FS) ReadFile(p string) ([]byte, error) {
+	_, d, err := f.lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil || d.IsDir {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+	}
+	cs, err := f.chain(d.cluster)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, d.Size)
+	buf := make([]byte, f.clusterSize())
+	for _, c := range cs {
+		if int64(len(out)) >= d.Size {
+			break
+		}
+		if _, err := f.dev.ReadAt(buf, f.clusterOffset(c)); err != nil {
+			return nil, err
+		}
+		out = append(out, buf[:min(int64(len(buf)), d.Size-int64(len(out)))]...)
+	}
+	return out, nil
+}
+
+// MkdirAll creates the directory p and any missing parents.
+func (f *FS) MkdirAll(p string) error {
+	dir := f.root
+	for _, name := range splitPath(p) {
+		ents, err := f.readDir(dir)
+		if err != nil {
+			return err
+		}
+		var next uint32
+		found := false
+		for _, e := range ents {
+			if strings.EqualFold(e.Name, name) {
+				if !e.IsDir {
+					return &fs.PathError{Op: "mkdir", Path: p, Err: fs.ErrExist}
+				}
+				next, found = e.cluster, true
+				break
+			}
+		}
+		if !found {
+			if next, err = f.mkdir(dir, name); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			next = f.root
+		}
+		dir = next
+	}
+	return nil
+}
+
+func (f *FS) mkdir(parent uint32, name string) (uint32, error) {
+	cs, err := f.alloc(1)
+	if err != nil {
+		return 0, err
+	}
+	c := cs[0]
+	buf := make([]byte, f.clusterSize())
+	dotdot := parent
+	if parent == f.root {
+		dotdot = 0
+	}
+	f.putEntry(buf[0:32], [11]byte{'.', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' '}, 0, attrDirectory, c, 0)
+	f.putEntry(buf[32:64], [11]byte{'.', '.', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' ', ' '}, 0, attrDirectory, dotdot, 0)
+	if _, err := f.dev.WriteAt(buf, f.clusterOffset(c)); err != nil {
+		return 0, err
+	}
+	return c, f.addEntry(parent, name, attrDirectory, c, 0)
+}
+
+// WriteFile creates or replaces the file at p; its directory must exist.
+// A file it replaces keeps its clusters until the new data is written,
+// unless only those clusters make room for it.
+func (f *FS) WriteFile(p string, data []byte) error {
+	dir, old, err := f.lookup(p)
+	if err != nil {
+		return err
+	}
+	if old != nil && old.IsDir {
+		return &fs.PathError{Op: "write", Path: p, Err: errors.New("is a directory")}
+	}
+	if int64(len(data)) > 0xFFFFFFFF {
+		return &fs.PathError{Op: "write", Path: p, Err: errors.New("file too large for FAT32")}
+	}
+	cs := f.clusterSize()
+	need := (int64(len(data)) + cs - 1) / cs
+	var oldClusters []uint32
+	if old != nil {
+		if oldClusters, err = f.chain(old.cluster); err != nil {
+			return err
+		}
+	}
+	if need > f.free+int64(len(oldClusters)) {
+		return errors.New("fat: filesystem is full")
+	}
+	released := false
+	if need > f.free {
+		if err := f.release(old.cluster); err != nil {
+			return err
+		}
+		released = true
+	}
+	var first uint32
+	if len(data) > 0 {
+		clusters, err := f.alloc(int(need))
+		if err != nil {
+			return err
+		}
+		first = clusters[0]
+		for i, c := range clusters {
+			chunk := data[int64(i)*cs : min(int64(i+1)*cs, int64(len(data)))]
+			if _, err := f.dev.WriteAt(chunk, f.clusterOffset(c)); err != nil {
+				return err
+			}
+		}
+	}
+	if old != nil {
+		if err := f.markDeleted(old); err != nil {
+			return err
+		}
+		if !released && old.cluster != 0 {
+			if err := f.release(old.cluster); err != nil {
+				return err
+			}
+		}
+	}
+	parts := splitPath(p)
+	return f.addEntry(dir, parts[len(parts)-1], attrArchive, first, uint32(len(data)))
+}
+
+// markDeleted marks the slots of d deleted, leaving its clusters allocated.
+func (f *FS) markDeleted(d *dirent) error {
+	for _, at := range d.slots {
+		if _, err := f.dev.WriteAt([]byte{0xE5}, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *FS) stamp() time.Time {
+	if f.Time.IsZero() {
+		return time.Now()
+	}
+	return f.Time
+}
+
+// putEntry fills one 32-byte 8.3 directory entry.
+func (f *FS) putEntry(e []byte, short [11]byte, ntCase byte, attr byte, cluster, size uint32) {
+	le := binary.LittleEndian
+	copy(e[0:11], short[:])
+	e[11] = attr
+	e[12] = ntCase
+	t := f.stamp()
+	date := uint16(max(t.Year()-1980, 0))<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	tm := uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+	le.PutUint16(e[14:], tm)
+	le.PutUint16(e[16:], date)
+	le.PutUint16(e[18:], date)
+	le.PutUint16(e[20:], uint16(cluster>>16))
+	le.PutUint16(e[22:], tm)
+	le.PutUint16(e[24:], date)
+	le.PutUint16(e[26:], uint16(cluster))
+	le.PutUint32(e[28:], size)
+}
+
+// addEntry writes the directory entries for name into dir, with long-name
+// entries when name is not a plain 8.3 name, growing dir if needed.
+func (f *FS) addEntry(dir uint32, name string, attr byte, cluster, size uint32) error {
+	ents, err := f.readDir(dir)
+	if err != nil {
+		return err
+	}
+	short, ntCase, ok := shortForm(name)
+	var slots [][]byte
+	if !ok {
+		short = uniqueShort(name, ents)
+		slots = lfnEntries(name, short)
+	}
+	e := make([]byte, 32)
+	f.putEntry(e, short, ntCase, attr, cluster, size)
+	slots = append(slots, e)
+
+	at, err := f.freeSlots(dir, len(slots))
+	if err != nil {
+		return err
+	}
+	for i, s := range slots {
+		if _, err := f.dev.WriteAt(s, at[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// freeSlots finds n consecutive unused 32-byte slots in dir, extending the
+// directory by a zeroed cluster when there is no room.
+func (f *FS) freeSlots(dir uint32, n int) ([]int64, error) {
+	cs, err := f.chain(dir)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, f.clusterSize())
+	var run []int64
+	for _, c := range cs {
+		at := f.clusterOffset(c)
+		if _, err := f.dev.ReadAt(buf, at); err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(buf); i += 32 {
+			if buf[i] == 0 || buf[i] == 0xE5 {
+				run = append(run, at+int64(i))
+				if len(run) == n {
+					return run, nil
+				}
+			} else {
+				run = run[:0]
+			}
+		}
+	}
+	// chains of slots may continue into the new cluster
+	added, err := f.alloc(1)
+	if err != nil {
+		return nil, err
+	}
+	f.fat[cs[len(cs)-1]] = added[0]
+	at := f.clusterOffset(added[0])
+	if _, err := f.dev.WriteAt(make([]byte, len(buf)), at); err != nil {
+		return nil, err
+	}
+	for i := int64(0); len(run) < n; i += 32 {
+		run = append(run, at+i)
+	}
+	return run, nil
+}
+
+// shortForm reports whether name fits an 8.3 entry as is, allowing an
+// all-lowercase base or extension through the NT case flags.
+func shortForm(name string) ([11]byte, byte, bool) {
+	var s [11]byte
+	for i := range s {
+		s[i] = ' '
+	}
+	base, ext := name, ""
+	if i := strings.LastIndexByte(name, '.'); i > 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	if base == "" || len(base) > 8 || len(ext) > 3 || strings.Contains(base, ".") {
+		return s, 0, false
+	}
+	var ntCase byte
+	for k, part := range []string{base, ext} {
+		lower, upper := strings.ToLower(part), strings.ToUpper(part)
+		switch part {
+		case upper:
+		case lower:
+			ntCase |= []byte{0x08, 0x10}[k]
+		default:
+			return s, 0, false
+		}
+		for _, c := range upper {
+			if c > 0x7E || c < 0x21 || strings.ContainsRune(`"*+,/:;<=>?[\]|`, c) {
+				return s, 0, false
+			}
+		}
+	}
+	copy(s[0:8], strings.ToUpper(base))
+	copy(s[8:11], strings.ToUpper(ext))
+	return s, ntCase, true
+}
+
+// uniqueShort derives a "BASIS~N.EXT" alias not used in ents.
+func uniqueShort(name string, ents []dirent) [11]byte {
+	clean := func(s string, n int) string {
+		var b strings.Builder
+		for _, c := range strings.ToUpper(s) {
+			if b.Len() == n {
+				break
+			}
+			switch {
+			case c == ' ' || c == '.':
+			case c > 0x7E || strings.ContainsRune(`"*+,/:;<=>?[\]|`, c):
+				b.WriteByte('_')
+			default:
+				b.WriteRune(c)
+			}
+		}
+		return b.String()
+	}
+	base, ext := name, ""
+	if i := strings.LastIndexByte(name, '.'); i > 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	b, x := clean(base, 8), clean(ext, 3)
+	if b == "" {
+		b = "_"
+	}
+	for n := 1; ; n++ {
+		tail := fmt.Sprintf("~%d", n)
+		var s [11]byte
+		copy(s[:], []byte(fmt.Sprintf("%-8s%-3s", b[:min(len(b), 8-len(tail))]+tail, x)))
+		taken := false
+		for _, e := range ents {
+			if e.short == s {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			return s
+		}
+	}
+}
+
+// lfnEntries builds the long-name slots for name, last part first as they
+// appear on disk.
+func lfnEntries(name string, short [11]byte) [][]byte {
+	var sum byte
+	for _, c := range short {
+		sum = (sum>>1 | sum<<7) + c
+	}
+	u := utf16.Encode([]rune(name))
+	if len(u)%13 != 0 {
+		u = append(u, 0)
+		for len(u)%13 != 0 {
+			u = append(u, 0xFFFF)
+		}
+	}
+	n := len(u) / 13
+	out := make([][]byte, n)
+	for k := 0; k < n; k++ {
+		e := make([]byte, 32)
+		e[0] = byte(k + 1)
+		if k == n-1 {
+			e[0] |= 0x40
+		}
+		e[11] = attrLFN
+		e[13] = sum
+		for j, o := range []int{1, 3, 5, 7, 9, 14, 16, 18, 20, 22, 24, 28, 30} {
+			binary.LittleEndian.PutUint16(e[o:], u[k*13+j])
+		}
+		out[n-1-k] = e
+	}
+	return out
+}
+
+// Flush writes the FATs and the FSInfo free count back to the disk.
+func (f *FS) Flush() error {
+	raw := make([]byte, f.b.fatSize*f.b.bytesPerSector)
+	if _, err := f.dev.ReadAt(raw, f.off+f.b.reserved*f.b.bytesPerSector); err != nil {
+		return err
+	}
+	for i, v := range f.fat {
+		// the top four bits are reserved and must be preserved
+		old := binary.LittleEndian.Uint32(raw[4*i:])
+		binary.LittleEndian.PutUint32(raw[4*i:], old&0xF0000000|v)
+	}
+	for i := int64(0); i < f.b.numFATs; i++ {
+		if _, err := f.dev.WriteAt(raw, f.off+(f.b.reserved+i*f.b.fatSize)*f.b.bytesPerSector); err != nil {
+			return err
+		}
+	}
+	info := make([]byte, 512)
+	for _, sec := range []int64{f.b.fsInfo, f.b.backupBoot + f.b.fsInfo} {
+		if sec == 0 || (sec == f.b.fsInfo+f.b.backupBoot && f.b.backupBoot == 0) {
+			continue
+		}
+		at := f.off + sec*f.b.bytesPerSector
+		if _, err := f.dev.ReadAt(info, at); err != nil {
+			return err
+		}
+		if !bytes.Equal(info[0:4], []byte("RRaA")) {
+			continue
+		}
+		binary.LittleEndian.PutUint32(info[488:], uint32(f.free))
+		binary.LittleEndian.PutUint32(info[492:], f.next)
+		if _, err := f.dev.WriteAt(info, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
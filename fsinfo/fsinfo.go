@@ -0,0 +1,178 @@
+// Package fsinfo reads the size and free-space counters of common
+// filesystems straight from their on-disk metadata, without mounting them.
+//
+// Only summary structures are read: the ext superblock, the XFS superblock,
+// the btrfs superblock, the FAT32 FSInfo sector (or the FAT itself) and the
+// NTFS $Bitmap. Counters
+// that filesystems update lazily (ext4, XFS) are as of the last clean
+// unmount.
+//
+// ReadNTFSState also tells whether Windows left an NTFS volume dirty or
+// hibernated, which makes it unsafe to touch from another system, and
+// ReadTimes when an ext filesystem was created, last mounted and last
+// written, for a forensic timeline.
+package fsinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrUnknown is returned for content that is not a supported filesystem.
+var ErrUnknown = errors.New("fsinfo: no supported filesystem found")
+
+// Usage is the space accounting of one filesystem.
+type Usage struct {
+	Type      string // ext2, ext3, ext4, xfs, btrfs, vfat, ntfs
+	BlockSize int64  // allocation unit in bytes
+	Blocks    int64  // blocks the filesystem spans
+	Free      int64  // free blocks
+}
+
+// Size returns the size of the filesystem in bytes.
+func (u Usage) Size() int64 { return u.Blocks * u.BlockSize }
+
+// FreeBytes returns the free space in bytes.
+func (u Usage) FreeBytes() int64 { return u.Free * u.BlockSize }
+
+// UsedBytes returns the allocated space in bytes, metadata included.
+func (u Usage) UsedBytes() int64 { return (u.Blocks - u.Free) * u.BlockSize }
+
+// Read detects the filesystem at byte offset off of r and returns its usage.
+func Read(r io.ReaderAt, off int64) (Usage, error) {
+	head := make([]byte, 4096)
+	if _, err := r.ReadAt(head, off); err != nil && err != io.EOF {
+		return Usage{}, err
+	}
+	switch {
+	case binary.LittleEndian.Uint16(head[1024+56:]) == 0xEF53:
+		return ext(head[1024:2048])
+	case bytes.Equal(head[0:4], []byte("XFSB")):
+		return xfs(head)
+	case bytes.Equal(head[3:11], []byte("NTFS    ")):
+		return ntfs(r, off, head)
+	case head[510] == 0x55 && head[511] == 0xAA && (bytes.Equal(head[82:87], []byte("FAT32")) ||
+		bytes.Equal(head[54:59], []byte("FAT12")) || bytes.Equal(head[54:59], []byte("FAT16"))):
+		return fat(r, off, head)
+	}
+	sb := make([]byte, 4096)
+	if _, err := r.ReadAt(sb, off+64<<10); err == nil && bytes.Equal(sb[64:72], []byte("_BHRfS_M")) {
+		return btrfs(sb)
+	}
+	return Usage{}, ErrUnknown
+}
+
+// btrfs reports the byte totals of the superblock in sectorsize units.
+// Used space counts allocated chunks' contents, not raw chunk allocation.
+func btrfs(sb []byte) (Usage, error) {
+	le := binary.LittleEndian
+	bs := int64(le.Uint32(sb[0x90:]))
+	if bs == 0 {
+		return Usage{}, ErrUnknown
+	}
+	total, used := int64(le.Uint64(sb[0x70:])), int64(le.Uint64(sb[0x78:]))
+	return Usage{Type: "btrfs", BlockSize: bs, Blocks: total / bs, Free: (total - used) / bs}, nil
+}
+
+func ext(sb []byte) (Usage, error) {
+	le := binary.LittleEndian
+	u := Usage{Type: "ext2", BlockSize: 1024 << le.Uint32(sb[24:])}
+	compat, incompat := le.Uint32(sb[92:]), le.Uint32(sb[96:])
+	if compat&0x4 != 0 {
+		u.Type = "ext3"
+	}
+	if incompat&(0x40|0x80|0x200) != 0 {
+		u.Type = "ext4"
+	}
+	u.Blocks = int64(le.Uint32(sb[4:]))
+	u.Free = int64(le.Uint32(sb[12:]))
+	if incompat&0x80 != 0 { // 64bit
+		u.Blocks |= int64(le.Uint32(sb[0x150:])) << 32
+		u.Free |= int64(le.Uint32(sb[0x158:])) << 32
+	}
+	return u, nil
+}
+
+func xfs(sb []byte) (Usage, error) {
+	be := binary.BigEndian
+	return Usage{
+		Type:      "xfs",
+		BlockSize: int64(be.Uint32(sb[4:])),
+		Blocks:    int64(be.Uint64(sb[8:])),
+		Free:      int64(be.Uint64(sb[144:])),
+	}, nil
+}
+
+func fat(r io.ReaderAt, off int64, bs []byte) (Usage, error) {
+	le := binary.LittleEndian
+	bps := int64(le.Uint16(bs[11:]))
+	spc := int64(bs[13])
+	reserved := int64(le.Uint16(bs[14:]))
+	nfats := int64(bs[16])
+	rootEntries := int64(le.Uint16(bs[17:]))
+	total := int64(le.Uint16(bs[19:]))
+	if total == 0 {
+		total = int64(le.Uint32(bs[32:]))
+	}
+	fatSize := int64(le.Uint16(bs[22:]))
+	fat32 := fatSize == 0
+	if fat32 {
+		fatSize = int64(le.Uint32(bs[36:]))
+	}
+	if bps == 0 || spc == 0 {
+		return Usage{}, ErrUnknown
+	}
+	rootSectors := (rootEntries*32 + bps - 1) / bps
+	dataSectors := total - reserved - nfats*fatSize - rootSectors
+	u := Usage{Type: "vfat", BlockSize: bps * spc, Blocks: dataSectors / spc}
+
+	if fat32 {
+		// FSInfo keeps a free count unless it is 0xFFFFFFFF (unknown)
+		info := make([]byte, 512)
+		fsinfo := int64(le.Uint16(bs[48:]))
+		if _, err := r.ReadAt(info, off+fsinfo*bps); err == nil &&
+			bytes.Equal(info[0:4], []byte("RRaA")) && bytes.Equal(info[484:488], []byte("rrAa")) {
+			if free := le.Uint32(info[488:]); free != 0xFFFFFFFF && int64(free) <= u.Blocks {
+				u.Free = int64(free)
+				return u, nil
+			}
+		}
+	}
+
+	// count free entries in the first FAT; clusters are numbered from 2
+	table := make([]byte, fatSize*bps)
+	if _, err := r.ReadAt(table, off+reserved*bps); err != nil && err != io.EOF {
+		return Usage{}, err
+	}
+	for c := int64(2); c < u.Blocks+2; c++ {
+		var v uint32
+		switch {
+		case fat32:
+			if 4*c+4 > int64(len(table)) {
+				return u, nil
+			}
+			v = le.Uint32(table[4*c:]) & 0x0FFFFFFF
+		case u.Blocks < 4085: // FAT12
+			i := c + c/2
+			if i+2 > int64(len(table)) {
+				return u, nil
+			}
+			v = uint32(le.Uint16(table[i:]))
+			if c&1 != 0 {
+				v >>= 4
+			}
+			v &= 0xFFF
+		default:
+			if 2*c+2 > int64(len(table)) {
+				return u, nil
+			}
+			v = uint32(le.Uint16(table[2*c:]))
+		}
+		if v == 0 {
+			u.Free++
+		}
+	}
+	return u, nil
+}
@@ -0,0 +1,189 @@
+package fsinfo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// ntfs counts the clear bits of the $Bitmap file, which has one bit per
+// cluster of the volume.
+func ntfs(r io.ReaderAt, off int64, bs []byte) (Usage, error) {
+	g, err := ntfsGeometry(bs)
+	if err != nil {
+		return Usage{}, err
+	}
+	bps, cluster, recSize, mft := g.bps, g.cluster, g.recSize, g.mft
+	u := Usage{Type: "ntfs", BlockSize: cluster, Blocks: int64(binary.LittleEndian.Uint64(bs[40:])) * bps / cluster}
+
+	// $Bitmap is MFT record 6; assumes the first MFT extent covers it,
+	// which holds for every volume formatted by Windows or mkntfs
+	rec := make([]byte, recSize)
+	if _, err := r.ReadAt(rec, off+mft+6*recSize); err != nil {
+		return Usage{}, err
+	}
+	if err := applyFixups(rec, bps, "FILE"); err != nil {
+		return Usage{}, err
+	}
+	runs, err := dataRuns(rec)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	used := int64(0)
+	remaining := (u.Blocks + 7) / 8
+	for _, run := range runs {
+		if remaining <= 0 {
+			break
+		}
+		n := min(run.clusters*cluster, remaining)
+		buf := make([]byte, n)
+		if _, err := r.ReadAt(buf, off+run.lcn*cluster); err != nil && err != io.EOF {
+			return Usage{}, err
+		}
+		for _, b := range buf {
+			used += int64(bits.OnesCount8(b))
+		}
+		remaining -= n
+	}
+	u.Free = max(u.Blocks-used, 0)
+	return u, nil
+}
+
+// ntfsGeom is the layout an NTFS boot sector describes, in bytes.
+type ntfsGeom struct {
+	bps, cluster, recSize, mft int64
+}
+
+func ntfsGeometry(bs []byte) (ntfsGeom, error) {
+	le := binary.LittleEndian
+	bps := int64(le.Uint16(bs[11:]))
+	spc := int64(bs[13])
+	if spc > 0x80 {
+		spc = 1 << (256 - spc)
+	}
+	if bps == 0 || spc == 0 {
+		return ntfsGeom{}, ErrUnknown
+	}
+	g := ntfsGeom{bps: bps, cluster: bps * spc, mft: int64(le.Uint64(bs[48:])) * bps * spc}
+	g.recSize = int64(int8(bs[64]))
+	if g.recSize < 0 {
+		g.recSize = 1 << -g.recSize
+	} else {
+		g.recSize *= g.cluster
+	}
+	if g.recSize < 512 || g.recSize > 64<<10 {
+		return ntfsGeom{}, ErrUnknown
+	}
+	return g, nil
+}
+
+// applyFixups restores the last two bytes of every sector of a FILE record
+// or INDX block, named by magic, from its update sequence array.
+func applyFixups(rec []byte, bps int64, magic string) error {
+	le := binary.LittleEndian
+	if string(rec[0:4]) != magic {
+		return fmt.Errorf("fsinfo: ntfs: not a %s record", magic)
+	}
+	usaOff, usaCount := int(le.Uint16(rec[4:])), int(le.Uint16(rec[6:]))
+	for i := 1; i < usaCount; i++ {
+		end := i*int(bps) - 2
+		if end+2 > len(rec) || usaOff+2*i+2 > len(rec) {
+			break
+		}
+		copy(rec[end:end+2], rec[usaOff+2*i:usaOff+2*i+2])
+	}
+	return nil
+}
+
+type run struct {
+	lcn, clusters int64
+}
+
+// dataRuns decodes the run list of the non-resident unnamed $DATA attribute.
+func dataRuns(rec []byte) ([]run, error) {
+	attr := findAttr(rec, 0x80)
+	if attr == nil || attr[8] != 1 {
+		return nil, fmt.Errorf("fsinfo: ntfs: no $DATA run list in MFT record")
+	}
+	return attrRuns(attr)
+}
+
+// findAttr returns the first attribute of type typ in a FILE record. For
+// $DATA only the unnamed stream counts.
+func findAttr(rec []byte, typ uint32) []byte {
+	le := binary.LittleEndian
+	pos := int(le.Uint16(rec[20:]))
+	for pos+16 <= len(rec) {
+		t, length := le.Uint32(rec[pos:]), int(le.Uint32(rec[pos+4:]))
+		if t == 0xFFFFFFFF || length <= 0 || pos+length > len(rec) {
+			break
+		}
+		attr := rec[pos : pos+length]
+		if t == typ && (typ != 0x80 || attr[9] == 0) {
+			return attr
+		}
+		pos += length
+	}
+	return nil
+}
+
+// attrRuns decodes the run list of a non-resident attribute.
+func attrRuns(attr []byte) ([]run, error) {
+	if len(attr) < 64 {
+		return nil, errors.New("fsinfo: ntfs: truncated non-resident attribute")
+	}
+	off := int(binary.LittleEndian.Uint16(attr[32:]))
+	if off > len(attr) {
+		return nil, errors.New("fsinfo: ntfs: bad run list offset")
+	}
+	return parseRuns(attr[off:])
+}
+
+// residentValue returns the value of a resident attribute.
+func residentValue(attr []byte) ([]byte, error) {
+	le := binary.LittleEndian
+	if len(attr) < 24 || attr[8] != 0 {
+		return nil, errors.New("fsinfo: ntfs: attribute is not resident")
+	}
+	n, off := int(le.Uint32(attr[16:])), int(le.Uint16(attr[20:]))
+	if off+n > len(attr) {
+		return nil, errors.New("fsinfo: ntfs: truncated resident attribute")
+	}
+	return attr[off : off+n], nil
+}
+
+func parseRuns(b []byte) ([]run, error) {
+	var out []run
+	lcn := int64(0)
+	for len(b) > 0 && b[0] != 0 {
+		lenSize, offSize := int(b[0]&0x0F), int(b[0]>>4)
+		if 1+lenSize+offSize > len(b) {
+			return nil, errors.New("fsinfo: ntfs: truncated run list")
+		}
+		count := leInt(b[1:1+lenSize], false)
+		if offSize == 0 {
+			// sparse run; $Bitmap never has them but skip gracefully
+			b = b[1+lenSize:]
+			continue
+		}
+		lcn += leInt(b[1+lenSize:1+lenSize+offSize], true)
+		out = append(out, run{lcn: lcn, clusters: count})
+		b = b[1+lenSize+offSize:]
+	}
+	return out, nil
+}
+
+// leInt decodes a little-endian integer of up to 8 bytes.
+func leInt(b []byte, signed bool) int64 {
+	var v int64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | int64(b[i])
+	}
+	if signed && len(b) > 0 && len(b) < 8 && b[len(b)-1]&0x80 != 0 {
+		v -= 1 << (8 * len(b))
+	}
+	return v
+}
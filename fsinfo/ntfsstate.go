@@ -0,0 +1,220 @@
+package fsinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// NTFSState is how Windows last left an NTFS volume.
+type NTFSState struct {
+	// Dirty is the $Volume dirty flag: the volume was not cleanly
+	// unmounted, or Windows still has it in use.
+	Dirty bool
+	// Hibernated means hiberfil.sys holds a hibernation image, written by
+	// hibernation or by Fast Startup. Windows will resume with this
+	// volume's metadata cached in memory and overwrite whatever changed.
+	Hibernated bool
+}
+
+// maxIndexBytes bounds how much of the root directory index is scanned for
+// hiberfil.sys; real root directories need a few blocks.
+const maxIndexBytes = 16 << 20
+
+// ReadNTFSState reads the dirty flag and hibernation state of the NTFS
+// volume at byte offset off of r. It returns ErrUnknown if there is no NTFS
+// volume there.
+func ReadNTFSState(r io.ReaderAt, off int64) (NTFSState, error) {
+	var st NTFSState
+	bs := make([]byte, 512)
+	if _, err := r.ReadAt(bs, off); err != nil {
+		return st, err
+	}
+	if !bytes.Equal(bs[3:11], []byte("NTFS    ")) {
+		return st, ErrUnknown
+	}
+	g, err := ntfsGeometry(bs)
+	if err != nil {
+		return st, err
+	}
+	v := &ntfsVolume{r: r, off: off, g: g}
+	// $MFT itself may be fragmented; its record 0 maps it
+	mft, err := v.record(0)
+	if err != nil {
+		return st, err
+	}
+	if v.mftRuns, err = dataRuns(mft); err != nil {
+		return st, err
+	}
+
+	// $Volume is record 3
+	rec, err := v.record(3)
+	if err != nil {
+		return st, err
+	}
+	if attr := findAttr(rec, 0x70); attr != nil {
+		val, err := residentValue(attr)
+		if err != nil {
+			return st, err
+		}
+		if len(val) >= 12 {
+			st.Dirty = binary.LittleEndian.Uint16(val[10:])&0x0001 != 0
+		}
+	}
+
+	n, err := v.lookupRoot("hiberfil.sys")
+	if err != nil || n < 0 {
+		return st, err
+	}
+	if rec, err = v.record(n); err != nil {
+		return st, err
+	}
+	attr := findAttr(rec, 0x80)
+	if attr == nil || attr[8] != 1 {
+		// a resident or missing stream is too small to hold an image
+		return st, nil
+	}
+	runs, err := attrRuns(attr)
+	if err != nil || len(runs) == 0 {
+		return st, err
+	}
+	magic := make([]byte, 4)
+	if _, err := r.ReadAt(magic, off+runs[0].lcn*g.cluster); err != nil {
+		return st, err
+	}
+	// Windows writes "hibr" (or "HIBR") and clears or replaces it with
+	// "wake" once it has resumed
+	st.Hibernated = strings.EqualFold(string(magic), "hibr")
+	return st, nil
+}
+
+type ntfsVolume struct {
+	r       io.ReaderAt
+	off     int64
+	g       ntfsGeom
+	mftRuns []run
+}
+
+// record reads MFT record n with its fixups applied.
+func (v *ntfsVolume) record(n int64) ([]byte, error) {
+	pos := n * v.g.recSize
+	at := v.off + v.g.mft + pos
+	if v.mftRuns != nil {
+		at = -1
+		for _, run := range v.mftRuns {
+			size := run.clusters * v.g.cluster
+			if pos < size {
+				at = v.off + run.lcn*v.g.cluster + pos
+				break
+			}
+			pos -= size
+		}
+		if at < 0 {
+			return nil, fmt.Errorf("fsinfo: ntfs: MFT record %d beyond the MFT", n)
+		}
+	}
+	rec := make([]byte, v.g.recSize)
+	if _, err := v.r.ReadAt(rec, at); err != nil {
+		return nil, err
+	}
+	if err := applyFixups(rec, v.g.bps, "FILE"); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// lookupRoot returns the MFT record number of the file called name in the
+// root directory, or -1. It scans every index entry rather than walking
+// the B+ tree, which is plenty for one directory.
+func (v *ntfsVolume) lookupRoot(name string) (int64, error) {
+	le := binary.LittleEndian
+	// the root directory is record 5
+	rec, err := v.record(5)
+	if err != nil {
+		return -1, err
+	}
+	attr := findAttr(rec, 0x90)
+	if attr == nil {
+		return -1, errors.New("fsinfo: ntfs: root directory has no index")
+	}
+	val, err := residentValue(attr)
+	if err != nil {
+		return -1, err
+	}
+	if len(val) < 32 {
+		return -1, errors.New("fsinfo: ntfs: truncated index root")
+	}
+	blockSize := int64(le.Uint32(val[8:]))
+	if n := findIndexEntry(val[16:], name); n >= 0 {
+		return n, nil
+	}
+
+	attr = findAttr(rec, 0xA0)
+	if attr == nil || attr[8] != 1 {
+		return -1, nil
+	}
+	if blockSize < 512 || blockSize > 64<<10 {
+		return -1, fmt.Errorf("fsinfo: ntfs: index block size %d", blockSize)
+	}
+	runs, err := attrRuns(attr)
+	if err != nil {
+		return -1, err
+	}
+	scanned := int64(0)
+	block := make([]byte, blockSize)
+	for _, run := range runs {
+		for b := int64(0); b+blockSize <= run.clusters*v.g.cluster; b += blockSize {
+			if scanned += blockSize; scanned > maxIndexBytes {
+				return -1, errors.New("fsinfo: ntfs: root directory index too large")
+			}
+			if _, err := v.r.ReadAt(block, v.off+run.lcn*v.g.cluster+b); err != nil {
+				return -1, err
+			}
+			if applyFixups(block, v.g.bps, "INDX") != nil {
+				// unused blocks of the allocation hold anything
+				continue
+			}
+			if n := findIndexEntry(block[24:], name); n >= 0 {
+				return n, nil
+			}
+		}
+	}
+	return -1, nil
+}
+
+// findIndexEntry looks through the entries following the index header h
+// for a $FILE_NAME key equal to name, ignoring case as NTFS does for Win32
+// names.
+func findIndexEntry(h []byte, name string) int64 {
+	le := binary.LittleEndian
+	if len(h) < 16 {
+		return -1
+	}
+	start, end := int(le.Uint32(h)), int(le.Uint32(h[4:]))
+	end = min(end, len(h))
+	for pos := start; pos+16 <= end; {
+		e := h[pos:]
+		length, keyLen, flags := int(le.Uint16(e[8:])), int(le.Uint16(e[10:])), le.Uint16(e[12:])
+		if flags&0x02 != 0 || length < 16 || pos+length > end {
+			break
+		}
+		if key := e[16:min(16+keyLen, length)]; len(key) >= 66 {
+			n := int(key[64])
+			if 66+2*n <= len(key) {
+				u := make([]uint16, n)
+				for i := range u {
+					u[i] = le.Uint16(key[66+2*i:])
+				}
+				if strings.EqualFold(string(utf16.Decode(u)), name) {
+					return int64(le.Uint64(e) & (1<<48 - 1))
+				}
+			}
+		}
+		pos += length
+	}
+	return -1
+}
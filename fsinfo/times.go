@@ -0,0 +1,66 @@
+package fsinfo
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNoTimes is returned by ReadTimes for a filesystem whose superblock
+// keeps no record of its use, such as XFS, btrfs, FAT or NTFS.
+var ErrNoTimes = errors.New("fsinfo: the filesystem keeps no activity record in its superblock")
+
+// Times is what a filesystem's superblock records of its use, for triage
+// without mounting it. Zero times were never set.
+type Times struct {
+	Type       string // ext2, ext3, ext4
+	Created    time.Time
+	LastMount  time.Time
+	LastWrite  time.Time // the superblock's, updated on every mount, unmount and sync
+	LastCheck  time.Time // last fsck
+	MountCount int       // mounts since the last fsck
+	// LastMountedOn is the directory the filesystem was last mounted on,
+	// as the kernel or tune2fs left it; often empty.
+	LastMountedOn string
+}
+
+// ReadTimes reads the activity record of the filesystem at byte offset off
+// of r. Only the ext family keeps one; other filesystems found there give
+// ErrNoTimes and anything else ErrUnknown.
+func ReadTimes(r io.ReaderAt, off int64) (Times, error) {
+	sb := make([]byte, 1024)
+	if _, err := r.ReadAt(sb, off+1024); err != nil && err != io.EOF {
+		return Times{}, err
+	}
+	if binary.LittleEndian.Uint16(sb[56:]) != 0xEF53 {
+		if _, err := Read(r, off); err == nil {
+			return Times{}, ErrNoTimes
+		}
+		return Times{}, ErrUnknown
+	}
+	u, err := ext(sb)
+	if err != nil {
+		return Times{}, err
+	}
+	le := binary.LittleEndian
+	// each time is 32 bits plus a high byte that ext4 keeps at 0x274
+	// onwards; older filesystems leave those bytes zero
+	stamp := func(lo int, hi int) time.Time {
+		s := int64(le.Uint32(sb[lo:])) | int64(sb[hi])<<32
+		if s == 0 {
+			return time.Time{}
+		}
+		return time.Unix(s, 0).UTC()
+	}
+	return Times{
+		Type:          u.Type,
+		LastMount:     stamp(0x2c, 0x275),
+		LastWrite:     stamp(0x30, 0x274),
+		MountCount:    int(le.Uint16(sb[0x34:])),
+		LastCheck:     stamp(0x40, 0x277),
+		LastMountedOn: strings.TrimRight(string(sb[0x88:0xc8]), "\x00"),
+		Created:       stamp(0x108, 0x276),
+	}, nil
+}
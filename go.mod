@@ -0,0 +1,3 @@
+module github.com/cpuuntery/go-code-and-bin
+
+go 1.25
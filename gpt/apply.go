@@ -0,0 +1,151 @@
+package gpt
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Device is anything a GPT can be written to: a file, a block device, or an
+// in-memory or remote implementation provided by the caller.
+type Device interface {
+	io.ReaderAt
+	io.WriterAt
+	Sync() error
+}
+
+// ApplyTo writes t to dev as both the primary and the backup copy. t may be
+// either copy; the other one is derived from it. CRCs are recomputed and
+// stored back into t.
+//
+// The backup array and header are written and synced first, then the
+// primary ones, so an interruption leaves at least one consistent copy.
+func (t *Table) ApplyTo(dev Device) error {
+	t.UpdateCRCs()
+	if err := t.checkWritable(); err != nil {
+		return err
+	}
+	primary, backup := t, t.Alternate()
+	if !t.Header.IsPrimary() {
+		primary, backup = backup, t
+	}
+	if err := writeCopy(dev, backup, "backup"); err != nil {
+		return fmt.Errorf("gpt: write backup: %w", err)
+	}
+	if err := dev.Sync(); err != nil {
+		return fmt.Errorf("gpt: sync after backup: %w", err)
+	}
+	if err := writeCopy(dev, primary, "primary"); err != nil {
+		return fmt.Errorf("gpt: write primary: %w", err)
+	}
+	if err := dev.Sync(); err != nil {
+		return fmt.Errorf("gpt: sync after primary: %w", err)
+	}
+	return nil
+}
+
+// WriteCopy writes t as the one copy its header says it is, primary or
+// backup, and syncs, leaving the other copy alone: the repair of a single
+// damaged copy from t.Alternate() of the good one. CRCs are recomputed and
+// stored back into t.
+func (t *Table) WriteCopy(dev Device) error {
+	t.UpdateCRCs()
+	if err := t.checkWritable(); err != nil {
+		return err
+	}
+	which := "backup"
+	if t.Header.IsPrimary() {
+		which = "primary"
+	}
+	if err := writeCopy(dev, t, which); err != nil {
+		return fmt.Errorf("gpt: write %s: %w", which, err)
+	}
+	if err := dev.Sync(); err != nil {
+		return fmt.Errorf("gpt: sync after %s: %w", which, err)
+	}
+	return nil
+}
+
+// writeCopy writes the entry array, then the header sector of one copy.
+// Header.Extra and Header.Tail carry any vendor bytes past the defined
+// fields over from the copy that was read.
+func writeCopy(dev Device, t *Table, which string) error {
+	ss := t.sectorSize()
+	if err := writeRegion(dev, which+" entry array", t.EntryArray(), int64(t.Header.PartitionTableLBA)*int64(ss), ss); err != nil {
+		return err
+	}
+	hdr, err := t.Header.Sector(ss)
+	if err != nil {
+		return err
+	}
+	return writeRegion(dev, which+" header", hdr, int64(t.Header.CurrentLBA)*int64(ss), ss)
+}
+
+// CheckWritable reports why ApplyTo or WriteCopy would refuse to write t,
+// checking a copy of it with its CRCs recomputed.
+func (t *Table) CheckWritable() error {
+	c := t.Clone()
+	c.UpdateCRCs()
+	return c.checkWritable()
+}
+
+// checkWritable refuses tables that would leave an unusable disk behind:
+// broken headers, arrays overlapping the usable area and entries that are
+// out of range, overlap each other or overlap a reserved region.
+func (t *Table) checkWritable() error {
+	if err := t.Header.Validate(); err != nil {
+		return err
+	}
+	h := t.Header
+	if h.CurrentLBA == h.BackupLBA {
+		return fmt.Errorf("gpt: header and backup both at LBA %d", h.CurrentLBA)
+	}
+	if int(h.NumPartitions) < len(t.Entries) {
+		return fmt.Errorf("%w: %d entries but header says %d", ErrNumEntries, len(t.Entries), h.NumPartitions)
+	}
+	ss := t.sectorSize()
+	if int(h.HeaderSize)+len(h.Tail) > ss {
+		return fmt.Errorf("%w: %d and %d trailing bytes exceed sector size %d", ErrHeaderSize, h.HeaderSize, len(h.Tail), ss)
+	}
+	for i, e := range t.Entries {
+		if EntrySize+len(e.Extra) > int(h.PartitionEntrySize) {
+			return fmt.Errorf("%w: entry %d carries %d extra bytes, entries are %d bytes", ErrEntrySize, i, len(e.Extra), h.PartitionEntrySize)
+		}
+	}
+	lo, hi := h.CurrentLBA, h.BackupLBA
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	if h.FirstUsableLBA < lo+1+h.TableSectors(ss) || h.LastUsableLBA+h.TableSectors(ss) >= hi {
+		return fmt.Errorf("%w: %d-%d collides with the GPT structures", ErrUsableRange, h.FirstUsableLBA, h.LastUsableLBA)
+	}
+	return checkEntries(t)
+}
+
+// checkEntries reports the first entry that is outside the usable range or
+// overlaps another one or one of t.Reserved.
+func checkEntries(t *Table) error {
+	h := t.Header
+	ss := t.sectorSize()
+	used := t.Used()
+	for _, i := range used {
+		e := t.Entries[i]
+		if e.EndingLBA < e.StartingLBA {
+			return fmt.Errorf("gpt: entry %d ends (%d) before it starts (%d)", i, e.EndingLBA, e.StartingLBA)
+		}
+		if e.StartingLBA < h.FirstUsableLBA || e.EndingLBA > h.LastUsableLBA {
+			return fmt.Errorf("gpt: entry %d (%d-%d) outside usable range %d-%d", i, e.StartingLBA, e.EndingLBA, h.FirstUsableLBA, h.LastUsableLBA)
+		}
+		if r, ok := reservedIn(t.Reserved, e.StartingLBA, e.EndingLBA, ss); ok {
+			return fmt.Errorf("gpt: entry %d (%d-%d) overlaps reserved region %s", i, e.StartingLBA, e.EndingLBA, r)
+		}
+	}
+	sort.Slice(used, func(a, b int) bool { return t.Entries[used[a]].StartingLBA < t.Entries[used[b]].StartingLBA })
+	for k := 1; k < len(used); k++ {
+		prev, cur := t.Entries[used[k-1]], t.Entries[used[k]]
+		if cur.StartingLBA <= prev.EndingLBA {
+			return fmt.Errorf("gpt: entries %d and %d overlap", used[k-1], used[k])
+		}
+	}
+	return nil
+}
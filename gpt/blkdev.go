@@ -0,0 +1,53 @@
+package gpt
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrNotSupported is returned by the block device queries and operations
+// below when the platform or the device cannot perform them.
+var ErrNotSupported = errors.New("gpt: not supported for this device or platform")
+
+// The block device queries and operations are implemented per platform in
+// blkdev_<goos>.go with the native ioctls; blkdev_other.go is the portable
+// fallback. They apply to block devices (and Windows physical drives) only;
+// for image files use the size of the file and a sector size of 512.
+
+// BlockSizes returns the logical and physical sector sizes of the block
+// device f.
+func BlockSizes(f *os.File) (logical, physical int, err error) {
+	return blockSizes(f)
+}
+
+// DeviceSize returns the size of the block device or file f in bytes,
+// asking the device where seeking to the end does not tell.
+func DeviceSize(f *os.File) (int64, error) {
+	if n, err := deviceSize(f); err == nil && n > 0 {
+		return n, nil
+	}
+	return f.Seek(0, io.SeekEnd)
+}
+
+// RereadPartitions asks the kernel to read the partition table of f again
+// after it was written. It fails while partitions of f are in use.
+func RereadPartitions(f *os.File) error {
+	return rereadPartitions(f)
+}
+
+// Discard tells the device that length bytes from off no longer hold data
+// (TRIM/UNMAP). The range reads back as zeros on most devices, but callers
+// must not rely on that.
+func Discard(f *os.File, off, length int64) error {
+	if off < 0 || length < 0 {
+		return errors.New("gpt: negative discard range")
+	}
+	return discard(f, off, length)
+}
+
+// isDevice reports whether f is a device rather than a regular file.
+func isDevice(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeDevice != 0
+}
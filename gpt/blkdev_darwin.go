@@ -0,0 +1,57 @@
+package gpt
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	dkiocGetBlockSize         = 0x40046418 // _IOR('d', 24, uint32_t)
+	dkiocGetBlockCount        = 0x40086419 // _IOR('d', 25, uint64_t)
+	dkiocGetPhysicalBlockSize = 0x4004644d // _IOR('d', 77, uint32_t)
+)
+
+func ioctl(f *os.File, req, arg uintptr) error {
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, arg); e != 0 {
+		if e == syscall.ENOTTY || e == syscall.EINVAL {
+			return ErrNotSupported
+		}
+		return e
+	}
+	return nil
+}
+
+func blockSizes(f *os.File) (int, int, error) {
+	var logical, physical uint32
+	if err := ioctl(f, dkiocGetBlockSize, uintptr(unsafe.Pointer(&logical))); err != nil {
+		return 0, 0, err
+	}
+	if err := ioctl(f, dkiocGetPhysicalBlockSize, uintptr(unsafe.Pointer(&physical))); err != nil {
+		physical = logical
+	}
+	return int(logical), int(physical), nil
+}
+
+// deviceSize is needed here: seeking to the end of a raw disk yields 0.
+func deviceSize(f *os.File) (int64, error) {
+	var count uint64
+	logical, _, err := blockSizes(f)
+	if err != nil {
+		return 0, err
+	}
+	if err := ioctl(f, dkiocGetBlockCount, uintptr(unsafe.Pointer(&count))); err != nil {
+		return 0, err
+	}
+	return int64(count) * int64(logical), nil
+}
+
+// rereadPartitions has nothing to do: the kernel notices the new table when
+// the disk is closed, or diskutil is asked to.
+func rereadPartitions(f *os.File) error {
+	return nil
+}
+
+func discard(f *os.File, off, length int64) error {
+	return ErrNotSupported
+}
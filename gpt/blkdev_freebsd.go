@@ -0,0 +1,57 @@
+package gpt
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	diocGSectorSize = 0x40046480 // _IOR('d', 128, u_int)
+	diocGMediaSize  = 0x40086481 // _IOR('d', 129, off_t)
+	diocGDelete     = 0x80106488 // _IOW('d', 136, off_t[2])
+	diocGStripeSize = 0x4008648b // _IOR('d', 139, off_t)
+)
+
+func ioctl(f *os.File, req, arg uintptr) error {
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, arg); e != 0 {
+		if e == syscall.ENOTTY || e == syscall.EINVAL || e == syscall.EOPNOTSUPP {
+			return ErrNotSupported
+		}
+		return e
+	}
+	return nil
+}
+
+func blockSizes(f *os.File) (int, int, error) {
+	var logical uint32
+	var stripe int64
+	if err := ioctl(f, diocGSectorSize, uintptr(unsafe.Pointer(&logical))); err != nil {
+		return 0, 0, err
+	}
+	// GEOM reports 4Kn-emulating drives through the stripe size
+	physical := int(logical)
+	if ioctl(f, diocGStripeSize, uintptr(unsafe.Pointer(&stripe))) == nil && stripe > int64(logical) {
+		physical = int(stripe)
+	}
+	return int(logical), physical, nil
+}
+
+func deviceSize(f *os.File) (int64, error) {
+	var n int64
+	if err := ioctl(f, diocGMediaSize, uintptr(unsafe.Pointer(&n))); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// rereadPartitions has nothing to do: GEOM tastes the disk again when the
+// writer closes it.
+func rereadPartitions(f *os.File) error {
+	return nil
+}
+
+func discard(f *os.File, off, length int64) error {
+	r := [2]int64{off, length}
+	return ioctl(f, diocGDelete, uintptr(unsafe.Pointer(&r)))
+}
@@ -0,0 +1,54 @@
+package gpt
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	blkRRPart  = 0x125f
+	blkSSZGet  = 0x1268
+	blkDiscard = 0x1277
+	blkPBSZGet = 0x127b
+	blkGetSize = 0x80001272 | uintptr(unsafe.Sizeof(uintptr(0)))<<16 // _IOR(0x12, 114, size_t)
+)
+
+func ioctl(f *os.File, req, arg uintptr) error {
+	if _, _, e := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), req, arg); e != 0 {
+		if e == syscall.ENOTTY || e == syscall.EINVAL || e == syscall.EOPNOTSUPP {
+			return ErrNotSupported
+		}
+		return e
+	}
+	return nil
+}
+
+func blockSizes(f *os.File) (int, int, error) {
+	var logical int32
+	var physical uint32
+	if err := ioctl(f, blkSSZGet, uintptr(unsafe.Pointer(&logical))); err != nil {
+		return 0, 0, err
+	}
+	if err := ioctl(f, blkPBSZGet, uintptr(unsafe.Pointer(&physical))); err != nil {
+		physical = uint32(logical)
+	}
+	return int(logical), int(physical), nil
+}
+
+func deviceSize(f *os.File) (int64, error) {
+	var n uint64
+	if err := ioctl(f, blkGetSize, uintptr(unsafe.Pointer(&n))); err != nil {
+		return 0, err
+	}
+	return int64(n), nil
+}
+
+func rereadPartitions(f *os.File) error {
+	return ioctl(f, blkRRPart, 0)
+}
+
+func discard(f *os.File, off, length int64) error {
+	r := [2]uint64{uint64(off), uint64(length)}
+	return ioctl(f, blkDiscard, uintptr(unsafe.Pointer(&r)))
+}
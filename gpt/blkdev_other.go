@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package gpt
+
+import "os"
+
+func blockSizes(f *os.File) (int, int, error) { return 0, 0, ErrNotSupported }
+
+func deviceSize(f *os.File) (int64, error) { return 0, ErrNotSupported }
+
+func rereadPartitions(f *os.File) error { return ErrNotSupported }
+
+func discard(f *os.File, off, length int64) error { return ErrNotSupported }
@@ -0,0 +1,59 @@
+package gpt
+
+import (
+	"encoding/binary"
+	"os"
+	"syscall"
+)
+
+const (
+	ioctlDiskGetDriveGeometryEx = 0x000700a0
+	ioctlDiskUpdateProperties   = 0x00070140
+
+	errorInvalidFunction = syscall.Errno(1)
+	errorNotSupported    = syscall.Errno(50)
+)
+
+func deviceIoControl(f *os.File, code uint32, out []byte) error {
+	var n uint32
+	var p *byte
+	if len(out) > 0 {
+		p = &out[0]
+	}
+	err := syscall.DeviceIoControl(syscall.Handle(f.Fd()), code, nil, 0, p, uint32(len(out)), &n, nil)
+	if err == errorInvalidFunction || err == errorNotSupported {
+		return ErrNotSupported
+	}
+	return err
+}
+
+// geometry returns the bytes per sector and disk size from a
+// DISK_GEOMETRY_EX: a 24-byte DISK_GEOMETRY ending in BytesPerSector,
+// then DiskSize.
+func geometry(f *os.File) (int, int64, error) {
+	b := make([]byte, 64)
+	if err := deviceIoControl(f, ioctlDiskGetDriveGeometryEx, b); err != nil {
+		return 0, 0, err
+	}
+	return int(binary.LittleEndian.Uint32(b[20:])), int64(binary.LittleEndian.Uint64(b[24:])), nil
+}
+
+func blockSizes(f *os.File) (int, int, error) {
+	ss, _, err := geometry(f)
+	return ss, ss, err
+}
+
+// deviceSize is needed here: seeking to the end of \\.\PhysicalDriveN
+// does not give the size of the disk.
+func deviceSize(f *os.File) (int64, error) {
+	_, n, err := geometry(f)
+	return n, err
+}
+
+func rereadPartitions(f *os.File) error {
+	return deviceIoControl(f, ioctlDiskUpdateProperties, nil)
+}
+
+func discard(f *os.File, off, length int64) error {
+	return ErrNotSupported
+}
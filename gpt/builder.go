@@ -0,0 +1,396 @@
+package gpt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Partition declares one partition for a Builder.
+type Partition struct {
+	Type       GUID
+	Name       string
+	Attributes uint64
+	// Start is the byte offset of the partition, rounded up to a whole
+	// sector and used as is. 0 places it after the previous partition at
+	// the next aligned sector, clear of reserved regions.
+	Start int64
+	// Size in bytes, rounded up to whole sectors. 0 means "the rest of the
+	// disk" and is only allowed for the last partition.
+	Size int64
+	// UniqueGUID is generated when zero.
+	UniqueGUID GUID
+	// Number is the 1-based entry the partition goes into, for layouts
+	// whose numbering differs from their on-disk order. 0 takes the lowest
+	// entry not claimed by another partition.
+	Number int
+	// Content, if set, is copied to the start of the partition. It must not
+	// be larger than the partition.
+	Content io.Reader
+}
+
+// Builder lays out a fresh disk image: protective MBR, primary and backup
+// GPT and the declared partitions in order, each aligned to Alignment.
+type Builder struct {
+	DiskSize   int64
+	SectorSize int
+	// Alignment of partition starts in sectors; 0 means 1 MiB worth.
+	Alignment uint64
+	// NumEntries in the entry array; 0 means DefaultNumEntries.
+	NumEntries uint32
+	// FirstUsableLBA pushes the start of the usable area out, e.g. to keep
+	// a firmware/bootloader region at fixed raw offsets partition-free. 0
+	// means right after the primary entry array.
+	FirstUsableLBA uint64
+	// DiskGUID is generated when zero.
+	DiskGUID GUID
+	// Reserved regions are skipped when placing partitions.
+	Reserved   []Reserved
+	Partitions []Partition
+}
+
+// NewBuilder returns a Builder for a disk of size bytes with 512-byte sectors.
+func NewBuilder(size int64) *Builder {
+	return &Builder{DiskSize: size, SectorSize: DefaultSectorSize}
+}
+
+// Add appends a partition and returns b for chaining.
+func (b *Builder) Add(p Partition) *Builder {
+	b.Partitions = append(b.Partitions, p)
+	return b
+}
+
+func (b *Builder) sectorSize() int {
+	if b.SectorSize <= 0 {
+		return DefaultSectorSize
+	}
+	return b.SectorSize
+}
+
+// Layout computes the primary table without writing anything. Missing GUIDs
+// are generated and stored back into b so repeated calls agree.
+func (b *Builder) Layout() (*Table, error) {
+	ss := b.sectorSize()
+	if ss < 512 || ss&(ss-1) != 0 {
+		return nil, fmt.Errorf("gpt: invalid sector size %d", ss)
+	}
+	total := uint64(b.DiskSize / int64(ss))
+	num := b.NumEntries
+	if num == 0 {
+		num = DefaultNumEntries
+	}
+	if len(b.Partitions) > int(num) {
+		return nil, fmt.Errorf("gpt: %d partitions do not fit in %d entries", len(b.Partitions), num)
+	}
+	align := b.Alignment
+	if align == 0 {
+		align = uint64((1 << 20) / ss)
+	}
+	tableSectors := (uint64(num)*EntrySize + uint64(ss) - 1) / uint64(ss)
+	if total < 3+2*tableSectors {
+		return nil, fmt.Errorf("gpt: disk of %d bytes is too small", b.DiskSize)
+	}
+	if b.DiskGUID.IsZero() {
+		g, err := NewGUID()
+		if err != nil {
+			return nil, err
+		}
+		b.DiskGUID = g
+	}
+
+	firstUsable := 2 + tableSectors
+	if b.FirstUsableLBA > firstUsable {
+		firstUsable = b.FirstUsableLBA
+	}
+	if firstUsable > total-2-tableSectors {
+		return nil, fmt.Errorf("gpt: first usable LBA %d beyond the end of the disk", firstUsable)
+	}
+
+	t := &Table{SectorSize: ss}
+	t.Header = Header{
+		Revision:           Revision10,
+		HeaderSize:         MinHeaderSize,
+		CurrentLBA:         1,
+		BackupLBA:          total - 1,
+		FirstUsableLBA:     firstUsable,
+		LastUsableLBA:      total - 2 - tableSectors,
+		DiskGUID:           b.DiskGUID,
+		PartitionTableLBA:  2,
+		NumPartitions:      num,
+		PartitionEntrySize: EntrySize,
+	}
+	copy(t.Header.Signature[:], HeaderSignature)
+	t.Entries = make([]Entry, num)
+	if err := checkReserved(t, b.Reserved); err != nil {
+		return nil, err
+	}
+
+	slots, err := b.slots(num)
+	if err != nil {
+		return nil, err
+	}
+	next := t.Header.FirstUsableLBA
+	for i := range b.Partitions {
+		p := &b.Partitions[i]
+		if p.Type.IsZero() {
+			return nil, fmt.Errorf("gpt: partition %d has no type GUID", i)
+		}
+		var start, end uint64
+		if p.Start > 0 {
+			start = uint64((p.Start + int64(ss) - 1) / int64(ss))
+			if start < t.Header.FirstUsableLBA {
+				return nil, fmt.Errorf("gpt: partition %d (%q) starts before the first usable LBA %d", i, p.Name, t.Header.FirstUsableLBA)
+			}
+		} else {
+			start = (next + align - 1) / align * align
+		}
+		for {
+			switch {
+			case p.Size < 0:
+				return nil, fmt.Errorf("gpt: partition %d has negative size", i)
+			case p.Size == 0:
+				if i != len(b.Partitions)-1 {
+					return nil, fmt.Errorf("gpt: only the last partition may fill the disk")
+				}
+				end = t.Header.LastUsableLBA
+			default:
+				end = start + (uint64(p.Size)+uint64(ss)-1)/uint64(ss) - 1
+			}
+			// move past any reserved region in the way and try again; a
+			// partition filling the disk ends up after all of them
+			r, ok := reservedIn(b.Reserved, start, end, ss)
+			if !ok {
+				break
+			}
+			if p.Start > 0 {
+				return nil, fmt.Errorf("gpt: partition %d (%q) overlaps reserved region %s", i, p.Name, r)
+			}
+			_, last := r.Sectors(ss)
+			start = (last + 1 + align - 1) / align * align
+		}
+		if start > t.Header.LastUsableLBA || end > t.Header.LastUsableLBA || end < start {
+			return nil, fmt.Errorf("gpt: partition %d (%q) does not fit on the disk", i, p.Name)
+		}
+		if p.UniqueGUID.IsZero() {
+			g, err := NewGUID()
+			if err != nil {
+				return nil, err
+			}
+			p.UniqueGUID = g
+		}
+		name, truncated := EncodeName(p.Name)
+		if truncated {
+			return nil, fmt.Errorf("gpt: partition %d name %q longer than 36 UTF-16 units", i, p.Name)
+		}
+		t.Entries[slots[i]] = Entry{
+			PartitionTypeGUID: p.Type,
+			UniqueGUID:        p.UniqueGUID,
+			StartingLBA:       start,
+			EndingLBA:         end,
+			Attributes:        p.Attributes,
+			PartitionName:     name,
+		}
+		next = max(next, end+1)
+	}
+	if err := checkEntries(t); err != nil {
+		return nil, err
+	}
+	t.UpdateCRCs()
+	return t, nil
+}
+
+// slots returns the entry index of each partition.
+func (b *Builder) slots(num uint32) ([]int, error) {
+	slots := make([]int, len(b.Partitions))
+	taken := make([]bool, num)
+	for i, p := range b.Partitions {
+		if p.Number == 0 {
+			continue
+		}
+		if p.Number < 0 || p.Number > int(num) {
+			return nil, fmt.Errorf("gpt: partition %d number %d outside 1-%d", i, p.Number, num)
+		}
+		if taken[p.Number-1] {
+			return nil, fmt.Errorf("gpt: partition number %d used twice", p.Number)
+		}
+		taken[p.Number-1] = true
+		slots[i] = p.Number - 1
+	}
+	free := 0
+	for i, p := range b.Partitions {
+		if p.Number != 0 {
+			continue
+		}
+		for taken[free] {
+			free++
+		}
+		taken[free] = true
+		slots[i] = free
+	}
+	return slots, nil
+}
+
+// reservedIn returns the first of reserved overlapping start-end.
+func reservedIn(reserved []Reserved, start, end uint64, ss int) (Reserved, bool) {
+	for _, r := range reserved {
+		if r.Overlaps(start, end, ss) {
+			return r, true
+		}
+	}
+	return Reserved{}, false
+}
+
+// region is one piece of the image written by WriteTo.
+type region struct {
+	off  int64
+	data []byte
+	r    io.Reader
+	max  int64
+}
+
+// WriteTo writes the complete image to w in a single sequential pass and
+// returns DiskSize on success. When w is an io.Seeker (files, devices) the
+// gaps between structures and payloads are skipped instead of zero-filled,
+// so they keep their previous content; otherwise zeros are written.
+func (b *Builder) WriteTo(w io.Writer) (int64, error) {
+	primary, err := b.Layout()
+	if err != nil {
+		return 0, err
+	}
+	backup := primary.Alternate()
+	ss := int64(primary.sectorSize())
+
+	ph, err := primary.Header.Sector(int(ss))
+	if err != nil {
+		return 0, err
+	}
+	bh, err := backup.Header.Sector(int(ss))
+	if err != nil {
+		return 0, err
+	}
+	total := uint64(b.DiskSize / ss)
+	regions := []region{
+		{off: 0, data: ProtectiveMBR(total, int(ss))},
+		{off: ss, data: ph},
+		{off: int64(primary.Header.PartitionTableLBA) * ss, data: primary.EntryArray()},
+		{off: int64(backup.Header.PartitionTableLBA) * ss, data: backup.EntryArray()},
+		{off: int64(backup.Header.CurrentLBA) * ss, data: bh},
+	}
+	slots, err := b.slots(primary.Header.NumPartitions)
+	if err != nil {
+		return 0, err
+	}
+	for i, p := range b.Partitions {
+		if p.Content != nil {
+			e := primary.Entries[slots[i]]
+			regions = append(regions, region{off: int64(e.StartingLBA) * ss, r: p.Content, max: int64(e.SizeBytes(int(ss)))})
+		}
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].off < regions[j].off })
+
+	seeker, canSeek := w.(io.Seeker)
+	var pos int64
+	skip := func(to int64) error {
+		if to == pos {
+			return nil
+		}
+		if canSeek {
+			if _, err := seeker.Seek(to-pos, io.SeekCurrent); err != nil {
+				return err
+			}
+		} else if _, err := io.CopyN(w, zeroReader{}, to-pos); err != nil {
+			return err
+		}
+		pos = to
+		return nil
+	}
+	for i, r := range regions {
+		if err := skip(r.off); err != nil {
+			return pos, err
+		}
+		if r.data != nil {
+			n, err := w.Write(r.data)
+			pos += int64(n)
+			if err != nil {
+				return pos, err
+			}
+			continue
+		}
+		n, err := io.Copy(w, io.LimitReader(r.r, r.max))
+		pos += n
+		if err != nil {
+			return pos, fmt.Errorf("gpt: write content of partition %d: %w", i, err)
+		}
+		if n == r.max {
+			// anything left over means the payload is larger than the partition
+			var one [1]byte
+			if m, _ := r.r.Read(one[:]); m > 0 {
+				return pos, errors.New("gpt: partition content larger than the partition")
+			}
+		}
+	}
+	if err := skip(int64(total) * ss); err != nil {
+		return pos, err
+	}
+	return pos, nil
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// ApplyTo writes the layout to dev through the same labelled writes as
+// Table.ApplyTo, so hooks (audit, dry runs) see every region: partition
+// contents first, then the backup GPT, the primary GPT and finally the
+// protective MBR. It returns the table that was written.
+func (b *Builder) ApplyTo(dev Device) (*Table, error) {
+	t, err := b.Layout()
+	if err != nil {
+		return nil, err
+	}
+	ss := t.sectorSize()
+	slots, err := b.slots(t.Header.NumPartitions)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 1<<20)
+	for i, p := range b.Partitions {
+		if p.Content == nil {
+			continue
+		}
+		e := t.Entries[slots[i]]
+		off := int64(e.StartingLBA) * int64(ss)
+		limit := int64(e.SizeBytes(ss))
+		var done int64
+		for {
+			n, rerr := io.ReadFull(p.Content, buf)
+			if n > 0 {
+				if done+int64(n) > limit {
+					return nil, fmt.Errorf("gpt: content of partition %d larger than the partition", i)
+				}
+				if err := writeRegion(dev, fmt.Sprintf("partition %d content", i), buf[:n], off+done, ss); err != nil {
+					return nil, err
+				}
+				done += int64(n)
+			}
+			if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+				break
+			}
+			if rerr != nil {
+				return nil, fmt.Errorf("gpt: read content of partition %d: %w", i, rerr)
+			}
+		}
+	}
+	if err := t.ApplyTo(dev); err != nil {
+		return nil, err
+	}
+	mbr := ProtectiveMBR(uint64(b.DiskSize/int64(ss)), ss)
+	if err := writeRegion(dev, "protective MBR", mbr, 0, ss); err != nil {
+		return nil, err
+	}
+	return t, dev.Sync()
+}
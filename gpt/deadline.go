@@ -0,0 +1,83 @@
+package gpt
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTimeout is returned by a DeadlineDevice when an operation does not
+// complete in time.
+var ErrTimeout = errors.New("gpt: device I/O timed out")
+
+// DeadlineDevice wraps a Device and fails any read, write or sync that takes
+// longer than Timeout, so a device that hangs (a dying USB bridge, a stuck
+// iSCSI session) produces an error instead of a process stuck in the
+// kernel. Block devices ignore O_NONBLOCK, so each operation runs on its own
+// goroutine under a watchdog; one that times out is abandoned and the
+// device is marked dead: every later operation fails with ErrTimeout
+// straight away rather than queueing behind the stuck one.
+type DeadlineDevice struct {
+	Device
+	Timeout time.Duration
+	dead    atomic.Bool
+}
+
+// WithDeadline wraps dev with a DeadlineDevice; d <= 0 returns dev as is.
+func WithDeadline(dev Device, d time.Duration) Device {
+	if d <= 0 {
+		return dev
+	}
+	return &DeadlineDevice{Device: dev, Timeout: d}
+}
+
+// run calls op under the watchdog. op must not touch caller memory after
+// a timeout, hence the private buffers in ReadAt and WriteAt.
+func (d *DeadlineDevice) run(what string, off int64, op func() (int, error)) (int, error) {
+	if d.dead.Load() {
+		return 0, fmt.Errorf("%w: device stopped responding earlier", ErrTimeout)
+	}
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := op()
+		done <- result{n, err}
+	}()
+	t := time.NewTimer(d.Timeout)
+	defer t.Stop()
+	select {
+	case r := <-done:
+		return r.n, r.err
+	case <-t.C:
+		d.dead.Store(true)
+		if off < 0 {
+			return 0, fmt.Errorf("%w: %s after %v", ErrTimeout, what, d.Timeout)
+		}
+		return 0, fmt.Errorf("%w: %s at byte %d after %v", ErrTimeout, what, off, d.Timeout)
+	}
+}
+
+// ReadAt reads into a private buffer and copies it to p only on success,
+// so an abandoned read cannot scribble over p later.
+func (d *DeadlineDevice) ReadAt(p []byte, off int64) (int, error) {
+	buf := make([]byte, len(p))
+	n, err := d.run("read", off, func() (int, error) { return d.Device.ReadAt(buf, off) })
+	copy(p[:n], buf)
+	return n, err
+}
+
+// WriteAt writes a private copy of p.
+func (d *DeadlineDevice) WriteAt(p []byte, off int64) (int, error) {
+	buf := append([]byte(nil), p...)
+	return d.run("write", off, func() (int, error) { return d.Device.WriteAt(buf, off) })
+}
+
+// Sync flushes the device under the same deadline.
+func (d *DeadlineDevice) Sync() error {
+	_, err := d.run("sync", -1, func() (int, error) { return 0, d.Device.Sync() })
+	return err
+}
@@ -0,0 +1,159 @@
+package gpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Entry is a GPT partition entry: the 128 bytes defined by the spec plus,
+// in Extra, whatever a larger PartitionEntrySize declares beyond them.
+type Entry struct {
+	PartitionTypeGUID GUID
+	UniqueGUID        GUID
+	StartingLBA       uint64
+	EndingLBA         uint64
+	Attributes        uint64
+	PartitionName     [72]byte // UTF-16LE
+	// Extra holds bytes 128 up to the entry size of the array the entry
+	// came from, less trailing zeros; nil when they are all zero. The spec
+	// allows entries of 128 × 2^n bytes; the bytes past 128 are
+	// vendor-defined and are written back unchanged.
+	Extra []byte
+}
+
+// Attribute bits defined by the UEFI specification.
+const (
+	// AttrPlatformRequired marks partitions the platform needs to function;
+	// tools must not delete or modify them.
+	AttrPlatformRequired uint64 = 1 << 0
+	// AttrEFIIgnore tells the firmware not to produce a block I/O protocol
+	// for the partition, so it never looks at its content.
+	AttrEFIIgnore uint64 = 1 << 1
+	// AttrLegacyBIOSBootable is what legacy BIOS bootloaders (and U-Boot's
+	// distro boot) scan for.
+	AttrLegacyBIOSBootable uint64 = 1 << 2
+)
+
+// MarshalBinary encodes the entry into 128 bytes, without Extra.
+func (e *Entry) MarshalBinary() ([]byte, error) {
+	b := make([]byte, EntrySize)
+	e.put(b)
+	return b, nil
+}
+
+func (e *Entry) put(b []byte) {
+	le := binary.LittleEndian
+	copy(b[0:16], e.PartitionTypeGUID[:])
+	copy(b[16:32], e.UniqueGUID[:])
+	le.PutUint64(b[32:40], e.StartingLBA)
+	le.PutUint64(b[40:48], e.EndingLBA)
+	le.PutUint64(b[48:56], e.Attributes)
+	copy(b[56:128], e.PartitionName[:])
+}
+
+// unmarshalSized decodes an entry of size bytes from b, keeping the bytes
+// past 128 in Extra.
+func (e *Entry) unmarshalSized(b []byte, size int) error {
+	if err := e.UnmarshalBinary(b); err != nil {
+		return err
+	}
+	e.Extra = nil
+	if size > EntrySize && len(b) >= size {
+		if tail := bytes.TrimRight(b[EntrySize:size], "\x00"); len(tail) > 0 {
+			e.Extra = append([]byte(nil), tail...)
+		}
+	}
+	return nil
+}
+
+// UnmarshalBinary decodes the entry from the first 128 bytes of b. Extra
+// is left alone.
+func (e *Entry) UnmarshalBinary(b []byte) error {
+	if len(b) < EntrySize {
+		return fmt.Errorf("%w: entry needs %d bytes, got %d", ErrShortBuffer, EntrySize, len(b))
+	}
+	le := binary.LittleEndian
+	copy(e.PartitionTypeGUID[:], b[0:16])
+	copy(e.UniqueGUID[:], b[16:32])
+	e.StartingLBA = le.Uint64(b[32:40])
+	e.EndingLBA = le.Uint64(b[40:48])
+	e.Attributes = le.Uint64(b[48:56])
+	copy(e.PartitionName[:], b[56:128])
+	return nil
+}
+
+// Equal reports whether e and o have the same fields and Extra bytes.
+func (e Entry) Equal(o Entry) bool {
+	return e.PartitionTypeGUID == o.PartitionTypeGUID && e.UniqueGUID == o.UniqueGUID &&
+		e.StartingLBA == o.StartingLBA && e.EndingLBA == o.EndingLBA &&
+		e.Attributes == o.Attributes && e.PartitionName == o.PartitionName &&
+		bytes.Equal(e.Extra, o.Extra)
+}
+
+// IsEmpty reports whether the entry is unused (zero type GUID).
+func (e Entry) IsEmpty() bool {
+	return e.PartitionTypeGUID.IsZero()
+}
+
+// FirmwareVisible reports whether UEFI firmware will expose the partition,
+// i.e. AttrEFIIgnore is clear.
+func (e Entry) FirmwareVisible() bool {
+	return e.Attributes&AttrEFIIgnore == 0
+}
+
+// Name decodes the UTF-16LE partition name up to the first NUL.
+func (e Entry) Name() string {
+	return DecodeName(e.PartitionName)
+}
+
+// Type returns the friendly name of the partition type GUID, or "" when the
+// GUID is not in the known types table.
+func (e Entry) Type() string {
+	return TypeName(e.PartitionTypeGUID)
+}
+
+// Sectors returns the number of sectors covered by the entry (inclusive range).
+func (e Entry) Sectors() uint64 {
+	if e.IsEmpty() || e.EndingLBA < e.StartingLBA {
+		return 0
+	}
+	return e.EndingLBA - e.StartingLBA + 1
+}
+
+// SizeBytes returns the partition size for the given logical sector size.
+func (e Entry) SizeBytes(sectorSize int) uint64 {
+	return e.Sectors() * uint64(sectorSize)
+}
+
+// DecodeName converts a UTF-16LE name field to a string, stopping at NUL.
+func DecodeName(b [72]byte) string {
+	u16 := make([]uint16, 0, 36)
+	for i := 0; i < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i : i+2])
+		if u == 0 {
+			break
+		}
+		u16 = append(u16, u)
+	}
+	return string(utf16.Decode(u16))
+}
+
+// EncodeName converts s to a NUL-padded UTF-16LE name field. It reports
+// whether s had to be truncated to fit the 36 code units available.
+func EncodeName(s string) (b [72]byte, truncated bool) {
+	u16 := utf16.Encode([]rune(s))
+	if len(u16) > 36 {
+		u16 = u16[:36]
+		// don't leave half a surrogate pair behind
+		if utf16.IsSurrogate(rune(u16[35])) && u16[35] < 0xdc00 {
+			u16 = u16[:35]
+		}
+		truncated = true
+	}
+	for i, u := range u16 {
+		binary.LittleEndian.PutUint16(b[i*2:], u)
+	}
+	return b, truncated
+}
@@ -0,0 +1,17 @@
+//go:build linux && (amd64 || arm64 || riscv64 || ppc64le || s390x || loong64)
+
+package gpt
+
+import (
+	"os"
+	"syscall"
+)
+
+const fadvDontNeed = 4 // POSIX_FADV_DONTNEED
+
+// dropCache asks the kernel to forget the cached pages of f, so the next
+// reads come from the device. Only clean pages are dropped.
+func dropCache(f *os.File) {
+	// offset 0, length 0: the whole file
+	syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), 0, 0, fadvDontNeed, 0, 0)
+}
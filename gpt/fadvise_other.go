@@ -0,0 +1,8 @@
+//go:build !linux || !(amd64 || arm64 || riscv64 || ppc64le || s390x || loong64)
+
+package gpt
+
+import "os"
+
+// dropCache is a no-op where there is no way to drop cached pages.
+func dropCache(f *os.File) {}
@@ -0,0 +1,108 @@
+package gpt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// Encoding says how the bytes of a header or entry field are read.
+type Encoding string
+
+const (
+	EncodingASCII   Encoding = "ascii"
+	EncodingUint32  Encoding = "uint32le"
+	EncodingUint64  Encoding = "uint64le"
+	EncodingGUID    Encoding = "guid"    // first three groups little-endian, see GUID
+	EncodingUTF16LE Encoding = "utf16le" // NUL-padded
+	EncodingBytes   Encoding = "bytes"
+)
+
+// Field is where the UEFI specification puts one field of the GPT header
+// or of a partition entry.
+type Field struct {
+	Entry    bool   // a partition entry field rather than a header one
+	Name     string // as in the UEFI specification, e.g. "MyLBA"
+	GoName   string // the field of Header or Entry holding it, e.g. "CurrentLBA"
+	Offset   int    // from the start of the header or entry
+	Size     int
+	Encoding Encoding
+}
+
+var fieldLayout = []Field{
+	{false, "Signature", "Signature", 0, 8, EncodingASCII},
+	{false, "Revision", "Revision", 8, 4, EncodingUint32},
+	{false, "HeaderSize", "HeaderSize", 12, 4, EncodingUint32},
+	{false, "HeaderCRC32", "HeaderCRC32", 16, 4, EncodingUint32},
+	{false, "Reserved", "Reserved", 20, 4, EncodingBytes},
+	{false, "MyLBA", "CurrentLBA", 24, 8, EncodingUint64},
+	{false, "AlternateLBA", "BackupLBA", 32, 8, EncodingUint64},
+	{false, "FirstUsableLBA", "FirstUsableLBA", 40, 8, EncodingUint64},
+	{false, "LastUsableLBA", "LastUsableLBA", 48, 8, EncodingUint64},
+	{false, "DiskGUID", "DiskGUID", 56, 16, EncodingGUID},
+	{false, "PartitionEntryLBA", "PartitionTableLBA", 72, 8, EncodingUint64},
+	{false, "NumberOfPartitionEntries", "NumPartitions", 80, 4, EncodingUint32},
+	{false, "SizeOfPartitionEntry", "PartitionEntrySize", 84, 4, EncodingUint32},
+	{false, "PartitionEntryArrayCRC32", "PartitionTableCRC", 88, 4, EncodingUint32},
+	{true, "PartitionTypeGUID", "PartitionTypeGUID", 0, 16, EncodingGUID},
+	{true, "UniquePartitionGUID", "UniqueGUID", 16, 16, EncodingGUID},
+	{true, "StartingLBA", "StartingLBA", 32, 8, EncodingUint64},
+	{true, "EndingLBA", "EndingLBA", 40, 8, EncodingUint64},
+	{true, "Attributes", "Attributes", 48, 8, EncodingUint64},
+	{true, "PartitionName", "PartitionName", 56, 72, EncodingUTF16LE},
+}
+
+// FieldLayout returns the fields of the GPT header, then those of a
+// partition entry, each in on-disk order. The slice is the caller's.
+func FieldLayout() []Field {
+	return append([]Field(nil), fieldLayout...)
+}
+
+// LookupField finds a header or entry field by its specification or Go
+// name, ignoring case.
+func LookupField(name string) (Field, bool) {
+	for _, f := range fieldLayout {
+		if strings.EqualFold(name, f.Name) || strings.EqualFold(name, f.GoName) {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Bytes returns the bytes of f in b, the encoded header or entry.
+func (f Field) Bytes(b []byte) ([]byte, error) {
+	if len(b) < f.Offset+f.Size {
+		return nil, fmt.Errorf("%w: %s needs %d bytes, have %d", ErrShortBuffer, f.Name, f.Offset+f.Size, len(b))
+	}
+	return b[f.Offset : f.Offset+f.Size], nil
+}
+
+// Format decodes f from b, the encoded header or entry, and returns its
+// value as gptctl and all_gpt_info print it.
+func (f Field) Format(b []byte) (string, error) {
+	v, err := f.Bytes(b)
+	if err != nil {
+		return "", err
+	}
+	switch f.Encoding {
+	case EncodingASCII:
+		return fmt.Sprintf("%q", v), nil
+	case EncodingUint32:
+		n := binary.LittleEndian.Uint32(v)
+		if strings.HasSuffix(f.Name, "CRC32") || f.Name == "Revision" {
+			return fmt.Sprintf("0x%08x", n), nil
+		}
+		return fmt.Sprint(n), nil
+	case EncodingUint64:
+		n := binary.LittleEndian.Uint64(v)
+		if f.Name == "Attributes" {
+			return fmt.Sprintf("0x%016x", n), nil
+		}
+		return fmt.Sprint(n), nil
+	case EncodingGUID:
+		return GUID(v).String(), nil
+	case EncodingUTF16LE:
+		return fmt.Sprintf("%q", DecodeName([72]byte(v))), nil
+	}
+	return fmt.Sprintf("%x", v), nil
+}
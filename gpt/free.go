@@ -0,0 +1,86 @@
+package gpt
+
+import "sort"
+
+// Extent is a run of sectors, both ends inclusive.
+type Extent struct {
+	First, Last uint64
+}
+
+// Sectors returns the length of the extent.
+func (x Extent) Sectors() uint64 { return x.Last - x.First + 1 }
+
+// Free returns the extents of the usable area that neither a partition nor
+// a reserved region covers, in disk order.
+func (t *Table) Free() []Extent {
+	var taken []Extent
+	for _, i := range t.Used() {
+		taken = append(taken, Extent{t.Entries[i].StartingLBA, t.Entries[i].EndingLBA})
+	}
+	for _, r := range t.Reserved {
+		if r.Size > 0 {
+			first, last := r.Sectors(t.sectorSize())
+			taken = append(taken, Extent{first, last})
+		}
+	}
+	sort.Slice(taken, func(a, b int) bool { return taken[a].First < taken[b].First })
+	var out []Extent
+	next := t.Header.FirstUsableLBA
+	for _, x := range taken {
+		if x.First > next && next <= t.Header.LastUsableLBA {
+			out = append(out, Extent{next, min(x.First-1, t.Header.LastUsableLBA)})
+		}
+		next = max(next, x.Last+1)
+	}
+	if next <= t.Header.LastUsableLBA {
+		out = append(out, Extent{next, t.Header.LastUsableLBA})
+	}
+	return out
+}
+
+// FindFree returns the first start LBA, aligned to align sectors, of a free
+// run of n sectors.
+func (t *Table) FindFree(n, align uint64) (uint64, bool) {
+	if align == 0 {
+		align = 1
+	}
+	for _, x := range t.Free() {
+		start := (x.First + align - 1) / align * align
+		if start >= x.First && start <= x.Last && x.Last-start+1 >= n {
+			return start, true
+		}
+	}
+	return 0, false
+}
+
+// FreeSlot returns the index of the first unused entry, or -1.
+func (t *Table) FreeSlot() int {
+	for i := range t.Entries {
+		if t.Entries[i].IsEmpty() {
+			return i
+		}
+	}
+	return -1
+}
+
+// LargestGap returns the biggest free run of sectors whose start is aligned
+// to align sectors, i.e. the largest partition that could be created, and
+// false if no aligned sector is free. Of equally large runs it returns the
+// first.
+func (t *Table) LargestGap(align uint64) (Extent, bool) {
+	if align == 0 {
+		align = 1
+	}
+	var best Extent
+	found := false
+	for _, x := range t.Free() {
+		start := (x.First + align - 1) / align * align
+		if start < x.First || start > x.Last {
+			continue
+		}
+		if g := (Extent{start, x.Last}); !found || g.Sectors() > best.Sectors() {
+			best, found = g, true
+		}
+	}
+	return best, found
+}
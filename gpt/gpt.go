@@ -0,0 +1,69 @@
+// Package gpt reads, validates and writes GUID Partition Tables.
+//
+// It holds the logic the command line tools in this repository used to
+// duplicate: the on-disk header and entry layouts, CRC32 calculation, GUID
+// byte order, UTF-16LE partition names and the table of known type GUIDs.
+// Functions return errors instead of terminating the process so the package
+// can be embedded in other programs.
+package gpt
+
+import (
+	"errors"
+	"hash/crc32"
+)
+
+const (
+	// DefaultSectorSize is the logical block size assumed when none is given.
+	DefaultSectorSize = 512
+	// HeaderSignature is the magic at the start of every GPT header.
+	HeaderSignature = "EFI PART"
+	// Revision10 is the only header revision defined by UEFI so far.
+	Revision10 = 0x00010000
+	// MinHeaderSize is the size of the fields defined by the spec.
+	MinHeaderSize = 92
+	// MaxHeaderSize bounds HeaderSize: a header fits in its sector, and no
+	// disk has logical sectors over 8 KiB.
+	MaxHeaderSize = 8192
+	// EntrySize is the size of the fields defined by the spec for an entry.
+	EntrySize = 128
+	// DefaultNumEntries is the entry count virtually every tool writes.
+	DefaultNumEntries = 128
+	// DefaultMaxTableBytes is the largest entry array Open reads unless
+	// told otherwise: far beyond any real table (16 KiB is usual), small
+	// enough that a hostile header cannot exhaust memory.
+	DefaultMaxTableBytes = 4 << 20
+	// crcChunk is how much of an entry array is held in memory at a time
+	// while it is read or checksummed.
+	crcChunk = 64 << 10
+)
+
+var (
+	ErrSignature   = errors.New("gpt: bad header signature")
+	ErrNoGPT       = errors.New("gpt: no GPT header")
+	ErrHeaderSize  = errors.New("gpt: invalid header size")
+	ErrHeaderCRC   = errors.New("gpt: header CRC32 mismatch")
+	ErrEntrySize   = errors.New("gpt: invalid partition entry size")
+	ErrNumEntries  = errors.New("gpt: invalid number of partition entries")
+	ErrUsableRange = errors.New("gpt: invalid usable LBA range")
+	ErrArrayCRC    = errors.New("gpt: partition entry array CRC32 mismatch")
+	ErrShortBuffer = errors.New("gpt: buffer too short")
+	ErrTableSize   = errors.New("gpt: partition entry array larger than allowed")
+)
+
+// HeaderCRC returns the CRC32 of a raw header, computed over the given bytes
+// with the stored HeaderCRC32 field (offset 16–19) treated as zero.
+func HeaderCRC(raw []byte) uint32 {
+	b := make([]byte, len(raw))
+	copy(b, raw)
+	if len(b) >= 20 {
+		for i := 16; i < 20; i++ {
+			b[i] = 0
+		}
+	}
+	return crc32.ChecksumIEEE(b)
+}
+
+// ArrayCRC returns the CRC32 of a raw partition entry array.
+func ArrayCRC(raw []byte) uint32 {
+	return crc32.ChecksumIEEE(raw)
+}
@@ -0,0 +1,91 @@
+package gpt
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// GUID is a GUID exactly as stored on disk. GPT stores the first three
+// fields little-endian and the last two as plain bytes (mixed endianness).
+type GUID [16]byte
+
+// String returns the canonical xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx form.
+func (g GUID) String() string {
+	return fmt.Sprintf("%08x-%04x-%04x-%02x%02x-%02x%02x%02x%02x%02x%02x",
+		binary.LittleEndian.Uint32(g[0:4]),
+		binary.LittleEndian.Uint16(g[4:6]),
+		binary.LittleEndian.Uint16(g[6:8]),
+		g[8], g[9],
+		g[10], g[11], g[12], g[13], g[14], g[15],
+	)
+}
+
+// Hex returns the raw on-disk bytes as contiguous lowercase hex.
+func (g GUID) Hex() string {
+	return hex.EncodeToString(g[:])
+}
+
+// IsZero reports whether g is the all-zero (unused) GUID.
+func (g GUID) IsZero() bool {
+	return g == GUID{}
+}
+
+// MarshalText implements encoding.TextMarshaler using the canonical form.
+func (g GUID) MarshalText() ([]byte, error) {
+	return []byte(g.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (g *GUID) UnmarshalText(b []byte) error {
+	v, err := ParseGUID(string(b))
+	if err != nil {
+		return err
+	}
+	*g = v
+	return nil
+}
+
+// ParseGUID parses the canonical textual form (case-insensitive, optional
+// surrounding braces) into on-disk byte order.
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+	t := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(s), "{"), "}")
+	if len(t) != 36 || t[8] != '-' || t[13] != '-' || t[18] != '-' || t[23] != '-' {
+		return g, fmt.Errorf("gpt: invalid GUID %q", s)
+	}
+	raw, err := hex.DecodeString(t[0:8] + t[9:13] + t[14:18] + t[19:23] + t[24:36])
+	if err != nil {
+		return g, fmt.Errorf("gpt: invalid GUID %q: %v", s, err)
+	}
+	copy(g[:], raw)
+	// first three fields are little-endian on disk
+	g[0], g[1], g[2], g[3] = g[3], g[2], g[1], g[0]
+	g[4], g[5] = g[5], g[4]
+	g[6], g[7] = g[7], g[6]
+	return g, nil
+}
+
+// MustParseGUID is like ParseGUID but panics on malformed input. It is meant
+// for package-level tables of well-known GUIDs.
+func MustParseGUID(s string) GUID {
+	g, err := ParseGUID(s)
+	if err != nil {
+		panic(err)
+	}
+	return g
+}
+
+// NewGUID returns a random (version 4) GUID.
+func NewGUID() (GUID, error) {
+	var g GUID
+	if _, err := rand.Read(g[:]); err != nil {
+		return g, err
+	}
+	// version lives in the high nibble of the (little-endian) third field
+	g[7] = (g[7] & 0x0f) | 0x40
+	g[8] = (g[8] & 0x3f) | 0x80
+	return g, nil
+}
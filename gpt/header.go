@@ -0,0 +1,195 @@
+package gpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Header models a GPT header: the 92 bytes defined by the spec plus, in
+// Extra, whatever a larger HeaderSize declares beyond them and, in Tail,
+// the rest of its sector.
+type Header struct {
+	Signature          [8]byte // "EFI PART"
+	Revision           uint32
+	HeaderSize         uint32
+	HeaderCRC32        uint32
+	Reserved           uint32
+	CurrentLBA         uint64
+	BackupLBA          uint64
+	FirstUsableLBA     uint64
+	LastUsableLBA      uint64
+	DiskGUID           GUID
+	PartitionTableLBA  uint64
+	NumPartitions      uint32
+	PartitionEntrySize uint32
+	PartitionTableCRC  uint32
+	// Extra holds bytes 92 up to HeaderSize, e.g. fields of a later
+	// revision or vendor data. They are covered by the header CRC and
+	// written back unchanged.
+	Extra []byte
+	// Tail holds the bytes from HeaderSize to the end of the sector the
+	// header was read from, trailing zeros trimmed. The spec wants them
+	// zero, but vendors stamp data there; it is outside the CRC and
+	// written back unchanged unless Normalize drops it.
+	Tail []byte
+}
+
+// MarshalBinary encodes the header into HeaderSize bytes (at least 92); bytes
+// past the defined fields come from Extra and are zero beyond it. A
+// HeaderSize over MaxHeaderSize is refused rather than allocated.
+func (h *Header) MarshalBinary() ([]byte, error) {
+	if h.HeaderSize > MaxHeaderSize {
+		return nil, fmt.Errorf("%w: %d exceeds %d", ErrHeaderSize, h.HeaderSize, MaxHeaderSize)
+	}
+	size := int(h.HeaderSize)
+	if size < MinHeaderSize {
+		size = MinHeaderSize
+	}
+	b := make([]byte, size)
+	le := binary.LittleEndian
+	copy(b[0:8], h.Signature[:])
+	le.PutUint32(b[8:12], h.Revision)
+	le.PutUint32(b[12:16], h.HeaderSize)
+	le.PutUint32(b[16:20], h.HeaderCRC32)
+	le.PutUint32(b[20:24], h.Reserved)
+	le.PutUint64(b[24:32], h.CurrentLBA)
+	le.PutUint64(b[32:40], h.BackupLBA)
+	le.PutUint64(b[40:48], h.FirstUsableLBA)
+	le.PutUint64(b[48:56], h.LastUsableLBA)
+	copy(b[56:72], h.DiskGUID[:])
+	le.PutUint64(b[72:80], h.PartitionTableLBA)
+	le.PutUint32(b[80:84], h.NumPartitions)
+	le.PutUint32(b[84:88], h.PartitionEntrySize)
+	le.PutUint32(b[88:92], h.PartitionTableCRC)
+	copy(b[MinHeaderSize:], h.Extra)
+	return b, nil
+}
+
+// UnmarshalBinary decodes the defined fields from the first 92 bytes of b,
+// Extra when b holds all of HeaderSize, and Tail from whatever b holds
+// after that.
+func (h *Header) UnmarshalBinary(b []byte) error {
+	if len(b) < MinHeaderSize {
+		return fmt.Errorf("%w: header needs %d bytes, got %d", ErrShortBuffer, MinHeaderSize, len(b))
+	}
+	le := binary.LittleEndian
+	copy(h.Signature[:], b[0:8])
+	h.Revision = le.Uint32(b[8:12])
+	h.HeaderSize = le.Uint32(b[12:16])
+	h.HeaderCRC32 = le.Uint32(b[16:20])
+	h.Reserved = le.Uint32(b[20:24])
+	h.CurrentLBA = le.Uint64(b[24:32])
+	h.BackupLBA = le.Uint64(b[32:40])
+	h.FirstUsableLBA = le.Uint64(b[40:48])
+	h.LastUsableLBA = le.Uint64(b[48:56])
+	copy(h.DiskGUID[:], b[56:72])
+	h.PartitionTableLBA = le.Uint64(b[72:80])
+	h.NumPartitions = le.Uint32(b[80:84])
+	h.PartitionEntrySize = le.Uint32(b[84:88])
+	h.PartitionTableCRC = le.Uint32(b[88:92])
+	h.Extra, h.Tail = nil, nil
+	n := max(int(h.HeaderSize), MinHeaderSize)
+	if n > len(b) {
+		return nil
+	}
+	if n > MinHeaderSize {
+		h.Extra = append([]byte(nil), b[MinHeaderSize:n]...)
+	}
+	if tail := bytes.TrimRight(b[n:], "\x00"); len(tail) > 0 {
+		h.Tail = append([]byte(nil), tail...)
+	}
+	return nil
+}
+
+// Sector encodes the header as the whole sectorSize-byte sector it is
+// written as: MarshalBinary followed by Tail and zeros.
+func (h *Header) Sector(sectorSize int) ([]byte, error) {
+	b, err := h.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if len(b)+len(h.Tail) > sectorSize {
+		return nil, fmt.Errorf("%w: %d bytes and %d trailing bytes exceed sector size %d", ErrHeaderSize, len(b), len(h.Tail), sectorSize)
+	}
+	s := make([]byte, sectorSize)
+	copy(s[copy(s, b):], h.Tail)
+	return s, nil
+}
+
+// Normalize makes h a header as the spec lays it out: Reserved zero,
+// HeaderSize 92 and nothing but zeros after it, dropping Extra and Tail.
+// The CRC needs updating afterwards.
+func (h *Header) Normalize() {
+	h.Reserved = 0
+	h.HeaderSize = MinHeaderSize
+	h.Extra, h.Tail = nil, nil
+}
+
+// ComputeCRC returns the header CRC32 over HeaderSize bytes as it would be
+// written by MarshalBinary; that of no bytes for a HeaderSize it refuses.
+func (h *Header) ComputeCRC() uint32 {
+	b, _ := h.MarshalBinary()
+	return HeaderCRC(b)
+}
+
+// UpdateCRC stores ComputeCRC in HeaderCRC32.
+func (h *Header) UpdateCRC() {
+	h.HeaderCRC32 = h.ComputeCRC()
+}
+
+// TableBytes is the size in bytes of the partition entry array described by h.
+func (h *Header) TableBytes() int64 {
+	return int64(h.NumPartitions) * int64(h.PartitionEntrySize)
+}
+
+// TableSectors is the number of sectors the partition entry array occupies.
+func (h *Header) TableSectors(sectorSize int) uint64 {
+	ss := int64(sectorSize)
+	return uint64((h.TableBytes() + ss - 1) / ss)
+}
+
+// KnownRevision reports whether h has a revision this package was written
+// for. Later revisions are expected to stay compatible, so the table is
+// still used; callers may want to warn.
+func (h *Header) KnownRevision() bool {
+	return h.Revision == Revision10
+}
+
+// IsPrimary reports whether h describes itself as the primary header.
+func (h *Header) IsPrimary() bool {
+	return h.CurrentLBA < h.BackupLBA
+}
+
+// Validate checks the header for internal consistency: signature, sizes,
+// CRC32 and the usable LBA range. It does not look at the entry array.
+func (h *Header) Validate() error {
+	if string(h.Signature[:]) != HeaderSignature {
+		return fmt.Errorf("%w: %q", ErrSignature, h.Signature[:])
+	}
+	if h.HeaderSize < MinHeaderSize || h.HeaderSize > MaxHeaderSize {
+		return fmt.Errorf("%w: %d", ErrHeaderSize, h.HeaderSize)
+	}
+	if crc := h.ComputeCRC(); crc != h.HeaderCRC32 {
+		return fmt.Errorf("%w: stored 0x%08x, calculated 0x%08x", ErrHeaderCRC, h.HeaderCRC32, crc)
+	}
+	if !validEntrySize(h.PartitionEntrySize) {
+		return fmt.Errorf("%w: %d", ErrEntrySize, h.PartitionEntrySize)
+	}
+	if h.NumPartitions == 0 {
+		return fmt.Errorf("%w: %d", ErrNumEntries, h.NumPartitions)
+	}
+	if h.FirstUsableLBA > h.LastUsableLBA {
+		return fmt.Errorf("%w: first %d > last %d", ErrUsableRange, h.FirstUsableLBA, h.LastUsableLBA)
+	}
+	return nil
+}
+
+// validEntrySize reports whether n is 128 × 2^k as required by the spec.
+func validEntrySize(n uint32) bool {
+	if n < EntrySize || n%EntrySize != 0 {
+		return false
+	}
+	m := n / EntrySize
+	return m&(m-1) == 0
+}
@@ -0,0 +1,109 @@
+package gpt
+
+import (
+	"crypto/sha256"
+	"errors"
+)
+
+// ErrSkipWrite can be returned by Hooks.BeforeWrite to suppress a write
+// without failing the operation, which is how dry runs are implemented.
+var ErrSkipWrite = errors.New("gpt: write skipped by hook")
+
+// WriteEvent describes a single write performed by the library.
+type WriteEvent struct {
+	// Purpose says what is written, e.g. "primary header" or "backup entry array".
+	Purpose string
+	Offset  int64
+	LBA     uint64
+	Sectors uint64
+	// OldSum and NewSum are SHA-256 digests of the region before and after
+	// the write. OldSum is zero if the old content could not be read.
+	OldSum [32]byte
+	NewSum [32]byte
+	// Data is the content being written. Hooks must not modify it.
+	Data []byte
+	// Skipped is set when BeforeWrite returned ErrSkipWrite.
+	Skipped bool
+}
+
+// Hooks are callbacks invoked around every write made through a device
+// returned by WithHooks. Either may be nil.
+type Hooks struct {
+	// BeforeWrite runs before the data hits the device. Returning an error
+	// aborts the operation; ErrSkipWrite skips just this write.
+	BeforeWrite func(*WriteEvent) error
+	// AfterWrite runs once the write has been attempted, with its result.
+	AfterWrite func(*WriteEvent, error)
+}
+
+// HookedDevice wraps a Device and reports every write to Hooks.
+type HookedDevice struct {
+	Device
+	Hooks      Hooks
+	SectorSize int
+}
+
+// WithHooks wraps dev so that writes made through it, including those made
+// by Table.ApplyTo, are reported to h.
+func WithHooks(dev Device, h Hooks) *HookedDevice {
+	return &HookedDevice{Device: dev, Hooks: h, SectorSize: DefaultSectorSize}
+}
+
+// WriteAt implements io.WriterAt for writes not made by the library itself.
+func (d *HookedDevice) WriteAt(p []byte, off int64) (int, error) {
+	return d.writePurpose("write", p, off, d.SectorSize)
+}
+
+func (d *HookedDevice) writePurpose(purpose string, p []byte, off int64, sectorSize int) (int, error) {
+	if sectorSize <= 0 {
+		sectorSize = DefaultSectorSize
+	}
+	ss := int64(sectorSize)
+	ev := &WriteEvent{
+		Purpose: purpose,
+		Offset:  off,
+		LBA:     uint64(off / ss),
+		Sectors: uint64((off%ss + int64(len(p)) + ss - 1) / ss),
+		NewSum:  sha256.Sum256(p),
+		Data:    p,
+	}
+	old := make([]byte, len(p))
+	if n, err := d.Device.ReadAt(old, off); err == nil && n == len(p) {
+		ev.OldSum = sha256.Sum256(old)
+	}
+	if d.Hooks.BeforeWrite != nil {
+		if err := d.Hooks.BeforeWrite(ev); err != nil {
+			if !errors.Is(err, ErrSkipWrite) {
+				return 0, err
+			}
+			ev.Skipped = true
+			if d.Hooks.AfterWrite != nil {
+				d.Hooks.AfterWrite(ev, nil)
+			}
+			return len(p), nil
+		}
+	}
+	n, err := d.Device.WriteAt(p, off)
+	if d.Hooks.AfterWrite != nil {
+		d.Hooks.AfterWrite(ev, err)
+	}
+	return n, err
+}
+
+// purposeWriter is implemented by devices that want to know why a write
+// happens (see HookedDevice).
+type purposeWriter interface {
+	writePurpose(purpose string, p []byte, off int64, sectorSize int) (int, error)
+}
+
+// writeRegion is how the library writes: it labels the write for devices
+// that care and falls back to plain WriteAt otherwise.
+func writeRegion(dev Device, purpose string, p []byte, off int64, sectorSize int) error {
+	var err error
+	if pw, ok := dev.(purposeWriter); ok {
+		_, err = pw.writePurpose(purpose, p, off, sectorSize)
+	} else {
+		_, err = dev.WriteAt(p, off)
+	}
+	return err
+}
@@ -0,0 +1,240 @@
+package gpt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+)
+
+const (
+	// MBRSignature is the boot signature at offset 510 of LBA 0.
+	MBRSignature = 0xAA55
+	// ProtectiveMBRType is the partition type of the protective MBR entry.
+	ProtectiveMBRType = 0xEE
+	// BootCodeSize is the size of the boot code area at the start of LBA
+	// 0, ahead of the disk signature and the partition records.
+	BootCodeSize = 440
+)
+
+// ProtectiveMBR returns LBA 0 (sectorSize bytes) holding a protective MBR
+// for a disk of totalSectors sectors: one 0xEE entry from LBA 1 to the end,
+// with the size capped at 0xFFFFFFFF for disks beyond 2 TiB.
+func ProtectiveMBR(totalSectors uint64, sectorSize int) []byte {
+	b := make([]byte, sectorSize)
+	e := b[446:462]
+	e[1], e[2], e[3] = 0x00, 0x02, 0x00 // CHS of LBA 1
+	e[4] = ProtectiveMBRType
+	e[5], e[6], e[7] = 0xff, 0xff, 0xff
+	binary.LittleEndian.PutUint32(e[8:12], 1)
+	binary.LittleEndian.PutUint32(e[12:16], ProtectiveSize(totalSectors))
+	binary.LittleEndian.PutUint16(b[510:512], MBRSignature)
+	return b
+}
+
+// ProtectiveSize is the size in sectors the 0xEE record of a protective
+// MBR gives for a disk of totalSectors sectors: everything after LBA 0, or
+// 0xFFFFFFFF when that does not fit in 32 bits (beyond 2 TiB with 512-byte
+// sectors, 16 TiB with 4096-byte ones).
+func ProtectiveSize(totalSectors uint64) uint32 {
+	if totalSectors == 0 || totalSectors-1 > 0xFFFFFFFF {
+		return 0xFFFFFFFF
+	}
+	return uint32(totalSectors - 1)
+}
+
+// BootCodeSum returns the SHA-256 of the boot code area of the MBR in b as
+// hex, or "" when the area is blank, as on disks that boot only by UEFI.
+func BootCodeSum(b []byte) string {
+	code := b[:min(len(b), BootCodeSize)]
+	if bytes.Count(code, []byte{0}) == len(code) {
+		return ""
+	}
+	sum := sha256.Sum256(code)
+	return hex.EncodeToString(sum[:])
+}
+
+// ProtectiveRecord returns the index (0-3) of the 0xEE partition record of
+// the MBR in b, or -1 if there is none or b carries no boot signature.
+func ProtectiveRecord(b []byte) int {
+	if len(b) < 512 || binary.LittleEndian.Uint16(b[510:]) != MBRSignature {
+		return -1
+	}
+	for i := 0; i < 4; i++ {
+		if b[446+16*i+4] == ProtectiveMBRType {
+			return i
+		}
+	}
+	return -1
+}
+
+// ResizeProtective sets the size of the 0xEE record in the MBR b to cover a
+// disk of totalSectors sectors and reports whether it changed anything.
+// Other records, as in a hybrid MBR, and the boot code are left alone.
+func ResizeProtective(b []byte, totalSectors uint64) bool {
+	i := ProtectiveRecord(b)
+	if i < 0 {
+		return false
+	}
+	e := b[446+16*i : 446+16*(i+1)]
+	size := ProtectiveSize(totalSectors)
+	if binary.LittleEndian.Uint32(e[12:]) == size {
+		return false
+	}
+	binary.LittleEndian.PutUint32(e[12:16], size)
+	return true
+}
+
+// MBRPartition is one primary partition record of a classic MBR.
+type MBRPartition struct {
+	Index    int // record 0-3
+	Bootable bool
+	Type     byte
+	Start    uint32 // LBA
+	Sectors  uint32
+}
+
+// TypeName returns the usual name of the partition's MBR type, or "".
+func (p MBRPartition) TypeName() string { return mbrTypes[p.Type] }
+
+var mbrTypes = map[byte]string{
+	0x01: "FAT12",
+	0x04: "FAT16 <32M",
+	0x05: "Extended",
+	0x06: "FAT16",
+	0x07: "HPFS/NTFS/exFAT",
+	0x0b: "W95 FAT32",
+	0x0c: "W95 FAT32 (LBA)",
+	0x0e: "W95 FAT16 (LBA)",
+	0x0f: "W95 Ext'd (LBA)",
+	0x11: "Hidden FAT12",
+	0x17: "Hidden HPFS/NTFS",
+	0x1b: "Hidden W95 FAT32",
+	0x1c: "Hidden W95 FAT32 (LBA)",
+	0x27: "Hidden NTFS WinRE",
+	0x42: "Windows dynamic disk",
+	0x82: "Linux swap",
+	0x83: "Linux",
+	0x85: "Linux extended",
+	0x8e: "Linux LVM",
+	0xa5: "FreeBSD",
+	0xa6: "OpenBSD",
+	0xa8: "Darwin UFS",
+	0xa9: "NetBSD",
+	0xab: "Darwin boot",
+	0xaf: "HFS / HFS+",
+	0xbe: "Solaris boot",
+	0xbf: "Solaris",
+	0xda: "Non-FS data",
+	0xee: "GPT",
+	0xef: "EFI (FAT-12/16/32)",
+	0xfb: "VMware VMFS",
+	0xfd: "Linux raid autodetect",
+}
+
+// ParseMBR returns the used partition records of a classic MBR in b. ok is
+// false unless b carries the boot signature and every record is sound: a
+// status byte of 0x00 or 0x80 and, if used, a non-empty extent after LBA 0
+// that overlaps no other. The boot sector of an unpartitioned FAT or NTFS
+// volume carries the signature too, but rarely passes.
+func ParseMBR(b []byte) (parts []MBRPartition, ok bool) {
+	if len(b) < 512 || binary.LittleEndian.Uint16(b[510:]) != MBRSignature {
+		return nil, false
+	}
+	for i := 0; i < 4; i++ {
+		r := b[446+16*i : 446+16*(i+1)]
+		if r[0] != 0x00 && r[0] != 0x80 {
+			return nil, false
+		}
+		if r[4] == 0 {
+			continue
+		}
+		p := MBRPartition{
+			Index:    i,
+			Bootable: r[0] == 0x80,
+			Type:     r[4],
+			Start:    binary.LittleEndian.Uint32(r[8:12]),
+			Sectors:  binary.LittleEndian.Uint32(r[12:16]),
+		}
+		if p.Start == 0 || p.Sectors == 0 {
+			return nil, false
+		}
+		for _, q := range parts {
+			if uint64(p.Start) < uint64(q.Start)+uint64(q.Sectors) && uint64(q.Start) < uint64(p.Start)+uint64(p.Sectors) {
+				return nil, false
+			}
+		}
+		parts = append(parts, p)
+	}
+	return parts, true
+}
+
+// Kinds of MBR found in LBA 0 of a GPT disk, as ClassifyMBR tells them
+// apart.
+const (
+	MBRMissing    = "missing"    // no boot signature
+	MBREmpty      = "empty"      // the boot signature, no partition records
+	MBRProtective = "protective" // the 0xEE record alone, as the spec has it
+	MBRHybrid     = "hybrid"     // the 0xEE record and others mirroring GPT partitions
+	MBRClassic    = "classic"    // partition records but no 0xEE one
+)
+
+// ClassifyMBR decodes the MBR in b and returns its kind with every used
+// partition record, the 0xEE one included. Unlike ParseMBR it does not
+// judge the records; a GPT disk's LBA 0 may hold anything.
+func ClassifyMBR(b []byte) (kind string, records []MBRPartition) {
+	if len(b) < 512 || binary.LittleEndian.Uint16(b[510:]) != MBRSignature {
+		return MBRMissing, nil
+	}
+	protective := false
+	for i := 0; i < 4; i++ {
+		r := b[446+16*i : 446+16*(i+1)]
+		if r[4] == 0 {
+			continue
+		}
+		records = append(records, MBRPartition{
+			Index:    i,
+			Bootable: r[0] == 0x80,
+			Type:     r[4],
+			Start:    binary.LittleEndian.Uint32(r[8:12]),
+			Sectors:  binary.LittleEndian.Uint32(r[12:16]),
+		})
+		protective = protective || r[4] == ProtectiveMBRType
+	}
+	switch {
+	case len(records) == 0:
+		return MBREmpty, nil
+	case protective && len(records) == 1:
+		return MBRProtective, records
+	case protective:
+		return MBRHybrid, records
+	}
+	return MBRClassic, records
+}
+
+// MBRDiskError is returned by Open for a disk that has no GPT but a classic
+// MBR partition table in LBA 0.
+type MBRDiskError struct {
+	Path       string
+	Partitions []MBRPartition
+}
+
+func (e *MBRDiskError) Error() string {
+	return fmt.Sprintf("gpt: %s is an MBR-partitioned disk with %d partitions and no GPT; sgdisk --mbrtogpt (or gdisk) converts it", e.Path, len(e.Partitions))
+}
+
+// mbrOnly returns an MBRDiskError if LBA 0 of r holds a classic MBR with
+// partitions and no protective record.
+func mbrOnly(r io.ReaderAt, offset int64, path string) error {
+	b := make([]byte, 512)
+	if _, err := r.ReadAt(b, offset); err != nil {
+		return nil
+	}
+	parts, ok := ParseMBR(b)
+	if !ok || len(parts) == 0 || ProtectiveRecord(b) >= 0 {
+		return nil
+	}
+	return &MBRDiskError{Path: path, Partitions: parts}
+}
@@ -0,0 +1,34 @@
+package gpt
+
+import (
+	"errors"
+	"io"
+)
+
+// MemDevice is a disk image held in memory, for tests, tools that build
+// an image before writing it out, and platforms without files such as
+// js/wasm. Its size is fixed: writes past the end fail.
+type MemDevice []byte
+
+func (m MemDevice) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("gpt: negative offset")
+	}
+	if off >= int64(len(m)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (m MemDevice) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > int64(len(m)) {
+		return 0, errors.New("gpt: write beyond the end of the image")
+	}
+	return copy(m[off:], p), nil
+}
+
+func (m MemDevice) Sync() error { return nil }
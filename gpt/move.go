@@ -0,0 +1,79 @@
+package gpt
+
+import (
+	"errors"
+	"fmt"
+)
+
+// moveChunk is how much partition data CopySectors holds at a time.
+const moveChunk = 4 << 20
+
+// MoveOrder returns the moves that actually relocate something, ordered so
+// that carrying each one out cannot overwrite data a later one still has
+// to read. Moves that displace each other in a cycle cannot be ordered
+// without scratch space and are refused.
+func MoveOrder(moves []Move) ([]Move, error) {
+	var pending []Move
+	for _, m := range moves {
+		if m.NewStart != m.OldStart && m.Sectors > 0 {
+			pending = append(pending, m)
+		}
+	}
+	var out []Move
+	for len(pending) > 0 {
+		ready := -1
+		for i, m := range pending {
+			blocked := false
+			for j, o := range pending {
+				if i != j && overlaps(m.NewStart, m.Sectors, o.OldStart, o.Sectors) {
+					blocked = true
+					break
+				}
+			}
+			if !blocked {
+				ready = i
+				break
+			}
+		}
+		if ready < 0 {
+			return nil, errors.New("gpt: partitions would have to swap places; keep their order to move them in place")
+		}
+		out = append(out, pending[ready])
+		pending = append(pending[:ready], pending[ready+1:]...)
+	}
+	return out, nil
+}
+
+func overlaps(a, n, b, m uint64) bool {
+	return a < b+m && b < a+n
+}
+
+// CopySectors copies n sectors from LBA src to LBA dst of dev a chunk at a
+// time. Overlapping ranges are handled by copying from the end when the
+// data moves up, so no sector is overwritten before it has been read.
+// Writes are labelled purpose for hooked devices.
+func CopySectors(dev Device, src, dst, n uint64, sectorSize int, purpose string) error {
+	if src == dst || n == 0 {
+		return nil
+	}
+	ss := uint64(sectorSize)
+	chunk := max(moveChunk/ss, 1)
+	buf := make([]byte, min(chunk, n)*ss)
+	for done := uint64(0); done < n; {
+		k := min(chunk, n-done)
+		// moving up, take the chunks from the end
+		off := done
+		if dst > src {
+			off = n - done - k
+		}
+		b := buf[:k*ss]
+		if _, err := dev.ReadAt(b, int64((src+off)*ss)); err != nil {
+			return fmt.Errorf("gpt: read LBA %d: %w", src+off, err)
+		}
+		if err := writeRegion(dev, purpose, b, int64((dst+off)*ss), sectorSize); err != nil {
+			return fmt.Errorf("gpt: write LBA %d: %w", dst+off, err)
+		}
+		done += k
+	}
+	return dev.Sync()
+}
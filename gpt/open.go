@@ -0,0 +1,386 @@
+package gpt
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+// Option tunes how Open locates and parses a GPT.
+type Option func(*options)
+
+type options struct {
+	sectorSize   int
+	offset       int64
+	preferBackup bool
+	strict       bool
+	readWrite    bool
+	maxTable     int64
+	ioTimeout    time.Duration
+}
+
+// WithSectorSize fixes the logical sector size instead of probing for the
+// header at 512 and 4096 bytes.
+func WithSectorSize(n int) Option {
+	return func(o *options) { o.sectorSize = n }
+}
+
+// WithOffset makes every LBA relative to byte offset n of the file, e.g. the
+// data offset of a RAID member or a disk image embedded in a larger file.
+func WithOffset(n int64) Option {
+	return func(o *options) { o.offset = n }
+}
+
+// PreferBackup selects the backup copy as Disk.Table when both copies are
+// valid (the primary is still used when only it is valid).
+func PreferBackup() Option {
+	return func(o *options) { o.preferBackup = true }
+}
+
+// Strict makes Open fail unless both copies validate and agree with each
+// other. By default a single valid copy is enough.
+func Strict() Option {
+	return func(o *options) { o.strict = true }
+}
+
+// WithMaxTableBytes caps the size of the entry array Open is willing to read
+// at n bytes (DefaultMaxTableBytes by default); n <= 0 removes the cap.
+// Copies declaring a larger array fail with ErrTableSize.
+func WithMaxTableBytes(n int64) Option {
+	return func(o *options) { o.maxTable = n }
+}
+
+// WithIOTimeout makes every read, write and sync of the Disk, including those
+// of Open itself, fail with ErrTimeout when it takes longer than d. See
+// DeadlineDevice.
+func WithIOTimeout(d time.Duration) Option {
+	return func(o *options) { o.ioTimeout = d }
+}
+
+// ReadWrite opens the file for writing too, so the Disk can be passed to
+// Table.ApplyTo.
+func ReadWrite() Option {
+	return func(o *options) { o.readWrite = true }
+}
+
+// Disk is an opened disk or image together with both copies of its GPT. It
+// implements Device, addressing the GPT disk (Offset is applied).
+type Disk struct {
+	f          *os.File
+	closer     io.Closer // the reader or device opened, if it has a Close
+	dev        Device    // f, wrapped with a deadline if requested
+	Path       string
+	Offset     int64
+	SectorSize int
+	// Size is the size in bytes of the GPT disk, i.e. excluding Offset.
+	Size int64
+
+	// Primary and Backup are nil when the copy could not be read at all;
+	// PrimaryErr and BackupErr hold the read or validation error, if any.
+	Primary    *Table
+	Backup     *Table
+	PrimaryErr error
+	BackupErr  error
+
+	preferBackup bool
+}
+
+// Open opens path read-only and reads both copies of the GPT.
+func Open(path string, opts ...Option) (*Disk, error) {
+	o := options{maxTable: DefaultMaxTableBytes}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.offset < 0 {
+		return nil, fmt.Errorf("gpt: negative offset %d", o.offset)
+	}
+	flags := os.O_RDONLY
+	if o.readWrite {
+		flags = os.O_RDWR
+	}
+	f, err := os.OpenFile(path, flags, 0)
+	if err != nil {
+		return nil, err
+	}
+	end, err := DeviceSize(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("gpt: size of %s: %w", path, err)
+	}
+	if o.sectorSize == 0 && isDevice(f) {
+		// the device knows better than the signature probe, which cannot
+		// tell on a disk without a GPT yet
+		if logical, _, err := BlockSizes(f); err == nil {
+			o.sectorSize = logical
+		}
+	}
+	d, err := newDisk(f, end, path, o)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	d.f = f
+	return d, nil
+}
+
+// OpenReaderAt reads both copies of the GPT from r, which holds size bytes,
+// e.g. sectors fetched from another machine or a compressed image. name
+// only appears in messages. The Disk is read-only and File returns nil;
+// Close closes r when it is an io.Closer.
+func OpenReaderAt(r io.ReaderAt, size int64, name string, opts ...Option) (*Disk, error) {
+	o := options{maxTable: DefaultMaxTableBytes}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.offset < 0 {
+		return nil, fmt.Errorf("gpt: negative offset %d", o.offset)
+	}
+	d, err := newDisk(readOnly{r}, size, name, o)
+	if err != nil {
+		return nil, err
+	}
+	d.closer, _ = r.(io.Closer)
+	return d, nil
+}
+
+// OpenDevice reads both copies of the GPT from dev, which holds size
+// bytes: a MemDevice, a browser File or anything else the caller provides.
+// Unlike OpenReaderAt, the Disk writes through to dev. Closing the Disk
+// closes dev if it has a Close.
+func OpenDevice(dev Device, size int64, name string, opts ...Option) (*Disk, error) {
+	o := options{maxTable: DefaultMaxTableBytes}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.offset < 0 {
+		return nil, fmt.Errorf("gpt: negative offset %d", o.offset)
+	}
+	d, err := newDisk(dev, size, name, o)
+	if err != nil {
+		return nil, err
+	}
+	d.closer, _ = dev.(io.Closer)
+	return d, nil
+}
+
+// readOnly adapts an io.ReaderAt to Device.
+type readOnly struct{ io.ReaderAt }
+
+func (readOnly) WriteAt([]byte, int64) (int, error) {
+	return 0, errors.New("gpt: disk opened read-only")
+}
+
+func (readOnly) Sync() error { return nil }
+
+func newDisk(dev Device, end int64, path string, o options) (*Disk, error) {
+	d := &Disk{
+		dev:          WithDeadline(dev, o.ioTimeout),
+		Path:         path,
+		Offset:       o.offset,
+		SectorSize:   o.sectorSize,
+		Size:         end - o.offset,
+		preferBackup: o.preferBackup,
+	}
+	if d.SectorSize == 0 {
+		d.SectorSize = detectSectorSize(d.dev, o.offset)
+	}
+	if d.SectorSize < 512 || d.SectorSize&(d.SectorSize-1) != 0 {
+		return nil, fmt.Errorf("gpt: invalid sector size %d", d.SectorSize)
+	}
+
+	d.Primary, d.PrimaryErr = readTable(d.dev, d.Offset, 1, d.SectorSize, o.maxTable)
+	backupLBA := d.lastLBA()
+	if d.Primary != nil && d.Primary.Header.BackupLBA != 0 {
+		backupLBA = d.Primary.Header.BackupLBA
+	}
+	d.Backup, d.BackupErr = readTable(d.dev, d.Offset, backupLBA, d.SectorSize, o.maxTable)
+	if d.Backup == nil && backupLBA != d.lastLBA() {
+		// the primary may point somewhere stale; try the last sector too
+		d.Backup, d.BackupErr = readTable(d.dev, d.Offset, d.lastLBA(), d.SectorSize, o.maxTable)
+	}
+
+	if o.strict {
+		if err := errors.Join(d.PrimaryErr, d.BackupErr); err != nil {
+			return nil, err
+		}
+		if err := CompareCopies(d.Primary, d.Backup); err != nil {
+			return nil, err
+		}
+	}
+	if d.Table() == nil {
+		if errors.Is(d.PrimaryErr, ErrSignature) && errors.Is(d.BackupErr, ErrSignature) {
+			if err := mbrOnly(d.dev, d.Offset, path); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w in %s: primary: %w; backup: %w", ErrNoGPT, path, d.PrimaryErr, d.BackupErr)
+		}
+		return nil, fmt.Errorf("gpt: no usable GPT in %s: primary: %w; backup: %w", path, d.PrimaryErr, d.BackupErr)
+	}
+	return d, nil
+}
+
+// detectSectorSize looks for the header signature at LBA 1 for 512 and 4096
+// byte sectors and falls back to DefaultSectorSize.
+func detectSectorSize(r io.ReaderAt, offset int64) int {
+	sig := make([]byte, len(HeaderSignature))
+	for _, ss := range []int{512, 4096} {
+		if _, err := r.ReadAt(sig, offset+int64(ss)); err == nil && string(sig) == HeaderSignature {
+			return ss
+		}
+	}
+	return DefaultSectorSize
+}
+
+// readTable reads the header at lba and the entry array it points to. A table
+// is returned whenever the header signature matches, together with the first
+// validation error if the copy is damaged. Arrays larger than maxTable bytes
+// are not read at all when maxTable > 0.
+func readTable(r io.ReaderAt, offset int64, lba uint64, sectorSize int, maxTable int64) (*Table, error) {
+	buf := make([]byte, sectorSize)
+	if _, err := r.ReadAt(buf, offset+int64(lba)*int64(sectorSize)); err != nil {
+		return nil, fmt.Errorf("gpt: read header at LBA %d: %w", lba, err)
+	}
+	t := &Table{SectorSize: sectorSize}
+	if err := t.Header.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	if string(t.Header.Signature[:]) != HeaderSignature {
+		return nil, fmt.Errorf("%w at LBA %d", ErrSignature, lba)
+	}
+	if !validEntrySize(t.Header.PartitionEntrySize) {
+		return nil, fmt.Errorf("%w: %d at LBA %d", ErrEntrySize, t.Header.PartitionEntrySize, lba)
+	}
+	// the header CRC covers HeaderSize bytes, which may exceed the 92 defined
+	// ones; UnmarshalBinary kept the rest in Header.Extra
+	var hdrErr error
+	if t.Header.HeaderSize < MinHeaderSize || int(t.Header.HeaderSize) > sectorSize {
+		hdrErr = fmt.Errorf("%w: %d at LBA %d", ErrHeaderSize, t.Header.HeaderSize, lba)
+	} else if crc := HeaderCRC(buf[:t.Header.HeaderSize]); crc != t.Header.HeaderCRC32 {
+		hdrErr = fmt.Errorf("%w at LBA %d: stored 0x%08x, calculated 0x%08x", ErrHeaderCRC, lba, t.Header.HeaderCRC32, crc)
+	}
+
+	if size := t.Header.TableBytes(); maxTable > 0 && size > maxTable {
+		return nil, fmt.Errorf("%w: %d entries of %d bytes at LBA %d, limit %d bytes", ErrTableSize, t.Header.NumPartitions, t.Header.PartitionEntrySize, lba, maxTable)
+	}
+	crc, err := readEntries(r, offset+int64(t.Header.PartitionTableLBA)*int64(sectorSize), t)
+	if err != nil {
+		return nil, fmt.Errorf("gpt: read entry array at LBA %d: %w", t.Header.PartitionTableLBA, err)
+	}
+	if hdrErr != nil {
+		return t, hdrErr
+	}
+	if crc != t.Header.PartitionTableCRC {
+		return t, fmt.Errorf("%w at LBA %d: stored 0x%08x, calculated 0x%08x", ErrArrayCRC, t.Header.PartitionTableLBA, t.Header.PartitionTableCRC, crc)
+	}
+	return t, nil
+}
+
+// readEntries fills t.Entries from the array at off, a chunk at a time so the
+// raw array is never held in memory whole, and returns its CRC32.
+func readEntries(r io.ReaderAt, off int64, t *Table) (uint32, error) {
+	es := int64(t.Header.PartitionEntrySize)
+	size := t.Header.TableBytes()
+	buf := make([]byte, min(size, max(crcChunk/es*es, es)))
+	t.Entries = make([]Entry, t.Header.NumPartitions)
+	var crc uint32
+	for done := int64(0); done < size; {
+		n := min(int64(len(buf)), size-done)
+		if _, err := r.ReadAt(buf[:n], off+done); err != nil {
+			return 0, err
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, buf[:n])
+		for k := int64(0); k < n; k += es {
+			if err := t.Entries[(done+k)/es].unmarshalSized(buf[k:], int(es)); err != nil {
+				return 0, err
+			}
+		}
+		done += n
+	}
+	return crc, nil
+}
+
+// CompareCopies reports the first difference between primary and backup
+// beyond the fields that legitimately differ (location fields and CRC).
+func CompareCopies(p, b *Table) error {
+	if p == nil || b == nil {
+		return nil
+	}
+	ph, bh := p.Header, b.Header
+	switch {
+	case ph.CurrentLBA != bh.BackupLBA || ph.BackupLBA != bh.CurrentLBA:
+		return fmt.Errorf("gpt: primary and backup headers point at different locations")
+	case ph.DiskGUID != bh.DiskGUID:
+		return fmt.Errorf("gpt: primary and backup disk GUIDs differ")
+	case ph.FirstUsableLBA != bh.FirstUsableLBA || ph.LastUsableLBA != bh.LastUsableLBA:
+		return fmt.Errorf("gpt: primary and backup usable ranges differ")
+	case ph.PartitionTableCRC != bh.PartitionTableCRC:
+		return fmt.Errorf("gpt: primary and backup entry arrays differ")
+	}
+	return nil
+}
+
+// lastLBA is the LBA of the last whole sector of the disk.
+func (d *Disk) lastLBA() uint64 {
+	n := d.Size / int64(d.SectorSize)
+	if n <= 0 {
+		return 0
+	}
+	return uint64(n - 1)
+}
+
+// LastLBA returns the LBA of the last sector of the disk.
+func (d *Disk) LastLBA() uint64 {
+	return d.lastLBA()
+}
+
+// Table returns the copy to work with: the primary if it is valid, the
+// backup if it is valid (or preferred), otherwise whichever copy could be
+// read at all.
+func (d *Disk) Table() *Table {
+	pOK := d.Primary != nil && d.PrimaryErr == nil
+	bOK := d.Backup != nil && d.BackupErr == nil
+	switch {
+	case bOK && (d.preferBackup || !pOK):
+		return d.Backup
+	case pOK:
+		return d.Primary
+	case d.Primary != nil:
+		return d.Primary
+	}
+	return d.Backup
+}
+
+// ReadAt reads from the GPT disk, i.e. relative to Offset.
+func (d *Disk) ReadAt(p []byte, off int64) (int, error) {
+	return d.dev.ReadAt(p, d.Offset+off)
+}
+
+// WriteAt writes to the GPT disk, i.e. relative to Offset. The Disk must have
+// been opened with ReadWrite.
+func (d *Disk) WriteAt(p []byte, off int64) (int, error) {
+	return d.dev.WriteAt(p, d.Offset+off)
+}
+
+// Sync flushes the underlying file.
+func (d *Disk) Sync() error {
+	return d.dev.Sync()
+}
+
+// File returns the underlying file.
+func (d *Disk) File() *os.File {
+	return d.f
+}
+
+// Close closes the underlying file.
+func (d *Disk) Close() error {
+	switch {
+	case d.f != nil:
+		return d.f.Close()
+	case d.closer != nil:
+		return d.closer.Close()
+	}
+	return nil
+}
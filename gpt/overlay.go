@@ -0,0 +1,280 @@
+package gpt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// overlayMagic starts an overlay file, followed by the size of the device
+// it belongs to and the block size.
+const overlayMagic = "GPTOVL01"
+
+const (
+	overlayHeaderSize   = 512
+	overlayBlockSize    = 4096
+	overlayRecordHeader = 8 + sha256.Size
+	overlayRecord       = overlayRecordHeader + overlayBlockSize
+)
+
+// Overlay is a Device that leaves its base untouched: writes go to a
+// sidecar file and reads see them on top of the base. Commands can then run
+// "for real" against a live disk; the result is inspected through another
+// Overlay on the same file and either committed to the disk or discarded.
+//
+// The sidecar holds whole blocks, each an 8-byte big-endian block number,
+// the SHA-256 of what the base held there when the block was first
+// written, and the block's data. A block written again is rewritten in
+// place, so the file grows only with the amount of the disk changed. The
+// sums let Commit refuse a disk that is not the one the overlay was made
+// on, or that changed since.
+type Overlay struct {
+	base   io.ReaderAt
+	size   int64
+	f      *os.File
+	blocks map[int64]int64 // block number -> offset of its data in f
+	end    int64           // where the next block record goes
+}
+
+// OpenOverlay opens the overlay file at path on top of base, which holds
+// size bytes, creating the file if it does not exist. An existing file
+// made for a device of another size is refused.
+func OpenOverlay(base io.ReaderAt, size int64, path string) (*Overlay, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	o := &Overlay{base: base, size: size, f: f, blocks: map[int64]int64{}}
+	if err := o.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("gpt: overlay %s: %w", path, err)
+	}
+	return o, nil
+}
+
+// IsOverlayFile reports whether the file at path is an overlay file.
+func IsOverlayFile(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(overlayMagic))
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false, nil
+	}
+	return string(magic) == overlayMagic, nil
+}
+
+// load reads the block index of an existing file or writes the header of a
+// new one. A record cut short by a crash is dropped.
+func (o *Overlay) load() error {
+	fi, err := o.f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr := make([]byte, overlayHeaderSize)
+	if fi.Size() == 0 {
+		copy(hdr, overlayMagic)
+		binary.BigEndian.PutUint64(hdr[8:], uint64(o.size))
+		binary.BigEndian.PutUint32(hdr[16:], overlayBlockSize)
+		o.end = overlayHeaderSize
+		_, err := o.f.WriteAt(hdr, 0)
+		return err
+	}
+	if _, err := o.f.ReadAt(hdr, 0); err != nil || !bytes.Equal(hdr[:8], []byte(overlayMagic)) {
+		return errors.New("not an overlay file")
+	}
+	if bs := binary.BigEndian.Uint32(hdr[16:]); bs != overlayBlockSize {
+		return fmt.Errorf("unsupported block size %d", bs)
+	}
+	if n := int64(binary.BigEndian.Uint64(hdr[8:])); n != o.size {
+		return fmt.Errorf("made for a device of %d bytes, this one has %d", n, o.size)
+	}
+	var num [8]byte
+	o.end = overlayHeaderSize
+	for ; o.end+overlayRecord <= fi.Size(); o.end += overlayRecord {
+		if _, err := o.f.ReadAt(num[:], o.end); err != nil {
+			return err
+		}
+		o.blocks[int64(binary.BigEndian.Uint64(num[:]))] = o.end + overlayRecordHeader
+	}
+	if o.end != fi.Size() {
+		return o.f.Truncate(o.end)
+	}
+	return nil
+}
+
+// Size returns the size of the device the overlay belongs to.
+func (o *Overlay) Size() int64 { return o.size }
+
+func (o *Overlay) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("gpt: negative offset")
+	}
+	if off >= o.size {
+		return 0, io.EOF
+	}
+	want := len(p)
+	if rest := o.size - off; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	for done := 0; done < len(p); {
+		pos := off + int64(done)
+		blk, in := pos/overlayBlockSize, int(pos%overlayBlockSize)
+		n := min(overlayBlockSize-in, len(p)-done)
+		if at, ok := o.blocks[blk]; ok {
+			if _, err := o.f.ReadAt(p[done:done+n], at+int64(in)); err != nil {
+				return done, err
+			}
+		} else if _, err := o.base.ReadAt(p[done:done+n], pos); err != nil && !errors.Is(err, io.EOF) {
+			return done, err
+		}
+		done += n
+	}
+	if len(p) < want {
+		return len(p), io.EOF
+	}
+	return len(p), nil
+}
+
+func (o *Overlay) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(p)) > o.size {
+		return 0, errors.New("gpt: write beyond the end of the device")
+	}
+	block := make([]byte, overlayBlockSize)
+	for done := 0; done < len(p); {
+		pos := off + int64(done)
+		blk, in := pos/overlayBlockSize, int(pos%overlayBlockSize)
+		n := min(overlayBlockSize-in, len(p)-done)
+		if n < overlayBlockSize {
+			// a partial block starts out as what is there now
+			clear(block)
+			if _, err := o.ReadAt(block, blk*overlayBlockSize); err != nil && !errors.Is(err, io.EOF) {
+				return done, err
+			}
+		}
+		copy(block[in:], p[done:done+n])
+		if err := o.put(blk, block); err != nil {
+			return done, err
+		}
+		done += n
+	}
+	return len(p), nil
+}
+
+// put stores one whole block, in place if it was written before.
+func (o *Overlay) put(blk int64, block []byte) error {
+	if at, ok := o.blocks[blk]; ok {
+		_, err := o.f.WriteAt(block, at)
+		return err
+	}
+	rec := make([]byte, overlayRecord)
+	binary.BigEndian.PutUint64(rec, uint64(blk))
+	orig, err := o.baseBlock(o.base, blk)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(orig)
+	copy(rec[8:], sum[:])
+	copy(rec[overlayRecordHeader:], block)
+	if _, err := o.f.WriteAt(rec, o.end); err != nil {
+		return err
+	}
+	o.blocks[blk] = o.end + overlayRecordHeader
+	o.end += overlayRecord
+	return nil
+}
+
+// baseBlock reads block blk of r, short at the end of the device.
+func (o *Overlay) baseBlock(r io.ReaderAt, blk int64) ([]byte, error) {
+	off := blk * overlayBlockSize
+	b := make([]byte, min(int64(overlayBlockSize), o.size-off))
+	if _, err := r.ReadAt(b, off); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Sync flushes the overlay file; the base is never written.
+func (o *Overlay) Sync() error { return o.f.Sync() }
+
+// Close closes the overlay file, and the base if it has a Close.
+func (o *Overlay) Close() error {
+	err := o.f.Close()
+	if c, ok := o.base.(io.Closer); ok {
+		err = errors.Join(err, c.Close())
+	}
+	return err
+}
+
+// Changed returns the byte ranges of the device the overlay replaces, in
+// order, adjacent blocks merged.
+func (o *Overlay) Changed() []OverlayRange {
+	var out []OverlayRange
+	for _, blk := range o.sortedBlocks() {
+		off := blk * overlayBlockSize
+		n := min(int64(overlayBlockSize), o.size-off)
+		if k := len(out) - 1; k >= 0 && out[k].Offset+out[k].Length == off {
+			out[k].Length += n
+			continue
+		}
+		out = append(out, OverlayRange{off, n})
+	}
+	return out
+}
+
+// OverlayRange is a run of bytes of the device held by an Overlay.
+type OverlayRange struct {
+	Offset, Length int64
+}
+
+func (o *Overlay) sortedBlocks() []int64 {
+	blks := make([]int64, 0, len(o.blocks))
+	for b := range o.blocks {
+		blks = append(blks, b)
+	}
+	sort.Slice(blks, func(i, j int) bool { return blks[i] < blks[j] })
+	return blks
+}
+
+// ErrOverlayStale is returned by Commit when the device does not hold what
+// the overlay was made on top of.
+var ErrOverlayStale = errors.New("gpt: the device changed since the overlay was made, or is another one")
+
+// Commit writes every block held by the overlay to dev, then syncs dev.
+// dev must hold what the overlay's base held: every block is checked
+// before anything is written. The overlay file is left in place.
+func (o *Overlay) Commit(dev Device, sectorSize int) error {
+	blks := o.sortedBlocks()
+	var sum [sha256.Size]byte
+	for _, blk := range blks {
+		if _, err := o.f.ReadAt(sum[:], o.blocks[blk]-sha256.Size); err != nil {
+			return fmt.Errorf("gpt: overlay block %d: %w", blk, err)
+		}
+		cur, err := o.baseBlock(dev, blk)
+		if err != nil {
+			return err
+		}
+		if sha256.Sum256(cur) != sum {
+			return fmt.Errorf("%w (offset %d differs)", ErrOverlayStale, blk*overlayBlockSize)
+		}
+	}
+	block := make([]byte, overlayBlockSize)
+	for _, blk := range blks {
+		off := blk * overlayBlockSize
+		b := block[:min(int64(overlayBlockSize), o.size-off)]
+		if _, err := o.f.ReadAt(b, o.blocks[blk]); err != nil {
+			return fmt.Errorf("gpt: overlay block %d: %w", blk, err)
+		}
+		if err := writeRegion(dev, "overlay", b, off, sectorSize); err != nil {
+			return fmt.Errorf("gpt: commit overlay at offset %d: %w", off, err)
+		}
+	}
+	return dev.Sync()
+}
@@ -0,0 +1,104 @@
+package gpt
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrReadBack means data read back after a write differs from what was
+// written: the device lost or corrupted the write without reporting it.
+var ErrReadBack = errors.New("gpt: read-back verification failed")
+
+// ReadBackDevice wraps a Device and checks every write: Sync, after
+// syncing, reads back each region written since the previous Sync and
+// compares it with what was written. Only a digest of each write is kept,
+// so large writes cost no memory, but a region that is partly overwritten
+// before the next Sync is only checked where the later write covers it.
+type ReadBackDevice struct {
+	Device
+	// File, when set, is the file or block device underneath. Its cached
+	// pages are dropped before reading back (where the platform allows),
+	// so the comparison sees the medium rather than the page cache.
+	File *os.File
+	// Verified counts the bytes checked so far.
+	Verified int64
+
+	pending []writtenRegion
+}
+
+type writtenRegion struct {
+	off, n int64
+	sum    [32]byte
+}
+
+// WithReadBack wraps dev so that its writes are read back and compared on
+// every Sync. f is the file beneath dev, or nil.
+func WithReadBack(dev Device, f *os.File) *ReadBackDevice {
+	return &ReadBackDevice{Device: dev, File: f}
+}
+
+func (d *ReadBackDevice) WriteAt(p []byte, off int64) (int, error) {
+	n, err := d.Device.WriteAt(p, off)
+	end := off + int64(n)
+	// earlier writes this one overlaps no longer hold their data
+	kept := d.pending[:0]
+	for _, w := range d.pending {
+		if w.off >= end || w.off+w.n <= off {
+			kept = append(kept, w)
+		}
+	}
+	d.pending = kept
+	if n > 0 {
+		d.pending = append(d.pending, writtenRegion{off: off, n: int64(n), sum: sha256.Sum256(p[:n])})
+	}
+	return n, err
+}
+
+// Sync syncs the device, then checks what was written since the last
+// Sync.
+func (d *ReadBackDevice) Sync() error {
+	if err := d.Device.Sync(); err != nil {
+		return err
+	}
+	return d.Check()
+}
+
+// Check reads back the regions written since the last check and compares
+// them with what was written. Call it after syncing.
+func (d *ReadBackDevice) Check() error {
+	if len(d.pending) == 0 {
+		return nil
+	}
+	if d.File != nil {
+		dropCache(d.File)
+	}
+	pending := d.pending
+	d.pending = nil
+	buf := make([]byte, min(crcChunk*16, maxRegion(pending)))
+	for _, w := range pending {
+		h := sha256.New()
+		for done := int64(0); done < w.n; {
+			k := int(min(int64(len(buf)), w.n-done))
+			if _, err := d.Device.ReadAt(buf[:k], w.off+done); err != nil {
+				return fmt.Errorf("%w: reading back %d bytes at offset %d: %v", ErrReadBack, w.n, w.off, err)
+			}
+			h.Write(buf[:k])
+			done += int64(k)
+		}
+		if [32]byte(h.Sum(nil)) != w.sum {
+			return fmt.Errorf("%w: the %d bytes at offset %d read back differently", ErrReadBack, w.n, w.off)
+		}
+		d.Verified += w.n
+	}
+	return nil
+}
+
+func maxRegion(ws []writtenRegion) int64 {
+	var m int64
+	for _, w := range ws {
+		m = max(m, w.n)
+	}
+	return m
+}
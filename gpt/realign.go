@@ -0,0 +1,75 @@
+package gpt
+
+import (
+	"fmt"
+	"sort"
+)
+
+// RealignOptions control Realign.
+type RealignOptions struct {
+	// Align is the alignment of every new start LBA in sectors; 0 or 1
+	// packs partitions back to back.
+	Align uint64
+	// StartAt is the lowest LBA the first partition may start at; below
+	// FirstUsableLBA (or 0) means FirstUsableLBA.
+	StartAt uint64
+	// SortBySize places partitions largest first instead of in their
+	// current on-disk order.
+	SortBySize bool
+}
+
+// Move is one partition Realign relocated.
+type Move struct {
+	Index    int // entry index
+	OldStart uint64
+	NewStart uint64
+	Sectors  uint64
+}
+
+// Realign lays the used entries of t out again from StartAt, each on the
+// next Align boundary after the one before and past any reserved region in
+// the way, keeping their sizes. It only edits the entries; moving the
+// partitions' contents is up to the caller.
+// t is unchanged if the partitions do not fit.
+func (t *Table) Realign(o RealignOptions) ([]Move, error) {
+	align := max(o.Align, 1)
+	ss := t.sectorSize()
+	used := t.Used()
+	sort.SliceStable(used, func(a, b int) bool {
+		ea, eb := t.Entries[used[a]], t.Entries[used[b]]
+		if o.SortBySize && ea.Sectors() != eb.Sectors() {
+			return ea.Sectors() > eb.Sectors()
+		}
+		return ea.StartingLBA < eb.StartingLBA
+	})
+	next := max(o.StartAt, t.Header.FirstUsableLBA)
+	var moves []Move
+	for _, i := range used {
+		e := t.Entries[i]
+		if e.EndingLBA < e.StartingLBA {
+			return nil, fmt.Errorf("gpt: entry %d ends (%d) before it starts (%d)", i, e.EndingLBA, e.StartingLBA)
+		}
+		start := (next + align - 1) / align * align
+		end := start + e.Sectors() - 1
+		for {
+			r, ok := reservedIn(t.Reserved, start, end, ss)
+			if !ok {
+				break
+			}
+			_, last := r.Sectors(ss)
+			start = (last + 1 + align - 1) / align * align
+			end = start + e.Sectors() - 1
+		}
+		if end > t.Header.LastUsableLBA {
+			return nil, fmt.Errorf("gpt: entry %d (%d sectors) would end at %d, past the last usable LBA %d", i, e.Sectors(), end, t.Header.LastUsableLBA)
+		}
+		moves = append(moves, Move{Index: i, OldStart: e.StartingLBA, NewStart: start, Sectors: e.Sectors()})
+		next = end + 1
+	}
+	for _, m := range moves {
+		e := &t.Entries[m.Index]
+		e.StartingLBA, e.EndingLBA = m.NewStart, m.NewStart+m.Sectors-1
+	}
+	t.UpdateCRCs()
+	return moves, nil
+}
@@ -0,0 +1,51 @@
+package gpt
+
+import "fmt"
+
+// Reserved is a named byte range of the disk that partitions must not cover,
+// such as a bootloader stage or environment the firmware reads from a fixed
+// raw offset.
+type Reserved struct {
+	Name   string
+	Offset int64
+	Size   int64
+}
+
+// Sectors returns the first and last LBA touched by r.
+func (r Reserved) Sectors(sectorSize int) (first, last uint64) {
+	ss := int64(sectorSize)
+	return uint64(r.Offset / ss), uint64((r.Offset+r.Size+ss-1)/ss) - 1
+}
+
+// Overlaps reports whether the LBA range start-end covers any part of r.
+func (r Reserved) Overlaps(start, end uint64, sectorSize int) bool {
+	if r.Size <= 0 {
+		return false
+	}
+	first, last := r.Sectors(sectorSize)
+	return start <= last && end >= first
+}
+
+func (r Reserved) String() string {
+	return fmt.Sprintf("%q (bytes %d-%d)", r.Name, r.Offset, r.Offset+r.Size-1)
+}
+
+// checkReserved refuses regions that collide with the GPT structures of t;
+// those can only be moved by changing the number of entries.
+func checkReserved(t *Table, reserved []Reserved) error {
+	ss := t.sectorSize()
+	h := t.Header
+	array := h.TableSectors(ss)
+	for _, r := range reserved {
+		if r.Offset < 0 || r.Size < 0 {
+			return fmt.Errorf("gpt: reserved region %s has a negative offset or size", r)
+		}
+		switch {
+		case r.Overlaps(0, h.PartitionTableLBA+array-1, ss):
+			return fmt.Errorf("gpt: reserved region %s collides with the protective MBR or primary GPT (LBA 0-%d); use fewer entries", r, h.PartitionTableLBA+array-1)
+		case r.Overlaps(h.LastUsableLBA+1, h.BackupLBA, ss):
+			return fmt.Errorf("gpt: reserved region %s collides with the backup GPT", r)
+		}
+	}
+	return nil
+}
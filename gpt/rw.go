@@ -0,0 +1,114 @@
+package gpt
+
+import (
+	"fmt"
+	"io"
+)
+
+// The functions here read and write a single header or entry array, for
+// programs that want the pieces of a GPT rather than the checked pair of
+// copies Open gives. They honour WithSectorSize, WithOffset and
+// WithMaxTableBytes; other options are ignored.
+
+func newOptions(opts []Option) options {
+	o := options{maxTable: DefaultMaxTableBytes}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// sectorSizeFor returns the sector size of o, probing r when none is set.
+func (o *options) sectorSizeFor(r io.ReaderAt) int {
+	if o.sectorSize == 0 {
+		o.sectorSize = detectSectorSize(r, o.offset)
+	}
+	return o.sectorSize
+}
+
+// ReadHeader reads the primary header from LBA 1 of r. The header is
+// returned whenever its signature matches, together with ErrHeaderCRC or
+// another validation error if it is damaged, so a tool can still show what
+// it holds.
+func ReadHeader(r io.ReaderAt, opts ...Option) (*Header, error) {
+	return ReadHeaderAt(r, 1, opts...)
+}
+
+// ReadHeaderAt is ReadHeader for the header at lba, e.g. the backup's.
+func ReadHeaderAt(r io.ReaderAt, lba uint64, opts ...Option) (*Header, error) {
+	o := newOptions(opts)
+	if o.offset < 0 {
+		return nil, fmt.Errorf("gpt: negative offset %d", o.offset)
+	}
+	ss := o.sectorSizeFor(r)
+	buf := make([]byte, ss)
+	if _, err := r.ReadAt(buf, o.offset+int64(lba)*int64(ss)); err != nil {
+		return nil, fmt.Errorf("gpt: read header at LBA %d: %w", lba, err)
+	}
+	h := &Header{}
+	if err := h.UnmarshalBinary(buf); err != nil {
+		return nil, err
+	}
+	if string(h.Signature[:]) != HeaderSignature {
+		return nil, fmt.Errorf("%w at LBA %d", ErrSignature, lba)
+	}
+	// a HeaderSize past the sector would have the CRC cover bytes that
+	// were never read
+	if h.HeaderSize < MinHeaderSize || int(h.HeaderSize) > ss {
+		return h, fmt.Errorf("%w: %d at LBA %d", ErrHeaderSize, h.HeaderSize, lba)
+	}
+	if err := h.Validate(); err != nil {
+		return h, fmt.Errorf("%w at LBA %d", err, lba)
+	}
+	return h, nil
+}
+
+// ReadEntries reads the entry array h points to, every slot of it, and
+// checks it against the CRC in h. The entries are returned with
+// ErrArrayCRC when only the CRC is wrong.
+func ReadEntries(r io.ReaderAt, h *Header, opts ...Option) ([]Entry, error) {
+	o := newOptions(opts)
+	if o.offset < 0 {
+		return nil, fmt.Errorf("gpt: negative offset %d", o.offset)
+	}
+	if !validEntrySize(h.PartitionEntrySize) {
+		return nil, fmt.Errorf("%w: %d", ErrEntrySize, h.PartitionEntrySize)
+	}
+	if size := h.TableBytes(); o.maxTable > 0 && size > o.maxTable {
+		return nil, fmt.Errorf("%w: %d entries of %d bytes, limit %d bytes", ErrTableSize, h.NumPartitions, h.PartitionEntrySize, o.maxTable)
+	}
+	ss := o.sectorSizeFor(r)
+	t := &Table{Header: *h}
+	crc, err := readEntries(r, o.offset+int64(h.PartitionTableLBA)*int64(ss), t)
+	if err != nil {
+		return nil, fmt.Errorf("gpt: read entry array at LBA %d: %w", h.PartitionTableLBA, err)
+	}
+	if crc != h.PartitionTableCRC {
+		return t.Entries, fmt.Errorf("%w at LBA %d: stored 0x%08x, calculated 0x%08x", ErrArrayCRC, h.PartitionTableLBA, h.PartitionTableCRC, crc)
+	}
+	return t.Entries, nil
+}
+
+// WriteHeader updates the CRC of h and writes it as the whole sector at
+// its CurrentLBA. The sector size is DefaultSectorSize unless
+// WithSectorSize gives it. The entry array it points to is not touched;
+// Table.ApplyTo writes both copies of a whole table.
+func WriteHeader(w io.WriterAt, h *Header, opts ...Option) error {
+	o := newOptions(opts)
+	if o.offset < 0 {
+		return fmt.Errorf("gpt: negative offset %d", o.offset)
+	}
+	ss := o.sectorSize
+	if ss == 0 {
+		ss = DefaultSectorSize
+	}
+	h.UpdateCRC()
+	sector, err := h.Sector(ss)
+	if err != nil {
+		return err
+	}
+	if _, err := w.WriteAt(sector, o.offset+int64(h.CurrentLBA)*int64(ss)); err != nil {
+		return fmt.Errorf("gpt: write header at LBA %d: %w", h.CurrentLBA, err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package gpt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// ScanLimit is how far into a disk ScanHeaders looks for a header.
+const ScanLimit = 64 << 10
+
+// scanSectorSizes are the sector sizes ScanHeaders tries a header under.
+var scanSectorSizes = []int{512, 1024, 2048, 4096, 8192}
+
+// Geometry is where ScanHeaders found a GPT header and how the rest of its
+// table has to be read.
+type Geometry struct {
+	// At is the byte position of the header.
+	At int64
+	// SectorSize is the sector size the table was written with and Offset
+	// the byte position of its LBA 0, so that the header lies at Offset +
+	// CurrentLBA × SectorSize. SectorSize is 0 if the entry array was not
+	// found under any sector size; Offset is meaningless then.
+	SectorSize int
+	Offset     int64
+	// ByteSwapped is set for a header whose integer fields were written
+	// big-endian; Header holds them decoded.
+	ByteSwapped bool
+	Header      Header
+}
+
+// Standard reports whether Open finds the table of g without help: a
+// little-endian table at offset 0 with 512- or 4096-byte sectors.
+func (g Geometry) Standard() bool {
+	return !g.ByteSwapped && g.Offset == 0 && (g.SectorSize == 512 || g.SectorSize == 4096)
+}
+
+// ScanHeaders is a recovery heuristic for tables broken imaging tools
+// wrote shifted by some bytes, under the wrong sector size assumption or
+// byte-swapped. It searches the first ScanLimit bytes of r for headers
+// that validate, in either byte order, and for each works out the sector
+// size and offset under which its entry array is found with a matching
+// CRC.
+func ScanHeaders(r io.ReaderAt, size int64) ([]Geometry, error) {
+	buf := make([]byte, min(size, ScanLimit+512))
+	n, err := r.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	buf = buf[:n]
+	var found []Geometry
+	for pos := 0; ; pos++ {
+		i := bytes.Index(buf[pos:], []byte(HeaderSignature))
+		if i < 0 || pos+i >= ScanLimit {
+			break
+		}
+		pos += i
+		raw := buf[pos:min(pos+512, len(buf))]
+		h, swapped, ok := decodeAnyHeader(raw)
+		if !ok {
+			continue
+		}
+		g := Geometry{At: int64(pos), ByteSwapped: swapped, Header: h}
+		for _, ss := range scanSectorSizes {
+			off := int64(pos) - int64(h.CurrentLBA)*int64(ss)
+			if off < 0 || h.CurrentLBA > uint64(size) || h.TableBytes() > DefaultMaxTableBytes {
+				continue
+			}
+			array := make([]byte, h.TableBytes())
+			if _, err := r.ReadAt(array, off+int64(h.PartitionTableLBA)*int64(ss)); err != nil {
+				continue
+			}
+			// an empty array matches anywhere zeros are; an unshifted
+			// geometry is the likelier one then
+			if crc32.ChecksumIEEE(array) == h.PartitionTableCRC && (g.SectorSize == 0 || off == 0) {
+				g.SectorSize, g.Offset = ss, off
+			}
+		}
+		found = append(found, g)
+	}
+	return found, nil
+}
+
+// decodeAnyHeader decodes raw as a valid header, little-endian as the spec
+// has it or else big-endian.
+func decodeAnyHeader(raw []byte) (h Header, swapped, ok bool) {
+	if len(raw) < MinHeaderSize {
+		return h, false, false
+	}
+	// the CRC covers HeaderSize bytes, which have to be in raw
+	if h.UnmarshalBinary(raw) == nil && int(h.HeaderSize) <= len(raw) && h.Validate() == nil {
+		return h, false, true
+	}
+	if h.UnmarshalBinary(swapHeader(raw[:MinHeaderSize])) != nil || h.HeaderSize != MinHeaderSize {
+		return h, false, false
+	}
+	// the CRC of a swapped header is over the bytes as they were written
+	zeroed := append([]byte(nil), raw[:MinHeaderSize]...)
+	clear(zeroed[16:20])
+	if crc32.ChecksumIEEE(zeroed) != h.HeaderCRC32 {
+		return h, false, false
+	}
+	check := h
+	check.UpdateCRC()
+	return h, true, check.Validate() == nil
+}
+
+// swapHeader returns the defined fields of a big-endian header re-encoded
+// little-endian. The signature and disk GUID are byte strings and stay.
+func swapHeader(b []byte) []byte {
+	s := append([]byte(nil), b...)
+	be, le := binary.BigEndian, binary.LittleEndian
+	for _, f := range [][2]int{{8, 4}, {12, 4}, {16, 4}, {20, 4}, {24, 8}, {32, 8}, {40, 8}, {48, 8}, {72, 8}, {80, 4}, {84, 4}, {88, 4}} {
+		p := s[f[0] : f[0]+f[1]]
+		if f[1] == 4 {
+			le.PutUint32(p, be.Uint32(p))
+		} else {
+			le.PutUint64(p, be.Uint64(p))
+		}
+	}
+	return s
+}
@@ -0,0 +1,203 @@
+package gpt
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+// Table is one copy of a GPT: a header plus its partition entry array.
+type Table struct {
+	// SectorSize is the logical block size; 0 means DefaultSectorSize.
+	SectorSize int
+	Header     Header
+	// Entries holds every slot of the array (Header.NumPartitions of them),
+	// including unused ones, so indexes match on-disk entry numbers.
+	Entries []Entry
+	// Reserved lists byte ranges partitions must keep clear of. It is not
+	// stored on disk: Free and Realign place nothing there and ApplyTo
+	// refuses entries that overlap one.
+	Reserved []Reserved
+}
+
+func (t *Table) sectorSize() int {
+	if t.SectorSize <= 0 {
+		return DefaultSectorSize
+	}
+	return t.SectorSize
+}
+
+func (t *Table) entrySize() int {
+	if t.Header.PartitionEntrySize < EntrySize {
+		return EntrySize
+	}
+	return int(t.Header.PartitionEntrySize)
+}
+
+// EntryArray serializes the entries into the on-disk array of
+// NumPartitions × PartitionEntrySize bytes.
+func (t *Table) EntryArray() []byte {
+	es := t.entrySize()
+	n := int(t.Header.NumPartitions)
+	if n < len(t.Entries) {
+		n = len(t.Entries)
+	}
+	// int64, so a huge array fails to allocate rather than wrapping
+	// around on 32-bit platforms
+	b := make([]byte, int64(n)*int64(es))
+	for i := range t.Entries {
+		t.Entries[i].put(b[i*es : i*es+EntrySize])
+		copy(b[i*es+EntrySize:(i+1)*es], t.Entries[i].Extra)
+	}
+	return b
+}
+
+// ParseEntryArray decodes raw into entries of the given size.
+func ParseEntryArray(raw []byte, entrySize int) ([]Entry, error) {
+	if entrySize < EntrySize {
+		return nil, fmt.Errorf("%w: %d", ErrEntrySize, entrySize)
+	}
+	entries := make([]Entry, len(raw)/entrySize)
+	for i := range entries {
+		if err := entries[i].unmarshalSized(raw[i*entrySize:], entrySize); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// ComputeArrayCRC returns the CRC32 of EntryArray without building it, one
+// entry at a time, so huge arrays cost no more memory than their Entries.
+func (t *Table) ComputeArrayCRC() uint32 {
+	es := t.entrySize()
+	n := max(int(t.Header.NumPartitions), len(t.Entries))
+	b := make([]byte, es)
+	var crc uint32
+	for i := 0; i < n; i++ {
+		clear(b)
+		if i < len(t.Entries) {
+			t.Entries[i].put(b[:EntrySize])
+			copy(b[EntrySize:], t.Entries[i].Extra)
+		}
+		crc = crc32.Update(crc, crc32.IEEETable, b)
+	}
+	return crc
+}
+
+// UpdateCRCs recomputes the entry array CRC and then the header CRC.
+func (t *Table) UpdateCRCs() {
+	t.Header.PartitionTableCRC = t.ComputeArrayCRC()
+	t.Header.UpdateCRC()
+}
+
+// Used returns the indexes of all non-empty entries.
+func (t *Table) Used() []int {
+	var idx []int
+	for i, e := range t.Entries {
+		if !e.IsEmpty() {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// Validate checks the header and the entry array CRC.
+func (t *Table) Validate() error {
+	if err := t.Header.Validate(); err != nil {
+		return err
+	}
+	if crc := t.ComputeArrayCRC(); crc != t.Header.PartitionTableCRC {
+		return fmt.Errorf("%w: stored 0x%08x, calculated 0x%08x", ErrArrayCRC, t.Header.PartitionTableCRC, crc)
+	}
+	return nil
+}
+
+// MarshalBinary serializes the table as one header sector followed by the
+// entry array, with both CRCs recomputed. t itself is not modified.
+func (t *Table) MarshalBinary() ([]byte, error) {
+	c := t.Clone()
+	c.UpdateCRCs()
+	out, err := c.Header.Sector(t.sectorSize())
+	if err != nil {
+		return nil, err
+	}
+	return append(out, c.EntryArray()...), nil
+}
+
+// UnmarshalBinary is the inverse of MarshalBinary. CRCs are not checked;
+// call Validate for that.
+func (t *Table) UnmarshalBinary(data []byte) error {
+	ss := t.sectorSize()
+	if len(data) < ss {
+		return fmt.Errorf("%w: need at least one %d-byte sector", ErrShortBuffer, ss)
+	}
+	if err := t.Header.UnmarshalBinary(data[:ss]); err != nil {
+		return err
+	}
+	size := t.Header.TableBytes()
+	if int64(len(data)-ss) < size {
+		return fmt.Errorf("%w: entry array needs %d bytes, got %d", ErrShortBuffer, size, len(data)-ss)
+	}
+	entries, err := ParseEntryArray(data[ss:int64(ss)+size], t.entrySize())
+	if err != nil {
+		return err
+	}
+	t.Entries = entries
+	return nil
+}
+
+// Clone returns a deep copy of t.
+func (t *Table) Clone() *Table {
+	c := *t
+	c.Entries = append([]Entry(nil), t.Entries...)
+	for i := range c.Entries {
+		if c.Entries[i].Extra != nil {
+			c.Entries[i].Extra = append([]byte(nil), c.Entries[i].Extra...)
+		}
+	}
+	c.Reserved = append([]Reserved(nil), t.Reserved...)
+	c.Header.Extra = append([]byte(nil), t.Header.Extra...)
+	c.Header.Tail = append([]byte(nil), t.Header.Tail...)
+	return &c
+}
+
+// Alternate derives the other copy of the table: a primary yields the
+// matching backup (array right before the backup header) and vice versa.
+// CRCs are recomputed.
+func (t *Table) Alternate() *Table {
+	c := t.Clone()
+	h := &c.Header
+	h.CurrentLBA, h.BackupLBA = t.Header.BackupLBA, t.Header.CurrentLBA
+	if h.CurrentLBA > h.BackupLBA {
+		h.PartitionTableLBA = h.CurrentLBA - t.Header.TableSectors(t.sectorSize())
+	} else {
+		h.PartitionTableLBA = h.CurrentLBA + 1
+	}
+	c.UpdateCRCs()
+	return c
+}
+
+// MoveBackup points the backup copy of t at lastLBA, normally the last
+// sector of a disk that grew since the table was written, and moves
+// LastUsableLBA along with it. t must be the primary copy. Partitions that
+// would end up past the usable area are refused.
+func (t *Table) MoveBackup(lastLBA uint64) error {
+	if !t.Header.IsPrimary() {
+		return errors.New("gpt: MoveBackup needs the primary copy")
+	}
+	h := &t.Header
+	tableSectors := h.TableSectors(t.sectorSize())
+	if lastLBA < h.FirstUsableLBA+tableSectors+1 {
+		return fmt.Errorf("gpt: LBA %d leaves no room for the backup GPT", lastLBA)
+	}
+	lastUsable := lastLBA - tableSectors - 1
+	for _, i := range t.Used() {
+		if t.Entries[i].EndingLBA > lastUsable {
+			return fmt.Errorf("gpt: entry %d ends at %d, past the new last usable LBA %d", i, t.Entries[i].EndingLBA, lastUsable)
+		}
+	}
+	h.BackupLBA = lastLBA
+	h.LastUsableLBA = lastUsable
+	t.UpdateCRCs()
+	return nil
+}
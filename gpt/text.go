@@ -0,0 +1,245 @@
+package gpt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TextVersion is the first line of the text form written by MarshalText.
+const TextVersion = "# gpt text v1"
+
+// MarshalText writes t in a canonical, line-oriented form meant to be kept
+// under version control: every header field and every used entry, in a
+// fixed order, one "key value" pair per line. UnmarshalText turns it back
+// into a table that writes the same bytes, CRCs included when t was
+// consistent. Empty entries are implied; entries are listed by number.
+// Vendor bytes past 128 in an entry (Entry.Extra) are kept for used
+// entries only; those past the header in its sector (Header.Tail) are
+// kept too.
+func (t *Table) MarshalText() ([]byte, error) {
+	var b bytes.Buffer
+	h := &t.Header
+	kv := func(k string, v any) { fmt.Fprintf(&b, "%s %v\n", k, v) }
+	b.WriteString(TextVersion + "\n")
+	kv("sector-size", t.sectorSize())
+	kv("signature", strconv.Quote(string(h.Signature[:])))
+	kv("revision", fmt.Sprintf("0x%08x", h.Revision))
+	kv("header-size", h.HeaderSize)
+	if len(h.Extra) > 0 {
+		kv("header-extra", hex.EncodeToString(h.Extra))
+	}
+	kv("header-reserved", h.Reserved)
+	if len(h.Tail) > 0 {
+		kv("header-tail", hex.EncodeToString(h.Tail))
+	}
+	kv("my-lba", h.CurrentLBA)
+	kv("alternate-lba", h.BackupLBA)
+	kv("first-usable-lba", h.FirstUsableLBA)
+	kv("last-usable-lba", h.LastUsableLBA)
+	kv("disk-guid", h.DiskGUID)
+	kv("entry-array-lba", h.PartitionTableLBA)
+	kv("entries", h.NumPartitions)
+	kv("entry-size", h.PartitionEntrySize)
+	for _, i := range t.Used() {
+		e := t.Entries[i]
+		fmt.Fprintf(&b, "\npartition %d\n", i+1)
+		kv("type", e.PartitionTypeGUID)
+		kv("guid", e.UniqueGUID)
+		kv("first-lba", e.StartingLBA)
+		kv("last-lba", e.EndingLBA)
+		kv("attributes", fmt.Sprintf("0x%016x", e.Attributes))
+		name := e.Name()
+		if enc, _ := EncodeName(name); enc == e.PartitionName {
+			kv("name", strconv.Quote(name))
+		} else {
+			// bytes after the terminating NUL or unpaired surrogates would
+			// not survive a round trip through a string
+			kv("name-raw", hex.EncodeToString(e.PartitionName[:]))
+		}
+		if len(e.Extra) > 0 {
+			kv("extra", hex.EncodeToString(e.Extra))
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// Fingerprint returns the SHA-256, as hex, of the text form of t as the
+// primary copy. CRCs are not part of it and either copy of a consistent
+// GPT gives the same digest, so it changes only when the content of the
+// table does: a field of the header, an entry or vendor bytes.
+func (t *Table) Fingerprint() (string, error) {
+	if !t.Header.IsPrimary() {
+		t = t.Alternate()
+	}
+	b, err := t.MarshalText()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// UnmarshalText parses the form written by MarshalText. Every header field
+// must be present; CRCs are not part of the text and are recomputed.
+func (t *Table) UnmarshalText(text []byte) error {
+	sc := bufio.NewScanner(bytes.NewReader(text))
+	line := 0
+	if !sc.Scan() || strings.TrimSpace(sc.Text()) != TextVersion {
+		return fmt.Errorf("gpt: text: first line must be %q", TextVersion)
+	}
+	line++
+	var nt Table
+	h := &nt.Header
+	seen := map[string]bool{}
+	var cur *Entry
+	entries := map[int]*Entry{}
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("gpt: text line %d: %s", line, fmt.Sprintf(format, args...))
+	}
+	for sc.Scan() {
+		line++
+		s := strings.TrimSpace(sc.Text())
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		key, val, _ := strings.Cut(s, " ")
+		val = strings.TrimSpace(val)
+		if key == "partition" {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return fail("invalid partition number %q", val)
+			}
+			if entries[n] != nil {
+				return fail("partition %d listed twice", n)
+			}
+			cur = &Entry{}
+			entries[n] = cur
+			continue
+		}
+		scope := "header"
+		if cur != nil {
+			scope = "partition"
+		}
+		id := scope + "." + key
+		if cur == nil {
+			if seen[id] {
+				return fail("%s given twice", key)
+			}
+			seen[id] = true
+		}
+		var err error
+		u64 := func(dst *uint64) { *dst, err = strconv.ParseUint(val, 0, 64) }
+		u32 := func(dst *uint32) {
+			var v uint64
+			v, err = strconv.ParseUint(val, 0, 32)
+			*dst = uint32(v)
+		}
+		switch id {
+		case "header.sector-size":
+			nt.SectorSize, err = strconv.Atoi(val)
+		case "header.signature":
+			var sig string
+			if sig, err = strconv.Unquote(val); err == nil {
+				if len(sig) != 8 {
+					return fail("signature must be 8 bytes")
+				}
+				copy(h.Signature[:], sig)
+			}
+		case "header.revision":
+			u32(&h.Revision)
+		case "header.header-size":
+			u32(&h.HeaderSize)
+		case "header.header-extra":
+			h.Extra, err = hex.DecodeString(val)
+		case "header.header-tail":
+			h.Tail, err = hex.DecodeString(val)
+		case "header.header-reserved":
+			u32(&h.Reserved)
+		case "header.my-lba":
+			u64(&h.CurrentLBA)
+		case "header.alternate-lba":
+			u64(&h.BackupLBA)
+		case "header.first-usable-lba":
+			u64(&h.FirstUsableLBA)
+		case "header.last-usable-lba":
+			u64(&h.LastUsableLBA)
+		case "header.disk-guid":
+			h.DiskGUID, err = ParseGUID(val)
+		case "header.entry-array-lba":
+			u64(&h.PartitionTableLBA)
+		case "header.entries":
+			u32(&h.NumPartitions)
+		case "header.entry-size":
+			u32(&h.PartitionEntrySize)
+		case "partition.type":
+			cur.PartitionTypeGUID, err = ParseGUID(val)
+		case "partition.guid":
+			cur.UniqueGUID, err = ParseGUID(val)
+		case "partition.first-lba":
+			u64(&cur.StartingLBA)
+		case "partition.last-lba":
+			u64(&cur.EndingLBA)
+		case "partition.attributes":
+			u64(&cur.Attributes)
+		case "partition.name":
+			var name string
+			if name, err = strconv.Unquote(val); err == nil {
+				var truncated bool
+				if cur.PartitionName, truncated = EncodeName(name); truncated {
+					return fail("name %q longer than 36 UTF-16 units", name)
+				}
+			}
+		case "partition.extra":
+			cur.Extra, err = hex.DecodeString(val)
+		case "partition.name-raw":
+			var raw []byte
+			if raw, err = hex.DecodeString(val); err == nil {
+				if len(raw) != len(cur.PartitionName) {
+					return fail("name-raw must be %d bytes", len(cur.PartitionName))
+				}
+				copy(cur.PartitionName[:], raw)
+			}
+		default:
+			return fail("unknown %s key %q", scope, key)
+		}
+		if err != nil {
+			return fail("%s: %v", key, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	for _, k := range []string{"sector-size", "signature", "revision", "header-size", "header-reserved", "my-lba",
+		"alternate-lba", "first-usable-lba", "last-usable-lba", "disk-guid", "entry-array-lba", "entries", "entry-size"} {
+		if !seen["header."+k] {
+			return fmt.Errorf("gpt: text: missing %s", k)
+		}
+	}
+	if int64(h.HeaderSize) < MinHeaderSize+int64(len(h.Extra)) {
+		return fmt.Errorf("gpt: text: header-extra does not fit in header-size %d", h.HeaderSize)
+	}
+	if int(h.HeaderSize)+len(h.Tail) > nt.sectorSize() {
+		return fmt.Errorf("gpt: text: header-tail does not fit in the %d-byte sector after header-size %d", nt.sectorSize(), h.HeaderSize)
+	}
+	nt.Entries = make([]Entry, h.NumPartitions)
+	for n, e := range entries {
+		if n > len(nt.Entries) {
+			return fmt.Errorf("gpt: text: partition %d beyond %d entries", n, h.NumPartitions)
+		}
+		if e.IsEmpty() {
+			return fmt.Errorf("gpt: text: partition %d has no type", n)
+		}
+		if EntrySize+len(e.Extra) > int(h.PartitionEntrySize) {
+			return fmt.Errorf("gpt: text: partition %d: extra does not fit in entry-size %d", n, h.PartitionEntrySize)
+		}
+		nt.Entries[n-1] = *e
+	}
+	nt.UpdateCRCs()
+	*t = nt
+	return nil
+}
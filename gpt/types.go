@@ -0,0 +1,251 @@
+package gpt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Very large map of known partition type GUIDs (canonical lowercase keys)
+var knownGuidPairs = [][2]string{
+	// UEFI / common
+	{"c12a7328-f81f-11d2-ba4b-00a0c93ec93b", "EFI System Partition"},
+	{"21686148-6449-6e6f-744e-656564454649", "BIOS Boot Partition"},
+
+	// Linux / distro / LVM / RAID
+	{"4f68bce3-e8cd-4db1-96e7-fbcaf984b709", "Linux root (x86-64)"},
+	{"44479540-f297-41b2-9af7-d131d5f0458a", "Linux root (x86)"},
+	{"b921b045-1df0-41c3-af44-4c6f280d3fae", "Linux root (ARM64)"},
+	{"69dad710-2ce4-4e3c-b16c-21a1d49abed3", "Linux root (ARM)"},
+	{"72ec70a6-cf74-40e6-bd49-4bda08e8f224", "Linux root (RISC-V 64)"},
+	{"0fc63daf-8483-4772-8e79-3d69d8477de4", "Linux filesystem data"},
+	{"0657fd6d-a4ab-43c4-84e5-0933c84b4f4f", "Linux swap"},
+	{"e6d6d379-f507-44c2-a23c-238f2a3df928", "Linux LVM"},
+	{"a19d880f-05fc-4d3b-a006-743f0f84911e", "Linux root (old coreos style)"},
+	{"930a0d1a-6b73-4b1a-9cc9-9e6d2a3f3b9d", "Linux home (non-standard)"},
+	{"0bfb3f1a-9b27-4e6f-8d3a-000000000000", "Linux reserved (nonstandard)"},
+	{"9163b3ee-6b79-4a9a-9a8b-3a44f2b6f1f5", "Linux RAID"},
+	{"1777a15b-d0a1-4ef9-b0c8-2f2f6b6a4a3f", "Linux reserved (vendor)"},
+
+	// Microsoft / Windows
+	{"e3c9e316-0b5c-4db8-817d-f92df00215ae", "Microsoft Reserved Partition (MSR)"},
+	{"ebd0a0a2-b9e5-4433-87c0-68b6b72699c7", "Microsoft Basic Data"},
+	{"de94bba4-06d1-4d40-a16a-bfd50179d6ac", "Windows Recovery Environment"},
+
+	// ChromeOS / CoreOS / Android / vendor
+	{"fe3a2a5d-4f32-41a7-b725-accc3285a309", "ChromeOS kernel"},
+	{"3cb8e202-3b7e-47dd-8a3c-7ff2a13cfcec", "ChromeOS rootfs"},
+	{"cab6e88e-abf3-4102-a07a-d4bb9be3c1d3", "ChromeOS firmware"},
+	{"2e0a753d-9e48-43b0-8337-b15192cb1b5e", "ChromeOS reserved"},
+	{"09845860-705f-4bb5-b16c-8a8a099caf52", "ChromeOS miniOS"},
+	{"3f0f8318-f146-4e6b-8222-c28c8f02e0d5", "ChromeOS hibernate"},
+	{"44479540-f297-41b2-9af7-d131d5f0458a", "Android fstab (vendor-defined)"},
+	{"2568845d-2332-4675-bc39-8fa5a4748d15", "Android bootloader"},
+	{"114eaffe-1552-4022-b26e-9b053604cf84", "Android bootloader 2"},
+	{"49a4d17f-93a3-45c1-a0de-f50b2ebe2599", "Android boot"},
+	{"4177c722-9e92-4aab-8644-43502bfd5506", "Android recovery"},
+	{"ef32a33b-a409-486c-9141-9ffb711f6266", "Android misc"},
+	{"20ac26be-20b7-11e3-84c5-6cfdb94711e9", "Android metadata"},
+	{"38f428e6-d326-425d-9140-6e0ea133647c", "Android system"},
+	{"a893ef21-e428-470a-9e55-0668fd91a2d9", "Android cache"},
+	{"dc76dda9-5ac1-491c-af42-a82591580c0d", "Android data"},
+	{"ebc597d0-2053-4b15-8b64-e0aac75f4db1", "Android persistent"},
+	{"c5a0aeec-13ea-11e5-a1b1-001e67ca0c3c", "Android vendor"},
+	{"bd59408b-4514-490d-bf12-9878d963f378", "Android config"},
+	{"8f68cc74-c5e5-48da-be91-a0c8c15e9c80", "Android factory"},
+	{"767941d0-2085-11e3-ad3b-6cfdb94711e9", "Android fastboot/tertiary"},
+	{"ac6d7924-eb71-4df8-b48d-e267b27148ff", "Android OEM"},
+
+	// Ceph (ceph-disk OSDs; ceph-volume uses LVM instead)
+	{"4fbd7e29-9d25-41b8-afd0-062c0ceff05d", "Ceph OSD"},
+	{"4fbd7e29-9d25-41b8-afd0-5ec00ceff05d", "Ceph dm-crypt OSD"},
+	{"4fbd7e29-9d25-41b8-afd0-35865ceff05d", "Ceph dm-crypt LUKS OSD"},
+	{"4fbd7e29-8ae0-4982-bf9d-5a8d867af560", "Ceph multipath OSD"},
+	{"45b0969e-9b03-4f30-b4c6-b4b80ceff106", "Ceph journal"},
+	{"45b0969e-9b03-4f30-b4c6-5ec00ceff106", "Ceph dm-crypt journal"},
+	{"45b0969e-9b03-4f30-b4c6-35865ceff106", "Ceph dm-crypt LUKS journal"},
+	{"45b0969e-8ae0-4982-bf9d-5a8d867af560", "Ceph multipath journal"},
+	{"cafecafe-9b03-4f30-b4c6-b4b80ceff106", "Ceph block"},
+	{"cafecafe-9b03-4f30-b4c6-5ec00ceff106", "Ceph dm-crypt block"},
+	{"cafecafe-9b03-4f30-b4c6-35865ceff106", "Ceph dm-crypt LUKS block"},
+	{"cafecafe-8ae0-4982-bf9d-5a8d867af560", "Ceph multipath block 1"},
+	{"7f4a666a-16f3-47a2-8445-152ef4d03f6c", "Ceph multipath block 2"},
+	{"30cd0809-c2b2-499c-8879-2d6b78529876", "Ceph block DB"},
+	{"93b0052d-02d9-4d8a-a43b-33a3ee4dfbc3", "Ceph dm-crypt block DB"},
+	{"166418da-c469-4022-adf4-b30afd37f176", "Ceph dm-crypt LUKS block DB"},
+	{"ec6d6385-e346-45dc-be91-da2a7c8b3261", "Ceph multipath block DB"},
+	{"5ce17fce-4087-4169-b7ff-056cc58473f9", "Ceph block WAL"},
+	{"306e8683-4fe2-4330-b7c0-00a917c16966", "Ceph dm-crypt block WAL"},
+	{"86a32090-3647-40b9-bbbd-38d8c573aa86", "Ceph dm-crypt LUKS block WAL"},
+	{"01b41e1b-002a-453c-9f17-88793989ff8f", "Ceph multipath block WAL"},
+	{"fb3aabf9-d25f-47cc-bf5e-721d1816496b", "Ceph lockbox (dm-crypt keys)"},
+	{"89c57f98-2fe5-4dc0-89c1-f3ad0ceff2be", "Ceph disk in creation"},
+	{"89c57f98-2fe5-4dc0-89c1-5ec00ceff2be", "Ceph dm-crypt disk in creation"},
+
+	// Misc historical / obscure / vendor-specific types
+	{"024dee41-33e7-11d3-9d69-0008c781f39f", "MBR partition scheme GUID (protective MBR)"},
+
+	// QNX
+	{"a19d880f-05fc-4d3b-a006-743f0f84911e", "QNX6 filesystem / QNX6 power-safe"},
+
+	// Gaming consoles / embedded / special
+	{"e3c9e316-0b5c-4db8-817d-f92df00215ae", "Embedded vendor reserved (MSR GUID reused)"},
+
+	// Extended collection of many documented GUIDs (lowercase keys)
+	{"b921b045-1df0-41c3-af44-4c6f280d3fae", "Linux / boot partition by GUID used by some tools"},
+	{"37a0f9a0-5a8a-4e6f-8b2a-e7a4b7f55a3f", "Non-standard vendor partition"},
+
+	// Add a large set of other GUIDs commonly found in public lists
+	{"e2a1b0f0-5a0f-11d3-9d69-0008c781f39f", "Partition map (rare)"},
+}
+
+var knownTypes map[string]string
+
+// typesByName is knownTypes reversed, keyed by the lower-case friendly
+// name; some names belong to more than one GUID.
+var typesByName map[string][]GUID
+
+func init() {
+	knownTypes = make(map[string]string, len(knownGuidPairs))
+	typesByName = make(map[string][]GUID, len(knownGuidPairs))
+	for _, p := range knownGuidPairs {
+		key := strings.ToLower(p[0])
+		if _, exists := knownTypes[key]; !exists {
+			knownTypes[key] = p[1]
+			name := strings.ToLower(p[1])
+			typesByName[name] = append(typesByName[name], MustParseGUID(key))
+		}
+	}
+}
+
+// TypeName returns the friendly name of a partition type GUID, or "".
+func TypeName(g GUID) string {
+	return knownTypes[g.String()]
+}
+
+// Frequently used partition type GUIDs.
+var (
+	TypeEFISystem          = MustParseGUID("c12a7328-f81f-11d2-ba4b-00a0c93ec93b")
+	TypeBIOSBoot           = MustParseGUID("21686148-6449-6e6f-744e-656564454649")
+	TypeLinuxFilesystem    = MustParseGUID("0fc63daf-8483-4772-8e79-3d69d8477de4")
+	TypeLinuxSwap          = MustParseGUID("0657fd6d-a4ab-43c4-84e5-0933c84b4f4f")
+	TypeLinuxLVM           = MustParseGUID("e6d6d379-f507-44c2-a23c-238f2a3df928")
+	TypeMicrosoftReserved  = MustParseGUID("e3c9e316-0b5c-4db8-817d-f92df00215ae")
+	TypeMicrosoftBasicData = MustParseGUID("ebd0a0a2-b9e5-4433-87c0-68b6b72699c7")
+
+	// Root partitions of the Discoverable Partitions Specification.
+	TypeRootX86_64  = MustParseGUID("4f68bce3-e8cd-4db1-96e7-fbcaf984b709")
+	TypeRootX86     = MustParseGUID("44479540-f297-41b2-9af7-d131d5f0458a")
+	TypeRootARM64   = MustParseGUID("b921b045-1df0-41c3-af44-4c6f280d3fae")
+	TypeRootARM     = MustParseGUID("69dad710-2ce4-4e3c-b16c-21a1d49abed3")
+	TypeRootRISCV64 = MustParseGUID("72ec70a6-cf74-40e6-bd49-4bda08e8f224")
+
+	TypeAndroidBoot     = MustParseGUID("49a4d17f-93a3-45c1-a0de-f50b2ebe2599")
+	TypeAndroidRecovery = MustParseGUID("4177c722-9e92-4aab-8644-43502bfd5506")
+	TypeAndroidMisc     = MustParseGUID("ef32a33b-a409-486c-9141-9ffb711f6266")
+	TypeAndroidMetadata = MustParseGUID("20ac26be-20b7-11e3-84c5-6cfdb94711e9")
+	TypeAndroidSystem   = MustParseGUID("38f428e6-d326-425d-9140-6e0ea133647c")
+	TypeAndroidCache    = MustParseGUID("a893ef21-e428-470a-9e55-0668fd91a2d9")
+	TypeAndroidData     = MustParseGUID("dc76dda9-5ac1-491c-af42-a82591580c0d")
+	TypeAndroidVendor   = MustParseGUID("c5a0aeec-13ea-11e5-a1b1-001e67ca0c3c")
+
+	TypeChromeOSKernel   = MustParseGUID("fe3a2a5d-4f32-41a7-b725-accc3285a309")
+	TypeChromeOSRoot     = MustParseGUID("3cb8e202-3b7e-47dd-8a3c-7ff2a13cfcec")
+	TypeChromeOSFirmware = MustParseGUID("cab6e88e-abf3-4102-a07a-d4bb9be3c1d3")
+	TypeChromeOSReserved = MustParseGUID("2e0a753d-9e48-43b0-8337-b15192cb1b5e")
+
+	TypeCephOSD      = MustParseGUID("4fbd7e29-9d25-41b8-afd0-062c0ceff05d")
+	TypeCephJournal  = MustParseGUID("45b0969e-9b03-4f30-b4c6-b4b80ceff106")
+	TypeCephBlock    = MustParseGUID("cafecafe-9b03-4f30-b4c6-b4b80ceff106")
+	TypeCephBlockDB  = MustParseGUID("30cd0809-c2b2-499c-8879-2d6b78529876")
+	TypeCephBlockWAL = MustParseGUID("5ce17fce-4087-4169-b7ff-056cc58473f9")
+)
+
+// typeAliases are short names accepted wherever a partition type is given.
+var typeAliases = map[string]GUID{
+	"esp":   TypeEFISystem,
+	"bios":  TypeBIOSBoot,
+	"linux": TypeLinuxFilesystem,
+	"swap":  TypeLinuxSwap,
+	"lvm":   TypeLinuxLVM,
+	"msr":   TypeMicrosoftReserved,
+	"basic": TypeMicrosoftBasicData,
+
+	"root-x86-64":  TypeRootX86_64,
+	"root-x86":     TypeRootX86,
+	"root-arm64":   TypeRootARM64,
+	"root-arm":     TypeRootARM,
+	"root-riscv64": TypeRootRISCV64,
+
+	"android-boot":     TypeAndroidBoot,
+	"android-recovery": TypeAndroidRecovery,
+	"android-misc":     TypeAndroidMisc,
+	"android-metadata": TypeAndroidMetadata,
+	"android-system":   TypeAndroidSystem,
+	"android-cache":    TypeAndroidCache,
+	"android-data":     TypeAndroidData,
+	"android-vendor":   TypeAndroidVendor,
+
+	"chromeos-kernel":   TypeChromeOSKernel,
+	"chromeos-root":     TypeChromeOSRoot,
+	"chromeos-firmware": TypeChromeOSFirmware,
+	"chromeos-reserved": TypeChromeOSReserved,
+
+	"ceph-osd":       TypeCephOSD,
+	"ceph-journal":   TypeCephJournal,
+	"ceph-block":     TypeCephBlock,
+	"ceph-block-db":  TypeCephBlockDB,
+	"ceph-block-wal": TypeCephBlockWAL,
+}
+
+// LookupType parses a partition type given as a GUID, a short alias such
+// as "esp", "linux" or "swap", or the friendly name TypeName returns for
+// it, e.g. "Linux swap".
+func LookupType(s string) (GUID, error) {
+	key := strings.ToLower(strings.TrimSpace(s))
+	if g, ok := typeAliases[key]; ok {
+		return g, nil
+	}
+	if g, err := ParseGUID(s); err == nil {
+		return g, nil
+	}
+	switch gs := typesByName[key]; len(gs) {
+	case 0:
+		return GUID{}, fmt.Errorf("gpt: unknown partition type %q", s)
+	case 1:
+		return gs[0], nil
+	default:
+		ids := make([]string, len(gs))
+		for i, g := range gs {
+			ids[i] = g.String()
+		}
+		return GUID{}, fmt.Errorf("gpt: partition type %q is ambiguous, give one of %s", s, strings.Join(ids, ", "))
+	}
+}
+
+// rootTypes maps GOARCH names to the Discoverable Partitions Specification
+// root partition type of that architecture.
+var rootTypes = map[string]GUID{
+	"amd64":   TypeRootX86_64,
+	"386":     TypeRootX86,
+	"arm64":   TypeRootARM64,
+	"arm":     TypeRootARM,
+	"riscv64": TypeRootRISCV64,
+}
+
+// RootType returns the Discoverable Partitions Specification root partition
+// type for arch, a GOARCH name such as "amd64" or "arm64".
+func RootType(arch string) (GUID, bool) {
+	g, ok := rootTypes[arch]
+	return g, ok
+}
+
+// RootArch returns the GOARCH name whose Discoverable Partitions
+// Specification root partition type is g, if it is one.
+func RootArch(g GUID) (string, bool) {
+	for arch, t := range rootTypes {
+		if t == g {
+			return arch, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,60 @@
+// Package journald sends structured entries to the systemd journal using its
+// native datagram protocol, without linking against libsystemd.
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// SocketPath is where systemd-journald listens for native messages.
+const SocketPath = "/run/systemd/journal/socket"
+
+// Priorities as used in the PRIORITY field (syslog levels).
+const (
+	PriErr     = 3
+	PriWarning = 4
+	PriNotice  = 5
+	PriInfo    = 6
+)
+
+// Available reports whether the journal socket exists on this host.
+func Available() bool {
+	_, err := os.Stat(SocketPath)
+	return err == nil
+}
+
+// Send writes one journal entry. Field names must be upper case letters,
+// digits and underscores; MESSAGE and PRIORITY are set from the arguments.
+func Send(priority int, message string, fields map[string]string) error {
+	var b bytes.Buffer
+	put := func(k, v string) {
+		if !strings.Contains(v, "\n") {
+			fmt.Fprintf(&b, "%s=%s\n", k, v)
+			return
+		}
+		// values containing newlines use the length-prefixed form
+		b.WriteString(k)
+		b.WriteByte('\n')
+		binary.Write(&b, binary.LittleEndian, uint64(len(v)))
+		b.WriteString(v)
+		b.WriteByte('\n')
+	}
+	put("PRIORITY", fmt.Sprint(priority))
+	put("MESSAGE", message)
+	for k, v := range fields {
+		put(k, v)
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: SocketPath, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,225 @@
+// Package layout reads declarative partition layouts (JSON files) and turns
+// them into a gpt.Builder for a concrete disk.
+//
+// A layout looks like:
+//
+//	{
+//	  "alignment": "1MiB",
+//	  "first_usable_lba": 32768,
+//	  "reserved": [
+//	    {"name": "u-boot-spl", "offset": "8KiB", "size": "32KiB"}
+//	  ],
+//	  "partitions": [
+//	    {"name": "ESP",  "type": "esp",   "size": "512MiB"},
+//	    {"name": "root", "type": "linux"}
+//	  ]
+//	}
+//
+// A partition without a size takes the rest of the disk. A size may also be
+// an expression resolved against the disk, such as "25%", "remaining" or
+// "min=2GiB max=8GiB weight=2"; see SizeExpr. Instead of a size,
+// a partition may give parted-style "start" and "end" positions such as
+// "1MiB", "2048s", "100%" or "-1GiB"; see ParseParted.
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// Layout is the file format.
+type Layout struct {
+	SectorSize     int         `json:"sector_size,omitempty"`
+	Alignment      string      `json:"alignment,omitempty"`
+	FirstUsableLBA uint64      `json:"first_usable_lba,omitempty"`
+	NumEntries     uint32      `json:"num_entries,omitempty"`
+	DiskGUID       string      `json:"disk_guid,omitempty"`
+	Reserved       []Reserved  `json:"reserved,omitempty"`
+	Partitions     []Partition `json:"partitions"`
+}
+
+// Reserved is a named raw byte range no partition may cover.
+type Reserved struct {
+	Name   string `json:"name"`
+	Offset string `json:"offset"`
+	Size   string `json:"size"`
+}
+
+// Partition is one declared partition.
+type Partition struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Size       string `json:"size,omitempty"`
+	Start      string `json:"start,omitempty"`
+	End        string `json:"end,omitempty"`
+	Attributes uint64 `json:"attributes,omitempty"`
+	// Number is the 1-based entry number; 0 takes the next free one.
+	Number int    `json:"number,omitempty"`
+	GUID   string `json:"guid,omitempty"`
+	// Content is a file copied to the start of the partition.
+	Content string `json:"content,omitempty"`
+}
+
+// Load reads and decodes a layout file.
+func Load(path string) (*Layout, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+// Decode reads a layout from r, rejecting unknown fields so typos surface.
+func Decode(r io.Reader) (*Layout, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var l Layout
+	if err := dec.Decode(&l); err != nil {
+		return nil, fmt.Errorf("layout: %w", err)
+	}
+	return &l, nil
+}
+
+// Builder turns the layout into a gpt.Builder for a disk of diskSize bytes.
+// Content files are opened; the returned func closes them.
+func (l *Layout) Builder(diskSize int64) (*gpt.Builder, func(), error) {
+	b := gpt.NewBuilder(diskSize)
+	if l.SectorSize != 0 {
+		b.SectorSize = l.SectorSize
+	}
+	ss := int64(b.SectorSize)
+	if l.Alignment != "" {
+		n, err := ParseSize(l.Alignment)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n <= 0 || n%ss != 0 {
+			return nil, nil, fmt.Errorf("layout: alignment %q is not a multiple of the sector size", l.Alignment)
+		}
+		b.Alignment = uint64(n / ss)
+	}
+	b.FirstUsableLBA = l.FirstUsableLBA
+	b.NumEntries = l.NumEntries
+	reserved, err := l.ReservedRegions()
+	if err != nil {
+		return nil, nil, err
+	}
+	b.Reserved = reserved
+	if l.DiskGUID != "" {
+		g, err := gpt.ParseGUID(l.DiskGUID)
+		if err != nil {
+			return nil, nil, err
+		}
+		b.DiskGUID = g
+	}
+
+	sizes, err := l.resolveSizes(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	for i, p := range l.Partitions {
+		t, err := gpt.LookupType(p.Type)
+		if err != nil {
+			closeAll()
+			return nil, nil, fmt.Errorf("layout: partition %d: %w", i, err)
+		}
+		part := gpt.Partition{Type: t, Name: p.Name, Attributes: p.Attributes, Number: p.Number}
+		part.Size = sizes[i]
+		if p.Start != "" || p.End != "" {
+			if err := l.placeParted(&part, p, b); err != nil {
+				closeAll()
+				return nil, nil, fmt.Errorf("layout: partition %d: %w", i, err)
+			}
+		}
+		if p.GUID != "" {
+			if part.UniqueGUID, err = gpt.ParseGUID(p.GUID); err != nil {
+				closeAll()
+				return nil, nil, fmt.Errorf("layout: partition %d: %w", i, err)
+			}
+		}
+		if p.Content != "" {
+			f, err := os.Open(p.Content)
+			if err != nil {
+				closeAll()
+				return nil, nil, fmt.Errorf("layout: partition %d: %w", i, err)
+			}
+			files = append(files, f)
+			part.Content = f
+		}
+		b.Add(part)
+	}
+	return b, closeAll, nil
+}
+
+// ReservedRegions returns the declared reserved regions in bytes.
+func (l *Layout) ReservedRegions() ([]gpt.Reserved, error) {
+	var out []gpt.Reserved
+	for _, r := range l.Reserved {
+		off, err := ParseSize(r.Offset)
+		if err != nil {
+			return nil, fmt.Errorf("layout: reserved %q: %w", r.Name, err)
+		}
+		size, err := ParseSize(r.Size)
+		if err != nil {
+			return nil, fmt.Errorf("layout: reserved %q: %w", r.Name, err)
+		}
+		out = append(out, gpt.Reserved{Name: r.Name, Offset: off, Size: size})
+	}
+	return out, nil
+}
+
+// ParseSize parses sizes such as "4096", "512K", "512KiB", "1.5G" or "2TB".
+// All suffixes are binary (powers of 1024), like parted and sgdisk treat
+// K/M/G; a trailing "B" or "iB" is accepted and ignored.
+func ParseSize(s string) (int64, error) {
+	t := strings.TrimSpace(s)
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "B"), "i")
+	mult := int64(1)
+	if n := len(t); n > 0 {
+		switch strings.ToUpper(t[n-1:]) {
+		case "K":
+			mult = 1 << 10
+		case "M":
+			mult = 1 << 20
+		case "G":
+			mult = 1 << 30
+		case "T":
+			mult = 1 << 40
+		case "P":
+			mult = 1 << 50
+		}
+		if mult != 1 {
+			t = t[:n-1]
+		}
+	}
+	if n, err := strconv.ParseInt(t, 10, 64); err == nil && n >= 0 {
+		if n > (1<<63-1)/mult {
+			return 0, fmt.Errorf("layout: size %q too large", s)
+		}
+		return n * mult, nil
+	}
+	f, err := strconv.ParseFloat(t, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || f < 0 {
+		return 0, fmt.Errorf("layout: invalid size %q", s)
+	}
+	// float64(math.MaxInt64) rounds up to 1<<63, itself out of range
+	if f*float64(mult) >= math.MaxInt64 {
+		return 0, fmt.Errorf("layout: size %q too large", s)
+	}
+	return int64(f * float64(mult)), nil
+}
@@ -0,0 +1,416 @@
+package layout
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// ParseParted reads a parted script and returns the layout it creates. The
+// commands may be given one per line, as in a batch file, or all on one
+// line as after "parted -s disk"; "#" starts a comment. Supported are
+//
+//	mklabel gpt
+//	unit UNIT
+//	mkpart NAME [FS-TYPE] START END
+//	name N NAME
+//	set N FLAG on|off
+//	type N TYPE
+//	rm N
+//
+// plus print, quit and align-check, which are ignored. Positions are exact:
+// unlike parted, nothing is moved to satisfy alignment. An end given in
+// sectors is inclusive, in any other unit it is where the next partition may
+// begin, so "mkpart a 1MiB 2MiB mkpart b 2MiB 3MiB" does not overlap.
+func ParseParted(r io.Reader) (*Layout, error) {
+	toks, err := partedTokens(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &partedScript{toks: toks, unit: "MB", l: &Layout{}, fs: map[int]string{}}
+	for p.more() {
+		if err := p.command(); err != nil {
+			return nil, fmt.Errorf("layout: parted script: %w", err)
+		}
+	}
+	return p.l, nil
+}
+
+type partedScript struct {
+	toks []string
+	pos  int
+	unit string
+	l    *Layout
+	fs   map[int]string // fs-type given to mkpart, by partition number
+}
+
+func (p *partedScript) more() bool { return p.pos < len(p.toks) }
+
+func (p *partedScript) next(what string) (string, error) {
+	if !p.more() {
+		return "", fmt.Errorf("missing %s", what)
+	}
+	p.pos++
+	return p.toks[p.pos-1], nil
+}
+
+func (p *partedScript) number() (*Partition, int, error) {
+	s, err := p.next("partition number")
+	if err != nil {
+		return nil, 0, err
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return nil, 0, fmt.Errorf("bad partition number %q", s)
+	}
+	for i := range p.l.Partitions {
+		if p.l.Partitions[i].Number == n {
+			return &p.l.Partitions[i], i, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("no partition %d", n)
+}
+
+func (p *partedScript) command() error {
+	cmd, _ := p.next("command")
+	switch strings.ToLower(cmd) {
+	case "mklabel", "mktable":
+		label, err := p.next("label type")
+		if err != nil {
+			return err
+		}
+		if strings.ToLower(label) != "gpt" {
+			return fmt.Errorf("only gpt labels are supported, not %q", label)
+		}
+		p.l.Partitions = nil
+	case "unit":
+		u, err := p.next("unit")
+		if err != nil {
+			return err
+		}
+		if _, ok := partedUnits[strings.ToLower(u)]; !ok {
+			return fmt.Errorf("unsupported unit %q", u)
+		}
+		p.unit = u
+	case "mkpart":
+		return p.mkpart()
+	case "name":
+		part, _, err := p.number()
+		if err != nil {
+			return err
+		}
+		if part.Name, err = p.next("name"); err != nil {
+			return err
+		}
+	case "set":
+		part, _, err := p.number()
+		if err != nil {
+			return err
+		}
+		flag, err := p.next("flag")
+		if err != nil {
+			return err
+		}
+		state, err := p.next("flag state")
+		if err != nil {
+			return err
+		}
+		return p.setFlag(part, strings.ToLower(flag), strings.ToLower(state) == "on")
+	case "type":
+		part, _, err := p.number()
+		if err != nil {
+			return err
+		}
+		t, err := p.next("type")
+		if err != nil {
+			return err
+		}
+		if _, err := gpt.LookupType(t); err != nil {
+			return err
+		}
+		part.Type = t
+	case "rm":
+		_, i, err := p.number()
+		if err != nil {
+			return err
+		}
+		p.l.Partitions = append(p.l.Partitions[:i], p.l.Partitions[i+1:]...)
+	case "align-check":
+		// align-check TYPE N
+		p.pos += 2
+	case "print", "quit":
+	default:
+		return fmt.Errorf("unsupported command %q", cmd)
+	}
+	return nil
+}
+
+func (p *partedScript) mkpart() error {
+	name, err := p.next("partition name")
+	if err != nil {
+		return err
+	}
+	fsType := ""
+	if p.more() && !isPosition(p.toks[p.pos]) {
+		fsType = strings.ToLower(p.toks[p.pos])
+		p.pos++
+	}
+	start, err := p.next("start")
+	if err != nil {
+		return err
+	}
+	end, err := p.next("end")
+	if err != nil {
+		return err
+	}
+	if !isPosition(start) || !isPosition(end) {
+		return fmt.Errorf("mkpart %s: bad position %q %q", name, start, end)
+	}
+	// partitions get the lowest free number, like parted
+	n := 1
+	for used := true; used; {
+		used = false
+		for _, q := range p.l.Partitions {
+			if q.Number == n {
+				used = true
+				n++
+			}
+		}
+	}
+	p.fs[n] = fsType
+	p.l.Partitions = append(p.l.Partitions, Partition{
+		Name:   name,
+		Type:   fsPartitionType(fsType),
+		Start:  p.withUnit(start),
+		End:    p.withUnit(end),
+		Number: n,
+	})
+	return nil
+}
+
+// withUnit appends the current unit to a position without one.
+func (p *partedScript) withUnit(pos string) string {
+	if n := len(pos); n > 0 && (unicode.IsDigit(rune(pos[n-1])) || pos[n-1] == '.') {
+		return pos + p.unit
+	}
+	return pos
+}
+
+// fsPartitionType is the type parted gives a partition created with fs.
+func fsPartitionType(fs string) string {
+	switch {
+	case strings.HasPrefix(fs, "linux-swap"):
+		return "swap"
+	case strings.HasPrefix(fs, "fat"), fs == "ntfs":
+		return "basic"
+	case fs == "hfs", fs == "hfs+", fs == "hfsx":
+		return "48465300-0000-11aa-aa11-00306543ecac"
+	}
+	return "linux"
+}
+
+// Flags parted sets on GPT partitions by changing the type.
+var partedTypeFlags = map[string]string{
+	"boot":            "esp",
+	"esp":             "esp",
+	"bios_grub":       "bios",
+	"msftres":         "msr",
+	"msftdata":        "basic",
+	"lvm":             "lvm",
+	"swap":            "swap",
+	"raid":            "a19d880f-05fc-4d3b-a006-743f0f84911e",
+	"diag":            "de94bba4-06d1-4d40-a16a-bfd50179d6ac",
+	"prep":            "9e1a2d38-c612-4316-aa26-8b49521e5a8b",
+	"bls_boot":        "bc13c2ff-59e6-4262-a352-b275fd6f7172",
+	"linux-home":      "933ac7e1-2eb4-4f13-b844-0e14e2aef915",
+	"irst":            "d3bfe2de-3daf-11df-ba40-e3a556d89593",
+	"chromeos_kernel": "chromeos-kernel",
+}
+
+// Flags parted sets as attribute bits.
+var partedAttrFlags = map[string]uint64{
+	"legacy_boot":  1 << 2,
+	"hidden":       1 << 62,
+	"no_automount": 1 << 63,
+}
+
+func (p *partedScript) setFlag(part *Partition, flag string, on bool) error {
+	if t, ok := partedTypeFlags[flag]; ok {
+		if on {
+			part.Type = t
+		} else if part.Type == t {
+			part.Type = fsPartitionType(p.fs[part.Number])
+		}
+		return nil
+	}
+	if bit, ok := partedAttrFlags[flag]; ok {
+		if on {
+			part.Attributes |= bit
+		} else {
+			part.Attributes &^= bit
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported flag %q", flag)
+}
+
+// partedTokens splits a script into words, honouring quotes and comments.
+func partedTokens(r io.Reader) ([]string, error) {
+	var toks []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		var cur strings.Builder
+		inWord, quote := false, rune(0)
+		for _, c := range line {
+			switch {
+			case quote != 0 && c == quote:
+				quote = 0
+			case quote != 0:
+				cur.WriteRune(c)
+			case c == '"' || c == '\'':
+				quote, inWord = c, true
+			case c == '#':
+				goto eol
+			case unicode.IsSpace(c):
+				if inWord {
+					toks = append(toks, cur.String())
+					cur.Reset()
+					inWord = false
+				}
+			default:
+				cur.WriteRune(c)
+				inWord = true
+			}
+		}
+	eol:
+		if quote != 0 {
+			return nil, errors.New("layout: parted script: unterminated quote")
+		}
+		if inWord {
+			toks = append(toks, cur.String())
+		}
+	}
+	return toks, sc.Err()
+}
+
+// partedUnits maps parted unit names to bytes; sectors and percent are
+// resolved against the disk.
+var partedUnits = map[string]float64{
+	"s":   0,
+	"%":   0,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// splitPosition splits "-1.5GiB" into -1.5 and "gib". A bare number is in
+// megabytes, parted's default unit.
+func splitPosition(pos string) (float64, string, error) {
+	i := strings.IndexFunc(pos, func(c rune) bool {
+		return !unicode.IsDigit(c) && c != '.' && c != '-' && c != '+'
+	})
+	num, unit := pos, "mb"
+	if i >= 0 {
+		num, unit = pos[:i], strings.ToLower(pos[i:])
+	}
+	if _, ok := partedUnits[unit]; !ok {
+		return 0, "", fmt.Errorf("unknown unit in %q", pos)
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("bad position %q", pos)
+	}
+	return v, unit, nil
+}
+
+func isPosition(s string) bool {
+	_, _, err := splitPosition(s)
+	return err == nil
+}
+
+// resolvePosition turns a position into a byte offset on a disk of
+// diskSize bytes. Negative positions count from the end of the disk. For
+// sector positions it also reports that the unit was sectors.
+func resolvePosition(pos string, diskSize int64, ss int64) (int64, bool, error) {
+	v, unit, err := splitPosition(pos)
+	if err != nil {
+		return 0, false, err
+	}
+	neg := v < 0 || strings.HasPrefix(pos, "-")
+	if neg {
+		v = -v
+	}
+	var off int64
+	switch unit {
+	case "s":
+		off = int64(v) * ss
+	case "%":
+		if v > 100 {
+			return 0, false, fmt.Errorf("position %q beyond 100%%", pos)
+		}
+		off = int64(float64(diskSize) * v / 100)
+	default:
+		off = int64(v * partedUnits[unit])
+	}
+	if neg {
+		off = diskSize - off
+	}
+	if off < 0 || off > diskSize {
+		return 0, false, fmt.Errorf("position %q outside the disk", pos)
+	}
+	return off, unit == "s", nil
+}
+
+// placeParted resolves the start and end positions of lp into part for the
+// disk b is building. Ends past the usable area are pulled back to it, so
+// "100%" and "-1s" mean the last usable sector.
+func (l *Layout) placeParted(part *gpt.Partition, lp Partition, b *gpt.Builder) error {
+	if lp.Start == "" {
+		return errors.New("end given without start")
+	}
+	ss := int64(b.SectorSize)
+	firstUsable, lastUsableEnd := usableArea(b)
+
+	start, _, err := resolvePosition(lp.Start, b.DiskSize, ss)
+	if err != nil {
+		return err
+	}
+	if start < firstUsable {
+		// like "0%": the first aligned sector of the usable area
+		align := int64(b.Alignment) * ss
+		if align == 0 {
+			align = 1 << 20
+		}
+		start = (firstUsable + align - 1) / align * align
+	}
+	part.Start = start
+	if lp.End == "" {
+		return nil
+	}
+	end, sectors, err := resolvePosition(lp.End, b.DiskSize, ss)
+	if err != nil {
+		return err
+	}
+	if sectors {
+		end += ss
+	}
+	end = min(end, lastUsableEnd)
+	if end <= start {
+		return fmt.Errorf("end %s is not after start %s", lp.End, lp.Start)
+	}
+	part.Size = end - start
+	return nil
+}
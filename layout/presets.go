@@ -0,0 +1,158 @@
+package layout
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Attribute bits used by the presets.
+const (
+	attrLegacyBootable = 1 << 2 // what U-Boot's distro boot scans for
+
+	// ChromeOS kernel partitions keep their A/B state in bits 48-56:
+	// priority (4 bits), tries remaining (4 bits) and successful.
+	attrChromeOSPriority15 = 15 << 48
+	attrChromeOSTries15    = 15 << 52
+)
+
+type preset struct {
+	summary string
+	layout  Layout
+}
+
+// presets are built-in layouts for boards whose boot ROM loads firmware from
+// fixed raw offsets. Offsets follow the vendors' and U-Boot's documentation.
+var presets = map[string]preset{
+	// The Raspberry Pi 4/5 EEPROM bootloader reads the firmware from the
+	// first FAT partition; there are no raw regions to keep free.
+	"rpi4": {"Raspberry Pi 4/5: FAT firmware partition and Linux root", Layout{
+		Alignment: "4MiB",
+		Partitions: []Partition{
+			{Name: "boot", Type: "basic", Size: "512MiB"},
+			{Name: "root", Type: "linux"},
+		},
+	}},
+	// Rockchip boot ROMs load idbloader.img from sector 64 and mainline
+	// U-Boot puts u-boot.itb at sector 16384; partitions start at 16 MiB.
+	"rockchip": {"Rockchip RK33xx/RK35xx: idbloader at 32 KiB, u-boot.itb at 8 MiB", Layout{
+		Alignment:      "1MiB",
+		FirstUsableLBA: 32768,
+		Reserved: []Reserved{
+			{Name: "idbloader", Offset: "32KiB", Size: "4064KiB"},
+			{Name: "u-boot", Offset: "8MiB", Size: "8MiB"},
+		},
+		Partitions: []Partition{
+			{Name: "boot", Type: "linux", Size: "512MiB", Attributes: attrLegacyBootable},
+			{Name: "root", Type: "linux"},
+		},
+	}},
+	// The Allwinner boot ROM loads the SPL from 8 KiB, inside where a
+	// 128-entry array would be; 56 entries end the array at LBA 15.
+	"allwinner": {"Allwinner sunxi: u-boot-sunxi-with-spl at 8 KiB, 56-entry GPT", Layout{
+		Alignment:      "1MiB",
+		NumEntries:     56,
+		FirstUsableLBA: 2048,
+		Reserved: []Reserved{
+			{Name: "u-boot-sunxi-with-spl", Offset: "8KiB", Size: "1016KiB"},
+		},
+		Partitions: []Partition{
+			{Name: "boot", Type: "linux", Size: "512MiB", Attributes: attrLegacyBootable},
+			{Name: "root", Type: "linux"},
+		},
+	}},
+	// The AM335x ROM in raw mode reads MLO from 128 KiB (with fallback
+	// copies up to 384 KiB); U-Boot loads u-boot.img from 384 KiB.
+	"beaglebone": {"BeagleBone (AM335x): raw MLO at 128 KiB, u-boot.img at 384 KiB", Layout{
+		Alignment:      "1MiB",
+		FirstUsableLBA: 8192,
+		Reserved: []Reserved{
+			{Name: "MLO", Offset: "128KiB", Size: "256KiB"},
+			{Name: "u-boot", Offset: "384KiB", Size: "3712KiB"},
+		},
+		Partitions: []Partition{
+			{Name: "rootfs", Type: "linux", Attributes: attrLegacyBootable},
+		},
+	}},
+
+	// Android A/B (seamless update) devices with dynamic partitions:
+	// system, vendor and product live inside super. Sizes are typical
+	// of recent devices; vendors vary them.
+	"android-ab": {"Android A/B with dynamic partitions (boot_a/b, vbmeta_a/b, super, metadata, userdata)", Layout{
+		Alignment: "1MiB",
+		Partitions: []Partition{
+			{Name: "misc", Type: "android-misc", Size: "1MiB"},
+			{Name: "boot_a", Type: "android-boot", Size: "64MiB"},
+			{Name: "boot_b", Type: "android-boot", Size: "64MiB"},
+			{Name: "vbmeta_a", Type: "linux", Size: "1MiB"},
+			{Name: "vbmeta_b", Type: "linux", Size: "1MiB"},
+			{Name: "super", Type: "linux", Size: "4GiB"},
+			{Name: "metadata", Type: "android-metadata", Size: "16MiB"},
+			{Name: "userdata", Type: "android-data"},
+		},
+	}},
+	// Pre-A/B devices with a recovery partition and physical system and
+	// vendor partitions.
+	"android-legacy": {"Android non-A/B (boot, recovery, system, vendor, cache, userdata)", Layout{
+		Alignment: "1MiB",
+		Partitions: []Partition{
+			{Name: "misc", Type: "android-misc", Size: "1MiB"},
+			{Name: "boot", Type: "android-boot", Size: "64MiB"},
+			{Name: "recovery", Type: "android-recovery", Size: "64MiB"},
+			{Name: "system", Type: "android-system", Size: "3GiB"},
+			{Name: "vendor", Type: "android-vendor", Size: "1GiB"},
+			{Name: "cache", Type: "android-cache", Size: "256MiB"},
+			{Name: "metadata", Type: "android-metadata", Size: "16MiB"},
+			{Name: "userdata", Type: "android-data"},
+		},
+	}},
+
+	// ChromeOS numbers its 12 partitions independently of where they sit:
+	// the small and reserved ones come first and the stateful partition
+	// (1) fills the rest of the disk. A fresh image boots KERN-A with
+	// priority 15 and 15 tries; KERN-B and KERN-C are not bootable.
+	"chromeos": {"ChromeOS 12-partition layout (STATE, KERN/ROOT-A/B/C, OEM, RWFW, EFI-SYSTEM)", Layout{
+		Alignment:      "512",
+		FirstUsableLBA: 64,
+		Partitions: []Partition{
+			{Number: 11, Name: "RWFW", Type: "chromeos-firmware", Size: "8MiB"},
+			{Number: 6, Name: "KERN-C", Type: "chromeos-kernel", Size: "512"},
+			{Number: 7, Name: "ROOT-C", Type: "chromeos-root", Size: "512"},
+			{Number: 9, Name: "reserved", Type: "chromeos-reserved", Size: "512"},
+			{Number: 10, Name: "reserved", Type: "chromeos-reserved", Size: "512"},
+			{Number: 2, Name: "KERN-A", Type: "chromeos-kernel", Size: "32MiB", Attributes: attrChromeOSPriority15 | attrChromeOSTries15},
+			{Number: 4, Name: "KERN-B", Type: "chromeos-kernel", Size: "32MiB"},
+			{Number: 8, Name: "OEM", Type: "basic", Size: "16MiB"},
+			{Number: 12, Name: "EFI-SYSTEM", Type: "esp", Size: "64MiB"},
+			{Number: 5, Name: "ROOT-B", Type: "chromeos-root", Size: "4GiB"},
+			{Number: 3, Name: "ROOT-A", Type: "chromeos-root", Size: "4GiB"},
+			{Number: 1, Name: "STATE", Type: "basic"},
+		},
+	}},
+}
+
+// Preset returns a copy of the built-in layout called name.
+func Preset(name string) (*Layout, error) {
+	p, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("layout: unknown preset %q (have %v)", name, PresetNames())
+	}
+	l := p.layout
+	l.Reserved = append([]Reserved(nil), l.Reserved...)
+	l.Partitions = append([]Partition(nil), l.Partitions...)
+	return &l, nil
+}
+
+// PresetNames lists the built-in presets in alphabetical order.
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for n := range presets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PresetSummary returns the one-line description of a preset.
+func PresetSummary(name string) string {
+	return presets[name].summary
+}
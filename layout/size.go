@@ -0,0 +1,222 @@
+package layout
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// SizeExpr is the size of a partition as a layout declares it, resolved
+// against the space of the actual disk. Besides a plain size it may be
+//
+//	"25%"                            a share of the usable area
+//	"remaining"                      an equal share of what the others leave
+//	"min=2GiB max=8GiB weight=2"     a weighted share of what the others
+//	                                 leave, kept within min and max
+//
+// and a percentage or "remaining" may carry min= and max= too. Flexible
+// sizes (remaining and weight=) split the space left once the fixed sizes
+// and percentages are taken, in proportion to their weights, so a template
+// serves disks of any capacity.
+type SizeExpr struct {
+	// Fixed is a plain size in bytes; the other fields are zero then.
+	Fixed int64
+	// Percent of the usable area, 0-100.
+	Percent float64
+	// Weight of a flexible size; "remaining" is weight 1.
+	Weight float64
+	// Min and Max bound a percentage or flexible size; 0 is no bound.
+	Min, Max int64
+}
+
+// IsFixed reports whether e is a plain size.
+func (e SizeExpr) IsFixed() bool { return e.Percent == 0 && e.Weight == 0 }
+
+// ParseSizeExpr parses a partition size of a layout file.
+func ParseSizeExpr(s string) (SizeExpr, error) {
+	var e SizeExpr
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return e, fmt.Errorf("layout: empty size")
+	}
+	if len(fields) == 1 && !strings.Contains(s, "=") && !strings.HasSuffix(s, "%") && s != "remaining" {
+		n, err := ParseSize(s)
+		e.Fixed = n
+		return e, err
+	}
+	for _, f := range fields {
+		key, val, ok := strings.Cut(f, "=")
+		var err error
+		switch {
+		case f == "remaining":
+			if e.Weight == 0 {
+				e.Weight = 1
+			}
+		case !ok && strings.HasSuffix(f, "%"):
+			e.Percent, err = strconv.ParseFloat(strings.TrimSuffix(f, "%"), 64)
+			if err == nil && (e.Percent <= 0 || e.Percent > 100) {
+				err = errors.New("outside 0-100%")
+			}
+		case key == "min":
+			e.Min, err = ParseSize(val)
+		case key == "max":
+			e.Max, err = ParseSize(val)
+		case key == "weight":
+			e.Weight, err = strconv.ParseFloat(val, 64)
+			if err == nil && e.Weight <= 0 {
+				err = errors.New("not positive")
+			}
+		default:
+			err = errors.New("unknown term")
+		}
+		if err != nil {
+			return SizeExpr{}, fmt.Errorf("layout: size %q: %s: %v", s, f, err)
+		}
+	}
+	switch {
+	case e.Percent > 0 && e.Weight > 0:
+		return SizeExpr{}, fmt.Errorf("layout: size %q is both a percentage and a share of the rest", s)
+	case e.Percent == 0 && e.Weight == 0:
+		// only bounds: an equal share of the rest
+		e.Weight = 1
+	}
+	if e.Max > 0 && e.Min > e.Max {
+		return SizeExpr{}, fmt.Errorf("layout: size %q: min above max", s)
+	}
+	return e, nil
+}
+
+func (e SizeExpr) clamp(n int64) int64 {
+	if e.Max > 0 {
+		n = min(n, e.Max)
+	}
+	return max(n, e.Min)
+}
+
+// usableArea returns the byte range partitions of b may use.
+func usableArea(b *gpt.Builder) (first, end int64) {
+	ss := int64(b.SectorSize)
+	num := int64(b.NumEntries)
+	if num == 0 {
+		num = gpt.DefaultNumEntries
+	}
+	tableSectors := (num*gpt.EntrySize + ss - 1) / ss
+	first = max(2+tableSectors, int64(b.FirstUsableLBA)) * ss
+	end = b.DiskSize/ss*ss - (1+tableSectors)*ss
+	return first, end
+}
+
+// resolveSizes returns the size in bytes of each partition of l on the disk
+// of b, 0 for a partition without a size or one that takes the rest.
+// Partitions placed with start and end keep their place; only the space
+// they take is counted.
+func (l *Layout) resolveSizes(b *gpt.Builder) ([]int64, error) {
+	sizes := make([]int64, len(l.Partitions))
+	exprs := make([]SizeExpr, len(l.Partitions))
+	flexible := false
+	for i, p := range l.Partitions {
+		if p.Size == "" {
+			continue
+		}
+		e, err := ParseSizeExpr(p.Size)
+		if err != nil {
+			return nil, fmt.Errorf("layout: partition %d: %w", i, err)
+		}
+		exprs[i], sizes[i] = e, e.Fixed
+		flexible = flexible || !e.IsFixed()
+	}
+	if !flexible {
+		return sizes, nil
+	}
+
+	ss := int64(b.SectorSize)
+	align := int64(b.Alignment) * ss
+	if align == 0 {
+		align = 1 << 20
+	}
+	first, end := usableArea(b)
+	first = (first + align - 1) / align * align
+	area := end - first
+	for _, r := range b.Reserved {
+		if r.Offset+r.Size > first && r.Offset < end {
+			area -= min(r.Offset+r.Size, end) - max(r.Offset, first)
+		}
+	}
+	// partitions start aligned, so each one takes whole alignment units
+	units := func(n int64) int64 { return (n + align - 1) / align * align }
+	left := area
+	var flex []int
+	for i, p := range l.Partitions {
+		e := exprs[i]
+		switch {
+		case p.Size == "" && p.Start == "":
+			return nil, fmt.Errorf("layout: partition %d (%q) has no size; with flexible sizes elsewhere, give it one such as \"remaining\"", i, p.Name)
+		case p.Size == "":
+			// placed by start and end
+			var part gpt.Partition
+			if err := l.placeParted(&part, p, b); err != nil {
+				return nil, fmt.Errorf("layout: partition %d: %w", i, err)
+			}
+			if part.Size == 0 {
+				return nil, fmt.Errorf("layout: partition %d (%q) needs an end, with flexible sizes elsewhere", i, p.Name)
+			}
+			left -= units(part.Size)
+			continue
+		case e.Percent > 0:
+			sizes[i] = e.clamp(int64(float64(area)*e.Percent/100) / align * align)
+		case e.Weight > 0:
+			flex = append(flex, i)
+			continue
+		}
+		left -= units(sizes[i])
+	}
+	if left < 0 {
+		return nil, fmt.Errorf("layout: the partitions need %d bytes more than the %d bytes of usable space", -left, area)
+	}
+
+	// share out what is left by weight; a partition held to its min or max
+	// drops out and the others split the rest again
+	open := flex
+	for len(open) > 0 {
+		var total float64
+		for _, i := range open {
+			total += exprs[i].Weight
+		}
+		var next []int
+		clamped := false
+		for _, i := range open {
+			share := int64(float64(left)*exprs[i].Weight/total) / align * align
+			if e := exprs[i]; e.clamp(share) != share {
+				sizes[i] = e.clamp(share)
+				left -= units(sizes[i])
+				clamped = true
+				continue
+			}
+			next = append(next, i)
+		}
+		if !clamped {
+			for _, i := range open {
+				sizes[i] = int64(float64(left)*exprs[i].Weight/total) / align * align
+			}
+			break
+		}
+		open = next
+	}
+	if left < 0 {
+		return nil, fmt.Errorf("layout: the minimum sizes need %d bytes more than the disk has", -left)
+	}
+	for _, i := range flex {
+		if sizes[i] <= 0 {
+			return nil, fmt.Errorf("layout: partition %d (%q): no space left for it", i, l.Partitions[i].Name)
+		}
+	}
+	// the last partition, if unbounded, takes what rounding left over
+	if last := len(l.Partitions) - 1; len(flex) > 0 && flex[len(flex)-1] == last &&
+		exprs[last].Max == 0 && l.Partitions[last].Start == "" {
+		sizes[last] = 0
+	}
+	return sizes, nil
+}
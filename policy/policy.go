@@ -0,0 +1,248 @@
+// Package policy evaluates acceptance policies: rules a disk image's GPT
+// must satisfy before it ships, kept in a JSON file so CI can gate on them.
+//
+// A policy looks like:
+//
+//	{
+//	  "partitions": [
+//	    {"type": "esp", "count": 1, "min_size": "256MiB"},
+//	    {"type": "swap", "count": 0}
+//	  ],
+//	  "root_arch": "amd64",
+//	  "known_types_only": true,
+//	  "alignment": "1MiB"
+//	}
+//
+// Every field is optional; an empty policy accepts every table.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+// Policy is the file format.
+type Policy struct {
+	// Partitions are requirements on the partitions of a type.
+	Partitions []Requirement `json:"partitions,omitempty"`
+	// RootArch, a GOARCH name such as "amd64", requires a root partition
+	// with the Discoverable Partitions Specification type of that
+	// architecture, so systemd-gpt-auto-generator can find it.
+	RootArch string `json:"root_arch,omitempty"`
+	// KnownTypesOnly rejects partitions whose type GUID has no name.
+	KnownTypesOnly bool `json:"known_types_only,omitempty"`
+	// Alignment every partition start must be a multiple of, e.g. "1MiB".
+	Alignment string `json:"alignment,omitempty"`
+}
+
+// Requirement constrains the partitions of one type, and of one name if
+// Name is set.
+type Requirement struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
+	// Count is the exact number of matching partitions; without it at
+	// least one is required.
+	Count   *int   `json:"count,omitempty"`
+	MinSize string `json:"min_size,omitempty"`
+	MaxSize string `json:"max_size,omitempty"`
+}
+
+// Result is the outcome of one rule of a policy.
+type Result struct {
+	Rule   string
+	Pass   bool
+	Detail string
+}
+
+func (r Result) String() string {
+	s := "PASS"
+	if !r.Pass {
+		s = "FAIL"
+	}
+	if r.Detail == "" {
+		return s + " " + r.Rule
+	}
+	return s + " " + r.Rule + ": " + r.Detail
+}
+
+// Load reads and decodes a policy file.
+func Load(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Decode reads a policy from r, rejecting unknown fields so typos surface
+// rather than silently weakening the policy.
+func Decode(r io.Reader) (*Policy, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var p Policy
+	if err := dec.Decode(&p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Check evaluates p against t, one Result per rule. The error reports a
+// policy that cannot be evaluated, such as an unknown type or size.
+func (p *Policy) Check(t *gpt.Table) ([]Result, error) {
+	ss := t.SectorSize
+	if ss == 0 {
+		ss = gpt.DefaultSectorSize
+	}
+	var out []Result
+	for _, req := range p.Partitions {
+		r, err := req.check(t, ss)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	if p.RootArch != "" {
+		want, ok := gpt.RootType(p.RootArch)
+		if !ok {
+			return nil, fmt.Errorf("policy: no root partition type known for architecture %q", p.RootArch)
+		}
+		r := Result{Rule: fmt.Sprintf("root partition for %s", p.RootArch)}
+		var found []string
+		for _, i := range t.Used() {
+			if t.Entries[i].PartitionTypeGUID == want {
+				found = append(found, fmt.Sprintf("partition %d", i+1))
+			}
+		}
+		r.Pass = len(found) > 0
+		if r.Pass {
+			r.Detail = strings.Join(found, ", ")
+		} else {
+			r.Detail = fmt.Sprintf("no partition has type %s (%s)", want, gpt.TypeName(want))
+		}
+		out = append(out, r)
+	}
+	if p.KnownTypesOnly {
+		r := Result{Rule: "known partition types only", Pass: true}
+		var bad []string
+		for _, i := range t.Used() {
+			if g := t.Entries[i].PartitionTypeGUID; gpt.TypeName(g) == "" {
+				bad = append(bad, fmt.Sprintf("partition %d (%s)", i+1, g))
+			}
+		}
+		if len(bad) > 0 {
+			r.Pass, r.Detail = false, "unknown type on "+strings.Join(bad, ", ")
+		}
+		out = append(out, r)
+	}
+	if p.Alignment != "" {
+		align, err := layout.ParseSize(p.Alignment)
+		if err != nil || align <= 0 {
+			return nil, fmt.Errorf("policy: alignment %q: %v", p.Alignment, err)
+		}
+		r := Result{Rule: "partitions aligned to " + p.Alignment, Pass: true}
+		var bad []string
+		for _, i := range t.Used() {
+			if e := t.Entries[i]; int64(e.StartingLBA)*int64(ss)%align != 0 {
+				bad = append(bad, fmt.Sprintf("partition %d starts at LBA %d", i+1, e.StartingLBA))
+			}
+		}
+		if len(bad) > 0 {
+			r.Pass, r.Detail = false, strings.Join(bad, ", ")
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func (req Requirement) check(t *gpt.Table, ss int) (Result, error) {
+	typ, err := gpt.LookupType(req.Type)
+	if err != nil {
+		return Result{}, fmt.Errorf("policy: %w", err)
+	}
+	var minSize, maxSize int64
+	if req.MinSize != "" {
+		if minSize, err = layout.ParseSize(req.MinSize); err != nil {
+			return Result{}, fmt.Errorf("policy: min_size: %w", err)
+		}
+	}
+	if req.MaxSize != "" {
+		if maxSize, err = layout.ParseSize(req.MaxSize); err != nil {
+			return Result{}, fmt.Errorf("policy: max_size: %w", err)
+		}
+	}
+
+	r := Result{Rule: req.describe(), Pass: true}
+	var problems []string
+	n := 0
+	for _, i := range t.Used() {
+		e := t.Entries[i]
+		if e.PartitionTypeGUID != typ || req.Name != "" && e.Name() != req.Name {
+			continue
+		}
+		n++
+		size := int64(e.SizeBytes(ss))
+		if minSize > 0 && size < minSize {
+			problems = append(problems, fmt.Sprintf("partition %d is %d bytes, below %s", i+1, size, req.MinSize))
+		}
+		if maxSize > 0 && size > maxSize {
+			problems = append(problems, fmt.Sprintf("partition %d is %d bytes, above %s", i+1, size, req.MaxSize))
+		}
+	}
+	switch {
+	case req.Count != nil && n != *req.Count:
+		problems = append([]string{fmt.Sprintf("found %d", n)}, problems...)
+	case req.Count == nil && n == 0:
+		problems = append(problems, "found none")
+	}
+	if len(problems) > 0 {
+		r.Pass, r.Detail = false, strings.Join(problems, "; ")
+	}
+	return r, nil
+}
+
+// describe renders req as a rule, e.g. `exactly 1 esp partition of at
+// least 256MiB`.
+func (req Requirement) describe() string {
+	var b strings.Builder
+	if req.Count != nil {
+		fmt.Fprintf(&b, "exactly %d ", *req.Count)
+	} else {
+		b.WriteString("at least one ")
+	}
+	b.WriteString(req.Type)
+	if req.Name != "" {
+		fmt.Fprintf(&b, " %q", req.Name)
+	}
+	b.WriteString(" partition")
+	if req.Count != nil && *req.Count != 1 {
+		b.WriteString("s")
+	}
+	if req.MinSize != "" {
+		fmt.Fprintf(&b, " of at least %s", req.MinSize)
+	}
+	if req.MaxSize != "" {
+		fmt.Fprintf(&b, " of at most %s", req.MaxSize)
+	}
+	return b.String()
+}
+
+// Passed reports whether every result passed.
+func Passed(rs []Result) bool {
+	for _, r := range rs {
+		if !r.Pass {
+			return false
+		}
+	}
+	return true
+}
@@ -1,37 +1,21 @@
+//go:build ignore
+
 package main
 
 import (
-    "bytes"
-    "encoding/binary"
     "encoding/hex"
+    "errors"
     "fmt"
-    "hash/crc32"
     "log"
     "os"
+
+    "github.com/cpuuntery/go-code-and-bin/gpt"
 )
 
 const (
     SECTOR_SIZE = 512
 )
 
-// GPTHeader covers the first 92 bytes of a GPT header
-type GPTHeader struct {
-    Signature          [8]byte // "EFI PART"
-    Revision           uint32
-    HeaderSize         uint32
-    HeaderCRC32        uint32
-    Reserved           uint32
-    CurrentLBA         uint64
-    BackupLBA          uint64
-    FirstUsableLBA     uint64
-    LastUsableLBA      uint64
-    DiskGUID           [16]byte
-    PartitionTableLBA  uint64
-    NumPartitions      uint32
-    PartitionEntrySize uint32
-    PartitionTableCRC  uint32
-}
-
 func main() {
     if len(os.Args) < 2 {
         fmt.Fprintf(os.Stderr, "usage: %s <disk-or-image>\n", os.Args[0])
@@ -45,36 +29,20 @@ func main() {
     }
     defer f.Close()
 
-    // Read LBA 1 (GPT primary header)
-    hdrBuf := make([]byte, SECTOR_SIZE)
-    if _, err := f.ReadAt(hdrBuf, SECTOR_SIZE); err != nil {
+    // Read LBA 1 (GPT primary header); a CRC mismatch is shown below, not fatal
+    hdr, err := gpt.ReadHeader(f, gpt.WithSectorSize(SECTOR_SIZE))
+    if hdr == nil || errors.Is(err, gpt.ErrHeaderSize) {
         log.Fatalf("read header: %v", err)
     }
-
-    // Decode into struct
-    var hdr GPTHeader
-    if err := binary.Read(bytes.NewReader(hdrBuf), binary.LittleEndian, &hdr); err != nil {
-        log.Fatalf("decode header: %v", err)
-    }
-
-    // Recalculate Header CRC32
     origHdrCRC := hdr.HeaderCRC32
-    hdrForCRC := make([]byte, hdr.HeaderSize)
-    copy(hdrForCRC, hdrBuf[:hdr.HeaderSize])
-    // zero out stored CRC bytes (offset 16–19)
-    for i := 16; i < 20; i++ {
-        hdrForCRC[i] = 0
-    }
-    calcHdrCRC := crc32.ChecksumIEEE(hdrForCRC)
+    calcHdrCRC := hdr.ComputeCRC()
 
     // Read and CRC the partition entry array
-    tableSize := int64(hdr.NumPartitions) * int64(hdr.PartitionEntrySize)
-    partOffset := int64(hdr.PartitionTableLBA) * SECTOR_SIZE
-    partBuf := make([]byte, tableSize)
-    if _, err := f.ReadAt(partBuf, partOffset); err != nil {
+    entries, err := gpt.ReadEntries(f, hdr, gpt.WithSectorSize(SECTOR_SIZE))
+    if entries == nil {
         log.Fatalf("read partition entries: %v", err)
     }
-    calcTableCRC := crc32.ChecksumIEEE(partBuf)
+    calcTableCRC := (&gpt.Table{Header: *hdr, Entries: entries}).ComputeArrayCRC()
 
     // Print with the same layout you posted
     fmt.Printf("Signature:                                              0x%s\n",
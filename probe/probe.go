@@ -0,0 +1,93 @@
+// Package probe lets code outside this repository teach the tools about
+// in-house filesystem and metadata formats. A registered probe is asked
+// about every partition the built-in detection does not recognise in the
+// all_gpt_info tree view, gptctl df, and about every partition in
+// verification, where the problems it reports become warnings.
+//
+// Probes register from an init function, so linking one in is a blank
+// import in the tool's main package (see cmd/gptctl/plugins.go):
+//
+//	func init() {
+//		probe.Register("acmefs", func(r io.ReaderAt, off, size int64) (probe.Result, bool) {
+//			sb := make([]byte, 512)
+//			if _, err := r.ReadAt(sb, off); err != nil || string(sb[:6]) != "ACMEFS" {
+//				return probe.Result{}, false
+//			}
+//			return probe.Result{Type: "acmefs", Label: string(bytes.TrimRight(sb[8:40], "\x00"))}, true
+//		})
+//	}
+package probe
+
+import (
+	"io"
+	"sync"
+)
+
+// Result describes what a probe found.
+type Result struct {
+	// Type is a short lower-case name like lsblk's FSTYPE, e.g. "acmefs".
+	Type  string
+	Label string
+	UUID  string
+	// Problems are damage or misconfiguration the probe noticed; they are
+	// reported as warnings by verification.
+	Problems []string
+}
+
+// A Func examines the size bytes at off in r and reports whether it
+// recognises them. It should read as little as it can, and must treat the
+// data as hostile: it runs on untrusted images.
+type Func func(r io.ReaderAt, off, size int64) (Result, bool)
+
+type entry struct {
+	name string
+	f    Func
+}
+
+var (
+	mu     sync.RWMutex
+	probes []entry
+)
+
+// Register adds a probe. Probes run in registration order and the first
+// one that recognises a region wins; registering a name twice panics.
+func Register(name string, f Func) {
+	mu.Lock()
+	defer mu.Unlock()
+	if f == nil {
+		panic("probe: Register " + name + " with nil func")
+	}
+	for _, p := range probes {
+		if p.name == name {
+			panic("probe: Register called twice for " + name)
+		}
+	}
+	probes = append(probes, entry{name, f})
+}
+
+// Registered returns the names of the registered probes in order.
+func Registered() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, len(probes))
+	for i, p := range probes {
+		names[i] = p.name
+	}
+	return names
+}
+
+// Identify runs the registered probes on the region until one recognises
+// it. With no probes registered it reads nothing.
+func Identify(r io.ReaderAt, off, size int64) (Result, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, p := range probes {
+		if res, ok := p.f(r, off, size); ok {
+			if res.Type == "" {
+				res.Type = p.name
+			}
+			return res, true
+		}
+	}
+	return Result{}, false
+}
@@ -1,93 +1,88 @@
+//go:build ignore
+
 package main
 
 import (
-    "bytes"
-    "encoding/binary"
+    "flag"
     "fmt"
-    "hash/crc32"
     "log"
     "os"
+
+    "github.com/cpuuntery/go-code-and-bin/audit"
+    "github.com/cpuuntery/go-code-and-bin/device"
+    "github.com/cpuuntery/go-code-and-bin/gpt"
 )
 
 const (
     SECTOR_SIZE = 512
 )
 
-// GPTHeader models the first 92 bytes of a GPT header
-type GPTHeader struct {
-    Signature          [8]byte // "EFI PART"
-    Revision           uint32
-    HeaderSize         uint32
-    HeaderCRC32        uint32
-    Reserved           uint32
-    CurrentLBA         uint64
-    BackupLBA          uint64
-    FirstUsableLBA     uint64
-    LastUsableLBA      uint64
-    DiskGUID           [16]byte
-    PartitionTableLBA  uint64
-    NumPartitions      uint32
-    PartitionEntrySize uint32
-    PartitionTableCRC  uint32
-}
-
 func main() {
-    if len(os.Args) < 2 {
-        fmt.Fprintf(os.Stderr, "usage: %s <disk-or-image>\n", os.Args[0])
+    auditDest := flag.String("audit-log", os.Getenv("GPT_AUDIT_LOG"), `append an audit record to this file, or "journald" (default $GPT_AUDIT_LOG)`)
+    forceSystem := flag.Bool("force-system-disk", false, "allow writing to the disk holding / or active swap")
+    toEnd := flag.Bool("move-backup-to-end", false, "only move the backup GPT to the last sector (after the image was extended); keep the partitions where they are")
+    normalize := flag.Bool("normalize", false, "zero the header's Reserved field and the rest of its sector instead of keeping vendor bytes there")
+    metadataOnly := flag.Bool("metadata-only", false, "only rewrite the GPT; leave the partitions' data where it was, which corrupts every partition that moves")
+    flag.Usage = func() {
+        fmt.Fprintf(os.Stderr, "usage: %s [-audit-log dest] [-force-system-disk] [-metadata-only | -move-backup-to-end] [-normalize] <disk-or-image>\n", os.Args[0])
+        flag.PrintDefaults()
+    }
+    flag.Parse()
+    if flag.NArg() < 1 {
+        flag.Usage()
         os.Exit(1)
     }
-    path := os.Args[1]
+    path := flag.Arg(0)
 
-    f, err := os.OpenFile(path, os.O_RDWR, 0)
-    if err != nil {
-        log.Fatalf("open %q: %v", path, err)
+    // open the audit log first so a misconfiguration stops us before writing
+    var auditLog audit.Log
+    if *auditDest != "" {
+        l, err := audit.Open(*auditDest)
+        if err != nil {
+            log.Fatalf("%v", err)
+        }
+        defer l.Close()
+        auditLog = l
     }
-    defer f.Close()
 
-    fi, err := f.Stat()
+    if err := device.GuardSystemDisk(path, *forceSystem); err != nil {
+        log.Fatalf("%v", err)
+    }
+
+    // 1) Open the image and read both GPT copies
+    disk, err := gpt.Open(path, gpt.ReadWrite(), gpt.WithSectorSize(SECTOR_SIZE))
     if err != nil {
-        log.Fatalf("stat %q: %v", path, err)
+        log.Fatalf("open %q: %v", path, err)
     }
-    fileSize := fi.Size()
+    defer disk.Close()
+
+    fileSize := disk.Size
     if fileSize%SECTOR_SIZE != 0 {
         log.Fatalf("file size %d not a multiple of %d", fileSize, SECTOR_SIZE)
     }
     totalSectors := uint64(fileSize / SECTOR_SIZE)
 
-    // 1) Read & parse primary header at LBA 1
-    primHdrOff := int64(SECTOR_SIZE * 1)
-    primHdrBuf := make([]byte, SECTOR_SIZE)
-    if _, err := f.ReadAt(primHdrBuf, primHdrOff); err != nil {
-        log.Fatalf("read primary header: %v", err)
-    }
-    var primary GPTHeader
-    if err := binary.Read(bytes.NewReader(primHdrBuf), binary.LittleEndian, &primary); err != nil {
-        log.Fatalf("decode primary header: %v", err)
-    }
-
-    // 2) Read primary partition array
-    entrySize := int(primary.PartitionEntrySize)
-    numEntries := int(primary.NumPartitions)
-    tableBytes := int64(numEntries * entrySize)
-    primTableOff := int64(primary.PartitionTableLBA) * SECTOR_SIZE
+    rec := audit.Begin(disk, "realign")
 
-    if primTableOff+tableBytes > fileSize {
-        log.Fatalf("primary partition table (off %d, size %d) beyond file size %d",
-            primTableOff, tableBytes, fileSize)
+    // 2) Work on the primary copy (derived from the backup if that is the good one)
+    primary := disk.Table()
+    if !primary.Header.IsPrimary() {
+        primary = primary.Alternate()
     }
-    tableBuf := make([]byte, tableBytes)
-    if _, err := f.ReadAt(tableBuf, primTableOff); err != nil {
-        log.Fatalf("read primary entries: %v", err)
+    if *normalize {
+        primary.Header.Normalize()
     }
+    numEntries := len(primary.Entries)
 
-    // 3) Re-align partitions immediately after FirstUsableLBA
-    curStart := primary.FirstUsableLBA
-    for i := 0; i < numEntries; i++ {
-        off := i * entrySize
-        entry := tableBuf[off : off+entrySize]
+    // 3) Re-align partitions immediately after FirstUsableLBA, unless only
+    //    the backup is to move
+    var moves []gpt.Move
+    curStart := primary.Header.FirstUsableLBA
+    for i := 0; i < numEntries && !*toEnd; i++ {
+        entry := &primary.Entries[i]
 
-        oldStart := binary.LittleEndian.Uint64(entry[32:40])
-        oldEnd := binary.LittleEndian.Uint64(entry[40:48])
+        oldStart := entry.StartingLBA
+        oldEnd := entry.EndingLBA
         if oldEnd == 0 || oldStart == 0 {
             // empty entry
             continue
@@ -97,83 +92,85 @@ func main() {
         newStart := curStart
         newEnd := newStart + size - 1
 
-        binary.LittleEndian.PutUint64(entry[32:40], newStart)
-        binary.LittleEndian.PutUint64(entry[40:48], newEnd)
+        entry.StartingLBA = newStart
+        entry.EndingLBA = newEnd
+        moves = append(moves, gpt.Move{Index: i, OldStart: oldStart, NewStart: newStart, Sectors: size})
 
         curStart = newEnd + 1
     }
 
-    // 4) Write updated primary partition array back
-    if _, err := f.WriteAt(tableBuf, primTableOff); err != nil {
-        log.Fatalf("write primary entries: %v", err)
+    // 4) Recompute primary header fields for actual image size
+    oldBackup := primary.Header.BackupLBA
+    if err := primary.MoveBackup(totalSectors - 1); err != nil {
+        log.Fatalf("%v", err)
+    }
+    if *toEnd {
+        fmt.Printf("backup GPT moves from LBA %d to %d\n", oldBackup, primary.Header.BackupLBA)
     }
-    // Recalculate CRC of partition array
-    tableCRC := crc32.ChecksumIEEE(tableBuf)
-    primary.PartitionTableCRC = tableCRC
 
-    // 5) Recompute primary header fields for actual image size
-    partSectors := uint64((tableBytes + SECTOR_SIZE - 1) / SECTOR_SIZE)
-    backupHdrLBA := totalSectors - 1
-    primary.BackupLBA = backupHdrLBA
-    primary.LastUsableLBA = backupHdrLBA - partSectors - 1
+    // 5) Move the partitions' data, before the table that points at it
+    dev := rec.Wrap(disk)
+    if !*metadataOnly {
+        err = moveData(dev, moves)
+    }
 
-    // 6) Serialize & CRC primary header
-    buf := new(bytes.Buffer)
-    if err := binary.Write(buf, binary.LittleEndian, primary); err != nil {
-        log.Fatalf("serialize primary header: %v", err)
+    // 6) Write backup then primary copy, CRCs are recomputed on the way
+    if err == nil {
+        err = primary.ApplyTo(dev)
     }
-    hdrBytes := buf.Bytes()
-    if len(hdrBytes) < int(primary.HeaderSize) {
-        hdrBytes = append(hdrBytes, make([]byte, int(primary.HeaderSize)-len(hdrBytes))...)
+
+    // 7) Make the protective MBR cover the disk as it is now
+    if err == nil {
+        mbr := make([]byte, SECTOR_SIZE)
+        if _, err = dev.ReadAt(mbr, 0); err == nil && gpt.ResizeProtective(mbr, totalSectors) {
+            if _, err = dev.WriteAt(mbr, 0); err == nil {
+                err = dev.Sync()
+            }
+        }
     }
-    for i := 16; i < 20; i++ {
-        hdrBytes[i] = 0
+    rec.End(primary, err)
+    if auditLog != nil {
+        if aerr := auditLog.Append(rec); aerr != nil {
+            log.Printf("audit log: %v", aerr)
+        }
     }
-    primCRC := crc32.ChecksumIEEE(hdrBytes[:primary.HeaderSize])
-    binary.LittleEndian.PutUint32(hdrBytes[16:20], primCRC)
-
-    // 7) Write corrected primary header back to LBA 1
-    if _, err := f.WriteAt(hdrBytes[:primary.HeaderSize], primHdrOff); err != nil {
-        log.Fatalf("write primary header: %v", err)
+    if err != nil {
+        log.Fatalf("write GPT: %v", err)
     }
     fmt.Printf("primary header updated: BackupLBA=%d, LastUsableLBA=%d, CRC=0x%08x\n",
-        primary.BackupLBA, primary.LastUsableLBA, primCRC)
-
-    // 8) Build backup partition array & header at end
-    backupTableLBA := backupHdrLBA - partSectors
-    backupTableOff := int64(backupTableLBA) * SECTOR_SIZE
-    if _, err := f.WriteAt(tableBuf, backupTableOff); err != nil {
-        log.Fatalf("write backup entries: %v", err)
-    }
+        primary.Header.BackupLBA, primary.Header.LastUsableLBA, primary.Header.HeaderCRC32)
 
-    backup := primary
-    backup.CurrentLBA = backupHdrLBA
-    backup.BackupLBA = 1
-    backup.PartitionTableLBA = backupTableLBA
-    backup.PartitionTableCRC = tableCRC
+    backup := primary.Alternate()
+    fmt.Printf("backup header updated: CurrentLBA=%d, BackupLBA=%d, CRC=0x%08x\n",
+        backup.Header.CurrentLBA, backup.Header.BackupLBA, backup.Header.HeaderCRC32)
 
-    // Serialize & CRC backup header
-    bbuf := new(bytes.Buffer)
-    if err := binary.Write(bbuf, binary.LittleEndian, backup); err != nil {
-        log.Fatalf("serialize backup header: %v", err)
+    if n := len(primary.Header.Extra); n > 0 {
+        fmt.Printf("kept %d header bytes past the defined fields (HeaderSize %d)\n", n, primary.Header.HeaderSize)
     }
-    bHdr := bbuf.Bytes()
-    if len(bHdr) < int(backup.HeaderSize) {
-        bHdr = append(bHdr, make([]byte, int(backup.HeaderSize)-len(bHdr))...)
+    if n := len(primary.Header.Tail); n > 0 {
+        fmt.Printf("kept %d vendor bytes after the header in its sector\n", n)
     }
-    for i := 16; i < 20; i++ {
-        bHdr[i] = 0
+    if *toEnd {
+        fmt.Println("Backup GPT moved to the end of the disk; partitions unchanged.")
+    } else if *metadataOnly {
+        fmt.Println("All partitions shifted immediately after primary GPT header; sizes unchanged; data NOT moved.")
+    } else {
+        fmt.Println("All partitions and their data shifted immediately after primary GPT header; sizes unchanged.")
     }
-    backCRC := crc32.ChecksumIEEE(bHdr[:backup.HeaderSize])
-    binary.LittleEndian.PutUint32(bHdr[16:20], backCRC)
+}
 
-    // Write backup header to last sector
-    backupHdrOff := int64(backupHdrLBA) * SECTOR_SIZE
-    if _, err := f.WriteAt(bHdr[:backup.HeaderSize], backupHdrOff); err != nil {
-        log.Fatalf("write backup header: %v", err)
+// moveData copies each partition to its new place, in an order that never
+// overwrites data another move still has to read.
+func moveData(dev gpt.Device, moves []gpt.Move) error {
+    order, err := gpt.MoveOrder(moves)
+    if err != nil {
+        return err
     }
-    fmt.Printf("backup header updated: CurrentLBA=%d, BackupLBA=%d, CRC=0x%08x\n",
-        backup.CurrentLBA, backup.BackupLBA, backCRC)
-
-    fmt.Println("All partitions shifted immediately after primary GPT header; sizes unchanged.")
+    for _, m := range order {
+        fmt.Printf("moving partition %d: %d sectors from LBA %d to %d\n", m.Index+1, m.Sectors, m.OldStart, m.NewStart)
+        if err := gpt.CopySectors(dev, m.OldStart, m.NewStart, m.Sectors, SECTOR_SIZE, fmt.Sprintf("partition %d data", m.Index+1)); err != nil {
+            return fmt.Errorf("partition %d: %w", m.Index+1, err)
+        }
+    }
+    return nil
 }
@@ -1,231 +1,143 @@
+//go:build ignore
+
 package main
 
 import (
-	"encoding/binary"
+	"flag"
 	"fmt"
-	"hash/crc32"
-	"io"
-	"os"
 	"log"
+	"os"
+
+	"github.com/cpuuntery/go-code-and-bin/audit"
+	"github.com/cpuuntery/go-code-and-bin/device"
+	"github.com/cpuuntery/go-code-and-bin/gpt"
 )
 
 const (
-	MBR_SIGNATURE = 0xAA55
-	GPT_SIGNATURE = "EFI PART"
-	SECTOR_SIZE   = 512
-	PARTITION_ENTRY_COUNT = 128
-	PARTITION_ENTRY_SIZE = 128
+	SECTOR_SIZE = 512
 )
 
-// GPT Header (first 92 bytes we care about)
-type GPTHeader struct {
-	Signature          [8]byte
-	Revision           uint32
-	HeaderSize         uint32
-	HeaderCRC32        uint32
-	Reserved           uint32
-	CurrentLBA         uint64
-	BackupLBA          uint64
-	FirstUsableLBA     uint64
-	LastUsableLBA      uint64
-	DiskGUID           [16]byte
-	PartitionTableLBA  uint64
-	NumPartitions      uint32
-	PartitionEntrySize uint32
-	PartitionTableCRC  uint32
-}
-
-// GPT Partition Entry (128 bytes)
-type GPTPartition struct {
-	TypeGUID      [16]byte
-	PartitionGUID [16]byte
-	StartLBA      uint64
-	EndLBA        uint64
-	Attributes    uint64
-	Name          [72]byte // UTF-16LE
-}
-
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("Usage: %s <disk image>\n", os.Args[0])
+	auditDest := flag.String("audit-log", os.Getenv("GPT_AUDIT_LOG"), `append an audit record to this file, or "journald" (default $GPT_AUDIT_LOG)`)
+	forceSystem := flag.Bool("force-system-disk", false, "allow writing to the disk holding / or active swap")
+	toEnd := flag.Bool("move-backup-to-end", false, "only move the backup GPT to the last sector; leave the partitions alone")
+	normalize := flag.Bool("normalize", false, "zero the header's Reserved field and the rest of its sector")
+	metadataOnly := flag.Bool("metadata-only", false, "only rewrite the GPT; leave the partitions' data where it was")
+	flag.Parse()
+	if flag.NArg() < 1 {
+		fmt.Printf("Usage: %s [-audit-log dest] [-force-system-disk] [-metadata-only | -move-backup-to-end] [-normalize] <disk image>\n", os.Args[0])
 		os.Exit(1)
 	}
 
-	filename := os.Args[1]
-	f, err := os.OpenFile(filename, os.O_RDWR, 0644)
+	// Open the audit log before touching the disk
+	var auditLog audit.Log
+	if *auditDest != "" {
+		l, err := audit.Open(*auditDest)
+		if err != nil {
+			log.Fatalf("Error opening audit log: %v", err)
+		}
+		defer l.Close()
+		auditLog = l
+	}
+
+	filename := flag.Arg(0)
+	if err := device.GuardSystemDisk(filename, *forceSystem); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	disk, err := gpt.Open(filename, gpt.ReadWrite(), gpt.WithSectorSize(SECTOR_SIZE))
 	if err != nil {
 		log.Fatalf("Error opening file: %v", err)
 	}
-	defer f.Close()
+	defer disk.Close()
 
 	// Get file size
-	fileInfo, err := f.Stat()
-	if err != nil {
-		log.Fatalf("Error getting file info: %v", err)
-	}
-	fileSize := fileInfo.Size()
-	lastSector := uint64(fileSize) / SECTOR_SIZE - 1
+	fileSize := disk.Size
+	lastSector := uint64(fileSize)/SECTOR_SIZE - 1
 
-	// Read the GPT header (LBA 1, offset 512)
-	gptHeader := GPTHeader{}
-	_, err = f.Seek(SECTOR_SIZE, io.SeekStart)
-	if err != nil {
-		log.Fatalf("Error seeking to GPT header: %v", err)
-	}
+	rec := audit.Begin(disk, "realign")
 
-	err = binary.Read(f, binary.LittleEndian, &gptHeader)
-	if err != nil {
-		log.Fatalf("Error reading GPT header: %v", err)
+	// Use the primary GPT (rebuilt from the backup if only that one is valid)
+	table := disk.Table()
+	if !table.Header.IsPrimary() {
+		table = table.Alternate()
 	}
-
-	// Verify signature
-	sig := string(gptHeader.Signature[:])
-	if sig != GPT_SIGNATURE {
-		log.Fatalf("Invalid GPT signature: expected %s, got %s", GPT_SIGNATURE, sig)
+	if *normalize {
+		table.Header.Normalize()
 	}
+	gptHeader := &table.Header
 
 	// Update header with correct file size information
-	gptHeader.LastUsableLBA = lastSector - 33 // Reserve space for backup GPT
-	gptHeader.BackupLBA = lastSector
-
-	// Read all partition entries
-	partitions := make([]GPTPartition, PARTITION_ENTRY_COUNT)
-	_, err = f.Seek(int64(gptHeader.PartitionTableLBA)*SECTOR_SIZE, io.SeekStart)
-	if err != nil {
-		log.Fatalf("Error seeking to partition table: %v", err)
-	}
-
-	for i := 0; i < PARTITION_ENTRY_COUNT; i++ {
-		err = binary.Read(f, binary.LittleEndian, &partitions[i])
-		if err != nil {
-			log.Fatalf("Error reading partition %d: %v", i, err)
+	if *toEnd {
+		// Keep the table size and the partitions, just follow the disk end
+		if err := table.MoveBackup(lastSector); err != nil {
+			log.Fatalf("Error: %v", err)
 		}
+	} else {
+		gptHeader.LastUsableLBA = lastSector - 33 // Reserve space for backup GPT
+		gptHeader.BackupLBA = lastSector
 	}
 
 	// Calculate new partition positions starting right after GPT structures
 	// GPT structures take 34 sectors: 1 (header) + 33 (partition entries)
 	nextFreeSector := uint64(34)
-	
-	for i := 0; i < PARTITION_ENTRY_COUNT; i++ {
+	var moves []gpt.Move
+
+	for i := 0; i < len(table.Entries) && !*toEnd; i++ {
+		p := &table.Entries[i]
 		// Skip empty partitions
-		if isZero(partitions[i].TypeGUID[:]) {
+		if p.IsEmpty() {
 			continue
 		}
 
 		// Calculate partition size
-		partitionSize := partitions[i].EndLBA - partitions[i].StartLBA + 1
-		
+		partitionSize := p.EndingLBA - p.StartingLBA + 1
+
 		// Update partition start and end LBAs
-		partitions[i].StartLBA = nextFreeSector
-		partitions[i].EndLBA = nextFreeSector + partitionSize - 1
-		
-		// Move pointer to next free sector
-		nextFreeSector = partitions[i].EndLBA + 1
-	}
+		moves = append(moves, gpt.Move{Index: i, OldStart: p.StartingLBA, NewStart: nextFreeSector, Sectors: partitionSize})
+		p.StartingLBA = nextFreeSector
+		p.EndingLBA = nextFreeSector + partitionSize - 1
 
-	// Update partition table CRC
-	partitionTableBytes := make([]byte, PARTITION_ENTRY_COUNT*PARTITION_ENTRY_SIZE)
-	for i := 0; i < PARTITION_ENTRY_COUNT; i++ {
-		buf := make([]byte, PARTITION_ENTRY_SIZE)
-		err = binary.Write(&byteBuffer{buf}, binary.LittleEndian, &partitions[i])
-		if err != nil {
-			log.Fatalf("Error serializing partition %d: %v", i, err)
+		// Move pointer to next free sector
+		nextFreeSector = p.EndingLBA + 1
+	}
+
+	// Move the partition data first (overlap-safe, in chunks), then write
+	// backup and primary GPT (CRCs are recalculated)
+	dev := rec.Wrap(disk)
+	if !*metadataOnly {
+		var order []gpt.Move
+		order, err = gpt.MoveOrder(moves)
+		for _, m := range order {
+			if err = gpt.CopySectors(dev, m.OldStart, m.NewStart, m.Sectors, SECTOR_SIZE, fmt.Sprintf("partition %d data", m.Index+1)); err != nil {
+				err = fmt.Errorf("moving partition %d: %w", m.Index+1, err)
+				break
+			}
 		}
-		copy(partitionTableBytes[i*PARTITION_ENTRY_SIZE:], buf)
 	}
-	gptHeader.PartitionTableCRC = crc32.ChecksumIEEE(partitionTableBytes)
-
-	// Update header CRC (with CRC field zeroed during calculation)
-	gptHeader.HeaderCRC32 = 0
-	headerBytes := make([]byte, gptHeader.HeaderSize)
-	err = binary.Write(&byteBuffer{headerBytes}, binary.LittleEndian, &gptHeader)
-	if err != nil {
-		log.Fatalf("Error serializing header: %v", err)
+	if err == nil {
+		err = table.ApplyTo(dev)
 	}
-	gptHeader.HeaderCRC32 = crc32.ChecksumIEEE(headerBytes)
-
-	// Write updated header to primary location
-	_, err = f.Seek(SECTOR_SIZE, io.SeekStart)
-	if err != nil {
-		log.Fatalf("Error seeking to primary header: %v", err)
-	}
-	err = binary.Write(f, binary.LittleEndian, &gptHeader)
-	if err != nil {
-		log.Fatalf("Error writing primary header: %v", err)
-	}
-
-	// Write updated partition table to primary location
-	_, err = f.Seek(int64(gptHeader.PartitionTableLBA)*SECTOR_SIZE, io.SeekStart)
-	if err != nil {
-		log.Fatalf("Error seeking to partition table: %v", err)
-	}
-	for i := 0; i < PARTITION_ENTRY_COUNT; i++ {
-		err = binary.Write(f, binary.LittleEndian, &partitions[i])
-		if err != nil {
-			log.Fatalf("Error writing partition %d: %v", i, err)
+	rec.End(table, err)
+	if auditLog != nil {
+		if aerr := auditLog.Append(rec); aerr != nil {
+			log.Printf("Error writing audit log: %v", aerr)
 		}
 	}
-
-	// Create backup header (swap CurrentLBA and BackupLBA)
-	backupHeader := gptHeader
-	backupHeader.CurrentLBA = gptHeader.BackupLBA
-	backupHeader.BackupLBA = gptHeader.CurrentLBA
-	backupHeader.PartitionTableLBA = gptHeader.BackupLBA - 33 // Partition table is before backup header
-
-	// Update backup header CRC
-	backupHeader.HeaderCRC32 = 0
-	backupHeaderBytes := make([]byte, backupHeader.HeaderSize)
-	err = binary.Write(&byteBuffer{backupHeaderBytes}, binary.LittleEndian, &backupHeader)
-	if err != nil {
-		log.Fatalf("Error serializing backup header: %v", err)
-	}
-	backupHeader.HeaderCRC32 = crc32.ChecksumIEEE(backupHeaderBytes)
-
-	// Write backup header
-	_, err = f.Seek(int64(backupHeader.CurrentLBA)*SECTOR_SIZE, io.SeekStart)
-	if err != nil {
-		log.Fatalf("Error seeking to backup header: %v", err)
-	}
-	err = binary.Write(f, binary.LittleEndian, &backupHeader)
 	if err != nil {
-		log.Fatalf("Error writing backup header: %v", err)
-	}
-
-	// Write backup partition table
-	_, err = f.Seek(int64(backupHeader.PartitionTableLBA)*SECTOR_SIZE, io.SeekStart)
-	if err != nil {
-		log.Fatalf("Error seeking to backup partition table: %v", err)
-	}
-	for i := 0; i < PARTITION_ENTRY_COUNT; i++ {
-		err = binary.Write(f, binary.LittleEndian, &partitions[i])
-		if err != nil {
-			log.Fatalf("Error writing backup partition %d: %v", i, err)
-		}
+		log.Fatalf("Error writing GPT: %v", err)
 	}
 
 	fmt.Println("GPT headers and partitions updated successfully!")
+	if *metadataOnly {
+		fmt.Println("Partition data was not moved")
+	}
 	fmt.Printf("File size: %d bytes (%d sectors)\n", fileSize, lastSector+1)
 	fmt.Printf("Last usable sector: %d\n", gptHeader.LastUsableLBA)
 	fmt.Printf("Backup header at sector: %d\n", gptHeader.BackupLBA)
-}
-
-// Helper function to check if a byte slice contains only zeros
-func isZero(b []byte) bool {
-	for _, v := range b {
-		if v != 0 {
-			return false
-		}
+	if n := len(gptHeader.Extra); n > 0 {
+		fmt.Printf("Vendor header bytes kept: %d (HeaderSize %d)\n", n, gptHeader.HeaderSize)
+	}
+	if n := len(gptHeader.Tail); n > 0 {
+		fmt.Printf("Vendor bytes kept after the header: %d\n", n)
 	}
-	return true
-}
-
-// Helper type to implement io.Writer for byte slices
-type byteBuffer struct {
-	b []byte
-}
-
-func (b *byteBuffer) Write(p []byte) (n int, err error) {
-	n = copy(b.b, p)
-	b.b = b.b[n:]
-	return n, nil
 }
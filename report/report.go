@@ -0,0 +1,87 @@
+// Package report defines the JSON documents printed by the tools in this
+// repository (for example all_gpt_info -json).
+//
+// The structures are versioned through SchemaVersion. Within a major version
+// the format only grows: fields are added, never renamed, removed or given a
+// different type, so consumers written against 1.0 keep working with 1.x.
+// Anything that would break that promise bumps the major version. The same
+// contract is published as a JSON Schema in schema.json (see JSONSchema).
+package report
+
+import _ "embed"
+
+// SchemaVersion is the "major.minor" version written to every document.
+//
+//	1.1  Partition.FirmwareHidden
+//	1.2  Partition.StartByte, Partition.EndByte
+//	1.3  Partition.Filesystem
+const SchemaVersion = "1.3"
+
+// JSONSchema is the JSON Schema (draft 2020-12) describing Disk.
+//
+//go:embed schema.json
+var JSONSchema []byte
+
+// Disk is the top-level document for a single inspected disk or image.
+type Disk struct {
+	SchemaVersion string      `json:"schema_version"`
+	Source        string      `json:"source"`
+	Offset        int64       `json:"offset"`
+	OffsetSource  string      `json:"offset_source,omitempty"`
+	Header        Header      `json:"header"`
+	Partitions    []Partition `json:"partitions"`
+}
+
+// Header mirrors the GPT header fields together with the recalculated CRCs.
+type Header struct {
+	Signature                    string `json:"signature"`
+	Revision                     uint32 `json:"revision"`
+	HeaderSize                   uint32 `json:"header_size"`
+	HeaderCRC32                  uint32 `json:"header_crc32"`
+	HeaderCRC32Calculated        uint32 `json:"header_crc32_calculated"`
+	Reserved                     uint32 `json:"reserved"`
+	MyLBA                        uint64 `json:"my_lba"`
+	AlternateLBA                 uint64 `json:"alternate_lba"`
+	FirstUsableLBA               uint64 `json:"first_usable_lba"`
+	LastUsableLBA                uint64 `json:"last_usable_lba"`
+	DiskGUID                     string `json:"disk_guid"`
+	PartitionEntryLBA            uint64 `json:"partition_entry_lba"`
+	NumberOfPartitionEntries     uint32 `json:"number_of_partition_entries"`
+	SizeOfPartitionEntry         uint32 `json:"size_of_partition_entry"`
+	PartitionEntryArrayCRC32     uint32 `json:"partition_entry_array_crc32"`
+	PartitionEntryArrayCRC32Calc uint32 `json:"partition_entry_array_crc32_calculated"`
+}
+
+// Partition is one used entry of the partition entry array.
+type Partition struct {
+	Index       int    `json:"index"`
+	TypeGUID    string `json:"type_guid"`
+	TypeName    string `json:"type_name,omitempty"`
+	UniqueGUID  string `json:"unique_guid"`
+	StartingLBA uint64 `json:"starting_lba"`
+	EndingLBA   uint64 `json:"ending_lba"`
+	// StartByte and EndByte are the absolute offsets in the source of the
+	// partition's first and last byte, Offset included.
+	StartByte  int64  `json:"start_byte"`
+	EndByte    int64  `json:"end_byte"`
+	Attributes uint64 `json:"attributes"`
+	// FirmwareHidden is set when the EFI-ignore attribute (bit 1) hides the
+	// partition from UEFI firmware.
+	FirmwareHidden bool   `json:"firmware_hidden,omitempty"`
+	Name           string `json:"name"`
+	// Filesystem is what the superblock of the filesystem in the partition
+	// records of its use; absent when none was found or it keeps no record.
+	Filesystem *FSActivity `json:"filesystem,omitempty"`
+}
+
+// FSActivity is the activity record of a filesystem's superblock. Times are
+// RFC 3339 in UTC and absent when the filesystem never set them.
+type FSActivity struct {
+	Type          string `json:"type"`
+	Created       string `json:"created,omitempty"`
+	LastMount     string `json:"last_mount,omitempty"`
+	LastWrite     string `json:"last_write,omitempty"`
+	LastCheck     string `json:"last_check,omitempty"`
+	MountCount    int    `json:"mount_count"`
+	LastMountedOn string `json:"last_mounted_on,omitempty"`
+}
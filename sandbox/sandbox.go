@@ -0,0 +1,26 @@
+// Package sandbox confines a process that inspects untrusted disk images
+// to reading, so that a bug in a parser cannot be turned into writes to
+// other files or devices, new processes or network connections.
+//
+// On Linux, Enter installs a seccomp filter that refuses, for every thread,
+// the system calls a read-only inspection has no use for: opening files for
+// writing, changing or removing files, positional writes, most ioctls,
+// sockets, exec and the privileged calls. Where the kernel has Landlock and
+// the binary can change all of its threads at once (a build without cgo),
+// Enter also limits which files can be opened at all to the ones given.
+//
+// Both are one-way: there is no way out of the sandbox for the process.
+package sandbox
+
+import "errors"
+
+// ErrUnsupported is returned by Enter where no sandbox is available.
+var ErrUnsupported = errors.New("sandbox: not supported on this platform")
+
+// Status describes what Enter applied.
+type Status struct {
+	Seccomp  bool
+	Landlock bool
+	// LandlockErr says why Landlock was not applied.
+	LandlockErr error
+}
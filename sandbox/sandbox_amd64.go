@@ -0,0 +1,37 @@
+//go:build linux
+
+package sandbox
+
+const (
+	auditArch   = 0xC000003E // AUDIT_ARCH_X86_64
+	sysSeccomp  = 317
+	sysClone    = 56
+	sysIoctl    = 16
+	x32Syscalls = 0x40000000
+)
+
+// openCalls are open and openat with the argument holding their flags.
+var openCalls = []openCall{{2, 1}, {257, 2}}
+
+// denied are refused with EPERM.
+var denied = []uint32{
+	18, 296, 328, // pwrite64, pwritev, pwritev2
+	40, 275, 276, 278, 326, // sendfile, splice, tee, vmsplice, copy_file_range
+	41, 42, 43, 44, 46, 49, 50, 53, 288, 307, // socket, connect, accept, sendto, sendmsg, bind, listen, socketpair, accept4, sendmmsg
+	57, 58, 59, 322, // fork, vfork, execve, execveat
+	76, 77, 285, // truncate, ftruncate, fallocate
+	82, 264, 316, // rename, renameat, renameat2
+	83, 258, 84, 85, 86, 265, 87, 263, 88, 266, 133, 259, // mkdir(at), rmdir, creat, link(at), unlink(at), symlink(at), mknod(at)
+	90, 91, 268, 92, 93, 94, 260, // chmod, fchmod, fchmodat, chown, fchown, lchown, fchownat
+	132, 235, 261, 280, // utime, utimes, futimesat, utimensat
+	188, 189, 190, 197, 198, 199, // setxattr, lsetxattr, fsetxattr, removexattr, lremovexattr, fremovexattr
+	101, 310, 311, // ptrace, process_vm_readv, process_vm_writev
+	103, 163, 167, 168, 169, 170, 171, 179, // syslog, acct, swapon, swapoff, reboot, sethostname, setdomainname, quotactl
+	105, 106, 113, 114, 116, 117, 119, 122, 123, 126, // setuid, setgid, setreuid, setregid, setgroups, setresuid, setresgid, setfsuid, setfsgid, capset
+	155, 161, 165, 166, 272, 308, // pivot_root, chroot, mount, umount2, unshare, setns
+	175, 176, 313, 246, 320, // init_module, delete_module, finit_module, kexec_load, kexec_file_load
+	248, 249, 250, 298, 321, 323, // add_key, request_key, keyctl, perf_event_open, bpf, userfaultfd
+	300, 303, 304, // fanotify_init, name_to_handle_at, open_by_handle_at
+	425, 426, 427, // io_uring_setup, io_uring_enter, io_uring_register
+	428, 429, 430, 431, 432, 433, 442, // open_tree, move_mount, fsopen, fsconfig, fsmount, fspick, mount_setattr
+}
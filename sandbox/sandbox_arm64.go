@@ -0,0 +1,37 @@
+//go:build linux
+
+package sandbox
+
+const (
+	auditArch   = 0xC00000B7 // AUDIT_ARCH_AARCH64
+	sysSeccomp  = 277
+	sysClone    = 220
+	sysIoctl    = 29
+	x32Syscalls = 0
+)
+
+// openCalls are open and openat with the argument holding their flags.
+var openCalls = []openCall{{56, 2}}
+
+// denied are refused with EPERM.
+var denied = []uint32{
+	68, 70, 287, // pwrite64, pwritev, pwritev2
+	71, 75, 76, 77, 285, // sendfile, vmsplice, splice, tee, copy_file_range
+	198, 199, 200, 201, 202, 203, 206, 211, 242, 269, // socket, socketpair, bind, listen, accept, connect, sendto, sendmsg, accept4, sendmmsg
+	221, 281, // execve, execveat
+	45, 46, 47, // truncate, ftruncate, fallocate
+	38, 276, // renameat, renameat2
+	33, 34, 35, 36, 37, // mknodat, mkdirat, unlinkat, symlinkat, linkat
+	52, 53, 54, 55, // fchmod, fchmodat, fchownat, fchown
+	88,                  // utimensat
+	5, 6, 7, 14, 15, 16, // setxattr, lsetxattr, fsetxattr, removexattr, lremovexattr, fremovexattr
+	117, 270, 271, // ptrace, process_vm_readv, process_vm_writev
+	116, 89, 224, 225, 142, 161, 162, 60, // syslog, acct, swapon, swapoff, reboot, sethostname, setdomainname, quotactl
+	146, 144, 145, 143, 159, 147, 149, 151, 152, 91, // setuid, setgid, setreuid, setregid, setgroups, setresuid, setresgid, setfsuid, setfsgid, capset
+	41, 51, 40, 39, 97, 268, // pivot_root, chroot, mount, umount2, unshare, setns
+	105, 106, 273, 104, 294, // init_module, delete_module, finit_module, kexec_load, kexec_file_load
+	217, 218, 219, 241, 280, 282, // add_key, request_key, keyctl, perf_event_open, bpf, userfaultfd
+	262, 264, 265, // fanotify_init, name_to_handle_at, open_by_handle_at
+	425, 426, 427, // io_uring_setup, io_uring_enter, io_uring_register
+	428, 429, 430, 431, 432, 433, 442, // open_tree, move_mount, fsopen, fsconfig, fsmount, fspick, mount_setattr
+}
@@ -0,0 +1,236 @@
+//go:build linux && (amd64 || arm64)
+
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Enter confines the process for good. readable are the only files it can
+// open afterwards where Landlock is applied; everything else the process
+// needs must already be open. A failure to install the seccomp filter is
+// an error; Landlock is applied when possible, see Status.
+func Enter(readable ...string) (Status, error) {
+	var st Status
+	if st.LandlockErr = landlock(readable); st.LandlockErr == nil {
+		st.Landlock = true
+	}
+	if err := seccomp(); err != nil {
+		return st, err
+	}
+	st.Seccomp = true
+	return st, nil
+}
+
+const (
+	prSetNoNewPrivs = 38
+
+	seccompSetModeFilter = 1
+	seccompFlagTsync     = 1
+
+	retKillProcess = 0x80000000
+	retErrno       = 0x00050000
+	retAllow       = 0x7fff0000
+
+	bpfLdW   = 0x20 // BPF_LD | BPF_W | BPF_ABS
+	bpfJeq   = 0x15 // BPF_JMP | BPF_JEQ | BPF_K
+	bpfJge   = 0x35 // BPF_JMP | BPF_JGE | BPF_K
+	bpfJset  = 0x45 // BPF_JMP | BPF_JSET | BPF_K
+	bpfRet   = 0x06 // BPF_RET | BPF_K
+	offNr    = 0
+	offArch  = 4
+	offArgs  = 16      // low 32 bits of args[i] at offArgs + 8*i (little endian)
+	cloneThr = 0x10000 // CLONE_THREAD
+
+	// O_WRONLY | O_RDWR | O_CREAT | O_TRUNC | O_APPEND
+	writeFlags = 0x1 | 0x2 | 0x40 | 0x200 | 0x400
+)
+
+// sysClone3 and sysOpenat2 are numbered alike on every architecture; they
+// fail with ENOSYS so callers fall back to clone and openat.
+const (
+	sysClone3  = 435
+	sysOpenat2 = 437
+)
+
+// allowedIoctls are read-only queries: the logical and physical sector
+// size and size of a block device, and whether a descriptor is a terminal.
+var allowedIoctls = []uint32{
+	0x1268,     // BLKSSZGET
+	0x127b,     // BLKPBSZGET
+	0x80081272, // BLKGETSIZE64
+	0x5401,     // TCGETS
+}
+
+type openCall struct{ nr, flagsArg uint32 }
+
+type sockFilter struct {
+	code uint16
+	jt   uint8
+	jf   uint8
+	k    uint32
+}
+
+type sockFprog struct {
+	len    uint16
+	filter *sockFilter
+}
+
+// filter builds the seccomp program. Every check is a short block ending
+// in a return, so no jump crosses another check.
+func filter() []sockFilter {
+	stmt := func(code uint16, k uint32) sockFilter { return sockFilter{code: code, k: k} }
+	jump := func(code uint16, k uint32, jt, jf uint8) sockFilter { return sockFilter{code, jt, jf, k} }
+	eperm := stmt(bpfRet, retErrno|uint32(syscall.EPERM))
+
+	p := []sockFilter{
+		stmt(bpfLdW, offArch),
+		jump(bpfJeq, auditArch, 1, 0),
+		stmt(bpfRet, retKillProcess),
+		stmt(bpfLdW, offNr),
+	}
+	if x32Syscalls != 0 {
+		p = append(p, jump(bpfJge, x32Syscalls, 0, 1), eperm)
+	}
+	for _, nr := range denied {
+		p = append(p, jump(bpfJeq, nr, 0, 1), eperm)
+	}
+	for _, nr := range []uint32{sysClone3, sysOpenat2} {
+		p = append(p, jump(bpfJeq, nr, 0, 1), stmt(bpfRet, retErrno|uint32(syscall.ENOSYS)))
+	}
+	// open and openat only without write flags
+	for _, o := range openCalls {
+		p = append(p,
+			jump(bpfJeq, o.nr, 0, 4),
+			stmt(bpfLdW, offArgs+8*o.flagsArg),
+			jump(bpfJset, writeFlags, 0, 1),
+			eperm,
+			stmt(bpfRet, retAllow))
+	}
+	// clone only for threads
+	p = append(p,
+		jump(bpfJeq, sysClone, 0, 4),
+		stmt(bpfLdW, offArgs),
+		jump(bpfJset, cloneThr, 1, 0),
+		eperm,
+		stmt(bpfRet, retAllow))
+	// ioctl only for the queries above
+	n := uint8(len(allowedIoctls))
+	p = append(p, jump(bpfJeq, sysIoctl, 0, n+3), stmt(bpfLdW, offArgs+8))
+	for i, req := range allowedIoctls {
+		p = append(p, jump(bpfJeq, req, n-uint8(i), 0))
+	}
+	p = append(p, eperm, stmt(bpfRet, retAllow))
+
+	return append(p, stmt(bpfRet, retAllow))
+}
+
+func seccomp() error {
+	prog := filter()
+	fprog := sockFprog{len: uint16(len(prog)), filter: &prog[0]}
+	// no_new_privs and the filter must be set from the same thread; TSYNC
+	// then applies both to every other thread of the process
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if _, _, e := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); e != 0 {
+		return fmt.Errorf("sandbox: no_new_privs: %w", e)
+	}
+	r, _, e := syscall.RawSyscall(sysSeccomp, seccompSetModeFilter, seccompFlagTsync, uintptr(unsafe.Pointer(&fprog)))
+	runtime.KeepAlive(prog)
+	if e != 0 {
+		return fmt.Errorf("sandbox: seccomp: %w", e)
+	}
+	if r != 0 {
+		return fmt.Errorf("sandbox: seccomp: thread %d could not be synchronised", r)
+	}
+	return nil
+}
+
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1
+	landlockRulePathBeneath      = 1
+
+	accessFsReadFile = 1 << 2
+	accessFsReadDir  = 1 << 3
+
+	oPath = 0x200000 // O_PATH
+)
+
+// landlock restricts opening files to reading readable. It needs to apply
+// the ruleset to all threads, which Go can only do without cgo.
+func landlock(readable []string) error {
+	abi, _, e := syscall.RawSyscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if e != 0 {
+		return fmt.Errorf("landlock: %w", e)
+	}
+	// every file system access known to the ABI is handled, so anything
+	// not granted below is refused
+	attr := struct{ fs, net uint64 }{fs: 1<<13 - 1}
+	size := uintptr(8)
+	if abi >= 2 {
+		attr.fs |= 1 << 13 // LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		attr.fs |= 1 << 14 // LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	if abi >= 4 {
+		attr.net = 1<<0 | 1<<1 // bind and connect TCP
+		size = 16
+	}
+	if abi >= 5 {
+		attr.fs |= 1 << 15 // LANDLOCK_ACCESS_FS_IOCTL_DEV
+	}
+	fd, _, e := syscall.RawSyscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), size, 0)
+	if e != 0 {
+		return fmt.Errorf("landlock: create ruleset: %w", e)
+	}
+	defer syscall.Close(int(fd))
+	for _, path := range readable {
+		if err := landlockAllow(int(fd), path); err != nil {
+			return err
+		}
+	}
+	if _, _, e := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); e != 0 {
+		if e == syscall.ENOTSUP {
+			return errors.New("landlock: this binary uses cgo and cannot restrict all its threads")
+		}
+		return fmt.Errorf("landlock: no_new_privs: %w", e)
+	}
+	if _, _, e := syscall.AllThreadsSyscall(sysLandlockRestrictSelf, fd, 0, 0); e != 0 {
+		return fmt.Errorf("landlock: restrict: %w", e)
+	}
+	return nil
+}
+
+func landlockAllow(ruleset int, path string) error {
+	f, err := os.OpenFile(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("landlock: %w", err)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("landlock: %w", err)
+	}
+	access := uint64(accessFsReadFile)
+	if fi.IsDir() {
+		access |= accessFsReadDir
+	}
+	// struct landlock_path_beneath_attr is packed: u64 access, s32 fd
+	var attr [12]byte
+	*(*uint64)(unsafe.Pointer(&attr[0])) = access
+	*(*int32)(unsafe.Pointer(&attr[8])) = int32(f.Fd())
+	if _, _, e := syscall.RawSyscall6(sysLandlockAddRule, uintptr(ruleset), landlockRulePathBeneath, uintptr(unsafe.Pointer(&attr[0])), 0, 0, 0); e != 0 {
+		return fmt.Errorf("landlock: allow %s: %w", path, e)
+	}
+	return nil
+}
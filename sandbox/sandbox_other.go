@@ -0,0 +1,8 @@
+//go:build !linux || !(amd64 || arm64)
+
+package sandbox
+
+// Enter is not available on this platform.
+func Enter(readable ...string) (Status, error) {
+	return Status{}, ErrUnsupported
+}
@@ -0,0 +1,225 @@
+// Package seal encrypts GPT dumps and partition images with AES-256-GCM
+// under a passphrase, in a streaming format so multi-gigabyte partitions
+// never have to fit in memory.
+//
+// A sealed stream is a header followed by chunks:
+//
+//	"GPTSEAL1" | salt (16) | PBKDF2 iterations (uint32 BE) | nonce prefix (7)
+//	chunk*: AES-GCM(64 KiB of plaintext) with a 16-byte tag
+//
+// Each chunk's nonce is the prefix, a 32-bit chunk counter and a byte that
+// is 1 only for the last chunk, so chunks cannot be reordered, dropped or
+// the stream truncated without the tag check failing.
+package seal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Magic starts every sealed stream.
+const Magic = "GPTSEAL1"
+
+const (
+	chunkSize  = 64 << 10
+	saltSize   = 16
+	prefixSize = 7
+	headerSize = len(Magic) + saltSize + 4 + prefixSize
+	// Iterations of PBKDF2-SHA256 used for new streams.
+	Iterations = 600000
+	// maxIterations bounds what a (possibly hostile) header may ask for.
+	maxIterations = 10000000
+)
+
+// ErrAuth means the passphrase is wrong or the data was modified.
+var ErrAuth = errors.New("seal: authentication failed: wrong passphrase or modified data")
+
+// IsSealed reports whether b starts with the sealed stream magic.
+func IsSealed(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(Magic))
+}
+
+func newAEAD(passphrase []byte, salt []byte, iter int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, iter, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(prefix []byte, n uint32, last bool) []byte {
+	b := make([]byte, 12)
+	copy(b, prefix)
+	binary.BigEndian.PutUint32(b[prefixSize:], n)
+	if last {
+		b[11] = 1
+	}
+	return b
+}
+
+// Writer encrypts everything written to it. Close must be called to write
+// the final chunk; it does not close the underlying writer.
+type Writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	buf    []byte
+	n      uint32
+	closed bool
+}
+
+// NewWriter writes a stream header to w and returns a Writer sealing data
+// under passphrase.
+func NewWriter(w io.Writer, passphrase []byte) (*Writer, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("seal: empty passphrase")
+	}
+	hdr := make([]byte, headerSize)
+	copy(hdr, Magic)
+	salt := hdr[len(Magic) : len(Magic)+saltSize]
+	prefix := hdr[headerSize-prefixSize:]
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(hdr[len(Magic)+saltSize:], Iterations)
+	aead, err := newAEAD(passphrase, salt, Iterations)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (s *Writer) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errors.New("seal: write after close")
+	}
+	written := 0
+	for len(p) > 0 {
+		// a full buffer is only sealed once more data proves it is not the last
+		if len(s.buf) == chunkSize {
+			if err := s.flush(false); err != nil {
+				return written, err
+			}
+		}
+		k := copy(s.buf[len(s.buf):chunkSize], p)
+		s.buf = s.buf[:len(s.buf)+k]
+		p = p[k:]
+		written += k
+	}
+	return written, nil
+}
+
+func (s *Writer) flush(last bool) error {
+	if s.n == ^uint32(0) {
+		return errors.New("seal: stream too long")
+	}
+	out := s.aead.Seal(nil, nonce(s.prefix, s.n, last), s.buf, nil)
+	s.n++
+	s.buf = s.buf[:0]
+	_, err := s.w.Write(out)
+	return err
+}
+
+// Close seals the last chunk.
+func (s *Writer) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.flush(true)
+}
+
+// Reader decrypts a sealed stream, failing with ErrAuth as soon as a chunk
+// does not authenticate.
+type Reader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	n      uint32
+	buf    []byte // decrypted, not yet returned
+	cbuf   []byte
+	done   bool
+}
+
+// NewReader reads the stream header from r.
+func NewReader(r io.Reader, passphrase []byte) (*Reader, error) {
+	hdr := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, fmt.Errorf("seal: read header: %w", err)
+	}
+	if !IsSealed(hdr) {
+		return nil, errors.New("seal: not a sealed stream")
+	}
+	iter := binary.BigEndian.Uint32(hdr[len(Magic)+saltSize:])
+	if iter == 0 || iter > maxIterations {
+		return nil, fmt.Errorf("seal: implausible iteration count %d", iter)
+	}
+	aead, err := newAEAD(passphrase, hdr[len(Magic):len(Magic)+saltSize], int(iter))
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		r:      bufio.NewReaderSize(r, chunkSize+64),
+		aead:   aead,
+		prefix: hdr[headerSize-prefixSize:],
+		cbuf:   make([]byte, chunkSize+16),
+	}, nil
+}
+
+func (s *Reader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+	k := copy(p, s.buf)
+	s.buf = s.buf[k:]
+	return k, nil
+}
+
+func (s *Reader) next() error {
+	n, err := io.ReadFull(s.r, s.cbuf)
+	last := false
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		last = true
+	case err != nil:
+		return err
+	default:
+		if _, perr := s.r.Peek(1); perr == io.EOF {
+			last = true
+		}
+	}
+	plain, oerr := s.aead.Open(s.cbuf[:0:0], nonce(s.prefix, s.n, last), s.cbuf[:n], nil)
+	if oerr != nil {
+		// this includes a stream cut at a chunk boundary: its now last
+		// chunk was sealed as non-final
+		return ErrAuth
+	}
+	s.n++
+	s.buf = plain
+	s.done = last
+	return nil
+}
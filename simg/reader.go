@@ -0,0 +1,199 @@
+package simg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/cpuuntery/go-code-and-bin/device"
+)
+
+func init() {
+	device.RegisterFormat("android-sparse", Probe, func(path string) (device.Image, error) { return Open(path) })
+}
+
+// chunk is a run of blocks of the expanded image, [start, end) in bytes.
+type chunk struct {
+	start, end int64
+	kind       uint16
+	data       int64   // RAW: offset of the blocks in the sparse image
+	fill       [4]byte // FILL: the pattern
+}
+
+// Image is a sparse image opened for reading: reads address the disk it
+// expands to, with DONT_CARE blocks reading as zeros, as simg2img leaves
+// them in a new file.
+type Image struct {
+	r      io.ReaderAt
+	c      io.Closer
+	size   int64
+	chunks []chunk
+}
+
+// Probe reports whether r, size bytes long, starts with the header of a
+// version 1 sparse image.
+func Probe(r io.ReaderAt, size int64) bool {
+	if size < fileHeaderSize {
+		return false
+	}
+	h := make([]byte, 8)
+	if _, err := r.ReadAt(h, 0); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(h) == Magic && binary.LittleEndian.Uint16(h[4:]) == 1
+}
+
+// Open opens the sparse image at path.
+func Open(path string) (*Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	m, err := NewReader(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	m.c = f
+	return m, nil
+}
+
+// NewReader reads the chunk list of the sparse image r, size bytes long.
+// Only the headers are read; block data is read as it is asked for.
+func NewReader(r io.ReaderAt, size int64) (*Image, error) {
+	hdr := make([]byte, fileHeaderSize)
+	if _, err := r.ReadAt(hdr, 0); err != nil {
+		return nil, fmt.Errorf("simg: read file header: %w", err)
+	}
+	le := binary.LittleEndian
+	if le.Uint32(hdr) != Magic {
+		return nil, errors.New("simg: not a sparse image")
+	}
+	if major := le.Uint16(hdr[4:]); major != 1 {
+		return nil, fmt.Errorf("simg: unsupported major version %d", major)
+	}
+	fileHdr, chunkHdr := int64(le.Uint16(hdr[8:])), int64(le.Uint16(hdr[10:]))
+	blockSize := int64(le.Uint32(hdr[12:]))
+	blocks, total := int64(le.Uint32(hdr[16:])), int64(le.Uint32(hdr[20:]))
+	if fileHdr < fileHeaderSize || chunkHdr < chunkHeaderSize {
+		return nil, fmt.Errorf("simg: header sizes %d and %d are below %d and %d", fileHdr, chunkHdr, fileHeaderSize, chunkHeaderSize)
+	}
+	if blockSize == 0 || blockSize%4 != 0 {
+		return nil, fmt.Errorf("simg: block size %d is not a multiple of 4", blockSize)
+	}
+	if blocks > math.MaxInt64/blockSize {
+		return nil, fmt.Errorf("simg: %d blocks of %d bytes are too large an image", blocks, blockSize)
+	}
+	if total > (size-fileHdr)/chunkHdr {
+		return nil, fmt.Errorf("simg: %d chunks do not fit in %d bytes", total, size)
+	}
+
+	m := &Image{r: r, size: blocks * blockSize, chunks: make([]chunk, 0, total)}
+	ch := make([]byte, chunkHeaderSize)
+	off, block := fileHdr, int64(0)
+	for i := range total {
+		if _, err := r.ReadAt(ch, off); err != nil {
+			return nil, fmt.Errorf("simg: read chunk %d header at byte %d: %w", i, off, err)
+		}
+		kind, n, bytes := le.Uint16(ch), int64(le.Uint32(ch[4:])), int64(le.Uint32(ch[8:]))
+		// within the image, every byte offset below fits an int64
+		if kind != ChunkCRC32 && n > blocks-block {
+			return nil, fmt.Errorf("simg: chunk %d runs past the %d blocks of the image", i, blocks)
+		}
+		var want int64
+		switch kind {
+		case ChunkRaw:
+			want = chunkHdr + n*blockSize
+		case ChunkFill, ChunkCRC32:
+			want = chunkHdr + 4
+		case ChunkDontCare:
+			want = chunkHdr
+		default:
+			return nil, fmt.Errorf("simg: chunk %d at byte %d has unknown type 0x%04x", i, off, kind)
+		}
+		if bytes != want {
+			return nil, fmt.Errorf("simg: chunk %d at byte %d is %d bytes, want %d for its type and %d blocks", i, off, bytes, want, n)
+		}
+		if off+bytes > size {
+			return nil, fmt.Errorf("simg: chunk %d at byte %d runs past the end of the file", i, off)
+		}
+		if kind == ChunkCRC32 {
+			off += bytes
+			continue
+		}
+		c := chunk{start: block * blockSize, end: (block + n) * blockSize, kind: kind, data: off + chunkHdr}
+		if kind == ChunkFill {
+			if _, err := r.ReadAt(c.fill[:], c.data); err != nil {
+				return nil, fmt.Errorf("simg: read chunk %d fill pattern: %w", i, err)
+			}
+		}
+		if n > 0 {
+			m.chunks = append(m.chunks, c)
+		}
+		block += n
+		off += bytes
+	}
+	if block != blocks {
+		return nil, fmt.Errorf("simg: chunks cover %d of the %d blocks of the image", block, blocks)
+	}
+	return m, nil
+}
+
+// Size is the size of the expanded image in bytes.
+func (m *Image) Size() int64 { return m.size }
+
+// ReadAt reads the expanded image.
+func (m *Image) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("simg: negative offset %d", off)
+	}
+	if off >= m.size {
+		return 0, io.EOF
+	}
+	want := len(p)
+	if int64(want) > m.size-off {
+		p = p[:m.size-off]
+	}
+	i := sort.Search(len(m.chunks), func(i int) bool { return m.chunks[i].end > off })
+	n := 0
+	for n < len(p) {
+		c := m.chunks[i]
+		b := p[n:min(int64(len(p)), int64(n)+c.end-off)]
+		switch c.kind {
+		case ChunkRaw:
+			if _, err := m.r.ReadAt(b, c.data+off-c.start); err != nil {
+				return n, fmt.Errorf("simg: read at byte %d: %w", off, err)
+			}
+		case ChunkFill:
+			for k := range b {
+				b[k] = c.fill[(off-c.start+int64(k))%4]
+			}
+		default:
+			clear(b)
+		}
+		n += len(b)
+		off += int64(len(b))
+		i++
+	}
+	if n < want {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Close closes the file Open opened.
+func (m *Image) Close() error {
+	if m.c == nil {
+		return nil
+	}
+	return m.c.Close()
+}
@@ -0,0 +1,198 @@
+// Package simg reads and writes Android sparse images, the format fastboot
+// flashes and factory images ship in. A sparse image is a header followed
+// by chunks, each covering a run of blocks of the disk:
+//
+//	file header (28 bytes): magic 0xed26ff3a, version 1.0, header sizes,
+//	    block size, total blocks, total chunks, image checksum
+//	chunk header (12 bytes): type, reserved, blocks, total bytes
+//	    RAW       the blocks' data follows
+//	    FILL      a 4-byte pattern follows, repeated over the blocks
+//	    DONT_CARE nothing follows; the blocks are left as they are
+//	    CRC32     a CRC32 of the data so far follows
+//
+// All integers are little-endian.
+//
+// Importing the package registers the format with device.RegisterFormat as
+// "android-sparse", so commands reading disks open sparse images as the
+// disk they expand to.
+package simg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Magic starts every sparse image.
+const Magic = 0xed26ff3a
+
+// Chunk types.
+const (
+	ChunkRaw      = 0xcac1
+	ChunkFill     = 0xcac2
+	ChunkDontCare = 0xcac3
+	ChunkCRC32    = 0xcac4
+)
+
+const (
+	fileHeaderSize  = 28
+	chunkHeaderSize = 12
+	// maxRawBytes bounds the data of a RAW chunk, whose total size must fit
+	// in 32 bits, with room to spare for readers that buffer a chunk whole;
+	// a chunk holds at least one block however large
+	maxRawBytes = 16 << 20
+)
+
+// Stats says what Write stored.
+type Stats struct {
+	Chunks          int
+	RawBytes        int64 // data stored as is
+	FillBytes       int64 // blocks stored as a 4-byte pattern, zeros included
+	CompressedBytes int64 // size of the sparse image
+}
+
+// Write stores the first size bytes of r as a sparse image with blocks of
+// blockSize bytes, a multiple of 4 that size must be a multiple of. Blocks
+// repeating a 4-byte pattern, zero blocks among them, become FILL chunks
+// and the rest RAW ones; no DONT_CARE chunks are written, so flashing the
+// image reproduces r exactly. w must be seekable: the chunk count in the
+// file header is filled in at the end.
+func Write(w io.WriteSeeker, r io.ReaderAt, size int64, blockSize int) (Stats, error) {
+	var st Stats
+	if blockSize <= 0 || blockSize%4 != 0 {
+		return st, fmt.Errorf("simg: block size %d is not a multiple of 4", blockSize)
+	}
+	if int64(blockSize) > math.MaxUint32-chunkHeaderSize {
+		return st, fmt.Errorf("simg: block size %d does not fit in a chunk", blockSize)
+	}
+	if size%int64(blockSize) != 0 {
+		return st, fmt.Errorf("simg: image size %d is not a multiple of the %d-byte block size", size, blockSize)
+	}
+	blocks := size / int64(blockSize)
+	if blocks > 0xffffffff {
+		return st, fmt.Errorf("simg: %d blocks do not fit in the header", blocks)
+	}
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return st, err
+	}
+	hdr := fileHeader(uint32(blockSize), uint32(blocks), 0)
+	if _, err := w.Write(hdr); err != nil {
+		return st, err
+	}
+	st.CompressedBytes = fileHeaderSize
+
+	bs := int64(blockSize)
+	maxRawBlocks := max(maxRawBytes/bs, 1)
+	buf := make([]byte, maxRawBlocks*bs)
+	// the pending chunk: a run of blocks of the same FILL pattern, or RAW
+	// blocks buffered in buf
+	var (
+		kind    uint16
+		pattern []byte
+		n       int64 // blocks
+	)
+	flush := func() error {
+		if n == 0 {
+			return nil
+		}
+		var payload []byte
+		switch kind {
+		case ChunkRaw:
+			payload = buf[:n*bs]
+			st.RawBytes += n * bs
+		case ChunkFill:
+			payload = pattern
+			st.FillBytes += n * bs
+		}
+		h := make([]byte, chunkHeaderSize)
+		binary.LittleEndian.PutUint16(h[0:], kind)
+		binary.LittleEndian.PutUint32(h[4:], uint32(n))
+		binary.LittleEndian.PutUint32(h[8:], uint32(chunkHeaderSize+len(payload)))
+		if _, err := w.Write(h); err != nil {
+			return err
+		}
+		if _, err := w.Write(payload); err != nil {
+			return err
+		}
+		st.Chunks++
+		st.CompressedBytes += int64(chunkHeaderSize + len(payload))
+		n = 0
+		return nil
+	}
+	in := make([]byte, max(bs, 1<<20/bs*bs))
+	var block []byte
+	for i := int64(0); i < blocks; i++ {
+		if k := i * bs % int64(len(in)); k == 0 {
+			chunk := in[:min(int64(len(in)), size-i*bs)]
+			if _, err := r.ReadAt(chunk, i*bs); err != nil {
+				return st, fmt.Errorf("simg: read at block %d: %w", i, err)
+			}
+			block = in[:bs]
+		} else {
+			block = in[k : k+bs]
+		}
+		if p, ok := fillPattern(block); ok {
+			if n > 0 && (kind != ChunkFill || !bytes.Equal(p, pattern)) {
+				if err := flush(); err != nil {
+					return st, err
+				}
+			}
+			if n == 0 {
+				kind, pattern = ChunkFill, append(pattern[:0], p...)
+			}
+			n++
+			continue
+		}
+		if n > 0 && (kind != ChunkRaw || n == maxRawBlocks) {
+			if err := flush(); err != nil {
+				return st, err
+			}
+		}
+		kind = ChunkRaw
+		copy(buf[n*bs:], block)
+		n++
+	}
+	if err := flush(); err != nil {
+		return st, err
+	}
+
+	end, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return st, err
+	}
+	if _, err := w.Seek(start, io.SeekStart); err != nil {
+		return st, err
+	}
+	if _, err := w.Write(fileHeader(uint32(blockSize), uint32(blocks), uint32(st.Chunks))); err != nil {
+		return st, err
+	}
+	_, err = w.Seek(end, io.SeekStart)
+	return st, err
+}
+
+func fileHeader(blockSize, blocks, chunks uint32) []byte {
+	h := make([]byte, fileHeaderSize)
+	le := binary.LittleEndian
+	le.PutUint32(h[0:], Magic)
+	le.PutUint16(h[4:], 1) // major version
+	le.PutUint16(h[6:], 0) // minor version
+	le.PutUint16(h[8:], fileHeaderSize)
+	le.PutUint16(h[10:], chunkHeaderSize)
+	le.PutUint32(h[12:], blockSize)
+	le.PutUint32(h[16:], blocks)
+	le.PutUint32(h[20:], chunks)
+	// the image checksum at 24 is optional and left 0, as by img2simg
+	return h
+}
+
+// fillPattern returns the 4-byte pattern b repeats, if it does: b is then
+// the same shifted by 4 bytes.
+func fillPattern(b []byte) ([]byte, bool) {
+	if !bytes.Equal(b[4:], b[:len(b)-4]) {
+		return nil, false
+	}
+	return b[:4], true
+}
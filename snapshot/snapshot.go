@@ -0,0 +1,209 @@
+// Package snapshot saves the complete GPT state of a disk, byte for byte,
+// so a change can be rolled back: the protective MBR, both headers and both
+// entry arrays, with enough about the device to recognise it again.
+//
+// Snapshots are JSON files in a directory, named after the time they were
+// taken, e.g. 20240501T101500.123Z-patch.json.
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// Identity describes the device a snapshot was taken of.
+type Identity struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	SectorSize int    `json:"sector_size"`
+	// DiskGUID is that of the table at the time, if there was one.
+	DiskGUID string `json:"disk_guid,omitempty"`
+	// Model and Serial are known for block devices only.
+	Model  string `json:"model,omitempty"`
+	Serial string `json:"serial,omitempty"`
+}
+
+// Region is a run of raw bytes at a byte offset of the device.
+type Region struct {
+	Name   string `json:"name"`
+	Offset int64  `json:"offset"`
+	Data   []byte `json:"data"`
+}
+
+// Snapshot is the GPT state of one device at one time.
+type Snapshot struct {
+	// ID is the file name without ".json"; it is set by Save and List.
+	ID        string    `json:"-"`
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	Identity  Identity  `json:"identity"`
+	Regions   []Region  `json:"regions"`
+}
+
+// rawSectors is how much is saved of a copy whose header cannot be read:
+// a header and the 32 sectors of a default 128-entry array.
+const rawSectors = 33
+
+// Take reads the GPT state of r, which holds id.Size bytes. primary and
+// backup are the copies as gpt.Open read them and may be nil; a missing
+// copy is saved as the sectors where it would normally be, so a disk
+// without a readable GPT can be snapshotted too.
+func Take(r io.ReaderAt, id Identity, operation string, primary, backup *gpt.Table) (*Snapshot, error) {
+	ss := int64(id.SectorSize)
+	if ss <= 0 {
+		ss = gpt.DefaultSectorSize
+		id.SectorSize = gpt.DefaultSectorSize
+	}
+	last := id.Size/ss - 1
+	if last < 2*rawSectors {
+		return nil, fmt.Errorf("snapshot: %s is too small for a GPT", id.Path)
+	}
+	s := &Snapshot{Time: time.Now().UTC(), Operation: operation, Identity: id}
+	add := func(name string, lba, sectors int64) error {
+		if lba < 0 || sectors <= 0 || lba+sectors > last+1 {
+			return fmt.Errorf("snapshot: %s at LBA %d (%d sectors) is outside the device", name, lba, sectors)
+		}
+		b := make([]byte, sectors*ss)
+		if _, err := r.ReadAt(b, lba*ss); err != nil {
+			return fmt.Errorf("snapshot: read %s: %w", name, err)
+		}
+		s.Regions = append(s.Regions, Region{Name: name, Offset: lba * ss, Data: b})
+		return nil
+	}
+	copyOf := func(which string, t *gpt.Table, hdrLBA, rawArrayLBA int64) error {
+		if t != nil {
+			// a damaged header may point anywhere; fall back to the
+			// usual place then
+			n, h := len(s.Regions), t.Header
+			if add(which+" header", int64(h.CurrentLBA), 1) == nil &&
+				add(which+" entries", int64(h.PartitionTableLBA), int64(h.TableSectors(int(ss)))) == nil {
+				return nil
+			}
+			s.Regions = s.Regions[:n]
+		}
+		if err := add(which+" header", hdrLBA, 1); err != nil {
+			return err
+		}
+		return add(which+" entries", rawArrayLBA, rawSectors-1)
+	}
+
+	if err := add("protective MBR", 0, 1); err != nil {
+		return nil, err
+	}
+	if err := copyOf("primary", primary, 1, 2); err != nil {
+		return nil, err
+	}
+	backupLBA := last
+	if backup == nil && primary != nil && int64(primary.Header.BackupLBA) < last {
+		backupLBA = int64(primary.Header.BackupLBA)
+	}
+	if err := copyOf("backup", backup, backupLBA, backupLBA-rawSectors+1); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save writes s to dir, creating dir if needed, and sets s.ID.
+func (s *Snapshot) Save(dir string) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	s.ID = s.Time.Format("20060102T150405.000Z") + "-" + strings.ReplaceAll(s.Operation, " ", "-")
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	// O_EXCL: two snapshots in the same millisecond must not overwrite
+	// each other
+	f, err := os.OpenFile(filepath.Join(dir, s.ID+".json"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads the snapshot id from dir.
+func Load(dir, id string) (*Snapshot, error) {
+	id = strings.TrimSuffix(id, ".json")
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return nil, fmt.Errorf("snapshot: invalid id %q", id)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	s.ID = id
+	return &s, nil
+}
+
+// List returns the snapshots in dir, oldest first. Files that do not parse
+// are skipped.
+func List(dir string) ([]*Snapshot, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var out []*Snapshot
+	for _, n := range names {
+		s, err := Load(dir, filepath.Base(n))
+		if err != nil {
+			continue
+		}
+		out = append(out, s)
+	}
+	sort.SliceStable(out, func(a, b int) bool { return out[a].Time.Before(out[b].Time) })
+	return out, nil
+}
+
+// Matches reports why the device described by id is not the one s was
+// taken of, or nil. The size and sector size must match, and the model
+// and serial number when both sides know them; the path and disk GUID may
+// differ, since device names move and the GUID may be what is rolled back.
+func (s *Snapshot) Matches(id Identity) error {
+	want := s.Identity
+	switch {
+	case want.Size != id.Size:
+		return fmt.Errorf("snapshot: %s is %d bytes, the snapshot was of %d bytes", id.Path, id.Size, want.Size)
+	case want.SectorSize != id.SectorSize:
+		return fmt.Errorf("snapshot: %s has %d-byte sectors, the snapshot %d-byte ones", id.Path, id.SectorSize, want.SectorSize)
+	case want.Serial != "" && id.Serial != "" && want.Serial != id.Serial:
+		return fmt.Errorf("snapshot: %s has serial %q, the snapshot was of %q", id.Path, id.Serial, want.Serial)
+	case want.Model != "" && id.Model != "" && want.Model != id.Model:
+		return fmt.Errorf("snapshot: %s is a %q, the snapshot was of a %q", id.Path, id.Model, want.Model)
+	}
+	return nil
+}
+
+// Restore writes every region of s back to dev, then syncs it.
+func (s *Snapshot) Restore(dev gpt.Device) error {
+	if len(s.Regions) == 0 {
+		return errors.New("snapshot: no regions")
+	}
+	for _, r := range s.Regions {
+		if _, err := dev.WriteAt(r.Data, r.Offset); err != nil {
+			return fmt.Errorf("snapshot: restore %s: %w", r.Name, err)
+		}
+	}
+	return dev.Sync()
+}
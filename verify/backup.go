@@ -0,0 +1,36 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// BackupLocation checks that the backup GPT header sits in the last sector
+// of d, where the spec puts it. An image or LUN that was extended leaves
+// the backup stranded in the middle: firmware still finds it through
+// AlternateLBA, but the space after it cannot be partitioned and tools that
+// look at the end of the disk report the backup missing.
+func BackupLocation(d *gpt.Disk) []Finding {
+	var alt uint64
+	switch {
+	case d.Primary != nil && d.PrimaryErr == nil:
+		alt = d.Primary.Header.BackupLBA
+	case d.Backup != nil && d.BackupErr == nil:
+		alt = d.Backup.Header.CurrentLBA
+	default:
+		return nil
+	}
+	last := d.LastLBA()
+	switch {
+	case alt == last:
+		return nil
+	case alt < last:
+		return []Finding{{Rule: RuleBackupLocation, Severity: Warning, Entry: -1, Message: fmt.Sprintf(
+			"backup GPT header is at LBA %d, not the last LBA %d; the disk grew by %d sectors since it was partitioned (gptctl realign -move-backup-to-end moves the backup without touching the partitions)",
+			alt, last, last-alt)}}
+	default:
+		return []Finding{{Rule: RuleBackupLocation, Severity: Error, Entry: -1, Message: fmt.Sprintf(
+			"AlternateLBA %d is beyond the last LBA %d; the disk or image was truncated", alt, last)}}
+	}
+}
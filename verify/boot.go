@@ -0,0 +1,235 @@
+package verify
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// BootStep is one check a UEFI firmware makes while looking for the GPT.
+type BootStep struct {
+	LBA    uint64
+	What   string
+	OK     bool
+	Detail string
+}
+
+func (s BootStep) String() string {
+	status := "ok"
+	if !s.OK {
+		status = "FAIL"
+	}
+	return fmt.Sprintf("LBA %-12d %-22s %-4s  %s", s.LBA, s.What, status, s.Detail)
+}
+
+// BootReport is the outcome of SimulateBoot.
+type BootReport struct {
+	Steps []BootStep
+	// Table is the copy firmware would consume, nil when it finds no
+	// usable GPT.
+	Table *gpt.Table
+	// Source is "primary" or "backup", naming Table.
+	Source string
+	// Restore names the copy firmware following the reference
+	// implementation would rewrite from Table, if any.
+	Restore string
+	// Conclusion explains the choice in one sentence.
+	Conclusion string
+	// Exposed are the 0-based entries firmware creates partitions for;
+	// Hidden maps the used entries it skips to the reason.
+	Exposed []int
+	Hidden  map[int]string
+}
+
+// SimulateBoot applies the GPT selection rules of the UEFI specification
+// (section 5.3.2), as the reference implementation in EDK II carries them
+// out, to the disk r of size bytes with the given logical block size. The
+// sector size is an input rather than detected: firmware takes it from the
+// block device, and a GPT laid out for another size is invisible to it.
+//
+// It deliberately re-reads the disk instead of trusting gpt.Open, which is
+// more lenient than firmware about which copy it accepts. maxTable bounds
+// the entry array read, 0 for no limit.
+func SimulateBoot(r io.ReaderAt, size int64, sectorSize int, maxTable int64) *BootReport {
+	rep := &BootReport{Hidden: map[int]string{}}
+	ss := int64(sectorSize)
+	if size < 3*ss {
+		rep.Conclusion = fmt.Sprintf("the disk is too small (%d bytes) to hold a GPT", size)
+		return rep
+	}
+	last := uint64(size/ss) - 1
+
+	mbr := make([]byte, ss)
+	if _, err := r.ReadAt(mbr, 0); err != nil {
+		rep.step(0, "protective MBR", false, "%v", err)
+		rep.Conclusion = "firmware cannot read LBA 0"
+		return rep
+	}
+	ok, detail := protectiveMBR(mbr)
+	rep.step(0, "protective MBR", ok, "%s", detail)
+	if !ok {
+		rep.Conclusion = "firmware treats the disk as MBR-partitioned and never looks for a GPT"
+		return rep
+	}
+
+	primary := rep.readCopy(r, "primary", 1, sectorSize, maxTable)
+	var backup *gpt.Table
+	if primary != nil {
+		// with a good primary, the backup is found where the primary says
+		alt := primary.Header.BackupLBA
+		if alt > last {
+			rep.step(alt, "backup header", false, "AlternateLBA %d is beyond the last LBA %d", alt, last)
+		} else {
+			backup = rep.readCopy(r, "backup", alt, sectorSize, maxTable)
+		}
+		rep.Table, rep.Source = primary, "primary"
+		rep.Conclusion = fmt.Sprintf("firmware uses the primary header at LBA 1 and its entry array at LBA %d", primary.Header.PartitionTableLBA)
+		if backup == nil {
+			rep.Restore = "backup"
+			rep.Conclusion += "; the backup is invalid and is rewritten from the primary"
+		}
+	} else {
+		// without one, the spec points at the last LBA, not at whatever a
+		// corrupt primary claims
+		backup = rep.readCopy(r, "backup", last, sectorSize, maxTable)
+		if backup == nil {
+			rep.Conclusion = "neither copy is valid: firmware finds no GPT and exposes no partitions"
+			return rep
+		}
+		rep.Table, rep.Source, rep.Restore = backup, "backup", "primary"
+		rep.Conclusion = fmt.Sprintf("the primary is invalid, so firmware uses the backup header at LBA %d and its entry array at LBA %d, and rewrites the primary from it", last, backup.Header.PartitionTableLBA)
+	}
+	rep.entries()
+	return rep
+}
+
+func (rep *BootReport) step(lba uint64, what string, ok bool, format string, args ...any) {
+	rep.Steps = append(rep.Steps, BootStep{LBA: lba, What: what, OK: ok, Detail: fmt.Sprintf(format, args...)})
+}
+
+// protectiveMBR checks LBA 0 the way EDK II does: a valid boot signature
+// and a partition record of type 0xEE starting at LBA 1.
+func protectiveMBR(b []byte) (bool, string) {
+	if b[510] != 0x55 || b[511] != 0xAA {
+		return false, fmt.Sprintf("no boot signature (0x%02x%02x at offset 510)", b[510], b[511])
+	}
+	for i := 0; i < 4; i++ {
+		rec := b[446+16*i : 446+16*(i+1)]
+		if rec[4] != 0xEE {
+			continue
+		}
+		if start := binary.LittleEndian.Uint32(rec[8:]); start != 1 {
+			return false, fmt.Sprintf("record %d has type 0xEE but starts at LBA %d, not 1", i+1, start)
+		}
+		return true, fmt.Sprintf("record %d has type 0xEE starting at LBA 1", i+1)
+	}
+	return false, "no partition record of type 0xEE"
+}
+
+// readCopy reads and checks the header at lba and its entry array, adding
+// a step for each, and returns the copy if firmware would accept it.
+func (rep *BootReport) readCopy(r io.ReaderAt, name string, lba uint64, sectorSize int, maxTable int64) *gpt.Table {
+	what := name + " header"
+	buf := make([]byte, sectorSize)
+	if _, err := r.ReadAt(buf, int64(lba)*int64(sectorSize)); err != nil {
+		rep.step(lba, what, false, "%v", err)
+		return nil
+	}
+	t := &gpt.Table{SectorSize: sectorSize}
+	if err := t.Header.UnmarshalBinary(buf); err != nil {
+		rep.step(lba, what, false, "%v", err)
+		return nil
+	}
+	if err := checkBootHeader(&t.Header, buf, lba, sectorSize, maxTable); err != nil {
+		rep.step(lba, what, false, "%v", err)
+		return nil
+	}
+	rep.step(lba, what, true, "signature, size, CRC32 0x%08x and MyLBA check out", t.Header.HeaderCRC32)
+
+	what = name + " entry array"
+	h := &t.Header
+	alba := h.PartitionTableLBA
+	raw := make([]byte, h.TableBytes())
+	if _, err := r.ReadAt(raw, int64(alba)*int64(sectorSize)); err != nil {
+		rep.step(alba, what, false, "%v", err)
+		return nil
+	}
+	if crc := gpt.ArrayCRC(raw); crc != h.PartitionTableCRC {
+		rep.step(alba, what, false, "%v: stored 0x%08x, calculated 0x%08x", gpt.ErrArrayCRC, h.PartitionTableCRC, crc)
+		return nil
+	}
+	entries, err := gpt.ParseEntryArray(raw, int(h.PartitionEntrySize))
+	if err != nil {
+		rep.step(alba, what, false, "%v", err)
+		return nil
+	}
+	t.Entries = entries
+	rep.step(alba, what, true, "%d entries of %d bytes, CRC32 0x%08x", h.NumPartitions, h.PartitionEntrySize, h.PartitionTableCRC)
+	return t
+}
+
+// checkBootHeader is the header validation of UEFI 5.3.2.
+func checkBootHeader(h *gpt.Header, raw []byte, lba uint64, sectorSize int, maxTable int64) error {
+	if string(h.Signature[:]) != gpt.HeaderSignature {
+		return fmt.Errorf("%w: %q", gpt.ErrSignature, h.Signature[:])
+	}
+	if h.HeaderSize < gpt.MinHeaderSize || int(h.HeaderSize) > sectorSize {
+		return fmt.Errorf("%w: %d", gpt.ErrHeaderSize, h.HeaderSize)
+	}
+	if crc := gpt.HeaderCRC(raw[:h.HeaderSize]); crc != h.HeaderCRC32 {
+		return fmt.Errorf("%w: stored 0x%08x, calculated 0x%08x", gpt.ErrHeaderCRC, h.HeaderCRC32, crc)
+	}
+	if h.CurrentLBA != lba {
+		return fmt.Errorf("MyLBA is %d but the header was read from LBA %d", h.CurrentLBA, lba)
+	}
+	if h.PartitionEntrySize < gpt.EntrySize || h.PartitionEntrySize%gpt.EntrySize != 0 {
+		return fmt.Errorf("%w: %d", gpt.ErrEntrySize, h.PartitionEntrySize)
+	}
+	if n := h.TableBytes(); n == 0 || (maxTable > 0 && n > maxTable) {
+		return fmt.Errorf("%w: %d entries of %d bytes", gpt.ErrNumEntries, h.NumPartitions, h.PartitionEntrySize)
+	}
+	return nil
+}
+
+// entries decides which used entries of rep.Table firmware turns into
+// partitions. Like EDK II it drops entries that are out of range or
+// overlap another, and entries with the EFI-ignore attribute (bit 1).
+func (rep *BootReport) entries() {
+	t := rep.Table
+	h := t.Header
+	used := t.Used()
+	for _, i := range used {
+		e := t.Entries[i]
+		switch {
+		case e.EndingLBA < e.StartingLBA:
+			rep.Hidden[i] = fmt.Sprintf("ends (%d) before it starts (%d)", e.EndingLBA, e.StartingLBA)
+		case e.StartingLBA < h.FirstUsableLBA || e.EndingLBA > h.LastUsableLBA:
+			rep.Hidden[i] = fmt.Sprintf("%d-%d is outside the usable range %d-%d", e.StartingLBA, e.EndingLBA, h.FirstUsableLBA, h.LastUsableLBA)
+		}
+	}
+	for a, i := range used {
+		for _, j := range used[a+1:] {
+			ei, ej := t.Entries[i], t.Entries[j]
+			if ei.StartingLBA <= ej.EndingLBA && ej.StartingLBA <= ei.EndingLBA {
+				rep.hide(i, fmt.Sprintf("overlaps partition %d", j+1))
+				rep.hide(j, fmt.Sprintf("overlaps partition %d", i+1))
+			}
+		}
+	}
+	for _, i := range used {
+		if !t.Entries[i].FirmwareVisible() {
+			rep.hide(i, "has the EFI-ignore attribute (bit 1) set")
+		}
+		if _, hidden := rep.Hidden[i]; !hidden {
+			rep.Exposed = append(rep.Exposed, i)
+		}
+	}
+}
+
+func (rep *BootReport) hide(i int, why string) {
+	if _, ok := rep.Hidden[i]; !ok {
+		rep.Hidden[i] = why
+	}
+}
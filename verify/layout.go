@@ -0,0 +1,91 @@
+package verify
+
+import (
+	"fmt"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/layout"
+)
+
+// Layout checks that every partition declared in l exists in t by name with
+// the declared type and at least the declared size, or within the bounds of
+// a size expression. A smaller partition is an error since images built for
+// the layout will not fit; a larger one, other attributes and partitions l
+// does not declare are warnings.
+func Layout(t *gpt.Table, l *layout.Layout) []Finding {
+	var out []Finding
+	add := func(rule Rule, sev Severity, entry int, format string, args ...any) {
+		out = append(out, Finding{Rule: rule, Severity: sev, Entry: entry, Message: fmt.Sprintf(format, args...)})
+	}
+	ss := t.SectorSize
+	if ss == 0 {
+		ss = gpt.DefaultSectorSize
+	}
+	byName := map[string]int{}
+	for _, i := range t.Used() {
+		byName[t.Entries[i].Name()] = i
+	}
+	declared := map[string]bool{}
+	for _, p := range l.Partitions {
+		declared[p.Name] = true
+		i, ok := byName[p.Name]
+		if p.Number != 0 {
+			// numbered partitions are matched by slot; names may repeat
+			if at := p.Number - 1; at < len(t.Entries) && !t.Entries[at].IsEmpty() && t.Entries[at].Name() == p.Name {
+				i, ok = at, true
+			} else if ok {
+				add(RuleLayoutNumber, Error, i, "%q should be partition %d", p.Name, p.Number)
+			}
+		}
+		if !ok {
+			add(RuleLayoutMissing, Error, -1, "partition %q is missing", p.Name)
+			continue
+		}
+		e := t.Entries[i]
+		if p.Type != "" {
+			want, err := gpt.LookupType(p.Type)
+			if err != nil {
+				add(RuleLayoutType, Error, i, "%v", err)
+			} else if e.PartitionTypeGUID != want {
+				add(RuleLayoutType, Error, i, "%q has type %s, want %s", p.Name, typeLabel(e.PartitionTypeGUID), typeLabel(want))
+			}
+		}
+		if p.Size != "" {
+			expr, err := layout.ParseSizeExpr(p.Size)
+			have := int64(e.SizeBytes(ss))
+			switch {
+			case err != nil:
+				add(RuleLayoutSize, Error, i, "%v", err)
+			case expr.IsFixed():
+				want := (expr.Fixed + int64(ss) - 1) / int64(ss) * int64(ss)
+				switch {
+				case have < want:
+					add(RuleLayoutSize, Error, i, "%q is %d bytes, smaller than the required %s", p.Name, have, p.Size)
+				case have > want:
+					add(RuleLayoutSize, Warning, i, "%q is %d bytes, larger than the declared %s", p.Name, have, p.Size)
+				}
+			// a size resolved against the disk can only be held to its bounds
+			case have < expr.Min:
+				add(RuleLayoutSize, Error, i, "%q is %d bytes, smaller than the required %s", p.Name, have, p.Size)
+			case expr.Max > 0 && have > expr.Max:
+				add(RuleLayoutSize, Warning, i, "%q is %d bytes, larger than the declared %s", p.Name, have, p.Size)
+			}
+		}
+		if e.Attributes != p.Attributes {
+			add(RuleLayoutAttrs, Warning, i, "%q has attributes 0x%x, layout declares 0x%x", p.Name, e.Attributes, p.Attributes)
+		}
+	}
+	for _, i := range t.Used() {
+		if name := t.Entries[i].Name(); !declared[name] {
+			add(RuleLayoutExtra, Warning, i, "%q is not part of the layout", name)
+		}
+	}
+	return out
+}
+
+func typeLabel(g gpt.GUID) string {
+	if n := gpt.TypeName(g); n != "" {
+		return fmt.Sprintf("%s (%s)", g, n)
+	}
+	return g.String()
+}
@@ -0,0 +1,123 @@
+package verify
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// ProtectiveMBR checks the 0xEE record of the MBR in LBA 0 of r against a
+// disk of totalSectors sectors. Its size must be everything after LBA 0,
+// or 0xFFFFFFFF once that no longer fits in 32 bits. Tools that truncate
+// the size on disks beyond 2 TiB write a record covering some random part
+// of the disk, which some firmware and older kernels reject.
+func ProtectiveMBR(r io.ReaderAt, sectorSize int, totalSectors uint64) []Finding {
+	var out []Finding
+	add := func(rule Rule, sev Severity, format string, args ...any) {
+		out = append(out, Finding{Rule: rule, Severity: sev, Entry: -1, Message: fmt.Sprintf(format, args...)})
+	}
+	mbr := make([]byte, sectorSize)
+	if _, err := r.ReadAt(mbr, 0); err != nil {
+		add(RulePMBRMissing, Error, "protective MBR: %v", err)
+		return out
+	}
+	kind, _ := gpt.ClassifyMBR(mbr)
+	switch kind {
+	case gpt.MBRMissing:
+		add(RulePMBRMissing, Warning, "LBA 0 holds no protective MBR (no 0xAA55 boot signature); UEFI firmware and MBR-only tools may treat the disk as unpartitioned")
+		return out
+	case gpt.MBREmpty:
+		add(RulePMBRMissing, Warning, "LBA 0 holds no protective MBR (boot signature but no partition records); UEFI firmware and MBR-only tools may treat the disk as unpartitioned")
+		return out
+	case gpt.MBRClassic:
+		// MBRRecords reports the partition records in its place
+		return out
+	}
+	i := gpt.ProtectiveRecord(mbr)
+	rec := mbr[446+16*i : 446+16*(i+1)]
+	start, size := binary.LittleEndian.Uint32(rec[8:]), binary.LittleEndian.Uint32(rec[12:])
+	want := gpt.ProtectiveSize(totalSectors)
+	switch {
+	case start != 1:
+		add(RulePMBRStart, Error, "protective MBR record starts at LBA %d, not 1", start)
+	case kind == gpt.MBRHybrid:
+		// the 0xEE record of a hybrid MBR covers only what the other
+		// records leave
+	case size == want:
+	case totalSectors-1 > 0xFFFFFFFF:
+		add(RulePMBRSize, Error, "protective MBR size is %d sectors; the disk has %d sectors, more than 32 bits can count, so it must be 0xFFFFFFFF", size, totalSectors)
+	case size == 0xFFFFFFFF:
+		add(RulePMBRSize, Warning, "protective MBR size is 0xFFFFFFFF on a disk of %d sectors, which the spec reserves for disks beyond what 32 bits can count", totalSectors)
+	case uint64(start)+uint64(size) > totalSectors:
+		add(RulePMBRSize, Error, "protective MBR covers LBA 1-%d, beyond the end of the disk at LBA %d", uint64(start)+uint64(size)-1, totalSectors-1)
+	default:
+		add(RulePMBRSize, Warning, "protective MBR covers %d of the %d sectors after LBA 0 (the disk grew?); expected %d", size, totalSectors-1, want)
+	}
+	return out
+}
+
+// MBRRecords checks the partition records of LBA 0 of r other than the
+// protective one against t. A hybrid MBR, whose extra records mirror GPT
+// partitions for BIOS boot or an older OS, works only while the two
+// tables agree, and nothing but the tool that made it keeps them in sync.
+// A classic MBR without a 0xEE record is left over from before the disk
+// got its GPT: MBR-only tools trust it and may write over GPT partitions.
+func MBRRecords(r io.ReaderAt, sectorSize int, t *gpt.Table) []Finding {
+	var out []Finding
+	add := func(rule Rule, sev Severity, format string, args ...any) {
+		out = append(out, Finding{Rule: rule, Severity: sev, Entry: -1, Message: fmt.Sprintf(format, args...)})
+	}
+	mbr := make([]byte, sectorSize)
+	if _, err := r.ReadAt(mbr, 0); err != nil {
+		return nil
+	}
+	kind, records := gpt.ClassifyMBR(mbr)
+	switch kind {
+	case gpt.MBRClassic:
+		add(RuleMBRStale, Warning, "LBA 0 holds a stale MBR partition table (%s) instead of a protective MBR; MBR-only tools see those partitions rather than the GPT and may write over GPT partitions (gdisk: x, n writes a protective MBR)",
+			describeRecords(records))
+		return out
+	case gpt.MBRHybrid:
+	default:
+		return nil
+	}
+	add(RuleMBRHybrid, Warning, "hybrid MBR: records besides the protective one (%s) mirror GPT partitions; tools that edit only the GPT leave them stale", describeRecords(records))
+	for _, p := range records {
+		if p.Type == gpt.ProtectiveMBRType {
+			continue
+		}
+		if !mirrorsEntry(t, p) {
+			add(RuleMBRStale, Error, "hybrid MBR record %d (0x%02x) covers LBA %d-%d, which matches no GPT partition", p.Index+1, p.Type, p.Start, uint64(p.Start)+uint64(p.Sectors)-1)
+		}
+	}
+	return out
+}
+
+// mirrorsEntry reports whether an MBR record spans exactly a partition of t.
+func mirrorsEntry(t *gpt.Table, p gpt.MBRPartition) bool {
+	for _, i := range t.Used() {
+		e := t.Entries[i]
+		if e.StartingLBA == uint64(p.Start) && e.EndingLBA == uint64(p.Start)+uint64(p.Sectors)-1 {
+			return true
+		}
+	}
+	return false
+}
+
+func describeRecords(records []gpt.MBRPartition) string {
+	var parts []string
+	for _, p := range records {
+		if p.Type == gpt.ProtectiveMBRType {
+			continue
+		}
+		s := fmt.Sprintf("%d: 0x%02x", p.Index+1, p.Type)
+		if n := p.TypeName(); n != "" {
+			s += " " + n
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ", ")
+}
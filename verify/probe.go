@@ -0,0 +1,35 @@
+package verify
+
+import (
+	"io"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+	"github.com/cpuuntery/go-code-and-bin/probe"
+)
+
+// Probed reports the problems the probes registered with package probe
+// find in the partitions of t. It reads nothing when none are registered.
+func Probed(r io.ReaderAt, t *gpt.Table) []Finding {
+	if len(probe.Registered()) == 0 {
+		return nil
+	}
+	var out []Finding
+	ss := t.SectorSize
+	if ss == 0 {
+		ss = gpt.DefaultSectorSize
+	}
+	for _, i := range t.Used() {
+		e := t.Entries[i]
+		if e.EndingLBA < e.StartingLBA {
+			continue
+		}
+		res, ok := probe.Identify(r, int64(e.StartingLBA)*int64(ss), int64(e.SizeBytes(ss)))
+		if !ok {
+			continue
+		}
+		for _, p := range res.Problems {
+			out = append(out, Finding{Rule: RuleContent, Severity: Warning, Entry: i, Message: res.Type + ": " + p})
+		}
+	}
+	return out
+}
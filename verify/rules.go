@@ -0,0 +1,152 @@
+package verify
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// Rule identifies one check. IDs are stable: new checks get new IDs and
+// retired ones are not reused, so CI configurations can refer to them.
+type Rule struct {
+	ID   string // e.g. "GPT014"
+	Name string // e.g. "overlap"
+}
+
+func (r Rule) String() string { return r.ID + " " + r.Name }
+
+var (
+	RuleHeaderCRC       = Rule{"GPT001", "header-crc"}
+	RuleEntriesCRC      = Rule{"GPT002", "entries-crc"}
+	RuleSignature       = Rule{"GPT003", "signature"}
+	RuleHeaderInvalid   = Rule{"GPT004", "header-invalid"}
+	RuleCopiesDiffer    = Rule{"GPT005", "copies-differ"}
+	RuleRevision        = Rule{"GPT006", "revision"}
+	RulePMBRMissing     = Rule{"GPT007", "pmbr-missing"}
+	RulePMBRStart       = Rule{"GPT008", "pmbr-start"}
+	RulePMBRSize        = Rule{"GPT009", "pmbr-size"}
+	RuleBackupLocation  = Rule{"GPT010", "backup-location"}
+	RuleEntryInverted   = Rule{"GPT011", "entry-inverted"}
+	RuleEntryRange      = Rule{"GPT012", "entry-outside-usable"}
+	RuleReservedOverlap = Rule{"GPT013", "reserved-overlap"}
+	RuleOverlap         = Rule{"GPT014", "overlap"}
+	RuleESPIgnored      = Rule{"GPT015", "esp-ignored"}
+	RuleFirstUsable     = Rule{"GPT016", "first-usable"}
+	RuleContent         = Rule{"GPT017", "content"}
+	RuleZeroed          = Rule{"GPT018", "zeroed"}
+	RuleLayoutNumber    = Rule{"GPT019", "layout-number"}
+	RuleLayoutMissing   = Rule{"GPT020", "layout-missing"}
+	RuleLayoutType      = Rule{"GPT021", "layout-type"}
+	RuleLayoutSize      = Rule{"GPT022", "layout-size"}
+	RuleLayoutAttrs     = Rule{"GPT023", "layout-attributes"}
+	RuleLayoutExtra     = Rule{"GPT024", "layout-undeclared"}
+	RuleMBRHybrid       = Rule{"GPT025", "mbr-hybrid"}
+	RuleMBRStale        = Rule{"GPT026", "mbr-stale"}
+)
+
+// Rules lists every rule in ID order.
+var Rules = []Rule{
+	RuleHeaderCRC, RuleEntriesCRC, RuleSignature, RuleHeaderInvalid, RuleCopiesDiffer, RuleRevision,
+	RulePMBRMissing, RulePMBRStart, RulePMBRSize, RuleBackupLocation,
+	RuleEntryInverted, RuleEntryRange, RuleReservedOverlap, RuleOverlap, RuleESPIgnored, RuleFirstUsable,
+	RuleContent, RuleZeroed,
+	RuleLayoutNumber, RuleLayoutMissing, RuleLayoutType, RuleLayoutSize, RuleLayoutAttrs, RuleLayoutExtra,
+	RuleMBRHybrid, RuleMBRStale,
+}
+
+// ruleDocs says what each rule checks, by rule ID.
+var ruleDocs = map[string]string{
+	"GPT001": "the HeaderCRC32 stored in a GPT header matches the CRC32 of its HeaderSize bytes, computed with the field itself zeroed",
+	"GPT002": "the PartitionEntryArrayCRC32 in a header matches the CRC32 of the NumberOfPartitionEntries × SizeOfPartitionEntry bytes of the entry array",
+	"GPT003": `a GPT header starts with the signature "EFI PART"`,
+	"GPT004": "a GPT header is otherwise sound: HeaderSize at least 92, SizeOfPartitionEntry 128 × 2^n, at least one entry, FirstUsableLBA not past LastUsableLBA, and an entry array that can be read",
+	"GPT005": "the primary and backup GPT point at each other and describe the same disk GUID, usable range and entries",
+	"GPT006": "the header Revision is one this tool knows (1.0); later fields are not interpreted",
+	"GPT007": "LBA 0 holds a protective MBR: the 0xAA55 signature and a 0xEE partition record",
+	"GPT008": "the protective MBR record starts at LBA 1",
+	"GPT009": "the protective MBR record covers the rest of the disk, or is 0xFFFFFFFF when the disk has more sectors than 32 bits can count",
+	"GPT010": "the backup GPT header is in the last sector of the disk, where AlternateLBA points",
+	"GPT011": "no entry has an EndingLBA before its StartingLBA",
+	"GPT012": "every entry lies within FirstUsableLBA-LastUsableLBA",
+	"GPT013": "no entry covers sectors kept free with -first-usable or a reserved region of the layout file or preset (-layout, -preset)",
+	"GPT014": "no two entries share a sector",
+	"GPT015": "at least one EFI System Partition is visible to the firmware, without the EFI-ignore attribute (bit 1)",
+	"GPT016": "FirstUsableLBA is at least the one required with -first-usable",
+	"GPT017": "what the partition holds (filesystem, RAID or LVM signature) fits its type",
+	"GPT018": "a partition does not read as all zeros in sampled blocks (-check-zeroed)",
+	"GPT019": "a partition declared in a layout file has the number declared",
+	"GPT020": "every partition declared in a layout file exists",
+	"GPT021": "a partition declared in a layout file has the type declared",
+	"GPT022": "a partition declared in a layout file has the size declared",
+	"GPT023": "a partition declared in a layout file has the attributes declared",
+	"GPT024": "every partition is declared in the layout file",
+	"GPT025": "the MBR is purely protective rather than hybrid, with records mirroring GPT partitions",
+	"GPT026": "the MBR holds no partition records that the GPT does not have",
+}
+
+// Doc says what the rule checks.
+func (r Rule) Doc() string { return ruleDocs[r.ID] }
+
+// fieldRules names the rules that check each header or entry field, by the
+// field's name in the UEFI specification.
+var fieldRules = map[string][]Rule{
+	"Signature":                {RuleSignature},
+	"Revision":                 {RuleRevision},
+	"HeaderSize":               {RuleHeaderInvalid, RuleHeaderCRC},
+	"HeaderCRC32":              {RuleHeaderCRC},
+	"Reserved":                 {RuleHeaderCRC},
+	"MyLBA":                    {RuleCopiesDiffer},
+	"AlternateLBA":             {RuleBackupLocation, RuleCopiesDiffer},
+	"FirstUsableLBA":           {RuleHeaderInvalid, RuleFirstUsable, RuleEntryRange, RuleCopiesDiffer},
+	"LastUsableLBA":            {RuleHeaderInvalid, RuleEntryRange, RuleCopiesDiffer},
+	"DiskGUID":                 {RuleCopiesDiffer},
+	"PartitionEntryLBA":        {RuleHeaderInvalid},
+	"NumberOfPartitionEntries": {RuleHeaderInvalid, RuleEntriesCRC},
+	"SizeOfPartitionEntry":     {RuleHeaderInvalid, RuleEntriesCRC},
+	"PartitionEntryArrayCRC32": {RuleEntriesCRC},
+	"PartitionTypeGUID":        {RuleESPIgnored, RuleContent, RuleLayoutType, RuleCopiesDiffer},
+	"UniquePartitionGUID":      {RuleCopiesDiffer},
+	"StartingLBA":              {RuleEntryInverted, RuleEntryRange, RuleReservedOverlap, RuleOverlap, RuleLayoutSize},
+	"EndingLBA":                {RuleEntryInverted, RuleEntryRange, RuleReservedOverlap, RuleOverlap, RuleLayoutSize},
+	"Attributes":               {RuleESPIgnored, RuleLayoutAttrs, RuleCopiesDiffer},
+	"PartitionName":            {RuleLayoutNumber, RuleLayoutMissing, RuleLayoutExtra, RuleCopiesDiffer},
+}
+
+// FieldRules returns the rules that check the header or entry field with
+// the given UEFI specification name, e.g. "HeaderCRC32".
+func FieldRules(field string) []Rule { return fieldRules[field] }
+
+// LookupRule finds a rule by ID or name, ignoring case.
+func LookupRule(s string) (Rule, bool) {
+	for _, r := range Rules {
+		if strings.EqualFold(s, r.ID) || strings.EqualFold(s, r.Name) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Ignore returns the findings whose rule is not in ids.
+func Ignore(fs []Finding, ids map[string]bool) []Finding {
+	var out []Finding
+	for _, f := range fs {
+		if !ids[f.Rule.ID] {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// copyRule classifies why gpt.Open rejected one copy of the table.
+func copyRule(err error) Rule {
+	switch {
+	case errors.Is(err, gpt.ErrHeaderCRC):
+		return RuleHeaderCRC
+	case errors.Is(err, gpt.ErrArrayCRC):
+		return RuleEntriesCRC
+	case errors.Is(err, gpt.ErrSignature):
+		return RuleSignature
+	}
+	return RuleHeaderInvalid
+}
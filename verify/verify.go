@@ -0,0 +1,181 @@
+// Package verify checks an opened GPT disk for problems and reports every
+// one it finds, rather than stopping at the first like gpt.Open does.
+// Each finding names the Rule that produced it by a stable ID.
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// Severity ranks a finding.
+type Severity int
+
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+func (s Severity) MarshalText() ([]byte, error) { return []byte(s.String()), nil }
+
+// Finding is one problem. Entry is the 0-based entry index it concerns, or
+// -1 for problems with the disk as a whole.
+type Finding struct {
+	Rule     Rule
+	Severity Severity
+	Entry    int
+	Message  string
+}
+
+func (f Finding) String() string {
+	if f.Entry >= 0 {
+		return fmt.Sprintf("%s %s: partition %d: %s", f.Severity, f.Rule.ID, f.Entry+1, f.Message)
+	}
+	return fmt.Sprintf("%s %s: %s", f.Severity, f.Rule.ID, f.Message)
+}
+
+// MarshalJSON encodes f with its rule spelled out and the 1-based partition
+// number, omitted for problems with the disk as a whole.
+func (f Finding) MarshalJSON() ([]byte, error) {
+	v := struct {
+		ID        string   `json:"id"`
+		Rule      string   `json:"rule"`
+		Severity  Severity `json:"severity"`
+		Partition int      `json:"partition,omitempty"`
+		Message   string   `json:"message"`
+	}{f.Rule.ID, f.Rule.Name, f.Severity, f.Entry + 1, f.Message}
+	return json.Marshal(v)
+}
+
+// Options are site requirements checked in addition to the GPT rules.
+type Options struct {
+	// FirstUsableLBA, when non-zero, is the first sector partitions may
+	// use; everything below it is reserved for firmware or a bootloader
+	// written at a fixed raw offset.
+	FirstUsableLBA uint64
+	// Reserved raw regions no partition may cover.
+	Reserved []gpt.Reserved
+	// ZeroSamples, when non-zero, samples that many blocks of every
+	// partition and warns about partitions that read as all zeros.
+	ZeroSamples int
+}
+
+// Disk checks both copies of the GPT on d and the table gpt.Open selected.
+func Disk(d *gpt.Disk, o Options) []Finding {
+	var out []Finding
+	add := func(rule Rule, sev Severity, entry int, format string, args ...any) {
+		out = append(out, Finding{Rule: rule, Severity: sev, Entry: entry, Message: fmt.Sprintf(format, args...)})
+	}
+	if d.PrimaryErr != nil {
+		add(copyRule(d.PrimaryErr), Error, -1, "primary: %v", d.PrimaryErr)
+	}
+	if d.BackupErr != nil {
+		add(copyRule(d.BackupErr), Error, -1, "backup: %v", d.BackupErr)
+	}
+	if d.PrimaryErr == nil && d.BackupErr == nil {
+		if err := gpt.CompareCopies(d.Primary, d.Backup); err != nil {
+			add(RuleCopiesDiffer, Error, -1, "%v", err)
+		}
+	}
+	t := d.Table()
+	if t == nil {
+		return out
+	}
+	out = append(out, ProtectiveMBR(d, d.SectorSize, d.LastLBA()+1)...)
+	out = append(out, MBRRecords(d, d.SectorSize, t)...)
+	out = append(out, BackupLocation(d)...)
+	out = append(out, Table(t, o)...)
+	out = append(out, Probed(d, t)...)
+	if o.ZeroSamples > 0 {
+		out = append(out, Zeroed(d, t, o.ZeroSamples)...)
+	}
+	return out
+}
+
+// Table checks the entries of one copy of the GPT.
+func Table(t *gpt.Table, o Options) []Finding {
+	var out []Finding
+	add := func(rule Rule, sev Severity, entry int, format string, args ...any) {
+		out = append(out, Finding{Rule: rule, Severity: sev, Entry: entry, Message: fmt.Sprintf(format, args...)})
+	}
+	h := t.Header
+	ss := t.SectorSize
+	if ss == 0 {
+		ss = gpt.DefaultSectorSize
+	}
+	if !h.KnownRevision() {
+		add(RuleRevision, Warning, -1, "unknown header revision 0x%08x (expected 0x%08x); fields beyond revision 1.0 are not interpreted", h.Revision, uint32(gpt.Revision10))
+	}
+	if o.FirstUsableLBA != 0 && h.FirstUsableLBA < o.FirstUsableLBA {
+		add(RuleFirstUsable, Error, -1, "FirstUsableLBA %d is below the required %d", h.FirstUsableLBA, o.FirstUsableLBA)
+	}
+
+	used := t.Used()
+	for _, i := range used {
+		e := t.Entries[i]
+		if e.EndingLBA < e.StartingLBA {
+			add(RuleEntryInverted, Error, i, "ends (%d) before it starts (%d)", e.EndingLBA, e.StartingLBA)
+			continue
+		}
+		if e.StartingLBA < h.FirstUsableLBA || e.EndingLBA > h.LastUsableLBA {
+			add(RuleEntryRange, Error, i, "%d-%d outside usable range %d-%d", e.StartingLBA, e.EndingLBA, h.FirstUsableLBA, h.LastUsableLBA)
+		}
+		if o.FirstUsableLBA != 0 && e.StartingLBA < o.FirstUsableLBA {
+			add(RuleReservedOverlap, Error, i, "%d-%d overlaps the reserved sectors 0-%d", e.StartingLBA, e.EndingLBA, o.FirstUsableLBA-1)
+		}
+		for _, r := range o.Reserved {
+			if r.Overlaps(e.StartingLBA, e.EndingLBA, ss) {
+				add(RuleReservedOverlap, Error, i, "%d-%d overlaps reserved region %s", e.StartingLBA, e.EndingLBA, r)
+			}
+		}
+	}
+
+	// an ESP hidden from the firmware might as well not be there
+	var esps, hidden []int
+	for _, i := range used {
+		if t.Entries[i].PartitionTypeGUID == gpt.TypeEFISystem {
+			esps = append(esps, i)
+			if !t.Entries[i].FirmwareVisible() {
+				hidden = append(hidden, i)
+			}
+		}
+	}
+	if len(esps) > 0 && len(hidden) == len(esps) {
+		for _, i := range hidden {
+			if len(esps) == 1 {
+				add(RuleESPIgnored, Warning, i, "the only EFI System Partition has the EFI-ignore attribute (bit 1) set; firmware will not boot from it")
+			} else {
+				add(RuleESPIgnored, Warning, i, "EFI System Partition has the EFI-ignore attribute (bit 1) set, as do all others; firmware will not boot from any")
+			}
+		}
+	}
+
+	sort.Slice(used, func(a, b int) bool { return t.Entries[used[a]].StartingLBA < t.Entries[used[b]].StartingLBA })
+	for k := 1; k < len(used); k++ {
+		prev, cur := t.Entries[used[k-1]], t.Entries[used[k]]
+		if cur.StartingLBA <= prev.EndingLBA {
+			add(RuleOverlap, Error, used[k], "overlaps partition %d", used[k-1]+1)
+		}
+	}
+	return out
+}
+
+// HasErrors reports whether any finding is an error.
+func HasErrors(fs []Finding) bool {
+	for _, f := range fs {
+		if f.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
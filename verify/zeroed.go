@@ -0,0 +1,63 @@
+package verify
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/cpuuntery/go-code-and-bin/gpt"
+)
+
+// zeroSampleSize is the size of every block read by Zeroed.
+const zeroSampleSize = 4096
+
+// Zeroed samples n blocks spread over each used partition of t, always
+// including the first and last, and warns about partitions where every
+// sample is zero: placeholders that were never populated.
+func Zeroed(r io.ReaderAt, t *gpt.Table, n int) []Finding {
+	var out []Finding
+	ss := t.SectorSize
+	if ss == 0 {
+		ss = gpt.DefaultSectorSize
+	}
+	buf := make([]byte, zeroSampleSize)
+	for _, i := range t.Used() {
+		e := t.Entries[i]
+		if e.EndingLBA < e.StartingLBA {
+			continue
+		}
+		off := int64(e.StartingLBA) * int64(ss)
+		size := int64(e.SizeBytes(ss))
+		zero, err := sampledZero(r, off, size, n, buf)
+		switch {
+		case err != nil:
+			out = append(out, Finding{Rule: RuleZeroed, Severity: Warning, Entry: i, Message: fmt.Sprintf("sampling for zeroes: %v", err)})
+		case zero:
+			out = append(out, Finding{Rule: RuleZeroed, Severity: Warning, Entry: i, Message: fmt.Sprintf("%q appears to be all zeros (%d samples)", e.Name(), n)})
+		}
+	}
+	return out
+}
+
+func sampledZero(r io.ReaderAt, off, size int64, n int, buf []byte) (bool, error) {
+	if int64(len(buf)) > size {
+		buf = buf[:size]
+	}
+	step := int64(0)
+	if n > 1 {
+		step = (size - int64(len(buf))) / int64(n-1)
+	}
+	for k := 0; k < n; k++ {
+		if _, err := r.ReadAt(buf, off+int64(k)*step); err != nil && err != io.EOF {
+			return false, err
+		}
+		for _, c := range buf {
+			if c != 0 {
+				return false, nil
+			}
+		}
+		if step == 0 {
+			break
+		}
+	}
+	return true, nil
+}